@@ -39,6 +39,7 @@ func usage() {
     cbindexplan -command=plan -cluster="127.0.0.1:8091" -username="<user>" -password="<pwd>" -indexes="indexes.json" -allowUnpin
     cbindexplan -command=plan -indexes="indexes.json" -memQuota="10G" -cpuQuota=16 -ddl="saved-ddl.txt"
     cbindexplan -command=plan -indexes="indexes.json" -memQuota="10G" -cpuQuota=16 -output="saved-plan.json"
+    cbindexplan -command=plan -indexes="indexes.json" -storageMode="plasma" -memQuota="10G" -diskQuota="500G" -cpuQuota=16
     cbindexplan -command=plan -plan="saved-plan.json" -indexes="indexes.json"
     cbindexplan -command=plan -plan="saved-plan.json" -indexes="indexes.json" -memQuota="10G" -cpuQuota=16 -output="newplan.json"
 - Rebalance 
@@ -49,10 +50,12 @@ func usage() {
     cbindexplan -command=rebalance -plan="saved-plan.json" -addNode=1
     `)
 	fmt.Fprintln(os.Stderr, `Usage Note:
-1) cbindexplan should only be used with MOI clsuter.
+1) cbindexplan sizes indexes using the sizing formula of the storage mode (memory_optimized, plasma or forestdb).  Storage mode is
+   taken from the live cluster or saved plan, and can be overridden using -storageMode.  Default is memory_optimized.
 2) When running cbindexplan, it may complain that the memory quota or cpu quota is not sufficient when pointing to a live cluster.
-   This is because cbindexplan can recalculate index size using the MOI sizing formula.   In this case, use -memQuota and -cpuQuota
+   This is because cbindexplan can recalculate index size using the sizing formula.   In this case, use -memQuota and -cpuQuota
    to override the clsuter setup during planning.
+3) For plasma and forestdb, disk usage per indexer node is constrained only when -diskQuota is given.
     `)
 	fmt.Fprintln(os.Stderr, `Placement Note:
 1) cbindexplan is a planning recommendation tool for index placement and rebalancing. This does not actual create or rebalance index,
@@ -66,7 +69,7 @@ func usage() {
    the outcome into a plan file (when specifying -output option).
 5) cbindexplan can recommend placement of new indexes on top of a saved plan (when using the -plan option).
 6) For placement, cbindexplan can generate create-index and build-index statmeents for new indexes when using -ddl option.
-7) For placement, cbindexplan will recalculate the size for all indexes using MOI sizing equation.   Besides new indexes to be replaced,
+7) For placement, cbindexplan will recalculate the size for all indexes using sizing equation of the storage mode.   Besides new indexes to be replaced,
    cbindexplan will also recaculate size for indexes retrived from a saved plan or live cluster before placement algorithm is run.
     `)
 	fmt.Fprintln(os.Stderr, `Rebalancing Note:
@@ -96,6 +99,8 @@ var gCommand string
 var gAddNode int
 var gMemQuota string
 var gCpuQuota int
+var gDiskQuota string
+var gStorageMode string
 var gEjectedNode string
 
 //////////////////////////////////////////////////////////////
@@ -120,6 +125,8 @@ func init() {
 	// quota
 	flag.StringVar(&gMemQuota, "memQuota", "", "memory quota per indexer node (e.g. 100M, 1G)")
 	flag.IntVar(&gCpuQuota, "cpuQuota", -1, "cpu quota per indexer node")
+	flag.StringVar(&gDiskQuota, "diskQuota", "", "disk quota per indexer node (e.g. 100G), for plasma and forestdb")
+	flag.StringVar(&gStorageMode, "storageMode", "", "storage mode = {memory_optimized | plasma | forestdb}")
 
 	// cluster size
 	flag.IntVar(&gAddNode, "addNode", 0, "number of indexer to add before running the planner")
@@ -179,6 +186,12 @@ func main() {
 		return
 	}
 
+	diskQuota, err := planner.ParseMemoryStr(gDiskQuota)
+	if err != nil {
+		logging.Fatalf("%v", err)
+		return
+	}
+
 	if gCommand == string(planner.CommandPlan) {
 
 		indexSpecs, err := planner.ReadIndexSpecs(gIndexSpecs)
@@ -193,7 +206,8 @@ func main() {
 			return
 		}
 
-		_, err = planner.ExecutePlanWithOptions(plan, indexSpecs, gDetail, gGenStmt, gOutput, gAddNode, gCpuQuota, memQuota, gAllowUnpin)
+		_, err = planner.ExecutePlanWithOptions(plan, indexSpecs, gDetail, gGenStmt, gOutput, gAddNode, gCpuQuota, memQuota,
+			diskQuota, gStorageMode, gAllowUnpin)
 		if err != nil {
 			logging.Fatalf("Planner error: %v.", err)
 			return
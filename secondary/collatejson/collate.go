@@ -16,7 +16,6 @@
 package collatejson
 
 import "bytes"
-import "encoding/json"
 import "errors"
 import "strings"
 import "sort"
@@ -143,6 +142,8 @@ func (codec *Codec) NumberType(what string) {
 // Encode json documents to order preserving binary representation.
 // `code` is the output buffer for encoding and expected to have
 // enough capacity, atleast 3x of input `text` and > MinBufferSize.
+// JSON text is encoded as it is scanned, without unmarshalling it
+// into golang native values.
 func (codec *Codec) Encode(text, code []byte) ([]byte, error) {
 	code = code[:0]
 	if cap(code) < (3*len(text)) || cap(code) < MinBufferSize {
@@ -150,11 +151,13 @@ func (codec *Codec) Encode(text, code []byte) ([]byte, error) {
 	} else if len(text) == 0 {
 		return code, nil
 	}
-	var m interface{}
-	if err := json.Unmarshal(text, &m); err != nil {
+	code, text, err := codec.text2code(text, code)
+	if err != nil {
 		return nil, err
+	} else if len(skipWS(text)) > 0 {
+		return nil, ErrorInvalidJSON
 	}
-	return codec.json2code(m, code)
+	return code, nil
 }
 
 // Decode a slice of byte into json string and return them as
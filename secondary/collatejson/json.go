@@ -0,0 +1,300 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+
+package collatejson
+
+import "bytes"
+import "encoding/json"
+import "errors"
+import "sort"
+import "strconv"
+import "unicode/utf8"
+
+// ErrorInvalidJSON means input text is not a valid JSON document.
+var ErrorInvalidJSON = errors.New("collatejson.invalidJSON")
+
+// jsonProperty is a property of JSON object being encoded, `start` and
+// `end` locate its encoded key and value in the output buffer.
+type jsonProperty struct {
+	key        []byte
+	start, end int
+}
+
+// jsonProperties sort properties by property name.
+type jsonProperties []jsonProperty
+
+func (props jsonProperties) Len() int      { return len(props) }
+func (props jsonProperties) Swap(i, j int) { props[i], props[j] = props[j], props[i] }
+func (props jsonProperties) Less(i, j int) bool {
+	return bytes.Compare(props[i].key, props[j].key) < 0
+}
+
+// text2code encodes JSON value at the start of `text` as it is scanned,
+// without building golang native values, and returns the remaining text.
+// Encoded value is appended to `code`.
+func (codec *Codec) text2code(text, code []byte) ([]byte, []byte, error) {
+	var err error
+
+	if text = skipWS(text); len(text) == 0 {
+		return nil, nil, ErrorInvalidJSON
+	}
+
+	switch text[0] {
+	case 'n':
+		if !bytes.HasPrefix(text, null) {
+			return nil, nil, ErrorInvalidJSON
+		}
+		code, text = append(code, TypeNull, Terminator), text[len(null):]
+
+	case 't':
+		if !bytes.HasPrefix(text, boolTrue) {
+			return nil, nil, ErrorInvalidJSON
+		}
+		code, text = append(code, TypeTrue, Terminator), text[len(boolTrue):]
+
+	case 'f':
+		if !bytes.HasPrefix(text, boolFalse) {
+			return nil, nil, ErrorInvalidJSON
+		}
+		code, text = append(code, TypeFalse, Terminator), text[len(boolFalse):]
+
+	case '"':
+		var s []byte
+		if s, text, err = scanString(text); err != nil {
+			return nil, nil, err
+		}
+		code = codec.string2code(s, code)
+
+	case '[':
+		return codec.array2code(text, code)
+
+	case '{':
+		return codec.object2code(text, code)
+
+	default:
+		var f float64
+		var cs []byte
+		if f, text, err = scanNumber(text); err != nil {
+			return nil, nil, err
+		}
+		code = append(code, TypeNumber)
+		if cs, err = codec.normalizeFloat(f, code[len(code):]); err != nil {
+			return nil, nil, err
+		}
+		code = append(code, cs...)
+		code = append(code, Terminator)
+	}
+	return code, text, nil
+}
+
+// array2code encodes JSON array at the start of `text`.
+func (codec *Codec) array2code(text, code []byte) ([]byte, []byte, error) {
+	var err error
+
+	code = append(code, TypeArray)
+	start, n := len(code), 0
+	if text = skipWS(text[1:]); len(text) > 0 && text[0] == ']' {
+		text = text[1:]
+	} else {
+		for {
+			if code, text, err = codec.text2code(text, code); err != nil {
+				return nil, nil, err
+			}
+			n++
+			if text = skipWS(text); len(text) == 0 {
+				return nil, nil, ErrorInvalidJSON
+			} else if text[0] == ',' {
+				text = text[1:]
+				continue
+			} else if text[0] != ']' {
+				return nil, nil, ErrorInvalidJSON
+			}
+			text = text[1:]
+			break
+		}
+	}
+
+	if codec.arrayLenPrefix {
+		// length is known only after the elements are scanned.
+		tmp := bufPool.Get().(*[]byte)
+		elems := append((*tmp)[:0], code[start:]...)
+		code = codec.length2code(n, code[:start])
+		code = append(code, elems...)
+		bufPool.Put(tmp)
+	}
+	code = append(code, Terminator)
+	return code, text, nil
+}
+
+// object2code encodes JSON object at the start of `text`, properties are
+// encoded in the order they are scanned and then sorted by name.
+func (codec *Codec) object2code(text, code []byte) ([]byte, []byte, error) {
+	var err error
+
+	code = append(code, TypeObj)
+	start := len(code)
+	props := make(jsonProperties, 0, 8)
+	if text = skipWS(text[1:]); len(text) > 0 && text[0] == '}' {
+		text = text[1:]
+	} else {
+		for {
+			if len(text) == 0 || text[0] != '"' {
+				return nil, nil, ErrorInvalidJSON
+			}
+			prop := jsonProperty{start: len(code)}
+			if prop.key, text, err = scanString(text); err != nil {
+				return nil, nil, err
+			}
+			code = codec.string2code(prop.key, code)
+			if text = skipWS(text); len(text) == 0 || text[0] != ':' {
+				return nil, nil, ErrorInvalidJSON
+			}
+			if code, text, err = codec.text2code(text[1:], code); err != nil {
+				return nil, nil, err
+			}
+			prop.end = len(code)
+			props = append(props, prop)
+
+			if text = skipWS(text); len(text) == 0 {
+				return nil, nil, ErrorInvalidJSON
+			} else if text[0] == ',' {
+				text = skipWS(text[1:])
+				continue
+			} else if text[0] != '}' {
+				return nil, nil, ErrorInvalidJSON
+			}
+			text = text[1:]
+			break
+		}
+	}
+
+	// like json.Unmarshal, the last of duplicate properties is retained.
+	sort.Stable(props)
+	uniq := props[:0]
+	for i, prop := range props {
+		if i+1 < len(props) && bytes.Equal(prop.key, props[i+1].key) {
+			continue
+		}
+		uniq = append(uniq, prop)
+	}
+
+	tmp := bufPool.Get().(*[]byte)
+	encoded := append((*tmp)[:0], code[start:]...)
+	code = code[:start]
+	if codec.propertyLenPrefix {
+		code = codec.length2code(len(uniq), code)
+	}
+	for _, prop := range uniq {
+		code = append(code, encoded[prop.start-start:prop.end-start]...)
+	}
+	bufPool.Put(tmp)
+	code = append(code, Terminator)
+	return code, text, nil
+}
+
+// string2code encodes string `s`, MissingLiteral is encoded as
+// TypeMissing.
+func (codec *Codec) string2code(s, code []byte) []byte {
+	if codec.doMissing && string(s) == string(MissingLiteral) {
+		return append(code, TypeMissing, Terminator)
+	}
+	code = append(code, TypeString)
+	code = suffixEncodeString(s, code)
+	return append(code, Terminator)
+}
+
+// length2code encodes length prefix of arrays and properties.
+func (codec *Codec) length2code(n int, code []byte) []byte {
+	code = append(code, TypeLength)
+	code = append(code, EncodeInt([]byte(strconv.Itoa(n)), code[len(code):])...)
+	return append(code, Terminator)
+}
+
+// scanString returns the string value of JSON string at the start of
+// `text` and the remaining text. Strings without escapes are returned as
+// a slice of `text`.
+func scanString(text []byte) ([]byte, []byte, error) {
+	escaped, ascii := false, true
+	for i := 1; i < len(text); i++ {
+		switch b := text[i]; {
+		case b == '"':
+			s := text[1:i]
+			if !escaped && (ascii || utf8.Valid(s)) {
+				return s, text[i+1:], nil
+			}
+			var str string
+			if err := json.Unmarshal(text[:i+1], &str); err != nil {
+				return nil, nil, err
+			}
+			return []byte(str), text[i+1:], nil
+
+		case b == '\\':
+			escaped = true
+			i++ // skip escaped character
+
+		case b < 0x20:
+			escaped = true // invalid, left to json.Unmarshal to report
+
+		case b >= utf8.RuneSelf:
+			ascii = false
+		}
+	}
+	return nil, nil, ErrorInvalidJSON
+}
+
+// scanNumber returns the value of JSON number at the start of `text`
+// and the remaining text.
+func scanNumber(text []byte) (float64, []byte, error) {
+	i := 0
+	if i < len(text) && text[i] == '-' {
+		i++
+	}
+	if i < len(text) && text[i] == '0' {
+		i++
+	} else if j := skipDigits(text, i); j > i {
+		i = j
+	} else {
+		return 0, nil, ErrorInvalidJSON
+	}
+	if i < len(text) && text[i] == '.' {
+		j := skipDigits(text, i+1)
+		if j == i+1 {
+			return 0, nil, ErrorInvalidJSON
+		}
+		i = j
+	}
+	if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+		i++
+		if i < len(text) && (text[i] == '+' || text[i] == '-') {
+			i++
+		}
+		j := skipDigits(text, i)
+		if j == i {
+			return 0, nil, ErrorInvalidJSON
+		}
+		i = j
+	}
+	f, err := strconv.ParseFloat(string(text[:i]), 64)
+	if err != nil {
+		return 0, nil, err
+	}
+	return f, text[i:], nil
+}
+
+func skipDigits(text []byte, i int) int {
+	for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+func skipWS(text []byte) []byte {
+	for len(text) > 0 {
+		switch text[0] {
+		case ' ', '\t', '\n', '\r':
+			text = text[1:]
+			continue
+		}
+		break
+	}
+	return text
+}
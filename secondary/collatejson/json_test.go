@@ -0,0 +1,67 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+
+package collatejson
+
+import "bytes"
+import "encoding/json"
+import "testing"
+
+func TestEncodeStream(t *testing.T) {
+	samples := []string{
+		`null`, `true`, `false`, `-0`, `0.5e-3`, `1E+2`, `10.2`,
+		`123456789012345678901234567890`,
+		`"hello"`, `"héllo"`, `"\"\\\/\b\f\n\r\t\u0000"`, "\"\xff\xfe\"",
+		`"~[]{}falsenilNA~"`,
+		`[]`, ` [ 1 , [ ] , { } ] `, `{}`,
+		`{ "inelegant":27.53096820876087, "horridness":true,
+		   "iridodesis":[79.1253026404128,null], "arrogantness":null,
+		   "unagrarian":false }`,
+		`{"b":1, "a":2, "b":[3], "é":{"z":null, "\u0000":"x"}}`,
+	}
+	for _, arrayLen := range []bool{false, true} {
+		codec := NewCodec(16)
+		codec.SortbyArrayLen(arrayLen)
+		codec.SortbyPropertyLen(!arrayLen)
+		for _, sample := range samples {
+			var m interface{}
+			if err := json.Unmarshal([]byte(sample), &m); err != nil {
+				t.Fatal(err)
+			}
+			ref, err := codec.json2code(m, make([]byte, 0, 1024))
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := codec.Encode([]byte(sample), make([]byte, 0, 1024))
+			if err != nil {
+				t.Errorf("encode failed for %q: %v", sample, err)
+			} else if !bytes.Equal(code, ref) {
+				t.Errorf("encode failed for %q: %q %q", sample, code, ref)
+			}
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	samples := []string{
+		`nul`, `truex`, `-`, `01`, `1.`, `1e`, `1e999`, `"abc`, "\"a\tb\"",
+		`"\u"`, `[1,]`, `[1 2]`, `[1]]`, `{"a":1,}`, `{"a" 1}`, `{1:2}`,
+		`{"a":1}x`,
+	}
+	codec := NewCodec(16)
+	for _, sample := range samples {
+		if _, err := codec.Encode([]byte(sample), make([]byte, 0, 1024)); err == nil {
+			t.Errorf("expected error for %q", sample)
+		}
+	}
+}
+
+func BenchmarkEncodeStream(b *testing.B) {
+	text := []byte(`{"name":"Fred","age":42,"tags":["a","b","c"],` +
+		`"addr":{"city":"Bangalore","zip":560001},"active":true}`)
+	codec := NewCodec(16)
+	code := make([]byte, 0, 1024)
+	b.SetBytes(int64(len(text)))
+	for i := 0; i < b.N; i++ {
+		codec.Encode(text, code[:0])
+	}
+}
@@ -0,0 +1,174 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+
+package collatejson
+
+import "errors"
+import "strconv"
+import "unicode/utf8"
+
+// ErrorInvalidCode means input is not a valid collatejson encoding.
+var ErrorInvalidCode = errors.New("collatejson.invalidCode")
+
+// ErrorInvalidEntry means input is not an index entry encoded as
+// [expr1, ..., docid].
+var ErrorInvalidEntry = errors.New("collatejson.invalidEntry")
+
+// DecodeValue decodes binary representation into golang native value,
+// the same value json.Unmarshal returns for the JSON text from Decode,
+// without the round trip through JSON text. That is, null, bool, float64,
+// string, []interface{} and map[string]interface{}. Missing items are
+// returned as MissingLiteral string.
+func (codec *Codec) DecodeValue(code []byte) (interface{}, error) {
+	val, remaining, err := codec.code2value(code)
+	if err != nil {
+		return nil, err
+	} else if len(remaining) > 0 {
+		return nil, ErrorInvalidCode
+	}
+	return val, nil
+}
+
+// DecodeEntry decodes binary representation of index entry,
+//
+//	[expr1, docid] - for simple key
+//	[expr1, expr2, ..., docid] - for composite key
+//
+// and returns them split as,
+//
+//	[expr1], docid - for simple key
+//	[expr1, expr2 ...], docid - for composite key
+func (codec *Codec) DecodeEntry(code []byte) ([]interface{}, []byte, error) {
+	val, err := codec.DecodeValue(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	vals, ok := val.([]interface{})
+	if !ok || len(vals) == 0 {
+		return nil, nil, ErrorInvalidEntry
+	}
+	docid, ok := vals[len(vals)-1].(string)
+	if !ok {
+		return nil, nil, ErrorInvalidEntry
+	}
+	return vals[:len(vals)-1], []byte(docid), nil
+}
+
+// local function that decodes basic json types from binary
+// representation, composite types recursively call this function.
+func (codec *Codec) code2value(code []byte) (interface{}, []byte, error) {
+	if len(code) == 0 {
+		return nil, nil, ErrorInvalidCode
+	}
+
+	var datum, remaining []byte
+	var err error
+
+	switch code[0] {
+	case TypeMissing:
+		_, remaining = getDatum(code)
+		return string(MissingLiteral), remaining, nil
+
+	case TypeNull:
+		_, remaining = getDatum(code)
+		return nil, remaining, nil
+
+	case TypeTrue:
+		_, remaining = getDatum(code)
+		return true, remaining, nil
+
+	case TypeFalse:
+		_, remaining = getDatum(code)
+		return false, remaining, nil
+
+	case TypeLength:
+		x := [64]byte{}
+		datum, remaining = getDatum(code)
+		_, ts := DecodeInt(datum[1:], x[:0])
+		n, err := strconv.Atoi(string(ts))
+		return float64(n), remaining, err
+
+	case TypeNumber:
+		x := [64]byte{}
+		datum, remaining = getDatum(code)
+		ts := DecodeFloat(datum[1:], x[:0])
+		if ts, err = codec.denormalizeFloat(ts); err != nil {
+			return nil, nil, err
+		}
+		f, err := strconv.ParseFloat(string(ts), 64)
+		return f, remaining, err
+
+	case TypeString:
+		var strb []byte
+		tmp := bufPool.Get().(*[]byte)
+		strb, remaining, err = suffixDecodeString(code[1:], (*tmp)[:0])
+		var s string
+		if err == nil {
+			s = validString(strb)
+		}
+		bufPool.Put(tmp)
+		return s, remaining, err
+
+	case TypeArray:
+		code = code[1:]
+		if codec.arrayLenPrefix && len(code) > 0 && code[0] == TypeLength {
+			_, code = getDatum(code)
+		}
+		var val interface{}
+		array := make([]interface{}, 0, 8)
+		for len(code) > 0 && code[0] != Terminator {
+			if val, code, err = codec.code2value(code); err != nil {
+				return nil, nil, err
+			}
+			array = append(array, val)
+		}
+		if len(code) == 0 {
+			return nil, nil, ErrorInvalidCode
+		}
+		return array, code[1:], nil // remove Terminator
+
+	case TypeObj:
+		code = code[1:]
+		if codec.propertyLenPrefix && len(code) > 0 && code[0] == TypeLength {
+			_, code = getDatum(code)
+		}
+		var key, val interface{}
+		obj := make(map[string]interface{})
+		for len(code) > 0 && code[0] != Terminator {
+			if key, code, err = codec.code2value(code); err != nil {
+				return nil, nil, err
+			}
+			prop, ok := key.(string)
+			if !ok {
+				return nil, nil, ErrorInvalidCode
+			}
+			if val, code, err = codec.code2value(code); err != nil {
+				return nil, nil, err
+			}
+			obj[prop] = val
+		}
+		if len(code) == 0 {
+			return nil, nil, ErrorInvalidCode
+		}
+		return obj, code[1:], nil // remove Terminator
+	}
+	return nil, nil, ErrorInvalidCode
+}
+
+// validString converts `s` to string, like Decode, invalid UTF-8 bytes
+// are replaced with utf8.RuneError.
+func validString(s []byte) string {
+	if utf8.Valid(s) {
+		return string(s)
+	}
+	r := make([]byte, 0, len(s)+8)
+	for i := 0; i < len(s); {
+		c, size := utf8.DecodeRune(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			r = append(r, string(utf8.RuneError)...)
+		} else {
+			r = append(r, s[i:i+size]...)
+		}
+		i += size
+	}
+	return string(r)
+}
@@ -0,0 +1,84 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+
+package collatejson
+
+import "encoding/json"
+import "reflect"
+import "testing"
+
+func TestDecodeValue(t *testing.T) {
+	samples := []string{
+		`null`, `true`, `false`, `0`, `-10.5`, `1e+300`, `"hello"`,
+		`"~[]{}falsenilNA~"`, "\"\xff\xfe\"", `[]`, `{}`,
+		`[null,true,10,10.2,[],{"key":{}}]`,
+		`{"mettled":{"ravening":null,"unguiltily":40.959598968246475},"wiriness":false}`,
+	}
+	for _, arrayLen := range []bool{false, true} {
+		codec := NewCodec(16)
+		codec.SortbyArrayLen(arrayLen)
+		codec.SortbyPropertyLen(!arrayLen)
+		for _, sample := range samples {
+			code, err := codec.Encode([]byte(sample), make([]byte, 0, 1024))
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, err := codec.Decode(code, make([]byte, 0, 1024))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ref interface{}
+			if err := json.Unmarshal(text, &ref); err != nil {
+				t.Fatal(err)
+			}
+			val, err := codec.DecodeValue(code)
+			if err != nil {
+				t.Errorf("decode failed for %q: %v", sample, err)
+			} else if !reflect.DeepEqual(val, ref) {
+				t.Errorf("decode failed for %q: %#v %#v", sample, val, ref)
+			}
+		}
+	}
+
+	codec := NewCodec(16)
+	for _, code := range [][]byte{nil, {TypeArray}, {TypeNull, Terminator, 0xff}, {0xff}} {
+		if _, err := codec.DecodeValue(code); err == nil {
+			t.Errorf("expected error for %q", code)
+		}
+	}
+}
+
+func TestDecodeEntry(t *testing.T) {
+	codec := NewCodec(16)
+	code, err := codec.Encode([]byte(`["x",10,"doc-1"]`), make([]byte, 0, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, docid, err := codec.DecodeEntry(code)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(key, []interface{}{"x", 10.0}) {
+		t.Errorf("unexpected key %v", key)
+	} else if string(docid) != "doc-1" {
+		t.Errorf("unexpected docid %q", docid)
+	}
+
+	for _, sample := range []string{`[]`, `["x",10]`, `"doc-1"`} {
+		code, err := codec.Encode([]byte(sample), make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := codec.DecodeEntry(code); err != ErrorInvalidEntry {
+			t.Errorf("expected ErrorInvalidEntry for %q, got %v", sample, err)
+		}
+	}
+}
+
+func BenchmarkDecodeValue(b *testing.B) {
+	text := []byte(`["Fred",42,["a","b","c"],{"city":"Bangalore"},true]`)
+	codec := NewCodec(16)
+	code, _ := codec.Encode(text, make([]byte, 0, 1024))
+	b.SetBytes(int64(len(code)))
+	for i := 0; i < b.N; i++ {
+		codec.DecodeValue(code)
+	}
+}
@@ -262,6 +262,23 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.dcp.includeXATTRs": ConfigValue{
+		false,
+		"request extended attributes of documents from KV, to index them " +
+			"as meta().xattrs, changing this value does not affect existing feeds.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.compression": ConfigValue{
+		false,
+		"request snappy compressed document values from KV, they are " +
+			"decompressed only for indexes that evaluate the document, " +
+			"changing this value does not affect existing feeds.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector adminport parameters
 	"projector.adminport.name": ConfigValue{
 		"projector.adminport",
@@ -359,6 +376,30 @@ var SystemConfig = Config{
 		true,        // immutable
 		false,       // case-insensitive
 	},
+	"projector.dataport.compression": ConfigValue{
+		"none",
+		"compression for transmission data from router to downstream " +
+			"client, one of none, snappy or gzip, does not affect existing feeds.",
+		"none",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dataport.enableTLS": ConfigValue{
+		false,
+		"connect to downstream client over TLS, does not affect " +
+			"existing feeds.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dataport.caFile": ConfigValue{
+		"",
+		"CA certificates, in PEM format, to verify downstream client's " +
+			"certificate, system's root CAs are used if empty.",
+		"",
+		false, // mutable
+		true,  // case-sensitive
+	},
 	"projector.dataport.statTick": ConfigValue{
 		5 * 60 * 1000, // 5 minutes
 		"tick, in milliseconds, to log endpoint statistics",
@@ -433,6 +474,21 @@ var SystemConfig = Config{
 		false,      // mutable
 		false,      // case-insensitive
 	},
+	"indexer.dataport.enableTLS": ConfigValue{
+		false,
+		"serve routers over TLS, using indexer.certFile and " +
+			"indexer.keyFile, plaintext connections are also accepted.",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"indexer.dataport.requireTLS": ConfigValue{
+		false,
+		"serve routers only over TLS, plaintext connections are refused.",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	// indexer queryport configuration
 	"indexer.queryport.maxPayload": ConfigValue{
 		64 * 1024,
@@ -469,6 +525,21 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"indexer.queryport.enableTLS": ConfigValue{
+		false,
+		"serve clients over TLS, using indexer.certFile and " +
+			"indexer.keyFile, plaintext connections are also accepted.",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"indexer.queryport.requireTLS": ConfigValue{
+		false,
+		"serve clients only over TLS, plaintext connections are refused.",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	// queryport client configuration
 	"queryport.client.maxPayload": ConfigValue{
 		1000 * 1024,
@@ -477,6 +548,29 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"queryport.client.compression": ConfigValue{
+		"none",
+		"compression for requests to server, one of none, snappy or gzip, " +
+			"server compresses its response the same way on a connection.",
+		"none",
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.enableTLS": ConfigValue{
+		false,
+		"connect to server over TLS.",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.caFile": ConfigValue{
+		"",
+		"CA certificates, in PEM format, to verify server's certificate, " +
+			"system's root CAs are used if empty.",
+		"",
+		true, // immutable
+		true, // case-sensitive
+	},
 	"queryport.client.readDeadline": ConfigValue{
 		300000,
 		"timeout, in milliseconds, is timeout while reading from socket",
@@ -565,6 +659,54 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"queryport.client.load.maxAge": ConfigValue{
+		10000,
+		"time in milliseconds after which the load reported by an indexer " +
+			"is ignored for picking replicas.",
+		10000,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.load.breakerThreshold": ConfigValue{
+		5,
+		"consecutive failed scans after which an indexer is avoided, " +
+			"0 disables the circuit breaker.",
+		5,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.hedge.enable": ConfigValue{
+		false,
+		"hedge scans of indexes with replicas to a second replica when " +
+			"the first replica is slow to respond.",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.hedge.percentile": ConfigValue{
+		95,
+		"percentile of recent first response latencies on an index after " +
+			"which a scan is hedged.",
+		95,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.hedge.minDelay": ConfigValue{
+		5,
+		"minimum time in milliseconds to wait for the first response " +
+			"before hedging a scan.",
+		5,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"queryport.client.load.breakerCooldown": ConfigValue{
+		5000,
+		"time in milliseconds an indexer is avoided once its circuit " +
+			"breaker opens.",
+		5000,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"queryport.client.backfillLimit": ConfigValue{
 		5 * 1024, // 5GB
 		"limit in mega-bytes to cap n1ql side backfilling, if ZERO backfill " +
@@ -1214,6 +1356,53 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"indexer.settings.histogram.enable": ConfigValue{
+		false,
+		"build equi-depth histograms over index keys in the background, " +
+			"each refresh reads every entry of the index partition",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.histogram.num_bins": ConfigValue{
+		32,
+		"maximum number of bins in an index histogram",
+		32,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.histogram.sample_size": ConfigValue{
+		10000,
+		"number of index keys sampled to build an index histogram",
+		10000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.histogram.refresh_interval": ConfigValue{
+		60,
+		"interval, in seconds, to check whether index histograms " +
+			"need to be refreshed",
+		60,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"indexer.settings.histogram.refresh_ratio": ConfigValue{
+		0.1,
+		"rebuild index histogram when mutations indexed since it was " +
+			"built cross this fraction of items in the histogram",
+		0.1,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.histogram.scan_batch": ConfigValue{
+		100000,
+		"maximum number of index entries sampled from a partition on " +
+			"each refresh interval, a histogram is rebuilt once all " +
+			"entries of the partition are sampled",
+		100000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.max_array_seckey_size": ConfigValue{
 		10240,
 		"Maximum size of secondary index key size for array index",
@@ -1413,6 +1602,16 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.moi.persistence.max_incrementals": ConfigValue{
+		0,
+		"Maximum number of incremental disk snapshots persisted on top of a full " +
+			"snapshot, 0 disables incremental snapshots. A longer chain is merged " +
+			"into a full snapshot on disk in the background. The last persisted " +
+			"snapshot is kept in memory until the next one is written",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.storage_mode": ConfigValue{
 		"",
 		"Storage Type e.g. forestdb, memory_optimized",
@@ -1420,6 +1619,49 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.scan_load.sample_interval": ConfigValue{
+		1000,
+		"interval in milliseconds at which the indexer load reported to " +
+			"scan clients is sampled",
+		1000,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_trace.log_size": ConfigValue{
+		100,
+		"number of recent traced scan requests kept for /debug/scans",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_admission.bucket_limit": ConfigValue{
+		0,
+		"maximum concurrent scans per bucket, 0 for no limit",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_admission.index_limit": ConfigValue{
+		0,
+		"maximum concurrent scans per index, 0 for no limit",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_admission.queue_size": ConfigValue{
+		1000,
+		"maximum scans waiting for admission, beyond which scans are rejected",
+		1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_admission.wait_timeout": ConfigValue{
+		5000,
+		"time in milliseconds a scan waits for admission before it is rejected",
+		5000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.scan_getseqnos_retries": ConfigValue{
 		30,
 		"Max retries for DCP request",
@@ -1434,6 +1676,13 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.num_partitions": ConfigValue{
+		8,
+		"Default number of partitions for a hash partitioned index.",
+		8,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.settings.log_level": ConfigValue{
 		"info",
 		"Projector logging level",
@@ -1479,6 +1728,15 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.rebalance.peer_transfer": ConfigValue{
+		true,
+		"copy the committed snapshot of a moved index from the source " +
+			"indexer and only catch up from its timestamp, instead of " +
+			"rebuilding the index from scratch.",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
 }
 
 // NewConfig from another
@@ -49,6 +49,10 @@ var ErrClientCancel = errors.New("Client requested cancel")
 
 var ErrIndexerInBootstrap = errors.New("Indexer In Warmup State. Please retry the request later.")
 
+// ErrScanRejected when indexer has no room to admit a scan request, the
+// request can be retried with another replica.
+var ErrScanRejected = errors.New("Index scan rejected, indexer is busy")
+
 const INDEXER_45_VERSION = 1
 const INDEXER_50_VERSION = 2
 const INDEXER_CUR_VERSION = INDEXER_50_VERSION
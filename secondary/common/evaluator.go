@@ -8,6 +8,10 @@ type Evaluator interface {
 	// Return the bucket name for which this evaluator is applicable.
 	Bucket() string
 
+	// Return the collection-id, within the bucket, for which this
+	// evaluator is applicable.
+	CollectionID() uint32
+
 	// StreamBeginData is generated for downstream.
 	StreamBeginData(vbno uint16, vbuuid, seqno uint64) (data interface{})
 
@@ -10,6 +10,7 @@
 package common
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -152,6 +153,11 @@ const (
 	// and make sure to return a stable data-set that is atleast as
 	// recent as the timestamp-vector.
 	QueryConsistency
+
+	// BestEffortConsistency indexer would scan the latest snapshot
+	// without waiting, and report how far behind the timestamp-vector,
+	// or the KV timestamp if there is none, it is.
+	BestEffortConsistency
 )
 
 func (cons Consistency) String() string {
@@ -162,11 +168,37 @@ func (cons Consistency) String() string {
 		return "SESSION_CONSISTENCY"
 	case QueryConsistency:
 		return "QUERY_CONSISTENCY"
+	case BestEffortConsistency:
+		return "BEST_EFFORT_CONSISTENCY"
 	default:
 		return "UNKNOWN_CONSISTENCY"
 	}
 }
 
+// Scope and collection of documents in buckets that do not use
+// collections, and of indexes created before collections.
+const (
+	DEFAULT_SCOPE      = "_default"
+	DEFAULT_COLLECTION = "_default"
+)
+
+// IsDefaultCollection returns true for the default collection in the
+// default scope, empty scope or collection stand for their default.
+func IsDefaultCollection(scope, collection string) bool {
+	return (scope == "" || scope == DEFAULT_SCOPE) &&
+		(collection == "" || collection == DEFAULT_COLLECTION)
+}
+
+// KeyspaceId identifies `collection` in `scope` of `bucket` as
+// "bucket.scope.collection", the default collection is identified by
+// the bucket name so that existing indexes keep their keyspace.
+func KeyspaceId(bucket, scope, collection string) string {
+	if IsDefaultCollection(scope, collection) {
+		return bucket
+	}
+	return bucket + "." + scope + "." + collection
+}
+
 //IndexDefn represents the index definition as specified
 //during CREATE INDEX
 type IndexDefn struct {
@@ -175,11 +207,16 @@ type IndexDefn struct {
 	Using           IndexType       `json:"using,omitempty"`
 	Bucket          string          `json:"bucket,omitempty"`
 	BucketUUID      string          `json:"bucketUUID,omitempty"`
+	Scope           string          `json:"scope,omitempty"`
+	Collection      string          `json:"collection,omitempty"`
+	CollectionId    uint32          `json:"collectionId,omitempty"`
 	IsPrimary       bool            `json:"isPrimary,omitempty"`
 	SecExprs        []string        `json:"secExprs,omitempty"`
 	ExprType        ExprType        `json:"exprType,omitempty"`
 	PartitionScheme PartitionScheme `json:"partitionScheme,omitempty"`
 	PartitionKey    string          `json:"partitionKey,omitempty"`
+	NumPartitions   uint32          `json:"numPartitions,omitempty"`
+	PartitionSplits [][]byte        `json:"partitionSplits,omitempty"`
 	WhereExpr       string          `json:"where,omitempty"`
 	Desc            []bool          `json:"desc,omitempty"`
 	Deferred        bool            `json:"deferred,omitempty"`
@@ -188,6 +225,11 @@ type IndexDefn struct {
 	IsArrayIndex    bool            `json:"isArrayIndex,omitempty"`
 	NumReplica      uint32          `json:"numReplica,omitempty"`
 
+	// ShadowOf is the index replaced by this index, once this index is
+	// built and caught up. Shadow index share the name of the index it
+	// replaces, and is not visible for scans until it is swapped in.
+	ShadowOf IndexDefnId `json:"shadowOf,omitempty"`
+
 	// transient field (not part of index metadata)
 	InstVersion int         `json:"instanceVersion,omitempty"`
 	ReplicaId   int         `json:"replicaId,omitempty"`
@@ -218,6 +260,11 @@ func (idx IndexDefn) String() string {
 	str += fmt.Sprintf("Name: %v ", idx.Name)
 	str += fmt.Sprintf("Using: %v ", idx.Using)
 	str += fmt.Sprintf("Bucket: %v ", idx.Bucket)
+	if !idx.IsDefaultCollection() {
+		str += fmt.Sprintf("Scope: %v ", idx.Scope)
+		str += fmt.Sprintf("Collection: %v ", idx.Collection)
+		str += fmt.Sprintf("CollectionId: %v ", idx.CollectionId)
+	}
 	str += fmt.Sprintf("IsPrimary: %v ", idx.IsPrimary)
 	str += fmt.Sprintf("NumReplica: %v ", idx.NumReplica)
 	str += fmt.Sprintf("InstVersion: %v ", idx.InstVersion)
@@ -225,7 +272,14 @@ func (idx IndexDefn) String() string {
 	str += fmt.Sprintf("\n\t\tDesc: %v", idx.Desc)
 	str += fmt.Sprintf("\n\t\tPartitionScheme: %v ", idx.PartitionScheme)
 	str += fmt.Sprintf("PartitionKey: %v ", idx.PartitionKey)
+	str += fmt.Sprintf("NumPartitions: %v ", idx.NumPartitions)
+	if len(idx.PartitionSplits) > 0 {
+		str += fmt.Sprintf("PartitionSplits: %v ", len(idx.PartitionSplits))
+	}
 	str += fmt.Sprintf("WhereExpr: %v ", idx.WhereExpr)
+	if idx.ShadowOf != 0 {
+		str += fmt.Sprintf("ShadowOf: %v ", idx.ShadowOf)
+	}
 	return str
 
 }
@@ -239,21 +293,38 @@ func (idx IndexDefn) Clone() *IndexDefn {
 		Using:           idx.Using,
 		Bucket:          idx.Bucket,
 		BucketUUID:      idx.BucketUUID,
+		Scope:           idx.Scope,
+		Collection:      idx.Collection,
+		CollectionId:    idx.CollectionId,
 		IsPrimary:       idx.IsPrimary,
 		SecExprs:        idx.SecExprs,
 		Desc:            idx.Desc,
 		ExprType:        idx.ExprType,
 		PartitionScheme: idx.PartitionScheme,
 		PartitionKey:    idx.PartitionKey,
+		NumPartitions:   idx.NumPartitions,
+		PartitionSplits: idx.PartitionSplits,
 		WhereExpr:       idx.WhereExpr,
 		Deferred:        idx.Deferred,
 		Immutable:       idx.Immutable,
 		Nodes:           idx.Nodes,
 		IsArrayIndex:    idx.IsArrayIndex,
 		NumReplica:      idx.NumReplica,
+		ShadowOf:        idx.ShadowOf,
 	}
 }
 
+// KeyspaceId of the collection on which the index is defined.
+func (idx *IndexDefn) KeyspaceId() string {
+	return KeyspaceId(idx.Bucket, idx.Scope, idx.Collection)
+}
+
+// IsDefaultCollection returns true if the index is defined on the
+// default collection of its bucket.
+func (idx *IndexDefn) IsDefaultCollection() bool {
+	return IsDefaultCollection(idx.Scope, idx.Collection)
+}
+
 func (idx *IndexDefn) HasDescending() bool {
 
 	if idx.Desc != nil {
@@ -267,6 +338,49 @@ func (idx *IndexDefn) HasDescending() bool {
 
 }
 
+// IsPartitioned returns true if index entries are distributed across
+// partitions by hashing the partition key, or by the range of partition
+// key values.
+func (idx *IndexDefn) IsPartitioned() bool {
+	return idx.PartitionScheme == KEY || idx.PartitionScheme == HASH ||
+		idx.PartitionScheme == RANGE
+}
+
+// GetNumPartitions returns the number of partitions for the index, an
+// index that is not partitioned has a single partition. A range
+// partitioned index has one partition more than its split keys.
+func (idx *IndexDefn) GetNumPartitions() int {
+	if idx.PartitionScheme == RANGE {
+		return len(idx.PartitionSplits) + 1
+	} else if idx.IsPartitioned() && idx.NumPartitions > 0 {
+		return int(idx.NumPartitions)
+	}
+	return 1
+}
+
+// PartitionNode returns the position, among Nodes, of the indexer node
+// hosting partition `partnId` of a partitioned index. Partitions are
+// spread round-robin across the nodes of the index, and the instance
+// on each node has its position as ReplicaId.
+func (idx *IndexDefn) PartitionNode(partnId PartitionId) int {
+	if len(idx.Nodes) <= 1 {
+		return 0
+	}
+	return int(partnId) % len(idx.Nodes)
+}
+
+// CanPrunePartitions returns true if partitions of the index can be
+// pruned using the leading key of a scan span, that is when the index
+// is range partitioned on its leading (ascending) secondary key.
+func (idx *IndexDefn) CanPrunePartitions() bool {
+	if idx.PartitionScheme != RANGE || idx.IsPrimary || len(idx.SecExprs) == 0 {
+		return false
+	} else if len(idx.Desc) > 0 && idx.Desc[0] {
+		return false
+	}
+	return idx.PartitionKey == idx.SecExprs[0]
+}
+
 func (idx IndexInst) String() string {
 
 	str := "\n"
@@ -463,11 +577,19 @@ func IsEquivalentIndex(d1, d2 *IndexDefn) bool {
 		d1.ExprType != d2.ExprType ||
 		d1.PartitionScheme != d2.PartitionScheme ||
 		d1.PartitionKey != d2.PartitionKey ||
+		d1.NumPartitions != d2.NumPartitions ||
+		len(d1.PartitionSplits) != len(d2.PartitionSplits) ||
 		d1.WhereExpr != d2.WhereExpr {
 
 		return false
 	}
 
+	for i, split := range d1.PartitionSplits {
+		if !bytes.Equal(split, d2.PartitionSplits[i]) {
+			return false
+		}
+	}
+
 	for _, s1 := range d1.SecExprs {
 		for _, s2 := range d2.SecExprs {
 			if s1 != s2 {
@@ -34,6 +34,9 @@ func (kp KeyPartitionDefn) Endpoints() []Endpoint {
 type KeyPartitionContainer struct {
 	PartitionMap  map[PartitionId]KeyPartitionDefn
 	NumPartitions int
+	//number of partitions keys are hashed to, when the container
+	//holds only the partitions hosted by an indexer node.
+	HashPartitions int
 }
 
 //NewKeyPartitionContainer initializes a new KeyPartitionContainer and returns
@@ -45,6 +48,17 @@ func NewKeyPartitionContainer() PartitionContainer {
 
 }
 
+//NewHashPartitionContainer initializes a new KeyPartitionContainer for
+//a hash partitioned index of numPartitions partitions and returns. The
+//container may hold only some of the partitions.
+func NewHashPartitionContainer(numPartitions int) PartitionContainer {
+
+	kpc := &KeyPartitionContainer{PartitionMap: make(map[PartitionId]KeyPartitionDefn),
+		NumPartitions: 0, HashPartitions: numPartitions}
+	return kpc
+
+}
+
 //AddPartition adds a partition to the container
 func (pc *KeyPartitionContainer) AddPartition(id PartitionId, p PartitionDefn) {
 	pc.PartitionMap[id] = p.(KeyPartitionDefn)
@@ -76,9 +90,21 @@ func (pc *KeyPartitionContainer) GetEndpointsByPartitionKey(key PartitionKey) []
 //partitionKey belongs.
 func (pc *KeyPartitionContainer) GetPartitionIdByPartitionKey(key PartitionKey) PartitionId {
 	//run hash function on partition key and return partition id
-	hash := crc32.ChecksumIEEE([]byte(key))
-	partnId := int(hash) % pc.NumPartitions
-	return PartitionId(partnId)
+	if pc.HashPartitions > 0 {
+		return HashPartitionId(key, pc.HashPartitions)
+	}
+	return HashPartitionId(key, pc.NumPartitions)
+}
+
+//HashPartitionId returns the partition, in the range [0, numPartitions),
+//to which the partition key is hashed. Projector and indexer must agree
+//on this function to route a mutation to its partition.
+func HashPartitionId(key []byte, numPartitions int) PartitionId {
+	if numPartitions <= 1 {
+		return PartitionId(0)
+	}
+	hash := crc32.ChecksumIEEE(key)
+	return PartitionId(hash % uint32(numPartitions))
 }
 
 //GetEndpointsByPartitionId returns the list of Endpoints hosting the give partitionId
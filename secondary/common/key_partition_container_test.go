@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestHashPartitionContainer(t *testing.T) {
+	defn := &IndexDefn{PartitionScheme: HASH, NumPartitions: 5,
+		Nodes: []string{"n0", "n1"}}
+
+	// node 1 hosts partitions 1 and 3.
+	pc := NewHashPartitionContainer(defn.GetNumPartitions())
+	for i := 0; i < defn.GetNumPartitions(); i++ {
+		partnId := PartitionId(i)
+		if defn.PartitionNode(partnId) == 1 {
+			pc.AddPartition(partnId, KeyPartitionDefn{Id: partnId})
+		}
+	}
+	if n := pc.GetNumPartitions(); n != 2 {
+		t.Errorf("Expected 2 partitions, received %v", n)
+	}
+
+	// keys are hashed to partitions of the index, not of the container.
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		expected := HashPartitionId([]byte(key), 5)
+		if id := pc.GetPartitionIdByPartitionKey(PartitionKey(key)); id != expected {
+			t.Errorf("Expected %v, received %v", expected, id)
+		}
+	}
+
+	single := &IndexDefn{PartitionScheme: HASH, NumPartitions: 5}
+	if node := single.PartitionNode(3); node != 0 {
+		t.Errorf("Expected node 0, received %v", node)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+//RangePartitionContainer implements PartitionContainer interface
+//for range based partitioning. Partition `i` holds partition keys
+//in the range [Splits[i-1], Splits[i]), where Splits are collatejson
+//encoded partition key values in ascending collation order.
+type RangePartitionContainer struct {
+	KeyPartitionContainer
+	Splits [][]byte
+}
+
+//NewRangePartitionContainer initializes a new RangePartitionContainer
+//for the given split keys and returns
+func NewRangePartitionContainer(splits [][]byte) PartitionContainer {
+
+	rpc := &RangePartitionContainer{
+		KeyPartitionContainer: KeyPartitionContainer{
+			PartitionMap:  make(map[PartitionId]KeyPartitionDefn),
+			NumPartitions: 0},
+		Splits: splits,
+	}
+	return rpc
+
+}
+
+//GetEndpointsByPartitionKey is a convenience method which calls other interface methods
+//to first determine the partitionId from PartitionKey and then the endpoints from
+//partitionId
+func (pc *RangePartitionContainer) GetEndpointsByPartitionKey(key PartitionKey) []Endpoint {
+
+	id := pc.GetPartitionIdByPartitionKey(key)
+	return pc.GetEndpointsByPartitionId(id)
+
+}
+
+//GetPartitionIdByPartitionKey returns the partitionId for the partition to which the
+//partitionKey belongs.
+func (pc *RangePartitionContainer) GetPartitionIdByPartitionKey(key PartitionKey) PartitionId {
+	return RangePartitionId(key, pc.Splits)
+}
+
+//RangePartitionId returns the partition, in the range [0, len(splits)],
+//for the JSON encoded partition key. A key that cannot be encoded, or
+//is missing, belongs to the first partition. Projector and indexer must
+//agree on this function to route a mutation to its partition.
+func RangePartitionId(key []byte, splits [][]byte) PartitionId {
+	if len(splits) == 0 {
+		return PartitionId(0)
+	}
+	code, err := EncodeRangeKey(key)
+	if err != nil {
+		logging.Warnf("RangePartitionId: Unable to encode partition key %s: %v",
+			string(key), err)
+		return PartitionId(0)
+	}
+	return searchSplits(code, splits)
+}
+
+//RangePartitionIds returns the partitions that can hold partition keys
+//within [low, high], where low and high are JSON encoded partition key
+//values, and nil is unbounded. Partitions are in ascending order.
+func RangePartitionIds(low, high []byte, splits [][]byte) ([]PartitionId, error) {
+
+	first, last := PartitionId(0), PartitionId(len(splits))
+	if low != nil {
+		code, err := EncodeRangeKey(low)
+		if err != nil {
+			return nil, err
+		}
+		first = searchSplits(code, splits)
+	}
+	if high != nil {
+		code, err := EncodeRangeKey(high)
+		if err != nil {
+			return nil, err
+		}
+		last = searchSplits(code, splits)
+	}
+
+	var partnIds []PartitionId
+	for id := first; id <= last; id++ {
+		partnIds = append(partnIds, id)
+	}
+	return partnIds, nil
+}
+
+//EncodeRangeKey encodes a JSON partition key value into collatejson,
+//the encoding used for split keys of a range partitioned index.
+func EncodeRangeKey(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	size := 3 * len(key)
+	if size < collatejson.MinBufferSize {
+		size = collatejson.MinBufferSize
+	}
+	codec := collatejson.NewCodec(16)
+	return codec.Encode(key, make([]byte, 0, size))
+}
+
+//ValidateRangeSplits returns an error unless split keys are in strictly
+//ascending collation order.
+func ValidateRangeSplits(splits [][]byte) error {
+	for i := 1; i < len(splits); i++ {
+		if bytes.Compare(splits[i-1], splits[i]) >= 0 {
+			return fmt.Errorf("Partition split key %v is not greater than split key %v", i, i-1)
+		}
+	}
+	return nil
+}
+
+//searchSplits does a binary search for the partition holding the
+//collatejson encoded partition key.
+func searchSplits(code []byte, splits [][]byte) PartitionId {
+	i := sort.Search(len(splits), func(i int) bool {
+		return bytes.Compare(code, splits[i]) < 0
+	})
+	return PartitionId(i)
+}
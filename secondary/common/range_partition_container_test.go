@@ -0,0 +1,43 @@
+package common
+
+import "testing"
+
+func TestRangePartitionId(t *testing.T) {
+	var splits [][]byte
+	for _, s := range []string{`10`, `20`, `"a"`} {
+		code, err := EncodeRangeKey([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		splits = append(splits, code)
+	}
+	if err := ValidateRangeSplits(splits); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]PartitionId{
+		`5`: 0, `10`: 1, `19.5`: 1, `20`: 2, `""`: 2, `"a"`: 3, `"z"`: 3,
+	}
+	for key, ref := range testcases {
+		if id := RangePartitionId([]byte(key), splits); id != ref {
+			t.Errorf("expected partition %v for %v, got %v", ref, key, id)
+		}
+	}
+	if id := RangePartitionId(nil, splits); id != 0 {
+		t.Errorf("expected partition 0 for missing key, got %v", id)
+	}
+
+	ids, err := RangePartitionIds([]byte(`15`), []byte(`"b"`), splits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[2] != 3 {
+		t.Errorf("unexpected partitions %v for span [15, \"b\"]", ids)
+	}
+	if ids, _ = RangePartitionIds(nil, []byte(`5`), splits); len(ids) != 1 {
+		t.Errorf("unexpected partitions %v for span [nil, 5]", ids)
+	}
+	if err := ValidateRangeSplits([][]byte{splits[1], splits[0]}); err == nil {
+		t.Errorf("expected error for unordered split keys")
+	}
+}
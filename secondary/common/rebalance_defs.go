@@ -107,6 +107,8 @@ type TransferToken struct {
 	Error        string
 	BuildSource  TokenBuildSource
 	TransferMode TokenTransferMode
+	//http address of the source indexer, used for peer builds
+	SourceHost string
 }
 
 func (tt TransferToken) Clone() TransferToken {
@@ -122,6 +124,7 @@ func (tt TransferToken) Clone() TransferToken {
 	ttc.Error = tt.Error
 	ttc.BuildSource = tt.BuildSource
 	ttc.TransferMode = tt.TransferMode
+	ttc.SourceHost = tt.SourceHost
 
 	return ttc
 
@@ -136,6 +139,9 @@ func (tt TransferToken) String() string {
 	str += fmt.Sprintf("State: %v ", tt.State)
 	str += fmt.Sprintf("BuildSource: %v ", tt.BuildSource)
 	str += fmt.Sprintf("TransferMode: %v ", tt.TransferMode)
+	if tt.SourceHost != "" {
+		str += fmt.Sprintf("SourceHost: %v ", tt.SourceHost)
+	}
 	if tt.Error != "" {
 		str += fmt.Sprintf("Error: %v ", tt.Error)
 	}
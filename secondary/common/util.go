@@ -214,6 +214,26 @@ func OpError(err error, vals []interface{}, idx int) error {
 	return nil
 }
 
+// ServiceAuthFunc return user and password to access the service
+// listening on `hostport`.
+type ServiceAuthFunc func(hostport string) (string, string, error)
+
+var httpServiceAuth ServiceAuthFunc = cbauth.GetHTTPServiceAuth
+var memcachedServiceAuth ServiceAuthFunc = cbauth.GetMemcachedServiceAuth
+
+// SetServiceAuth replaces cbauth as the source of credentials for
+// cluster REST and memcached services, for processes that are not
+// spawned by ns_server, like tests running against dcp/emulator.
+// A nil `fn` restores cbauth.
+func SetServiceAuth(fn ServiceAuthFunc) {
+	if fn == nil {
+		httpServiceAuth = cbauth.GetHTTPServiceAuth
+		memcachedServiceAuth = cbauth.GetMemcachedServiceAuth
+		return
+	}
+	httpServiceAuth, memcachedServiceAuth = fn, fn
+}
+
 // cbauth admin authentication helper
 // Uses default cbauth env variables internally to provide auth creds
 type CbAuthHandler struct {
@@ -222,7 +242,7 @@ type CbAuthHandler struct {
 }
 
 func (ah *CbAuthHandler) GetCredentials() (string, string) {
-	u, p, err := cbauth.GetHTTPServiceAuth(ah.Hostport)
+	u, p, err := httpServiceAuth(ah.Hostport)
 	if err != nil {
 		panic(err)
 	}
@@ -231,7 +251,7 @@ func (ah *CbAuthHandler) GetCredentials() (string, string) {
 }
 
 func (ah *CbAuthHandler) AuthenticateMemcachedConn(host string, conn *memcached.Client) error {
-	u, p, err := cbauth.GetMemcachedServiceAuth(host)
+	u, p, err := memcachedServiceAuth(host)
 	if err != nil {
 		panic(err)
 	}
@@ -383,7 +403,7 @@ func ClusterAuthUrl(cluster string) (string, error) {
 		cluster = u.Host
 	}
 
-	adminUser, adminPasswd, err := cbauth.GetHTTPServiceAuth(cluster)
+	adminUser, adminPasswd, err := httpServiceAuth(cluster)
 	if err != nil {
 		return "", err
 	}
@@ -501,6 +521,26 @@ func ConnectBucket(cluster, pooln, bucketn string) (*couchbase.Bucket, error) {
 	return bucket, err
 }
 
+// GetCollectionID fetches the collection-id of `collection` in `scope`
+// of `bucket`. The default collection has id 0 and does not require a
+// collections aware cluster.
+func GetCollectionID(cluster, bucket, scope, collection string) (uint32, error) {
+	if IsDefaultCollection(scope, collection) {
+		return 0, nil
+	}
+	b, err := ConnectBucket(cluster, "default" /*pooln*/, bucket)
+	if err != nil {
+		return 0, err
+	}
+	defer b.Close()
+
+	manifest, err := b.GetCollectionsManifest()
+	if err != nil {
+		return 0, err
+	}
+	return manifest.CollectionID(scope, collection)
+}
+
 // MaxVbuckets return the number of vbuckets in bucket.
 func MaxVbuckets(bucket *couchbase.Bucket) (int, error) {
 	count := 0
@@ -573,12 +613,17 @@ func SetNumCPUs(percent int) int {
 
 func IndexStatement(def IndexDefn, printNodes bool) string {
 	var stmt string
-	primCreate := "CREATE PRIMARY INDEX `%s` ON `%s`"
-	secCreate := "CREATE INDEX `%s` ON `%s`(%s)"
+	primCreate := "CREATE PRIMARY INDEX `%s` ON %s"
+	secCreate := "CREATE INDEX `%s` ON %s(%s)"
 	where := " WHERE %s"
 
+	keyspace := "`" + def.Bucket + "`"
+	if !def.IsDefaultCollection() {
+		keyspace += ".`" + def.Scope + "`.`" + def.Collection + "`"
+	}
+
 	if def.IsPrimary {
-		stmt = fmt.Sprintf(primCreate, def.Name, def.Bucket)
+		stmt = fmt.Sprintf(primCreate, def.Name, keyspace)
 	} else {
 		exprs := ""
 		for i, exp := range def.SecExprs {
@@ -590,7 +635,7 @@ func IndexStatement(def IndexDefn, printNodes bool) string {
 				exprs += " DESC"
 			}
 		}
-		stmt = fmt.Sprintf(secCreate, def.Name, def.Bucket, exprs)
+		stmt = fmt.Sprintf(secCreate, def.Name, keyspace, exprs)
 		if def.WhereExpr != "" {
 			stmt += fmt.Sprintf(where, def.WhereExpr)
 		}
@@ -355,3 +355,22 @@ func BenchmarkRemoveString(b *testing.B) {
 		RemoveString("4", a)
 	}
 }
+
+func TestIndexStatementKeyspace(t *testing.T) {
+	defn := IndexDefn{Name: "idx", Bucket: "b", SecExprs: []string{"`age`"}}
+	if defn.KeyspaceId() != "b" {
+		t.Fatalf("failed KeyspaceId %q", defn.KeyspaceId())
+	}
+	if stmt := IndexStatement(defn, false); stmt != "CREATE INDEX `idx` ON `b`(`age`)" {
+		t.Fatalf("failed IndexStatement %q", stmt)
+	}
+
+	defn.Scope, defn.Collection = DEFAULT_SCOPE, "c"
+	if defn.IsDefaultCollection() || defn.KeyspaceId() != "b._default.c" {
+		t.Fatalf("failed KeyspaceId %q", defn.KeyspaceId())
+	}
+	stmt := IndexStatement(defn, false)
+	if stmt != "CREATE INDEX `idx` ON `b`.`_default`.`c`(`age`)" {
+		t.Fatalf("failed IndexStatement %q", stmt)
+	}
+}
@@ -83,6 +83,11 @@ func NewClient(
 		panic("fatal: cannot open dataport-client with zero connections")
 	}
 
+	tlsConfig, err := tlsClientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	c = &Client{
 		raddr:     raddr,
 		conns:     make(map[int]net.Conn),
@@ -101,7 +106,7 @@ func NewClient(
 	c.logPrefix = fmt.Sprintf("ENDC[%v<-%v #%v]", raddr, cluster, topic)
 	// open connections with remote
 	for i := 0; i < parConns; i++ {
-		if conn, err = net.Dial("tcp", raddr); err != nil {
+		if conn, err = transport.Dial(raddr, tlsConfig); err != nil {
 			logging.Errorf("%v Dialing to %q: %v\n", c.logPrefix, raddr, err)
 			c.doClose()
 			return nil, err
@@ -18,6 +18,7 @@
 
 package dataport
 
+import "crypto/tls"
 import "fmt"
 import "net"
 import "time"
@@ -69,7 +70,17 @@ func NewRouterEndpoint(
 	cluster, topic, raddr string, maxvbs int,
 	config c.Config) (*RouterEndpoint, error) {
 
-	conn, err := net.Dial("tcp", raddr)
+	compression, err := transport.ParseCompression(config["compression"].String())
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := tlsClientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := transport.Dial(raddr, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -89,8 +100,7 @@ func NewRouterEndpoint(
 	}
 	endpoint.ch = make(chan []interface{}, endpoint.keyChSize)
 	endpoint.conn = conn
-	// TODO: add configuration params for transport flags.
-	flags := transport.TransportFlag(0).SetProtobuf()
+	flags := transport.TransportFlag(0).SetProtobuf().SetCompression(compression)
 	maxPayload := config["maxPayload"].Int()
 	endpoint.pkt = transport.NewTransportPacket(maxPayload, flags)
 	endpoint.pkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
@@ -109,6 +119,19 @@ func NewRouterEndpoint(
 	return endpoint, nil
 }
 
+// tlsClientConfig return TLS configuration to dial dataport server,
+// nil if TLS is not enabled.
+func tlsClientConfig(config c.Config) (*tls.Config, error) {
+	if cv, ok := config["enableTLS"]; !ok || !cv.Bool() {
+		return nil, nil
+	}
+	caFile := ""
+	if cv, ok := config["caFile"]; ok {
+		caFile = cv.String()
+	}
+	return transport.NewTLSClientConfig(caFile)
+}
+
 // commands
 const (
 	endpCmdPing byte = iota + 1
@@ -192,9 +215,11 @@ func (endpoint *RouterEndpoint) run(ch chan []interface{}) {
 	}()
 
 	statSince := time.Now()
-	var stitems [14]string
+	var stitems [17]string
 	logstats := func() {
 		prjLatency := endpoint.prjLatency
+		payloadBytes, wireBytes := endpoint.pkt.BytesSent()
+		compression := endpoint.pkt.Flags().GetCompression()
 		stitems[0] = `"topic":"` + endpoint.topic + `"`
 		stitems[1] = `"raddr":"` + endpoint.raddr + `"`
 		stitems[2] = `"mutCount":` + strconv.Itoa(int(endpoint.mutCount))
@@ -209,6 +234,9 @@ func (endpoint *RouterEndpoint) run(ch chan []interface{}) {
 		stitems[11] = `"latency.min":` + strconv.Itoa(int(prjLatency.Min()))
 		stitems[12] = `"latency.max":` + strconv.Itoa(int(prjLatency.Max()))
 		stitems[13] = `"latency.avg":` + strconv.Itoa(int(prjLatency.Mean()))
+		stitems[14] = `"compression":"` + transport.CompressionName(compression) + `"`
+		stitems[15] = `"payloadBytes":` + strconv.FormatInt(payloadBytes, 10)
+		stitems[16] = `"wireBytes":` + strconv.FormatInt(wireBytes, 10)
 		statjson := strings.Join(stitems[:], ",")
 		fmsg := "%v stats {%v}\n"
 		logging.Infof(fmsg, endpoint.logPrefix, statjson)
@@ -335,7 +363,13 @@ loop:
 }
 
 func (endpoint *RouterEndpoint) newStats() c.Statistics {
-	m := map[string]interface{}{}
+	payloadBytes, wireBytes := endpoint.pkt.BytesSent()
+	compression := endpoint.pkt.Flags().GetCompression()
+	m := map[string]interface{}{
+		"compression":  transport.CompressionName(compression),
+		"payloadBytes": float64(payloadBytes),
+		"wireBytes":    float64(wireBytes),
+	}
 	stats, _ := c.NewStatistics(m)
 	return stats
 }
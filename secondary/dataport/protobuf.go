@@ -47,11 +47,17 @@ func protobufEncode(payload interface{}) (data []byte, err error) {
 				pkv.Commands = make([]uint32, 0, l)
 				pkv.Keys = make([][]byte, 0, l)
 				pkv.Oldkeys = make([][]byte, 0, l)
+				pkv.Partnkeys = make([][]byte, 0, l)
 				for i, uuid := range kv.Uuids { // for each key-version
 					pkv.Uuids = append(pkv.Uuids, uuid)
 					pkv.Commands = append(pkv.Commands, uint32(kv.Commands[i]))
 					pkv.Keys = append(pkv.Keys, kv.Keys[i])
 					pkv.Oldkeys = append(pkv.Oldkeys, kv.Oldkeys[i])
+					if i < len(kv.Partnkeys) {
+						pkv.Partnkeys = append(pkv.Partnkeys, kv.Partnkeys[i])
+					} else {
+						pkv.Partnkeys = append(pkv.Partnkeys, nil)
+					}
 				}
 				pvb.Kvs = append(pvb.Kvs, pkv)
 			}
@@ -118,11 +124,15 @@ func protobuf2KeyVersions(keys []*protobuf.KeyVersions) []*c.KeyVersions {
 		commands := key.GetCommands()
 		newkeys := key.GetKeys()
 		oldkeys := key.GetOldkeys()
+		partnkeys := key.GetPartnkeys()
 		for i, uuid := range key.GetUuids() {
 			kv.Uuids = append(kv.Uuids, uuid)
 			kv.Commands = append(kv.Commands, byte(commands[i]))
 			kv.Keys = append(kv.Keys, newkeys[i])
 			kv.Oldkeys = append(kv.Oldkeys, oldkeys[i])
+			if i < len(partnkeys) {
+				kv.Partnkeys = append(kv.Partnkeys, partnkeys[i])
+			}
 		}
 		kvs = append(kvs, kv)
 	}
@@ -52,6 +52,7 @@
 
 package dataport
 
+import "crypto/tls"
 import "errors"
 import "fmt"
 import "io"
@@ -167,7 +168,16 @@ func NewServer(
 		readDeadline: time.Duration(config["tcpReadDeadline"].Int()),
 	}
 	s.logPrefix = fmt.Sprintf("DATP[->dataport %q]", laddr)
-	if s.lis, err = net.Listen("tcp", laddr); err != nil {
+	var tlsConfig *tls.Config
+	requireTLS := config["requireTLS"].Bool()
+	if requireTLS || config["enableTLS"].Bool() {
+		certFile, keyFile := config["certFile"].String(), config["keyFile"].String()
+		if tlsConfig, err = transport.NewTLSServerConfig(certFile, keyFile); err != nil {
+			logging.Errorf("%v failed loading certificate ! %v\n", s.logPrefix, err)
+			return nil, err
+		}
+	}
+	if s.lis, err = transport.Listen(laddr, tlsConfig, requireTLS); err != nil {
 		logging.Errorf("%v failed starting ! %v\n", s.logPrefix, err)
 		return nil, err
 	}
@@ -61,6 +61,49 @@ func TestPktVbmap(t *testing.T) {
 	}
 }
 
+func TestPktCompression(t *testing.T) {
+	seqno, nVbs, nMuts, nIndexes := 1, 20, 5, 5
+	vbsRef := constructVbKeyVersions("default", seqno, nVbs, nMuts, nIndexes)
+	for _, name := range []string{"snappy", "gzip"} {
+		compression, err := transport.ParseCompression(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc := newTestConnection()
+		tc.reset()
+		flags := transport.TransportFlag(0).SetProtobuf().SetCompression(compression)
+		pkt := transport.NewTransportPacket(1000*1024, flags)
+		pkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
+		pkt.SetDecoder(transport.EncodingProtobuf, protobufDecode)
+
+		if err := pkt.Send(tc, vbsRef); err != nil {
+			t.Fatal(err)
+		}
+		if payload, wire := pkt.BytesSent(); wire >= payload {
+			t.Errorf("%v: expected compression, payload %v wire %v", name, payload, wire)
+		}
+		// receive on a packet that does not compress.
+		rpkt := transport.NewTransportPacket(1000*1024, transport.TransportFlag(0).SetProtobuf())
+		rpkt.SetDecoder(transport.EncodingProtobuf, protobufDecode)
+		payload, err := rpkt.Receive(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vbs := protobuf2VbKeyVersions(payload.([]*protobuf.VbKeyVersions))
+		if len(vbsRef) != len(vbs) {
+			t.Fatalf("%v: mismatch in length", name)
+		}
+		for i, vb := range vbs {
+			if vb.Equal(vbsRef[i]) == false {
+				t.Fatalf("%v: mismatch in VbKeyVersions", name)
+			}
+		}
+		if rpkt.Flags().GetCompression() != compression {
+			t.Errorf("%v: expected receiver to pick compression from packet", name)
+		}
+	}
+}
+
 func BenchmarkSendVbKeyVersions(b *testing.B) {
 	seqno, nVbs, nMuts, nIndexes := 1, 20, 5, 5
 	vbs := constructVbKeyVersions("default", seqno, nVbs, nMuts, nIndexes)
@@ -0,0 +1,58 @@
+package couchbase
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrUnknownCollection is returned for a scope/collection missing from
+// the bucket's manifest.
+var ErrUnknownCollection = errors.New("unknown scope or collection")
+
+// CollectionsManifest lists scopes, and their collections, of a bucket.
+// Every change to the manifest bumps its uid.
+type CollectionsManifest struct {
+	UID    string          `json:"uid"`
+	Scopes []ManifestScope `json:"scopes"`
+}
+
+// ManifestScope is a scope in CollectionsManifest.
+type ManifestScope struct {
+	Name        string               `json:"name"`
+	UID         string               `json:"uid"`
+	Collections []ManifestCollection `json:"collections"`
+}
+
+// ManifestCollection is a collection in ManifestScope, its uid is the
+// collection-id that prefixes keys on collections aware DCP streams.
+type ManifestCollection struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// GetCollectionsManifest fetches the current manifest of this bucket.
+func (b *Bucket) GetCollectionsManifest() (*CollectionsManifest, error) {
+	manifest := &CollectionsManifest{}
+	path := "/pools/default/buckets/" + b.Name + "/collections"
+	if err := b.parseURLResponse(path, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// CollectionID returns the id of `collection` in `scope`, uids in the
+// manifest are hex encoded.
+func (m *CollectionsManifest) CollectionID(scope, collection string) (uint32, error) {
+	for _, s := range m.Scopes {
+		if s.Name != scope {
+			continue
+		}
+		for _, c := range s.Collections {
+			if c.Name == collection {
+				cid, err := strconv.ParseUint(c.UID, 16, 32)
+				return uint32(cid), err
+			}
+		}
+	}
+	return 0, ErrUnknownCollection
+}
@@ -0,0 +1,431 @@
+package emulator
+
+import (
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// ErrorKeyNotFound is returned when deleting a missing document.
+var ErrorKeyNotFound = errors.New("emulator.keyNotFound")
+
+// ErrorInvalidVbucket is returned for a vbucket outside the bucket.
+var ErrorInvalidVbucket = errors.New("emulator.invalidVbucket")
+
+// Flags of DCP_STREAMEND, sent to the client with the reason a stream
+// has ended.
+const (
+	StreamEndOK           = uint32(0x00) // end seqno reached
+	StreamEndClosed       = uint32(0x01) // closed by the producer
+	StreamEndStateChanged = uint32(0x02) // vbucket moved or failed over
+	StreamEndDisconnected = uint32(0x03) // connection is going away
+)
+
+// Bucket emulates a couchbase bucket, every mutation is kept in a
+// per-vbucket log so that streams can be started from any seqno.
+type Bucket struct {
+	cluster *Cluster
+	name    string
+	uuid    string
+
+	mu       sync.Mutex
+	cond     *sync.Cond // signalled on mutations and stream changes
+	vbuckets []*vbucket
+	manifest manifest
+}
+
+// manifest of scopes and collections, ids are allocated from a single
+// sequence starting at 8, like KV does.
+type manifest struct {
+	uid    uint64
+	nextId uint32
+	scopes []*scope
+}
+
+type scope struct {
+	name        string
+	uid         uint32
+	collections map[string]uint32
+	order       []string // collection names in creation order
+}
+
+type vbucket struct {
+	vbno    uint16
+	node    int              // index of the node that is master
+	seqno   uint64           // high seqno
+	flog    [][2]uint64      // {vbuuid, seqno} latest first
+	items   []*item          // log of mutations ordered by seqno
+	docs    map[string]*item // latest mutation for each collection+key
+	streams map[*dcpStream]bool
+}
+
+type item struct {
+	opcode   transport.CommandCode // DCP_MUTATION, DCP_DELETION, DCP_EXPIRATION
+	cid      uint32                // collection-id
+	key      []byte
+	value    []byte
+	datatype uint8
+	seqno    uint64
+	revSeqno uint64
+	cas      uint64
+	flags    uint32
+	expiry   uint32
+}
+
+func newBucket(c *Cluster, name string, numVbuckets, numNodes int) *Bucket {
+	b := &Bucket{
+		cluster:  c,
+		name:     name,
+		uuid:     newUUID(),
+		vbuckets: make([]*vbucket, numVbuckets),
+	}
+	b.manifest.nextId = 8
+	b.manifest.scopes = []*scope{{
+		name:        "_default",
+		collections: map[string]uint32{"_default": transport.DefaultCollectionID},
+		order:       []string{"_default"},
+	}}
+	b.cond = sync.NewCond(&b.mu)
+	for i := range b.vbuckets {
+		b.vbuckets[i] = &vbucket{
+			vbno:    uint16(i),
+			node:    i % numNodes,
+			flog:    [][2]uint64{{newVbuuid(), 0}},
+			docs:    make(map[string]*item),
+			streams: make(map[*dcpStream]bool),
+		}
+	}
+	return b
+}
+
+// Name of the bucket.
+func (b *Bucket) Name() string {
+	return b.name
+}
+
+// NumVbuckets in this bucket.
+func (b *Bucket) NumVbuckets() int {
+	return len(b.vbuckets)
+}
+
+// VBucket returns the vbucket hosting document `key`.
+func (b *Bucket) VBucket(key string) uint16 {
+	crc := crc32.ChecksumIEEE([]byte(key))
+	return uint16((crc >> 16) & 0x7fff & uint32(len(b.vbuckets)-1))
+}
+
+// Set document `key` to JSON `value`, returns the seqno of mutation.
+func (b *Bucket) Set(key string, value []byte) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm := b.mutateLocked(transport.DCP_MUTATION, 0, key, value, 0, 0)
+	return itm.seqno
+}
+
+// SetCollection sets document `key`, in collection `cid`, to JSON
+// `value`, returns the seqno of mutation. Mutations on collections other
+// than the default are streamed only to collections aware clients.
+func (b *Bucket) SetCollection(cid uint32, key string, value []byte) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm := b.mutateLocked(transport.DCP_MUTATION, cid, key, value, 0, 0)
+	return itm.seqno
+}
+
+// CreateCollection `name` in scope `scopeName`, scope is created if it
+// does not exist, returns the collection-id of the collection.
+func (b *Bucket) CreateCollection(scopeName, name string) uint32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := &b.manifest
+	var s *scope
+	for _, sc := range m.scopes {
+		if sc.name == scopeName {
+			s = sc
+			break
+		}
+	}
+	if s == nil {
+		s = &scope{name: scopeName, uid: m.nextId, collections: make(map[string]uint32)}
+		m.scopes = append(m.scopes, s)
+		m.nextId++
+	}
+	if cid, ok := s.collections[name]; ok {
+		return cid
+	}
+	cid := m.nextId
+	s.collections[name] = cid
+	s.order = append(s.order, name)
+	m.nextId++
+	m.uid++
+	return cid
+}
+
+// manifestJSON in the shape served by ns_server, uids are hex encoded.
+func (b *Bucket) manifestJSON() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	scopes := make([]map[string]interface{}, 0, len(b.manifest.scopes))
+	for _, s := range b.manifest.scopes {
+		collections := make([]map[string]string, 0, len(s.order))
+		for _, name := range s.order {
+			collections = append(collections, map[string]string{
+				"name": name,
+				"uid":  strconv.FormatUint(uint64(s.collections[name]), 16),
+			})
+		}
+		scopes = append(scopes, map[string]interface{}{
+			"name":        s.name,
+			"uid":         strconv.FormatUint(uint64(s.uid), 16),
+			"collections": collections,
+		})
+	}
+	return map[string]interface{}{
+		"uid":    strconv.FormatUint(b.manifest.uid, 16),
+		"scopes": scopes,
+	}
+}
+
+// Get the current value of document `key`.
+func (b *Bucket) Get(key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb := b.vbuckets[b.VBucket(key)]
+	itm, ok := vb.docs[docKey(0, key)]
+	if !ok || itm.opcode != transport.DCP_MUTATION {
+		return nil, false
+	}
+	return itm.value, true
+}
+
+// Delete document `key`, returns the seqno of deletion.
+func (b *Bucket) Delete(key string) (uint64, error) {
+	return b.remove(transport.DCP_DELETION, key)
+}
+
+// Expire document `key`, returns the seqno of expiration.
+func (b *Bucket) Expire(key string) (uint64, error) {
+	return b.remove(transport.DCP_EXPIRATION, key)
+}
+
+func (b *Bucket) remove(
+	opcode transport.CommandCode, key string) (uint64, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb := b.vbuckets[b.VBucket(key)]
+	if itm, ok := vb.docs[docKey(0, key)]; !ok || itm.opcode != transport.DCP_MUTATION {
+		return 0, ErrorKeyNotFound
+	}
+	itm := b.mutateLocked(opcode, 0, key, nil, 0, 0)
+	return itm.seqno, nil
+}
+
+func (b *Bucket) mutateLocked(
+	opcode transport.CommandCode, cid uint32, key string, value []byte,
+	flags, expiry uint32) *item {
+
+	vb := b.vbuckets[b.VBucket(key)]
+	vb.seqno++
+	itm := &item{
+		opcode: opcode,
+		cid:    cid,
+		key:    []byte(key),
+		value:  value,
+		seqno:  vb.seqno,
+		cas:    uint64(time.Now().UnixNano()),
+		flags:  flags,
+		expiry: expiry,
+	}
+	if len(value) > 0 {
+		itm.datatype = transport.DatatypeJSON
+	}
+	if prev, ok := vb.docs[docKey(cid, key)]; ok {
+		itm.revSeqno = prev.revSeqno + 1
+	} else {
+		itm.revSeqno = 1
+	}
+	vb.items = append(vb.items, itm)
+	vb.docs[docKey(cid, key)] = itm
+	b.cond.Broadcast()
+	return itm
+}
+
+// Seqnos returns the high seqno of every vbucket.
+func (b *Bucket) Seqnos() []uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	seqnos := make([]uint64, len(b.vbuckets))
+	for i, vb := range b.vbuckets {
+		seqnos[i] = vb.seqno
+	}
+	return seqnos
+}
+
+// FailoverLog of vbucket `vbno`, latest entry first.
+func (b *Bucket) FailoverLog(vbno uint16) [][2]uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(vbno) >= len(b.vbuckets) {
+		return nil
+	}
+	return append([][2]uint64(nil), b.vbuckets[vbno].flog...)
+}
+
+// EndStream ends all open streams of vbucket `vbno` with `flags`,
+// one of StreamEnd* constants.
+func (b *Bucket) EndStream(vbno uint16, flags uint32) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(vbno) >= len(b.vbuckets) {
+		return ErrorInvalidVbucket
+	}
+	b.endStreamsLocked(b.vbuckets[vbno], flags)
+	return nil
+}
+
+// Failover vbucket `vbno`, a new vbuuid is added to its failover log
+// at the current seqno and open streams are ended.
+func (b *Bucket) Failover(vbno uint16) error {
+	return b.Rollback(vbno, ^uint64(0))
+}
+
+// Rollback vbucket `vbno` to `seqno`, as it would after failing over
+// to a replica that is behind. Mutations after `seqno` are lost, a new
+// vbuuid is added to the failover log and open streams are ended, so
+// that clients resuming from the old branch receive ROLLBACK.
+func (b *Bucket) Rollback(vbno uint16, seqno uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int(vbno) >= len(b.vbuckets) {
+		return ErrorInvalidVbucket
+	}
+	vb := b.vbuckets[vbno]
+	b.endStreamsLocked(vb, StreamEndStateChanged)
+
+	if seqno < vb.seqno {
+		n := sort.Search(len(vb.items), func(i int) bool {
+			return vb.items[i].seqno > seqno
+		})
+		vb.items = vb.items[:n]
+		vb.seqno = seqno
+		vb.docs = make(map[string]*item)
+		for _, itm := range vb.items {
+			vb.docs[docKey(itm.cid, string(itm.key))] = itm
+		}
+	}
+	entry := [2]uint64{newVbuuid(), vb.seqno}
+	vb.flog = append([][2]uint64{entry}, vb.flog...)
+	logging.Infof("KVEMU %v vb:%v failover %v", b.name, vbno, entry)
+	return nil
+}
+
+// MoveVBucket makes node `node` the master of vbucket `vbno`, open
+// streams are ended and clients get NOT_MY_VBUCKET from the old node.
+func (b *Bucket) MoveVBucket(vbno uint16, node int) error {
+	if node < 0 || node >= len(b.cluster.nodes) {
+		return ErrorInvalidNode
+	}
+	b.mu.Lock()
+	if int(vbno) >= len(b.vbuckets) {
+		b.mu.Unlock()
+		return ErrorInvalidVbucket
+	}
+	vb := b.vbuckets[vbno]
+	b.endStreamsLocked(vb, StreamEndStateChanged)
+	vb.node = node
+	b.mu.Unlock()
+
+	b.cluster.notify()
+	return nil
+}
+
+// vbmap returns the master node of every vbucket.
+func (b *Bucket) vbmap() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vbmap := make([]int, len(b.vbuckets))
+	for i, vb := range b.vbuckets {
+		vbmap[i] = vb.node
+	}
+	return vbmap
+}
+
+// vbucketOn returns vbucket `vbno` if it is hosted by `node`.
+func (b *Bucket) vbucketOn(vbno uint16, node int) (*vbucket, bool) {
+	if int(vbno) >= len(b.vbuckets) {
+		return nil, false
+	}
+	vb := b.vbuckets[vbno]
+	return vb, vb.node == node
+}
+
+// rollbackSeqno for a stream request resuming from `start` on branch
+// `vbuuid`, returns false if the stream can be started.
+func (vb *vbucket) rollbackSeqno(
+	vbuuid, start, snapStart, snapEnd uint64) (uint64, bool) {
+
+	if start == 0 {
+		return 0, false
+	}
+	for i, entry := range vb.flog {
+		if entry[0] != vbuuid {
+			continue
+		}
+		upto := vb.seqno // branch is valid upto the next failover
+		if i > 0 {
+			upto = vb.flog[i-1][1]
+		}
+		if start > upto {
+			return upto, true
+		} else if snapEnd > upto {
+			return snapStart, true
+		}
+		return 0, false
+	}
+	return 0, true
+}
+
+// since returns mutations after `seqno` upto `end`.
+func (vb *vbucket) since(seqno, end uint64) []*item {
+	i := sort.Search(len(vb.items), func(i int) bool {
+		return vb.items[i].seqno > seqno
+	})
+	j := sort.Search(len(vb.items), func(i int) bool {
+		return vb.items[i].seqno > end
+	})
+	if i >= j {
+		return nil
+	}
+	return vb.items[i:j]
+}
+
+// docKey identifies document `key` across collections.
+func docKey(cid uint32, key string) string {
+	return string(transport.PrefixCollectionID(cid, []byte(key)))
+}
+
+func (b *Bucket) addStreamLocked(s *dcpStream) {
+	s.vb.streams[s] = true
+}
+
+func (b *Bucket) endStreamsLocked(vb *vbucket, flags uint32) {
+	for s := range vb.streams {
+		s.endLocked(flags)
+	}
+	b.cond.Broadcast()
+}
+
+func (b *Bucket) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, vb := range b.vbuckets {
+		b.endStreamsLocked(vb, StreamEndDisconnected)
+	}
+}
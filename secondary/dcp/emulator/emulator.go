@@ -0,0 +1,292 @@
+// Package emulator runs an in-process KV cluster for hermetic tests.
+//
+// Each emulated node serves the REST pool and bucket endpoints used by
+// cluster-info and the dcp package, and speaks enough of the memcached
+// and DCP protocol, via dcp/transport/server, for the projector and
+// indexer to stream mutations and query seqnos:
+//
+//	cluster, _ := emulator.NewCluster(1)
+//	defer cluster.Close()
+//	bucket, _ := cluster.CreateBucket("default", 64)
+//	bucket.Set("doc1", []byte(`{"age":10}`))
+//	couchbase.GetBucket(cluster.URL(), "default", "default")
+//
+// Collections are created with Bucket.CreateCollection() and their
+// documents written with Bucket.SetCollection(), they are streamed to
+// collections aware feeds.
+//
+// Failures can be injected with Bucket.EndStream(), Bucket.Rollback(),
+// Bucket.Failover(), Bucket.MoveVBucket() and Node.ResetConnections().
+package emulator
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// ErrorBucketExists is returned when creating a bucket twice.
+var ErrorBucketExists = errors.New("emulator.bucketExists")
+
+// ErrorInvalidVbuckets is returned for number of vbuckets that is not a
+// power of 2.
+var ErrorInvalidVbuckets = errors.New("emulator.invalidVbuckets")
+
+// ErrorInvalidNode is returned for an unknown node index.
+var ErrorInvalidNode = errors.New("emulator.invalidNode")
+
+// Cluster of emulated KV nodes sharing the same set of buckets.
+type Cluster struct {
+	uuid string
+
+	mu      sync.Mutex
+	nodes   []*Node
+	buckets map[string]*Bucket
+	order   []string      // bucket names in creation order
+	rev     int           // revision of cluster topology
+	changed chan struct{} // closed and replaced on every revision
+}
+
+// NewCluster starts `numNodes` emulated KV nodes listening on loopback.
+func NewCluster(numNodes int) (*Cluster, error) {
+	c := &Cluster{
+		uuid:    newUUID(),
+		buckets: make(map[string]*Bucket),
+		changed: make(chan struct{}),
+	}
+	for i := 0; i < numNodes; i++ {
+		node, err := newNode(c, i)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.nodes = append(c.nodes, node)
+	}
+	return c, nil
+}
+
+// URL to connect with the cluster, served by the first node.
+func (c *Cluster) URL() string {
+	return "http://" + c.nodes[0].RestAddr()
+}
+
+// Nodes in this cluster.
+func (c *Cluster) Nodes() []*Node {
+	return c.nodes
+}
+
+// CreateBucket with `numVbuckets` vbuckets, distributed round-robin
+// across nodes.
+func (c *Cluster) CreateBucket(name string, numVbuckets int) (*Bucket, error) {
+	if numVbuckets <= 0 || numVbuckets&(numVbuckets-1) != 0 {
+		return nil, ErrorInvalidVbuckets
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.buckets[name]; ok {
+		return nil, ErrorBucketExists
+	}
+	b := newBucket(c, name, numVbuckets, len(c.nodes))
+	c.buckets[name] = b
+	c.order = append(c.order, name)
+	c.notifyLocked()
+	logging.Infof("KVEMU created bucket %q with %v vbuckets", name, numVbuckets)
+	return b, nil
+}
+
+// Bucket by name, nil if it does not exist.
+func (c *Cluster) Bucket(name string) *Bucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buckets[name]
+}
+
+// Close all nodes and their connections.
+func (c *Cluster) Close() {
+	c.mu.Lock()
+	buckets := make([]*Bucket, 0, len(c.buckets))
+	for _, b := range c.buckets {
+		buckets = append(buckets, b)
+	}
+	c.mu.Unlock()
+
+	for _, b := range buckets {
+		b.close()
+	}
+	for _, node := range c.nodes {
+		node.close()
+	}
+}
+
+func (c *Cluster) bucketList() []*Bucket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buckets := make([]*Bucket, 0, len(c.order))
+	for _, name := range c.order {
+		buckets = append(buckets, c.buckets[name])
+	}
+	return buckets
+}
+
+// notify streaming REST clients of a topology change.
+func (c *Cluster) notify() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notifyLocked()
+}
+
+func (c *Cluster) notifyLocked() {
+	c.rev++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *Cluster) revision() (int, chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rev, c.changed
+}
+
+// Node is an emulated KV node, with a REST and a memcached endpoint.
+type Node struct {
+	cluster *Cluster
+	index   int
+	restLis net.Listener
+	mcLis   net.Listener
+	rest    *http.Server
+
+	mu       sync.Mutex
+	services map[string]int
+	conns    map[*kvConn]bool
+	closed   bool
+}
+
+func newNode(c *Cluster, index int) (*Node, error) {
+	restLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	mcLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		restLis.Close()
+		return nil, err
+	}
+	node := &Node{
+		cluster:  c,
+		index:    index,
+		restLis:  restLis,
+		mcLis:    mcLis,
+		services: make(map[string]int),
+		conns:    make(map[*kvConn]bool),
+	}
+	node.services["mgmt"] = restLis.Addr().(*net.TCPAddr).Port
+	node.services["kv"] = mcLis.Addr().(*net.TCPAddr).Port
+	node.rest = &http.Server{Handler: node.restHandler()}
+	go node.rest.Serve(restLis)
+	go node.acceptKV()
+	return node, nil
+}
+
+// RestAddr returns host:port of the REST endpoint.
+func (node *Node) RestAddr() string {
+	return node.restLis.Addr().String()
+}
+
+// KVAddr returns host:port of the memcached endpoint.
+func (node *Node) KVAddr() string {
+	return node.mcLis.Addr().String()
+}
+
+// SetService advertises `port` for service `name` on this node, like
+// "indexAdmin" or "projector", in nodeServices.
+func (node *Node) SetService(name string, port int) {
+	node.mu.Lock()
+	node.services[name] = port
+	node.mu.Unlock()
+	node.cluster.notify()
+}
+
+// ResetConnections abruptly closes all memcached connections to this
+// node, including DCP connections.
+func (node *Node) ResetConnections() {
+	node.mu.Lock()
+	conns := make([]*kvConn, 0, len(node.conns))
+	for conn := range node.conns {
+		conns = append(conns, conn)
+	}
+	node.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	logging.Infof("KVEMU node %v reset %v connections", node.index, len(conns))
+}
+
+func (node *Node) serviceMap() map[string]int {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	services := make(map[string]int, len(node.services))
+	for name, port := range node.services {
+		services[name] = port
+	}
+	return services
+}
+
+func (node *Node) acceptKV() {
+	for {
+		s, err := node.mcLis.Accept()
+		if err != nil {
+			return
+		}
+		conn := newKVConn(node, s)
+		node.mu.Lock()
+		if node.closed {
+			node.mu.Unlock()
+			s.Close()
+			return
+		}
+		node.conns[conn] = true
+		node.mu.Unlock()
+		go conn.run()
+	}
+}
+
+func (node *Node) forget(conn *kvConn) {
+	node.mu.Lock()
+	delete(node.conns, conn)
+	node.mu.Unlock()
+}
+
+func (node *Node) close() {
+	node.mu.Lock()
+	node.closed = true
+	node.mu.Unlock()
+
+	node.rest.Close()
+	node.mcLis.Close()
+	node.ResetConnections()
+}
+
+func newUUID() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+func newVbuuid() uint64 {
+	var buf [8]byte
+	rand.Read(buf[:])
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+func hostport(port int) string {
+	return fmt.Sprintf("127.0.0.1:%d", port)
+}
@@ -0,0 +1,227 @@
+package emulator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+)
+
+var dcpConfig = map[string]interface{}{
+	"genChanSize":    100,
+	"dataChanSize":   100,
+	"numConnections": 1,
+}
+
+func startFeed(t *testing.T, cluster *Cluster) (*couchbase.Bucket, *couchbase.DcpFeed) {
+	return startFeedWith(t, cluster, dcpConfig)
+}
+
+func startFeedWith(
+	t *testing.T, cluster *Cluster,
+	config map[string]interface{}) (*couchbase.Bucket, *couchbase.DcpFeed) {
+
+	bucket, err := couchbase.GetBucket(cluster.URL(), "default", "default")
+	if err != nil {
+		t.Fatalf("GetBucket(): %v", err)
+	}
+	name := couchbase.NewDcpFeedName("emulator-test")
+	feed, err := bucket.StartDcpFeed(name, 0, 0xABBA, config)
+	if err != nil {
+		t.Fatalf("StartDcpFeed(): %v", err)
+	}
+	return bucket, feed
+}
+
+func nextEvent(t *testing.T, feed *couchbase.DcpFeed, opcode transport.CommandCode) *mc.DcpEvent {
+	select {
+	case e := <-feed.C:
+		if e.Opcode != opcode {
+			t.Fatalf("Expected %v, received %v vb:%v status:%v", opcode, e.Opcode, e.VBucket, e.Status)
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for %v", opcode)
+	}
+	return nil
+}
+
+func TestEmulatorStream(t *testing.T) {
+	cluster, err := NewCluster(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	emu, _ := cluster.CreateBucket("default", 8)
+
+	bucket, feed := startFeed(t, cluster)
+	defer bucket.Close()
+	defer feed.Close()
+
+	// documents written over memcached land on their vbucket.
+	for i := 0; i < 16; i++ {
+		key := fmt.Sprintf("doc%v", i)
+		if err := bucket.SetRaw(key, 0, []byte(fmt.Sprintf(`{"n":%v}`, i))); err != nil {
+			t.Fatalf("SetRaw(%q): %v", key, err)
+		}
+	}
+	seqnos, err := feed.DcpGetSeqnos()
+	if err != nil {
+		t.Fatalf("DcpGetSeqnos(): %v", err)
+	}
+	for vbno, seqno := range emu.Seqnos() {
+		if seqnos[uint16(vbno)] != seqno {
+			t.Errorf("vb:%v expected seqno %v, received %v", vbno, seqno, seqnos[uint16(vbno)])
+		}
+	}
+
+	vb := emu.VBucket("doc1")
+	vbuuid := emu.FailoverLog(vb)[0][0]
+	high := emu.Seqnos()[vb]
+	if err := feed.DcpRequestStream(vb, 0xABBA, 0, vbuuid, 0, 0xFFFFFFFFFFFFFFFF, 0, 0); err != nil {
+		t.Fatalf("DcpRequestStream(): %v", err)
+	}
+	e := nextEvent(t, feed, transport.DCP_STREAMREQ)
+	if e.Status != transport.SUCCESS || len(*e.FailoverLog) != 1 {
+		t.Fatalf("Unexpected stream request response %v %v", e.Status, e.FailoverLog)
+	}
+	e = nextEvent(t, feed, transport.DCP_SNAPSHOT)
+	if e.SnapstartSeq != 1 || e.SnapendSeq != high {
+		t.Errorf("Unexpected snapshot {%v,%v}", e.SnapstartSeq, e.SnapendSeq)
+	}
+	for seqno := uint64(1); seqno <= high; seqno++ {
+		if e = nextEvent(t, feed, transport.DCP_MUTATION); e.Seqno != seqno {
+			t.Errorf("Expected seqno %v, received %v", seqno, e.Seqno)
+		}
+	}
+
+	// live mutations and deletions follow in their own snapshot.
+	emu.Delete("doc1")
+	nextEvent(t, feed, transport.DCP_SNAPSHOT)
+	if e = nextEvent(t, feed, transport.DCP_DELETION); string(e.Key) != "doc1" {
+		t.Errorf("Unexpected deletion of %q", e.Key)
+	}
+
+	// injected stream end.
+	emu.EndStream(vb, StreamEndStateChanged)
+	nextEvent(t, feed, transport.DCP_STREAMEND)
+}
+
+func TestEmulatorRollback(t *testing.T) {
+	cluster, err := NewCluster(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	emu, _ := cluster.CreateBucket("default", 4)
+
+	bucket, feed := startFeed(t, cluster)
+	defer bucket.Close()
+	defer feed.Close()
+
+	vb := emu.VBucket("doc")
+	for i := 0; i < 5; i++ {
+		emu.Set("doc", []byte(fmt.Sprintf(`{"n":%v}`, i)))
+	}
+	vbuuid := emu.FailoverLog(vb)[0][0]
+	emu.Rollback(vb, 2)
+
+	// resuming from the lost branch must rollback.
+	feed.DcpRequestStream(vb, 0xABBA, 0, vbuuid, 5, 0xFFFFFFFFFFFFFFFF, 5, 5)
+	e := nextEvent(t, feed, transport.DCP_STREAMREQ)
+	if e.Status != transport.ROLLBACK || e.Seqno != 2 {
+		t.Fatalf("Expected rollback to 2, received %v %v", e.Status, e.Seqno)
+	}
+
+	// resuming from the new branch, until end seqno.
+	flog := emu.FailoverLog(vb)
+	if len(flog) != 2 || flog[0][1] != 2 {
+		t.Fatalf("Unexpected failover log %v", flog)
+	}
+	emu.Set("doc", []byte(`{"n":5}`))
+	feed.DcpRequestStream(vb, 0xABBA, 0, flog[0][0], 2, 3, 2, 2)
+	nextEvent(t, feed, transport.DCP_STREAMREQ)
+	nextEvent(t, feed, transport.DCP_SNAPSHOT)
+	if e = nextEvent(t, feed, transport.DCP_MUTATION); string(e.Value) != `{"n":5}` {
+		t.Errorf("Unexpected value %s", e.Value)
+	}
+	nextEvent(t, feed, transport.DCP_STREAMEND)
+
+	// connection reset ends the stream.
+	feed.DcpRequestStream(vb, 0xABBA, 0, flog[0][0], 3, 0xFFFFFFFFFFFFFFFF, 3, 3)
+	nextEvent(t, feed, transport.DCP_STREAMREQ)
+	cluster.Nodes()[0].ResetConnections()
+	nextEvent(t, feed, transport.DCP_STREAMEND)
+}
+
+func TestEmulatorCollections(t *testing.T) {
+	cluster, err := NewCluster(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	emu, _ := cluster.CreateBucket("default", 1)
+	cid := emu.CreateCollection("tenant", "orders")
+
+	// collection-id is resolved from the bucket's manifest.
+	bucket, err := couchbase.GetBucket(cluster.URL(), "default", "default")
+	if err != nil {
+		t.Fatalf("GetBucket(): %v", err)
+	}
+	manifest, err := bucket.GetCollectionsManifest()
+	if err != nil {
+		t.Fatalf("GetCollectionsManifest(): %v", err)
+	}
+	if id, err := manifest.CollectionID("tenant", "orders"); err != nil || id != cid {
+		t.Fatalf("Expected collection-id %v, received %v %v", cid, id, err)
+	}
+	if _, err := manifest.CollectionID("tenant", "missing"); err != couchbase.ErrUnknownCollection {
+		t.Errorf("Expected ErrUnknownCollection, received %v", err)
+	}
+	bucket.Close()
+
+	emu.Set("doc", []byte(`{"n":0}`))
+	emu.SetCollection(cid, "doc", []byte(`{"n":8}`))
+	emu.Set("doc", []byte(`{"n":1}`))
+
+	config := map[string]interface{}{"collectionsAware": true}
+	for key, value := range dcpConfig {
+		config[key] = value
+	}
+	vbuuid := emu.FailoverLog(0)[0][0]
+	expected := map[bool][]uint32{false: {0, 0}, true: {0, cid, 0}}
+	for _, aware := range []bool{false, true} {
+		config["collectionsAware"] = aware
+		bucket, feed := startFeedWith(t, cluster, config)
+		feed.DcpRequestStream(0, 0xABBA, 0, vbuuid, 0, 3, 0, 0)
+		nextEvent(t, feed, transport.DCP_STREAMREQ)
+		nextEvent(t, feed, transport.DCP_SNAPSHOT)
+		for _, cid := range expected[aware] {
+			e := nextEvent(t, feed, transport.DCP_MUTATION)
+			if e.CollectionID != cid || string(e.Key) != "doc" {
+				t.Errorf("aware:%v expected %v:doc, received %v:%s",
+					aware, cid, e.CollectionID, e.Key)
+			}
+		}
+		nextEvent(t, feed, transport.DCP_STREAMEND)
+		feed.Close()
+		bucket.Close()
+	}
+
+	// streams filtered by collection carry only its documents.
+	config["collectionsAware"] = true
+	bucket, feed := startFeedWith(t, cluster, config)
+	defer bucket.Close()
+	defer feed.Close()
+	feed.DcpRequestStream(0, 0xABBA, 0, vbuuid, 0, 3, 0, 0, cid)
+	nextEvent(t, feed, transport.DCP_STREAMREQ)
+	nextEvent(t, feed, transport.DCP_SNAPSHOT)
+	e := nextEvent(t, feed, transport.DCP_MUTATION)
+	if e.CollectionID != cid || string(e.Key) != "doc" {
+		t.Errorf("Expected %v:doc, received %v:%s", cid, e.CollectionID, e.Key)
+	}
+	nextEvent(t, feed, transport.DCP_STREAMEND)
+}
@@ -0,0 +1,564 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	server "github.com/couchbase/indexing/secondary/dcp/transport/server"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/golang/snappy"
+)
+
+const (
+	snapshotMemory = uint32(0x01)
+	snapshotDisk   = uint32(0x02)
+)
+
+// kvConn is a memcached connection to a node, it is also a DCP producer
+// once the client has sent DCP_OPEN. Responses and DCP messages from
+// stream routines are serialized on the socket by `wmu`.
+type kvConn struct {
+	node *Node
+	s    net.Conn
+
+	wmu       sync.Mutex
+	closeOnce sync.Once
+
+	// following are set by the connection routine, `compression` and
+	// `collections` are negotiated before streams are requested and
+	// `streams` is guarded by the bucket lock.
+	bucket      *Bucket
+	name        string // name of DCP connection
+	compression bool
+	collections bool // keys are prefixed with collection-id
+	streams     map[uint16]*dcpStream
+}
+
+func newKVConn(node *Node, s net.Conn) *kvConn {
+	return &kvConn{node: node, s: s, streams: make(map[uint16]*dcpStream)}
+}
+
+// Read, Write and Close implement io.ReadWriteCloser for HandleIO().
+func (conn *kvConn) Read(p []byte) (int, error) {
+	return conn.s.Read(p)
+}
+
+func (conn *kvConn) Write(p []byte) (int, error) {
+	conn.wmu.Lock()
+	defer conn.wmu.Unlock()
+	return conn.s.Write(p)
+}
+
+// Close is idempotent, connections can be reset by the test.
+func (conn *kvConn) Close() error {
+	conn.closeOnce.Do(func() { conn.s.Close() })
+	return nil
+}
+
+func (conn *kvConn) run() {
+	defer conn.node.forget(conn)
+	defer conn.endStreams()
+	if b := conn.node.cluster.Bucket("default"); b != nil {
+		conn.bucket = b
+	}
+	err := server.HandleIO(conn, conn)
+	if err != nil && err != io.EOF {
+		logging.Debugf("KVEMU node %v connection %q: %v", conn.node.index, conn.name, err)
+	}
+}
+
+// HandleMessage implements server.RequestHandler{} interface, all
+// responses are transmitted by the handler itself.
+func (conn *kvConn) HandleMessage(
+	w io.Writer, req *transport.MCRequest) *transport.MCResponse {
+
+	var res *transport.MCResponse
+	switch req.Opcode {
+	case transport.HELLO:
+		res = conn.handleHello(req)
+	case transport.SASL_LIST_MECHS:
+		res = &transport.MCResponse{Body: []byte("PLAIN")}
+	case transport.SASL_AUTH:
+		res = conn.handleAuth(req)
+	case transport.SELECT_BUCKET:
+		res = conn.selectBucket(string(req.Key))
+	case transport.GET:
+		res = conn.handleGet(req)
+	case transport.SET, transport.ADD:
+		res = conn.handleStore(req)
+	case transport.DELETE:
+		res = conn.handleDelete(req)
+
+	case transport.DCP_OPEN:
+		conn.name = string(req.Key)
+		res = &transport.MCResponse{}
+	case transport.DCP_CONTROL:
+		res = conn.handleControl(req)
+	case transport.DCP_GET_SEQNO:
+		res = conn.handleGetSeqnos(req)
+	case transport.DCP_FAILOVERLOG:
+		res = conn.handleFailoverLog(req)
+	case transport.DCP_STREAMREQ:
+		res = conn.handleStreamRequest(req)
+	case transport.DCP_CLOSESTREAM:
+		res = conn.handleCloseStream(req)
+	case transport.DCP_BUFFERACK, transport.DCP_NOOP:
+		return nil // flow control is not emulated
+
+	default:
+		res = &transport.MCResponse{Status: transport.UNKNOWN_COMMAND}
+	}
+	if res != nil { // nil if already responded
+		conn.respond(req, res)
+	}
+	return nil
+}
+
+func (conn *kvConn) respond(req *transport.MCRequest, res *transport.MCResponse) {
+	res.Opcode, res.Opaque = req.Opcode, req.Opaque
+	if _, err := conn.Write(res.Bytes()); err != nil {
+		conn.Close()
+	}
+}
+
+func (conn *kvConn) send(pkt *transport.MCRequest) error {
+	_, err := conn.Write(pkt.Bytes())
+	if err != nil {
+		conn.Close()
+	}
+	return err
+}
+
+// handleHello enables the requested features that are emulated.
+func (conn *kvConn) handleHello(req *transport.MCRequest) *transport.MCResponse {
+	res := &transport.MCResponse{}
+	for i := 0; i+2 <= len(req.Body); i += 2 {
+		feature := binary.BigEndian.Uint16(req.Body[i:])
+		if feature == transport.FeatureCollections {
+			conn.collections = true
+			res.Body = append(res.Body, req.Body[i:i+2]...)
+		}
+	}
+	return res
+}
+
+func (conn *kvConn) handleAuth(req *transport.MCRequest) *transport.MCResponse {
+	// PLAIN: authzid \x00 user \x00 password
+	parts := bytes.Split(req.Body, []byte{0})
+	if len(parts) != 3 {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	if b := conn.node.cluster.Bucket(string(parts[1])); b != nil {
+		conn.bucket = b
+	}
+	return &transport.MCResponse{}
+}
+
+func (conn *kvConn) selectBucket(name string) *transport.MCResponse {
+	b := conn.node.cluster.Bucket(name)
+	if b == nil {
+		return &transport.MCResponse{Status: transport.KEY_ENOENT}
+	}
+	conn.bucket = b
+	return &transport.MCResponse{}
+}
+
+// vbucket addressed by `req`, a response if this connection can't
+// serve it.
+func (conn *kvConn) vbucket(
+	req *transport.MCRequest) (*vbucket, *transport.MCResponse) {
+
+	if conn.bucket == nil {
+		return nil, &transport.MCResponse{Status: transport.EINVAL}
+	}
+	vb, ok := conn.bucket.vbucketOn(req.VBucket, conn.node.index)
+	if !ok {
+		return nil, &transport.MCResponse{Status: transport.NOT_MY_VBUCKET}
+	}
+	return vb, nil
+}
+
+func (conn *kvConn) handleGet(req *transport.MCRequest) *transport.MCResponse {
+	b := conn.bucket
+	if b == nil {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb, res := conn.vbucket(req)
+	if res != nil {
+		return res
+	}
+	cid, key, res := conn.itemKey(req)
+	if res != nil {
+		return res
+	}
+	itm, ok := vb.docs[docKey(cid, key)]
+	if !ok || itm.opcode != transport.DCP_MUTATION {
+		return &transport.MCResponse{Status: transport.KEY_ENOENT}
+	}
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, itm.flags)
+	return &transport.MCResponse{Cas: itm.cas, Extras: extras, Body: itm.value}
+}
+
+func (conn *kvConn) handleStore(req *transport.MCRequest) *transport.MCResponse {
+	b := conn.bucket
+	if b == nil {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb, res := conn.vbucket(req)
+	if res != nil {
+		return res
+	}
+	cid, key, res := conn.itemKey(req)
+	if res != nil {
+		return res
+	}
+	prev, ok := vb.docs[docKey(cid, key)]
+	exists := ok && prev.opcode == transport.DCP_MUTATION
+	if req.Opcode == transport.ADD && exists {
+		return &transport.MCResponse{Status: transport.KEY_EEXISTS}
+	} else if req.Cas != 0 && (!exists || prev.cas != req.Cas) {
+		return &transport.MCResponse{Status: transport.KEY_EEXISTS}
+	}
+	var flags, expiry uint32
+	if len(req.Extras) >= 8 {
+		flags = binary.BigEndian.Uint32(req.Extras[:4])
+		expiry = binary.BigEndian.Uint32(req.Extras[4:8])
+	}
+	itm := b.mutateLocked(transport.DCP_MUTATION, cid, key, req.Body, flags, expiry)
+	return &transport.MCResponse{Cas: itm.cas}
+}
+
+func (conn *kvConn) handleDelete(req *transport.MCRequest) *transport.MCResponse {
+	b := conn.bucket
+	if b == nil {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb, res := conn.vbucket(req)
+	if res != nil {
+		return res
+	}
+	cid, key, res := conn.itemKey(req)
+	if res != nil {
+		return res
+	}
+	if itm, ok := vb.docs[docKey(cid, key)]; !ok || itm.opcode != transport.DCP_MUTATION {
+		return &transport.MCResponse{Status: transport.KEY_ENOENT}
+	}
+	itm := b.mutateLocked(transport.DCP_DELETION, cid, key, nil, 0, 0)
+	return &transport.MCResponse{Cas: itm.cas}
+}
+
+// itemKey returns collection-id and document id of request's key.
+func (conn *kvConn) itemKey(
+	req *transport.MCRequest) (uint32, string, *transport.MCResponse) {
+
+	if !conn.collections {
+		return transport.DefaultCollectionID, string(req.Key), nil
+	}
+	cid, docid, err := transport.SplitCollectionID(req.Key)
+	if err != nil {
+		return 0, "", &transport.MCResponse{Status: transport.EINVAL}
+	}
+	return cid, string(docid), nil
+}
+
+func (conn *kvConn) handleControl(req *transport.MCRequest) *transport.MCResponse {
+	switch string(req.Key) {
+	case "enable_value_compression":
+		conn.compression = string(req.Body) == "true"
+	}
+	return &transport.MCResponse{}
+}
+
+// handleGetSeqnos returns {vbno, seqno} of vbuckets active on this node.
+func (conn *kvConn) handleGetSeqnos(req *transport.MCRequest) *transport.MCResponse {
+	b := conn.bucket
+	if b == nil {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	body := make([]byte, 0, len(b.vbuckets)*10)
+	var entry [10]byte
+	for _, vb := range b.vbuckets {
+		if vb.node != conn.node.index {
+			continue
+		}
+		binary.BigEndian.PutUint16(entry[:2], vb.vbno)
+		binary.BigEndian.PutUint64(entry[2:], vb.seqno)
+		body = append(body, entry[:]...)
+	}
+	return &transport.MCResponse{Body: body}
+}
+
+func (conn *kvConn) handleFailoverLog(req *transport.MCRequest) *transport.MCResponse {
+	b := conn.bucket
+	if b == nil {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb, res := conn.vbucket(req)
+	if res != nil {
+		return res
+	}
+	return &transport.MCResponse{Body: encodeFailoverLog(vb.flog)}
+}
+
+// handleStreamRequest validates the request against the failover log
+// of the vbucket and spawns a routine to stream its mutations.
+func (conn *kvConn) handleStreamRequest(req *transport.MCRequest) *transport.MCResponse {
+	b := conn.bucket
+	if b == nil || len(req.Extras) < 48 {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	start := binary.BigEndian.Uint64(req.Extras[8:16])
+	end := binary.BigEndian.Uint64(req.Extras[16:24])
+	vbuuid := binary.BigEndian.Uint64(req.Extras[24:32])
+	snapStart := binary.BigEndian.Uint64(req.Extras[32:40])
+	snapEnd := binary.BigEndian.Uint64(req.Extras[40:48])
+	if start > end {
+		return &transport.MCResponse{Status: transport.ERANGE}
+	}
+	var filter []uint32
+	if conn.collections && len(req.Body) > 0 {
+		var err error
+		if filter, err = transport.DecodeCollectionsFilter(req.Body); err != nil {
+			return &transport.MCResponse{Status: transport.EINVAL}
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vb, res := conn.vbucket(req)
+	if res != nil {
+		return res
+	}
+	if s, ok := conn.streams[vb.vbno]; ok && !s.ending {
+		return &transport.MCResponse{Status: transport.KEY_EEXISTS}
+	}
+	if seqno, ok := vb.rollbackSeqno(vbuuid, start, snapStart, snapEnd); ok {
+		body := make([]byte, 8)
+		binary.BigEndian.PutUint64(body, seqno)
+		return &transport.MCResponse{Status: transport.ROLLBACK, Body: body}
+	}
+
+	s := &dcpStream{
+		conn:   conn,
+		bucket: b,
+		vb:     vb,
+		opaque: req.Opaque,
+		sent:   start,
+		end:    end,
+		filter: filter,
+		done:   make(chan struct{}),
+	}
+	conn.streams[vb.vbno] = s
+	b.addStreamLocked(s)
+	// stream starts after the response is sent, which happens before
+	// the bucket lock is released.
+	conn.respond(req, &transport.MCResponse{Body: encodeFailoverLog(vb.flog)})
+	go s.run()
+	return nil
+}
+
+func (conn *kvConn) handleCloseStream(req *transport.MCRequest) *transport.MCResponse {
+	b := conn.bucket
+	if b == nil {
+		return &transport.MCResponse{Status: transport.EINVAL}
+	}
+	b.mu.Lock()
+	s, ok := conn.streams[req.VBucket]
+	if !ok || s.ending {
+		b.mu.Unlock()
+		return &transport.MCResponse{Status: transport.KEY_ENOENT}
+	}
+	s.endLocked(streamEndSilent)
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	<-s.done // no more messages for this stream after the response
+	return &transport.MCResponse{}
+}
+
+// endStreams when the connection goes away.
+func (conn *kvConn) endStreams() {
+	b := conn.bucket
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	for _, s := range conn.streams {
+		s.endLocked(streamEndSilent)
+	}
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// streamEndSilent ends a stream without sending DCP_STREAMEND, when it
+// is closed by the client or the connection is gone.
+const streamEndSilent = ^uint32(0)
+
+// dcpStream sends mutations of a vbucket, in snapshots, on a DCP
+// connection. Fields are guarded by the bucket lock, except `sent`
+// which is owned by the stream routine.
+type dcpStream struct {
+	conn   *kvConn
+	bucket *Bucket
+	vb     *vbucket
+	opaque uint32
+	sent   uint64   // seqno of the last mutation sent
+	end    uint64   // end the stream once this seqno is sent
+	filter []uint32 // stream only these collections, if specified
+	ending bool
+	flags  uint32 // DCP_STREAMEND flags once ending
+	done   chan struct{}
+}
+
+func (s *dcpStream) endLocked(flags uint32) {
+	if !s.ending {
+		s.ending, s.flags = true, flags
+	}
+}
+
+func (s *dcpStream) run() {
+	b := s.bucket
+	defer close(s.done)
+	defer func() {
+		b.mu.Lock()
+		delete(s.vb.streams, s)
+		if s.conn.streams[s.vb.vbno] == s {
+			delete(s.conn.streams, s.vb.vbno)
+		}
+		b.mu.Unlock()
+	}()
+
+	snapType := snapshotDisk // first snapshot is a backfill
+	for {
+		if s.sent >= s.end {
+			s.sendStreamEnd(StreamEndOK)
+			return
+		}
+
+		b.mu.Lock()
+		for !s.ending && s.vb.seqno <= s.sent {
+			b.cond.Wait()
+		}
+		items := s.vb.since(s.sent, s.end)
+		ending, flags := s.ending, s.flags
+		b.mu.Unlock()
+
+		if ending {
+			if flags != streamEndSilent {
+				s.sendStreamEnd(flags)
+			}
+			return
+		}
+		if len(items) == 0 {
+			continue
+		}
+		if err := s.sendSnapshot(items, snapType); err != nil {
+			return
+		}
+		s.sent = items[len(items)-1].seqno
+		snapType = snapshotMemory
+	}
+}
+
+func (s *dcpStream) sendSnapshot(items []*item, snapType uint32) error {
+	marker := &transport.MCRequest{
+		Opcode:  transport.DCP_SNAPSHOT,
+		Opaque:  s.opaque,
+		VBucket: s.vb.vbno,
+		Extras:  make([]byte, 20),
+	}
+	binary.BigEndian.PutUint64(marker.Extras[:8], items[0].seqno)
+	binary.BigEndian.PutUint64(marker.Extras[8:16], items[len(items)-1].seqno)
+	binary.BigEndian.PutUint32(marker.Extras[16:20], snapType)
+	if err := s.conn.send(marker); err != nil {
+		return err
+	}
+	for _, itm := range items {
+		// only the default collection is streamed to legacy clients.
+		if itm.cid != transport.DefaultCollectionID && !s.conn.collections {
+			continue
+		} else if s.filter != nil && !hasCollection(s.filter, itm.cid) {
+			continue
+		}
+		if err := s.conn.send(s.mutation(itm)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasCollection(cids []uint32, cid uint32) bool {
+	for _, x := range cids {
+		if x == cid {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *dcpStream) mutation(itm *item) *transport.MCRequest {
+	pkt := &transport.MCRequest{
+		Opcode:   itm.opcode,
+		Opaque:   s.opaque,
+		VBucket:  s.vb.vbno,
+		Cas:      itm.cas,
+		Key:      itm.key,
+		Body:     itm.value,
+		Datatype: itm.datatype,
+	}
+	if s.conn.collections {
+		pkt.Key = transport.PrefixCollectionID(itm.cid, itm.key)
+	}
+	if itm.opcode == transport.DCP_MUTATION {
+		// seqno, rev-seqno, flags, expiry, lock-time, nmeta, nru
+		pkt.Extras = make([]byte, 31)
+		binary.BigEndian.PutUint32(pkt.Extras[16:20], itm.flags)
+		binary.BigEndian.PutUint32(pkt.Extras[20:24], itm.expiry)
+		if s.conn.compression && len(itm.value) > 0 {
+			pkt.Body = snappy.Encode(nil, itm.value)
+			pkt.Datatype |= transport.DatatypeSnappy
+		}
+	} else {
+		// seqno, rev-seqno, nmeta
+		pkt.Extras = make([]byte, 18)
+	}
+	binary.BigEndian.PutUint64(pkt.Extras[:8], itm.seqno)
+	binary.BigEndian.PutUint64(pkt.Extras[8:16], itm.revSeqno)
+	return pkt
+}
+
+func (s *dcpStream) sendStreamEnd(flags uint32) {
+	pkt := &transport.MCRequest{
+		Opcode:  transport.DCP_STREAMEND,
+		Opaque:  s.opaque,
+		VBucket: s.vb.vbno,
+		Extras:  make([]byte, 4),
+	}
+	binary.BigEndian.PutUint32(pkt.Extras, flags)
+	s.conn.send(pkt)
+}
+
+func encodeFailoverLog(flog [][2]uint64) []byte {
+	body := make([]byte, 16*len(flog))
+	for i, entry := range flog {
+		binary.BigEndian.PutUint64(body[i*16:], entry[0])
+		binary.BigEndian.PutUint64(body[i*16+8:], entry[1])
+	}
+	return body
+}
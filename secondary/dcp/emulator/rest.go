@@ -0,0 +1,219 @@
+package emulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// restHandler serves the subset of ns_server REST API used by the dcp
+// package and cluster-info, every node serves the same cluster with its
+// own `thisNode`.
+func (node *Node) restHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pools", node.handlePools)
+	mux.HandleFunc("/pools/default", node.handlePool)
+	mux.HandleFunc("/pools/default/buckets", node.handleBuckets)
+	mux.HandleFunc("/pools/default/buckets/", node.handleBucket)
+	mux.HandleFunc("/pools/default/b/", node.handleBucket)
+	mux.HandleFunc("/pools/default/nodeServices", node.handleNodeServices)
+	mux.HandleFunc("/pools/default/serverGroups", node.handleServerGroups)
+	mux.HandleFunc("/poolsStreaming/default",
+		node.streaming(func() interface{} { return node.pool() }))
+	mux.HandleFunc("/pools/default/nodeServicesStreaming",
+		node.streaming(func() interface{} { return node.nodeServices() }))
+	mux.HandleFunc("/pools/default/bucketsStreaming/",
+		func(w http.ResponseWriter, r *http.Request) {
+			name := strings.TrimPrefix(r.URL.Path, "/pools/default/bucketsStreaming/")
+			b := node.cluster.Bucket(name)
+			if b == nil {
+				http.NotFound(w, r)
+				return
+			}
+			node.streaming(func() interface{} { return node.bucketInfo(b) })(w, r)
+		})
+	return mux
+}
+
+func (node *Node) handlePools(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"isAdminCreds":          true,
+		"uuid":                  node.cluster.uuid,
+		"implementationVersion": "5.0.0-0000-enterprise",
+		"pools": []map[string]interface{}{{
+			"name":         "default",
+			"uri":          "/pools/default",
+			"streamingUri": "/poolsStreaming/default",
+		}},
+	})
+}
+
+func (node *Node) handlePool(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, node.pool())
+}
+
+func (node *Node) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets := node.cluster.bucketList()
+	infos := make([]interface{}, 0, len(buckets))
+	for _, b := range buckets {
+		infos = append(infos, node.bucketInfo(b))
+	}
+	writeJSON(w, infos)
+}
+
+func (node *Node) handleBucket(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	collections := strings.HasSuffix(path, "/collections")
+	if collections {
+		path = strings.TrimSuffix(path, "/collections")
+	}
+	name := path[strings.LastIndex(path, "/")+1:]
+	b := node.cluster.Bucket(name)
+	if b == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if collections {
+		writeJSON(w, b.manifestJSON())
+		return
+	}
+	writeJSON(w, node.bucketInfo(b))
+}
+
+func (node *Node) handleNodeServices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, node.nodeServices())
+}
+
+func (node *Node) handleServerGroups(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"groups": []map[string]interface{}{{
+			"name":  "Group 1",
+			"nodes": node.nodeList(),
+		}},
+	})
+}
+
+// streaming endpoints send the current value and then a new value on
+// every change in cluster topology, separated by empty lines.
+func (node *Node) streaming(value func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		for {
+			_, changed := node.cluster.revision()
+			data, err := json.Marshal(value())
+			if err != nil {
+				return
+			}
+			data = append(data, "\n\n\n\n"...)
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+func (node *Node) pool() map[string]interface{} {
+	return map[string]interface{}{
+		"name":  "default",
+		"nodes": node.nodeList(),
+		"buckets": map[string]string{
+			"uri":              "/pools/default/buckets",
+			"terseBucketsBase": "/pools/default/b/",
+		},
+		"serverGroupsUri": "/pools/default/serverGroups",
+	}
+}
+
+func (node *Node) nodeList() []map[string]interface{} {
+	nodes := make([]map[string]interface{}, 0, len(node.cluster.nodes))
+	for _, n := range node.cluster.nodes {
+		services := n.serviceMap()
+		names := make([]string, 0, len(services))
+		for name := range services {
+			if name != "mgmt" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		nodes = append(nodes, map[string]interface{}{
+			"hostname":             n.RestAddr(),
+			"couchApiBase":         "http://" + n.RestAddr() + "/",
+			"clusterMembership":    "active",
+			"clusterCompatibility": 0x50000,
+			"status":               "healthy",
+			"version":              "5.0.0-0000-enterprise",
+			"thisNode":             n == node,
+			"services":             names,
+			"ports":                map[string]int{"direct": services["kv"]},
+		})
+	}
+	return nodes
+}
+
+func (node *Node) nodeServices() map[string]interface{} {
+	rev, _ := node.cluster.revision()
+	nodesExt := make([]map[string]interface{}, 0, len(node.cluster.nodes))
+	for _, n := range node.cluster.nodes {
+		nodesExt = append(nodesExt, map[string]interface{}{
+			"hostname": "127.0.0.1",
+			"thisNode": n == node,
+			"services": n.serviceMap(),
+		})
+	}
+	return map[string]interface{}{"rev": rev, "nodesExt": nodesExt}
+}
+
+func (node *Node) bucketInfo(b *Bucket) map[string]interface{} {
+	serverList := make([]string, 0, len(node.cluster.nodes))
+	for _, n := range node.cluster.nodes {
+		serverList = append(serverList, n.KVAddr())
+	}
+	vbmap := b.vbmap()
+	vBucketMap := make([][]int, len(vbmap))
+	for vbno, master := range vbmap {
+		vBucketMap[vbno] = []int{master}
+	}
+	return map[string]interface{}{
+		"name":                  b.name,
+		"uuid":                  b.uuid,
+		"bucketType":            "membase",
+		"authType":              "sasl",
+		"saslPassword":          "",
+		"nodeLocator":           "vbucket",
+		"replicaNumber":         0,
+		"uri":                   "/pools/default/buckets/" + b.name + "?bucket_uuid=" + b.uuid,
+		"streamingUri":          "/pools/default/bucketsStreaming/" + b.name + "?bucket_uuid=" + b.uuid,
+		"bucketCapabilities":    []string{"dcp", "xattr", "cccp", "nodesExt"},
+		"bucketCapabilitiesVer": "",
+		"nodes":                 node.nodeList(),
+		"vBucketServerMap": map[string]interface{}{
+			"hashAlgorithm": "CRC",
+			"numReplicas":   0,
+			"serverList":    serverList,
+			"vBucketMap":    vBucketMap,
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/couchbase/indexing/secondary/dcp/transport"
 	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/golang/snappy"
 	"io"
 	"strconv"
 	"time"
@@ -45,6 +46,12 @@ type DcpFeed struct {
 	maxAckBytes uint32   // Max buffer control ack bytes
 	stats       DcpStats // Stats for dcp client
 	dcplatency  *Average
+	// negotiate extended attributes, compression and collections with
+	// the producer
+	includeXATTRs    bool
+	compression      bool
+	collectionsAware bool
+	collections      bool // keys are prefixed with collection-id
 }
 
 // NewDcpFeed creates a new DCP Feed.
@@ -64,6 +71,29 @@ func NewDcpFeed(
 		logPrefix:  fmt.Sprintf("DCPT[%s]", name),
 		dcplatency: &Average{},
 	}
+	if val, ok := config["includeXATTRs"]; ok && val != nil {
+		feed.includeXATTRs = val.(bool)
+	}
+	if val, ok := config["compression"]; ok && val != nil {
+		feed.compression = val.(bool)
+	}
+	if val, ok := config["collectionsAware"]; ok && val != nil {
+		feed.collectionsAware = val.(bool)
+	}
+	if feed.collectionsAware {
+		features, err := mc.Hello(name, transport.FeatureCollections)
+		if err != nil {
+			fmsg := "%v ##%x HELLO: %v"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, err)
+			return nil, err
+		}
+		for _, feature := range features {
+			feed.collections = feed.collections ||
+				feature == transport.FeatureCollections
+		}
+		fmsg := "%v ##%x collections negotiated: %v"
+		logging.Infof(fmsg, feed.logPrefix, opaque, feed.collections)
+	}
 
 	mc.Hijack()
 	feed.conn = mc
@@ -113,14 +143,16 @@ func (feed *DcpFeed) DcpGetSeqnos() (map[uint16]uint64, error) {
 	return resp[0].(map[uint16]uint64), nil
 }
 
-// DcpRequestStream for a single vbucket.
+// DcpRequestStream for a single vbucket. On collections aware feeds,
+// `collections`, if specified, restricts the stream to their documents.
 func (feed *DcpFeed) DcpRequestStream(vbno, opaqueMSB uint16, flags uint32,
-	vuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
+	vuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collections ...uint32) error {
 
 	respch := make(chan []interface{}, 1)
 	cmd := []interface{}{
 		dfCmdRequestStream, vbno, opaqueMSB, flags, vuuid,
-		startSequence, endSequence, snapStart, snapEnd, respch}
+		startSequence, endSequence, snapStart, snapEnd, collections, respch}
 	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
 	return opError(err, resp, 0)
 }
@@ -214,10 +246,11 @@ loop:
 				flags, vuuid := msg[3].(uint32), msg[4].(uint64)
 				startSequence, endSequence := msg[5].(uint64), msg[6].(uint64)
 				snapStart, snapEnd := msg[7].(uint64), msg[8].(uint64)
-				respch := msg[9].(chan []interface{})
+				collections := msg[9].([]uint32)
+				respch := msg[10].(chan []interface{})
 				err := feed.doDcpRequestStream(
 					vbno, opaqueMSB, flags, vuuid,
-					startSequence, endSequence, snapStart, snapEnd)
+					startSequence, endSequence, snapStart, snapEnd, collections)
 				respch <- []interface{}{err}
 
 			case dfCmdCloseStream:
@@ -291,6 +324,17 @@ func (feed *DcpFeed) handlePacket(
 		transport.DCP_EXPIRATION:
 		event = newDcpEvent(pkt, stream)
 		stream.Seqno = event.Seqno
+		if feed.collections {
+			// without its collection-id the item cannot be routed to
+			// indexes, drop it rather than treat it as a default
+			// collection item.
+			if err := event.splitCollectionID(); err != nil {
+				fmsg := "%v ##%x vb:%v seqno:%v dropped: %v"
+				logging.Errorf(fmsg, prefix, stream.AppOpaque, vb, event.Seqno, err)
+				event, sendAck = nil, true
+				break
+			}
+		}
 		feed.stats.TotalMutation++
 		sendAck = true
 
@@ -346,6 +390,13 @@ func (feed *DcpFeed) handlePacket(
 			logging.Errorf("%v NOOP.Transmit(): %v", prefix, err)
 		}
 
+	case transport.DCP_SYSTEM_EVENT, transport.DCP_SEQNO_ADVANCED:
+		// collections aware feeds see collection life-cycle events, index
+		// definitions carry their collection-id, consume and acknowledge.
+		sendAck = true
+		fmsg := "%v ##%x opcode %v for vb %d\n"
+		logging.Debugf(fmsg, prefix, stream.AppOpaque, pkt.Opcode, vb)
+
 	case transport.DCP_ADDSTREAM:
 		fmsg := "%v ##%x opcode DCP_ADDSTREAM not implemented\n"
 		logging.Fatalf(fmsg, prefix, stream.AppOpaque)
@@ -477,9 +528,13 @@ func (feed *DcpFeed) doDcpOpen(
 		Key:    []byte(name),
 		Opaque: opaqueOpen,
 	}
+	flags := transport.DCP_OPEN_PRODUCER // we are consumer
+	if feed.includeXATTRs {
+		flags |= transport.DCP_OPEN_INCLUDE_XATTRS
+	}
 	rq.Extras = make([]byte, 8)
 	binary.BigEndian.PutUint32(rq.Extras[:4], sequence)
-	binary.BigEndian.PutUint32(rq.Extras[4:], 1) // we are consumer
+	binary.BigEndian.PutUint32(rq.Extras[4:], flags)
 
 	prefix := feed.logPrefix
 	if err := feed.conn.Transmit(rq); err != nil {
@@ -516,49 +571,72 @@ func (feed *DcpFeed) doDcpOpen(
 	// send a DCP control message to set the window size for
 	// this connection
 	if bufsize > 0 {
-		rq := &transport.MCRequest{
-			Opcode: transport.DCP_CONTROL,
-			Key:    []byte("connection_buffer_size"),
-			Body:   []byte(strconv.Itoa(int(bufsize))),
-		}
-		if err := feed.conn.Transmit(rq); err != nil {
-			fmsg := "%v ##%x doDcpOpen.DCP_CONTROL.Transmit(): %v"
-			logging.Errorf(fmsg, prefix, opaque, err)
+		body := []byte(strconv.Itoa(int(bufsize)))
+		err := feed.doDcpControl("connection_buffer_size", body, opaque, rcvch)
+		if err != nil {
 			return err
 		}
-		msg, ok := <-rcvch
-		if !ok {
-			fmsg := "%v ##%x doDcpOpen.DCP_CONTROL.rcvch closed"
-			logging.Errorf(fmsg, prefix, opaque)
-			return ErrorConnection
-		}
-		pkt := msg[0].(*transport.MCRequest)
-		req := &transport.MCResponse{
-			Opcode: pkt.Opcode,
-			Cas:    pkt.Cas,
-			Opaque: pkt.Opaque,
-			Status: transport.Status(pkt.VBucket),
-			Extras: pkt.Extras,
-			Key:    pkt.Key,
-			Body:   pkt.Body,
-		}
-		if req.Opcode != transport.DCP_CONTROL {
-			fmsg := "%v ##%x DCP_CONTROL != #%v"
-			logging.Errorf(fmsg, prefix, opaque, req.Opcode)
-			return ErrorConnection
-		} else if req.Status != transport.SUCCESS {
-			fmsg := "%v ##%x doDcpOpen response status %v"
-			logging.Errorf(fmsg, prefix, opaque, req.Status)
-			return ErrorConnection
-		}
 		feed.maxAckBytes = uint32(bufferAckThreshold * float32(bufsize))
 	}
+	// ask the producer to send document values snappy compressed, they
+	// are decompressed on demand by DcpEvent.Decompress().
+	if feed.compression {
+		body := []byte("true")
+		err := feed.doDcpControl("enable_value_compression", body, opaque, rcvch)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (feed *DcpFeed) doDcpControl(
+	key string, body []byte, opaque uint16,
+	rcvch chan []interface{}) error {
+
+	prefix := feed.logPrefix
+	rq := &transport.MCRequest{
+		Opcode: transport.DCP_CONTROL,
+		Key:    []byte(key),
+		Body:   body,
+	}
+	if err := feed.conn.Transmit(rq); err != nil {
+		fmsg := "%v ##%x doDcpOpen.DCP_CONTROL.Transmit(%q): %v"
+		logging.Errorf(fmsg, prefix, opaque, key, err)
+		return err
+	}
+	msg, ok := <-rcvch
+	if !ok {
+		fmsg := "%v ##%x doDcpOpen.DCP_CONTROL.rcvch closed"
+		logging.Errorf(fmsg, prefix, opaque)
+		return ErrorConnection
+	}
+	pkt := msg[0].(*transport.MCRequest)
+	req := &transport.MCResponse{
+		Opcode: pkt.Opcode,
+		Cas:    pkt.Cas,
+		Opaque: pkt.Opaque,
+		Status: transport.Status(pkt.VBucket),
+		Extras: pkt.Extras,
+		Key:    pkt.Key,
+		Body:   pkt.Body,
+	}
+	if req.Opcode != transport.DCP_CONTROL {
+		fmsg := "%v ##%x DCP_CONTROL != #%v"
+		logging.Errorf(fmsg, prefix, opaque, req.Opcode)
+		return ErrorConnection
+	} else if req.Status != transport.SUCCESS {
+		fmsg := "%v ##%x doDcpOpen DCP_CONTROL %q response status %v"
+		logging.Errorf(fmsg, prefix, opaque, key, req.Status)
+		return ErrorConnection
+	}
 	return nil
 }
 
 func (feed *DcpFeed) doDcpRequestStream(
 	vbno, opaqueMSB uint16, flags uint32,
-	vuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
+	vuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collections []uint32) error {
 
 	rq := &transport.MCRequest{
 		Opcode:  transport.DCP_STREAMREQ,
@@ -573,6 +651,9 @@ func (feed *DcpFeed) doDcpRequestStream(
 	binary.BigEndian.PutUint64(rq.Extras[24:32], vuuid)
 	binary.BigEndian.PutUint64(rq.Extras[32:40], snapStart)
 	binary.BigEndian.PutUint64(rq.Extras[40:48], snapEnd)
+	if feed.collections && len(collections) > 0 {
+		rq.Body = transport.EncodeCollectionsFilter(collections)
+	}
 
 	prefix := feed.logPrefix
 	if err := feed.conn.Transmit(rq); err != nil {
@@ -727,6 +808,8 @@ type DcpEvent struct {
 	VBuuid     uint64                // This field is set by downstream
 	Key, Value []byte                // Item key/value
 	OldValue   []byte                // TODO: TBD: old document value
+	Datatype   uint8                 // Datatype bits of the item
+	XATTRs     []byte                // extended attributes section, if any
 	Cas        uint64                // CAS value of the item
 	// meta fields
 	Seqno uint64 // seqno. of the mutation, doubles as rollback-seqno
@@ -736,6 +819,8 @@ type DcpEvent struct {
 	Expiry   uint32 // Item expiration time
 	LockTime uint32
 	Nru      byte
+	// collections
+	CollectionID uint32 // collection of the item, on collections aware feeds
 	// snapshots
 	SnapstartSeq uint64 // start sequence number of this snapshot
 	SnapendSeq   uint64 // End sequence number of the snapshot
@@ -759,6 +844,16 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) *DcpEvent {
 	copy(event.Key, rq.Key)
 	event.Value = make([]byte, len(rq.Body))
 	copy(event.Value, rq.Body)
+	event.Datatype = rq.Datatype
+
+	// compressed values, along with their extended attributes, are left
+	// as is until Decompress() is called.
+	if event.Datatype&transport.DatatypeSnappy == 0 {
+		if err := event.splitXATTRs(); err != nil {
+			fmsg := "DCPT vb:%v invalid xattrs: %v"
+			logging.Errorf(fmsg, stream.Vbucket, err)
+		}
+	}
 
 	// 16 LSBits are used by client library to encode vbucket number.
 	// 16 MSBits are left for application to multiplex on opaque value.
@@ -792,6 +887,62 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) *DcpEvent {
 	return event
 }
 
+// IsCompressed returns whether the item's value is snappy compressed.
+func (event *DcpEvent) IsCompressed() bool {
+	return event.Datatype&transport.DatatypeSnappy != 0
+}
+
+// DecodedLen returns the length of the item's value, along with its
+// extended attributes, once decompressed.
+func (event *DcpEvent) DecodedLen() int {
+	if event.IsCompressed() {
+		n, err := snappy.DecodedLen(event.Value)
+		if err != nil {
+			return len(event.Value)
+		}
+		return n
+	}
+	return len(event.Value) + len(event.XATTRs)
+}
+
+// Decompress the item's value if it was sent snappy compressed and
+// split its extended attributes, if any. Subsequent calls are no-op.
+func (event *DcpEvent) Decompress() error {
+	if !event.IsCompressed() {
+		return nil
+	}
+	value, err := snappy.Decode(nil, event.Value)
+	if err != nil {
+		return err
+	}
+	event.Value = value
+	event.Datatype &^= transport.DatatypeSnappy
+	return event.splitXATTRs()
+}
+
+// on collections aware connections collection-id precedes the key.
+func (event *DcpEvent) splitCollectionID() error {
+	cid, docid, err := transport.SplitCollectionID(event.Key)
+	if err != nil {
+		return err
+	}
+	event.CollectionID, event.Key = cid, docid
+	return nil
+}
+
+// extended attributes precede the document value.
+func (event *DcpEvent) splitXATTRs() error {
+	if event.Datatype&transport.DatatypeXATTR == 0 {
+		return nil
+	}
+	xattrs, value, err := transport.SplitXATTRs(event.Value)
+	if err != nil {
+		return err
+	}
+	event.XATTRs, event.Value = xattrs, value
+	return nil
+}
+
 func (event *DcpEvent) String() string {
 	name := transport.CommandNames[event.Opcode]
 	if name == "" {
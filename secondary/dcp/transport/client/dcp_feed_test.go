@@ -0,0 +1,47 @@
+package memcached
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	"github.com/golang/snappy"
+)
+
+func TestDcpEventDecompress(t *testing.T) {
+	pair := []byte("\x00\x00\x00\x0etenant\x00\"acme\"\x00")
+	body := make([]byte, 4, 64)
+	binary.BigEndian.PutUint32(body, uint32(len(pair)))
+	body = append(body, pair...)
+	body = append(body, `{"name":"doc"}`...)
+
+	rq := &transport.MCRequest{
+		Opcode:   transport.DCP_MUTATION,
+		Key:      []byte("doc"),
+		Body:     snappy.Encode(nil, body),
+		Datatype: transport.DatatypeSnappy | transport.DatatypeXATTR,
+	}
+	event := newDcpEvent(rq, &DcpStream{Vbucket: 1})
+	if !event.IsCompressed() || event.XATTRs != nil {
+		t.Fatalf("Expected value to be left compressed")
+	}
+	if n := event.DecodedLen(); n != len(body) {
+		t.Errorf("Expected decoded length %v, received %v", len(body), n)
+	}
+
+	if err := event.Decompress(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if event.IsCompressed() || string(event.Value) != `{"name":"doc"}` ||
+		string(event.XATTRs) != string(pair) {
+		t.Errorf("Unexpected value %q xattrs %q", event.Value, event.XATTRs)
+	}
+	if err := event.Decompress(); err != nil || string(event.Value) != `{"name":"doc"}` {
+		t.Errorf("Expected decompress to be idempotent, %v %q", err, event.Value)
+	}
+
+	rq.Body = []byte("not snappy")
+	if err := newDcpEvent(rq, &DcpStream{}).Decompress(); err == nil {
+		t.Errorf("Expected error for corrupt value")
+	}
+}
@@ -151,6 +151,27 @@ func (c *Client) SelectBucket(bucket string) (*transport.MCResponse, error) {
 		Key:    []byte(fmt.Sprintf("%s", bucket))})
 }
 
+// Hello negotiates `features` for this connection, returns the subset
+// of features enabled by the server.
+func (c *Client) Hello(name string, features ...uint16) ([]uint16, error) {
+	body := make([]byte, 2*len(features))
+	for i, feature := range features {
+		binary.BigEndian.PutUint16(body[2*i:], feature)
+	}
+	res, err := c.Send(&transport.MCRequest{
+		Opcode: transport.HELLO,
+		Key:    []byte(name),
+		Body:   body})
+	if err != nil {
+		return nil, err
+	}
+	enabled := make([]uint16, 0, len(res.Body)/2)
+	for i := 0; i+2 <= len(res.Body); i += 2 {
+		enabled = append(enabled, binary.BigEndian.Uint16(res.Body[i:]))
+	}
+	return enabled, nil
+}
+
 func (c *Client) store(opcode transport.CommandCode, vb uint16,
 	key string, flags int, exp int, body []byte) (*transport.MCResponse, error) {
 
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// DefaultCollectionID is the id of `_default` collection in `_default`
+// scope, holding documents of buckets that do not use collections.
+const DefaultCollectionID = uint32(0)
+
+// SplitCollectionID splits the key of a packet, on a connection that has
+// negotiated FeatureCollections, into its collection-id and document id.
+//
+//	unsigned LEB128 collection-id
+//	document id
+func SplitCollectionID(key []byte) (cid uint32, docid []byte, err error) {
+	var shift uint
+	for i, b := range key {
+		if shift >= 32 {
+			break
+		}
+		cid |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return cid, key[i+1:], nil
+		}
+		shift += 7
+	}
+	return 0, nil, fmt.Errorf("invalid collection-id prefix in key %q", key)
+}
+
+// PrefixCollectionID encodes collection-id `cid` ahead of document id
+// `docid`, the inverse of SplitCollectionID.
+func PrefixCollectionID(cid uint32, docid []byte) []byte {
+	key := make([]byte, 0, len(docid)+5)
+	for cid >= 0x80 {
+		key = append(key, byte(cid)|0x80)
+		cid >>= 7
+	}
+	key = append(key, byte(cid))
+	return append(key, docid...)
+}
+
+// collectionsFilter is the value of DCP_STREAMREQ that restricts a stream
+// to documents of the listed collections, ids are in hex.
+type collectionsFilter struct {
+	Collections []string `json:"collections"`
+}
+
+// EncodeCollectionsFilter returns the DCP_STREAMREQ value that streams
+// only documents of collections `cids`.
+func EncodeCollectionsFilter(cids []uint32) []byte {
+	filter := collectionsFilter{Collections: make([]string, 0, len(cids))}
+	for _, cid := range cids {
+		filter.Collections = append(
+			filter.Collections, strconv.FormatUint(uint64(cid), 16))
+	}
+	value, _ := json.Marshal(&filter)
+	return value
+}
+
+// DecodeCollectionsFilter returns the collections of a DCP_STREAMREQ
+// value, the inverse of EncodeCollectionsFilter.
+func DecodeCollectionsFilter(value []byte) ([]uint32, error) {
+	var filter collectionsFilter
+	if err := json.Unmarshal(value, &filter); err != nil {
+		return nil, err
+	}
+	cids := make([]uint32, 0, len(filter.Collections))
+	for _, s := range filter.Collections {
+		cid, err := strconv.ParseUint(s, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection-id %q in filter", s)
+		}
+		cids = append(cids, uint32(cid))
+	}
+	return cids, nil
+}
@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollectionID(t *testing.T) {
+	for _, cid := range []uint32{0, 8, 0x7f, 0x80, 0x3fff, 0x4000, 0xffffffff} {
+		key := PrefixCollectionID(cid, []byte("doc1"))
+		rcid, docid, err := SplitCollectionID(key)
+		if err != nil {
+			t.Fatalf("cid:%x unexpected error %v", cid, err)
+		}
+		if rcid != cid || string(docid) != "doc1" {
+			t.Errorf("cid:%x received %x %q", cid, rcid, docid)
+		}
+	}
+
+	key := PrefixCollectionID(0x80, nil)
+	if len(key) != 2 || key[0] != 0x80 || key[1] != 0x01 {
+		t.Errorf("Unexpected encoding %x", key)
+	}
+	if _, _, err := SplitCollectionID([]byte{0x80, 0x80}); err == nil {
+		t.Errorf("Expected error for truncated prefix")
+	}
+	if _, _, err := SplitCollectionID(nil); err == nil {
+		t.Errorf("Expected error for empty key")
+	}
+}
+
+func TestCollectionsFilter(t *testing.T) {
+	cids := []uint32{0, 8, 0x1a}
+	value := EncodeCollectionsFilter(cids)
+	if expected := `{"collections":["0","8","1a"]}`; string(value) != expected {
+		t.Errorf("Expected %v, received %s", expected, value)
+	}
+	rcids, err := DecodeCollectionsFilter(value)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(rcids, cids) {
+		t.Errorf("Expected %v, received %v", cids, rcids)
+	}
+	if _, err := DecodeCollectionsFilter([]byte(`{"collections":["xyz"]}`)); err == nil {
+		t.Errorf("Expected error for invalid collection-id")
+	}
+}
@@ -54,6 +54,7 @@ const (
 	RINCRQ     = CommandCode(0x3a)
 	RDECR      = CommandCode(0x3b)
 	RDECRQ     = CommandCode(0x3c)
+	HELLO      = CommandCode(0x1f) // negotiate features of the connection
 
 	SASL_LIST_MECHS = CommandCode(0x20)
 	SASL_AUTH       = CommandCode(0x21)
@@ -84,11 +85,32 @@ const (
 	DCP_BUFFERACK   = CommandCode(0x5d) // DCP Buffer Acknowledgement
 	DCP_CONTROL     = CommandCode(0x5e) // Set flow control params
 
+	DCP_SYSTEM_EVENT   = CommandCode(0x5f) // Collection created or dropped
+	DCP_SEQNO_ADVANCED = CommandCode(0x64) // Seqno moved past filtered out items
+
 	SELECT_BUCKET = CommandCode(0x89) // Select bucket
 
 	OBSERVE = CommandCode(0x92)
 )
 
+// Datatype bits of memcached packets.
+const (
+	DatatypeJSON   = uint8(0x01) // body is JSON
+	DatatypeSnappy = uint8(0x02) // body is snappy compressed
+	DatatypeXATTR  = uint8(0x04) // body starts with extended attributes
+)
+
+// Flags of DCP_OPEN request.
+const (
+	DCP_OPEN_PRODUCER       = uint32(0x01) // server produces, client consumes
+	DCP_OPEN_INCLUDE_XATTRS = uint32(0x04) // send extended attributes
+)
+
+// Features negotiated with HELLO.
+const (
+	FeatureCollections = uint16(0x12) // keys are prefixed with collection-id
+)
+
 // Status field for memcached response.
 type Status uint16
 
@@ -166,6 +188,7 @@ func init() {
 	CommandNames[RINCRQ] = "RINCRQ"
 	CommandNames[RDECR] = "RDECR"
 	CommandNames[RDECRQ] = "RDECRQ"
+	CommandNames[HELLO] = "HELLO"
 
 	CommandNames[SASL_LIST_MECHS] = "SASL_LIST_MECHS"
 	CommandNames[SASL_AUTH] = "SASL_AUTH"
@@ -194,6 +217,8 @@ func init() {
 	CommandNames[DCP_NOOP] = "DCP_NOOP"
 	CommandNames[DCP_BUFFERACK] = "DCP_BUFFERACK"
 	CommandNames[DCP_CONTROL] = "DCP_CONTROL"
+	CommandNames[DCP_SYSTEM_EVENT] = "DCP_SYSTEM_EVENT"
+	CommandNames[DCP_SEQNO_ADVANCED] = "DCP_SEQNO_ADVANCED"
 	CommandNames[DCP_GET_SEQNO] = "DCP_GET_SEQNO"
 
 	StatusNames = make(map[Status]string)
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// SplitXATTRs splits the body of a packet with DatatypeXATTR into its
+// extended attributes section and the document value.
+//
+//	uint32 length of the section, followed by the section
+//	document value
+func SplitXATTRs(body []byte) (xattrs, value []byte, err error) {
+	if len(body) < 4 {
+		return nil, nil, fmt.Errorf("xattr section too short: %d", len(body))
+	}
+	n := int(binary.BigEndian.Uint32(body))
+	if n > len(body)-4 {
+		return nil, nil, fmt.Errorf("xattr section length %d exceeds body", n)
+	}
+	return body[4 : 4+n], body[4+n:], nil
+}
+
+// ParseXATTRs parses the extended attributes section of a document into
+// the JSON value of each attribute.
+//
+//	repeated for each attribute:
+//	  uint32 length of the pair, followed by
+//	  key, 0x00, JSON value, 0x00
+func ParseXATTRs(section []byte) (map[string][]byte, error) {
+	xattrs := make(map[string][]byte)
+	for len(section) > 0 {
+		if len(section) < 4 {
+			return nil, fmt.Errorf("xattr pair too short: %d", len(section))
+		}
+		n := int(binary.BigEndian.Uint32(section))
+		if n > len(section)-4 {
+			return nil, fmt.Errorf("xattr pair length %d exceeds section", n)
+		}
+		pair := section[4 : 4+n]
+		section = section[4+n:]
+
+		i := bytes.IndexByte(pair, 0)
+		if i < 0 || len(pair) < i+2 || pair[len(pair)-1] != 0 {
+			return nil, fmt.Errorf("malformed xattr pair %q", pair)
+		}
+		xattrs[string(pair[:i])] = pair[i+1 : len(pair)-1]
+	}
+	return xattrs, nil
+}
@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func xattrPair(key, value string) []byte {
+	pair := make([]byte, 4, 4+len(key)+len(value)+2)
+	pair = append(pair, key...)
+	pair = append(pair, 0)
+	pair = append(pair, value...)
+	pair = append(pair, 0)
+	binary.BigEndian.PutUint32(pair, uint32(len(pair)-4))
+	return pair
+}
+
+func TestXATTRs(t *testing.T) {
+	section := append(xattrPair("_sync", `{"rev":"1-a"}`), xattrPair("tenant", `"acme"`)...)
+	body := make([]byte, 4, 4+len(section)+16)
+	binary.BigEndian.PutUint32(body, uint32(len(section)))
+	body = append(body, section...)
+	body = append(body, `{"name":"doc"}`...)
+
+	xattrs, value, err := SplitXATTRs(body)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(value) != `{"name":"doc"}` {
+		t.Errorf("Unexpected document value %s", value)
+	}
+
+	attrs, err := ParseXATTRs(xattrs)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(attrs) != 2 || string(attrs["_sync"]) != `{"rev":"1-a"}` ||
+		string(attrs["tenant"]) != `"acme"` {
+		t.Errorf("Unexpected xattrs %q", attrs)
+	}
+
+	if _, _, err := SplitXATTRs(body[:len(section)]); err == nil {
+		t.Errorf("Expected error for truncated body")
+	}
+	if _, err := ParseXATTRs(section[:len(section)-1]); err == nil {
+		t.Errorf("Expected error for truncated section")
+	}
+}
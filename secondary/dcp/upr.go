@@ -137,6 +137,9 @@ func (b *Bucket) StartDcpFeed(
 //      "genChanSize", buffer channel size for control path.
 //      "dataChanSize", buffer channel size for data path.
 //      "numConnections", number of connections with DCP for local vbuckets.
+//      "includeXATTRs", optional, receive extended attributes of documents.
+//      "compression", optional, receive snappy compressed document values.
+//      "collectionsAware", optional, receive collection-id of documents.
 func (b *Bucket) StartDcpFeedOver(
 	name DcpFeedName,
 	sequence uint32,
@@ -175,16 +178,18 @@ const (
 
 // DcpRequestStream starts a stream for a vb on a feed
 // and immediately returns, it is upto the channel listener
-// to detect StreamBegin.
+// to detect StreamBegin. `collections`, if specified, restricts
+// collections aware feeds to documents of those collections.
 // Synchronous call.
 func (feed *DcpFeed) DcpRequestStream(
 	vb uint16, opaque uint16, flags uint32,
-	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
+	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collections ...uint32) error {
 
 	respch := make(chan []interface{}, 1)
 	cmd := []interface{}{
 		ufCmdRequestStream, vb, opaque, flags, vbuuid, startSequence,
-		endSequence, snapStart, snapEnd, respch}
+		endSequence, snapStart, snapEnd, collections, respch}
 	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
 	return opError(err, resp, 0)
 }
@@ -255,10 +260,11 @@ loop:
 				flags, vbuuid := msg[3].(uint32), msg[4].(uint64)
 				startSeq, endSeq := msg[5].(uint64), msg[6].(uint64)
 				snapStart, snapEnd := msg[7].(uint64), msg[8].(uint64)
+				collections := msg[9].([]uint32)
 				err := feed.dcpRequestStream(
 					vb, opaque, flags, vbuuid, startSeq, endSeq,
-					snapStart, snapEnd)
-				respch := msg[9].(chan []interface{})
+					snapStart, snapEnd, collections)
+				respch := msg[10].(chan []interface{})
 				respch <- []interface{}{err}
 
 			case ufCmdCloseStream:
@@ -340,7 +346,8 @@ func (feed *DcpFeed) connectToNodes(
 
 func (feed *DcpFeed) dcpRequestStream(
 	vb uint16, opaque uint16, flags uint32,
-	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
+	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collections []uint32) error {
 
 	prefix := feed.logPrefix
 	vbm := feed.bucket.VBServerMap()
@@ -371,7 +378,7 @@ func (feed *DcpFeed) dcpRequestStream(
 		}
 		err = singleFeed.dcpFeed.DcpRequestStream(
 			vb, opaque, flags, vbuuid, startSequence, endSequence,
-			snapStart, snapEnd)
+			snapStart, snapEnd, collections...)
 		if err != nil {
 			fmsg := "%v ##%x DcpFeed %v failed, trying next"
 			logging.Errorf(fmsg, prefix, opaque, singleFeed.dcpFeed.Name())
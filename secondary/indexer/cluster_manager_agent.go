@@ -371,7 +371,7 @@ func (meta *metaNotifier) OnIndexCreate(indexDefn *common.IndexDefn, instId comm
 	logging.Infof("clustMgrAgent::OnIndexCreate Notification "+
 		"Received for Create Index %v", indexDefn)
 
-	pc := meta.makeDefaultPartitionContainer()
+	pc := meta.makeDefaultPartitionContainer(indexDefn, replicaId)
 
 	idxInst := common.IndexInst{InstId: instId,
 		Defn:      *indexDefn,
@@ -518,12 +518,17 @@ func (meta *metaNotifier) OnIndexDelete(instId common.IndexInstId, bucket string
 	return nil
 }
 
-func (meta *metaNotifier) makeDefaultPartitionContainer() common.PartitionContainer {
+func (meta *metaNotifier) makeDefaultPartitionContainer(
+	indexDefn *common.IndexDefn, replicaId int) common.PartitionContainer {
+
+	addr := net.JoinHostPort("", meta.config["streamMaintPort"].String())
+	if indexDefn.IsPartitioned() {
+		return makePartitionContainer(indexDefn, addr, replicaId)
+	}
 
 	pc := common.NewKeyPartitionContainer()
 
 	//Add one partition for now
-	addr := net.JoinHostPort("", meta.config["streamMaintPort"].String())
 	endpt := []common.Endpoint{common.Endpoint(addr)}
 
 	partnDefn := common.KeyPartitionDefn{Id: common.PartitionId(1),
@@ -533,3 +538,30 @@ func (meta *metaNotifier) makeDefaultPartitionContainer() common.PartitionContai
 	return pc
 
 }
+
+//makePartitionContainer returns a container with partitions, among
+//[0, NumPartitions) of a hash or range partitioned index, hosted by the
+//local indexer endpoint for instance replicaId.
+func makePartitionContainer(indexDefn *common.IndexDefn,
+	addr string, replicaId int) common.PartitionContainer {
+
+	numPartitions := indexDefn.GetNumPartitions()
+
+	var pc common.PartitionContainer
+	if indexDefn.PartitionScheme == common.RANGE {
+		pc = common.NewRangePartitionContainer(indexDefn.PartitionSplits)
+	} else {
+		pc = common.NewHashPartitionContainer(numPartitions)
+	}
+	endpt := []common.Endpoint{common.Endpoint(addr)}
+	for i := 0; i < numPartitions; i++ {
+		partnId := common.PartitionId(i)
+		if indexDefn.PartitionNode(partnId) != replicaId {
+			continue
+		}
+		partnDefn := common.KeyPartitionDefn{Id: partnId,
+			Endpts: endpt}
+		pc.AddPartition(partnId, partnDefn)
+	}
+	return pc
+}
@@ -55,7 +55,8 @@ type DDLServiceMgr struct {
 // DDL related settings
 //
 type ddlSettings struct {
-	numReplica int32
+	numReplica   int32
+	numPartition int32
 }
 
 //////////////////////////////////////////////////////////////
@@ -82,7 +83,8 @@ func NewDDLServiceMgr(supvCmdch MsgChannel, supvMsgch MsgChannel, config common.
 	nodeId := service.NodeID(config["nodeuuid"].String())
 
 	numReplica := int32(config["settings.num_replica"].Int())
-	settings := &ddlSettings{numReplica: numReplica}
+	numPartition := int32(config["settings.num_partitions"].Int())
+	settings := &ddlSettings{numReplica: numReplica, numPartition: numPartition}
 
 	mgr := &DDLServiceMgr{
 		supvCmdch:   supvCmdch,
@@ -367,6 +369,10 @@ func (s *ddlSettings) NumReplica() int32 {
 	return atomic.LoadInt32(&s.numReplica)
 }
 
+func (s *ddlSettings) NumPartition() int32 {
+	return atomic.LoadInt32(&s.numPartition)
+}
+
 func (s *ddlSettings) handleSettings(config common.Config) {
 
 	numReplica := int32(config["settings.num_replica"].Int())
@@ -375,4 +381,11 @@ func (s *ddlSettings) handleSettings(config common.Config) {
 	} else {
 		logging.Errorf("DDLServiceMgr: invalid setting value for num_replica=%v", numReplica)
 	}
+
+	numPartition := int32(config["settings.num_partitions"].Int())
+	if numPartition > 0 {
+		atomic.StoreInt32(&s.numPartition, numPartition)
+	} else {
+		logging.Errorf("DDLServiceMgr: invalid setting value for num_partitions=%v", numPartition)
+	}
 }
@@ -433,7 +433,22 @@ func (f *flusher) processUpsert(mut *Mutation, docid []byte, meta *MutationMeta)
 
 	if partnInst := partnInstMap[partnId]; ok {
 		slice := partnInst.Sc.GetSliceByIndexKey(common.IndexKey(mut.key))
-		if err := slice.Insert(mut.key, docid, meta); err != nil {
+
+		//partition key of the document may have changed, unless it is
+		//immutable. If the partition did not have the docid, document
+		//is either new or has moved from another partition, remove the
+		//older entry from rest of the partitions.
+		moved := idxInst.Defn.IsPartitioned() && !idxInst.Defn.Immutable &&
+			len(partnInstMap) > 1
+
+		var err error
+		existed := true
+		if moved {
+			existed, err = slice.InsertSync(mut.key, docid, meta)
+		} else {
+			err = slice.Insert(mut.key, docid, meta)
+		}
+		if err != nil {
 			logging.Errorf("Flusher::processUpsert Error indexing Key: %s "+
 				"docid: %s in Slice: %v. Error: %v. Skipped.",
 				mut.key, docid, slice.Id(), err)
@@ -443,11 +458,13 @@ func (f *flusher) processUpsert(mut *Mutation, docid []byte, meta *MutationMeta)
 					"docid: %s in Slice: %v. Error: %v", err, mut.key, docid, slice.Id(), err2)
 			}
 		}
+		if moved && !existed {
+			f.deleteFromPartitions(mut, docid, meta, partnInstMap, partnId)
+		}
 	} else {
 		logging.Errorf("Flusher::processUpsert Partition Instance not found "+
 			"for Id: %v Skipped Mutation Key: %v", partnId, mut.key)
 	}
-
 }
 
 func (f *flusher) processDelete(mut *Mutation, docid []byte, meta *MutationMeta) {
@@ -464,6 +481,12 @@ func (f *flusher) processDelete(mut *Mutation, docid []byte, meta *MutationMeta)
 		return
 	}
 
+	//old partition key is not known, delete from all partitions.
+	if idxInst.Defn.IsPartitioned() {
+		f.deleteFromPartitions(mut, docid, meta, partnInstMap, common.PartitionId(-1))
+		return
+	}
+
 	if partnInst := partnInstMap[partnId]; ok {
 		slice := partnInst.Sc.GetSliceByIndexKey(common.IndexKey(mut.key))
 		if err := slice.Delete(docid, meta); err != nil {
@@ -476,6 +499,23 @@ func (f *flusher) processDelete(mut *Mutation, docid []byte, meta *MutationMeta)
 	}
 }
 
+//deleteFromPartitions deletes docid from all the partitions of a hash
+//partitioned index, except the partition `skip`.
+func (f *flusher) deleteFromPartitions(mut *Mutation, docid []byte,
+	meta *MutationMeta, partnInstMap PartitionInstMap, skip common.PartitionId) {
+
+	for partnId, partnInst := range partnInstMap {
+		if partnId == skip {
+			continue
+		}
+		slice := partnInst.Sc.GetSliceByIndexKey(common.IndexKey(mut.key))
+		if err := slice.Delete(docid, meta); err != nil {
+			logging.Errorf("Flusher::deleteFromPartitions Error Deleting DocId: %v "+
+				"from Partition: %v Slice: %v", docid, partnId, slice.Id())
+		}
+	}
+}
+
 //IsTimestampGreaterThanQueueLWT checks if each Vbucket in the Queue has
 //mutation with Seqno lower than the corresponding Seqno present in the
 //specified timestamp.
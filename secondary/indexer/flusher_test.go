@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// testSlice records the docids indexed in it and the writes it received.
+type testSlice struct {
+	Slice
+	id      SliceId
+	docs    map[string]bool
+	inserts int
+	syncs   int
+	deletes int
+}
+
+func (s *testSlice) Id() SliceId {
+	return s.id
+}
+
+func (s *testSlice) Insert(key []byte, docid []byte, meta *MutationMeta) error {
+	s.inserts++
+	s.docs[string(docid)] = true
+	return nil
+}
+
+func (s *testSlice) InsertSync(key []byte, docid []byte, meta *MutationMeta) (bool, error) {
+	s.syncs++
+	exists := s.docs[string(docid)]
+	s.docs[string(docid)] = true
+	return exists, nil
+}
+
+func (s *testSlice) Delete(docid []byte, meta *MutationMeta) error {
+	s.deletes++
+	delete(s.docs, string(docid))
+	return nil
+}
+
+func testFlusher(numPartitions int, immutable bool) (*flusher, []*testSlice) {
+	instId := common.IndexInstId(1)
+	pc := common.NewKeyPartitionContainer()
+	partnInstMap := make(PartitionInstMap)
+	slices := make([]*testSlice, numPartitions)
+	for i := 0; i < numPartitions; i++ {
+		partnId := common.PartitionId(i)
+		partnDefn := common.KeyPartitionDefn{Id: partnId}
+		pc.AddPartition(partnId, partnDefn)
+		slices[i] = &testSlice{id: SliceId(i), docs: make(map[string]bool)}
+		sc := NewHashedSliceContainer()
+		sc.AddSlice(0, slices[i])
+		partnInstMap[partnId] = PartitionInst{Defn: partnDefn, Sc: sc}
+	}
+
+	inst := common.IndexInst{
+		InstId: instId,
+		Defn: common.IndexDefn{
+			PartitionScheme: common.HASH,
+			NumPartitions:   uint32(numPartitions),
+			Immutable:       immutable,
+		},
+		Pc: pc,
+	}
+	f := &flusher{
+		indexInstMap:  common.IndexInstMap{instId: inst},
+		indexPartnMap: IndexPartnMap{instId: partnInstMap},
+	}
+	return f, slices
+}
+
+// testPartnKeys returns partition keys that hash to distinct partitions.
+func testPartnKeys(numPartitions int) [][]byte {
+	keys := make([][]byte, numPartitions)
+	for i, found := 0, 0; found < numPartitions; i++ {
+		key := []byte{byte('a' + i)}
+		partnId := common.HashPartitionId(key, numPartitions)
+		if keys[partnId] == nil {
+			keys[partnId] = key
+			found++
+		}
+	}
+	return keys
+}
+
+func testUpsert(f *flusher, docid string, partnkey []byte) {
+	mut := &Mutation{uuid: common.IndexInstId(1), command: common.Upsert,
+		key: []byte(`["k"]`), partnkey: partnkey}
+	f.processUpsert(mut, []byte(docid), NewMutationMeta())
+}
+
+func testDeletes(slices []*testSlice) int {
+	deletes := 0
+	for _, s := range slices {
+		deletes += s.deletes
+	}
+	return deletes
+}
+
+func TestFlusherUpsertPartitioned(t *testing.T) {
+	f, slices := testFlusher(4, false)
+	keys := testPartnKeys(4)
+
+	// new document is removed from rest of the partitions.
+	testUpsert(f, "doc1", keys[0])
+	if slices[0].syncs != 1 || !slices[0].docs["doc1"] {
+		t.Errorf("Expected doc1 in partition 0, received %v", slices[0].docs)
+	}
+	if deletes := testDeletes(slices); deletes != 3 {
+		t.Errorf("Expected 3 deletes, received %v", deletes)
+	}
+
+	// partition key did not change, no deletes.
+	testUpsert(f, "doc1", keys[0])
+	if deletes := testDeletes(slices); deletes != 3 {
+		t.Errorf("Expected 3 deletes, received %v", deletes)
+	}
+
+	// partition key changed, older entry is removed.
+	testUpsert(f, "doc1", keys[2])
+	if !slices[2].docs["doc1"] || slices[0].docs["doc1"] {
+		t.Errorf("Expected doc1 only in partition 2, received %v %v",
+			slices[0].docs, slices[2].docs)
+	}
+	if deletes := testDeletes(slices); deletes != 6 {
+		t.Errorf("Expected 6 deletes, received %v", deletes)
+	}
+}
+
+func TestFlusherUpsertImmutable(t *testing.T) {
+	f, slices := testFlusher(4, true)
+	keys := testPartnKeys(4)
+
+	testUpsert(f, "doc1", keys[1])
+	testUpsert(f, "doc1", keys[1])
+	if slices[1].inserts != 2 || slices[1].syncs != 0 {
+		t.Errorf("Expected 2 inserts 0 syncs, received %v %v",
+			slices[1].inserts, slices[1].syncs)
+	}
+	if deletes := testDeletes(slices); deletes != 0 {
+		t.Errorf("Expected 0 deletes, received %v", deletes)
+	}
+}
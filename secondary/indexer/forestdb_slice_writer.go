@@ -171,6 +171,8 @@ type indexItem struct {
 	key    []byte
 	rawKey []byte
 	docid  []byte
+	// if not nil, whether docid was indexed is sent once applied.
+	existCh chan bool
 }
 
 //fdbSlice represents a forestdb slice
@@ -187,6 +189,8 @@ type fdbSlice struct {
 
 	qCount platform.AlignedInt64
 
+	numDocsIndexed platform.AlignedInt64
+
 	path     string
 	currfile string
 	id       SliceId //slice id
@@ -240,6 +244,11 @@ type fdbSlice struct {
 	confLock   sync.RWMutex
 	statFdLock sync.Mutex
 
+	//compaction, which replaces the file, is skipped while pinned
+	//for a copy
+	pinLock sync.Mutex
+	pins    int
+
 	// Array processing
 	arrayExprPosition int
 	isArrayDistinct   bool
@@ -283,6 +292,22 @@ func (fdb *fdbSlice) Insert(rawKey []byte, docid []byte, meta *MutationMeta) err
 	return fdb.fatalDbErr
 }
 
+//InsertSync will insert the given key/value pair like Insert, and
+//wait till it is applied. Returns true if docid was already indexed
+//in the slice.
+func (fdb *fdbSlice) InsertSync(rawKey []byte, docid []byte, meta *MutationMeta) (bool, error) {
+	key, err := GetIndexEntryBytes(rawKey, docid, fdb.idxDefn.IsPrimary, fdb.idxDefn.IsArrayIndex, 1, fdb.idxDefn.Desc)
+	if err != nil {
+		return false, err
+	}
+
+	item := &indexItem{key: key, rawKey: rawKey, docid: docid, existCh: make(chan bool, 1)}
+	fdb.idxStats.numDocsFlushQueued.Add(1)
+	platform.AddInt64(&fdb.qCount, 1)
+	fdb.cmdCh <- item
+	return <-item.existCh, fdb.fatalDbErr
+}
+
 //Delete will delete the given document from slice.
 //Internally the request is buffered and executed async.
 //If forestdb has encountered any fatal error condition,
@@ -315,9 +340,16 @@ loop:
 			case *indexItem:
 				icmd = c.(*indexItem)
 				start = time.Now()
+				var exists bool
+				if icmd.existCh != nil {
+					exists = fdb.exists(icmd.docid, workerId)
+				}
 				nmut = fdb.insert((*icmd).key, (*icmd).rawKey, (*icmd).docid, workerId)
 				elapsed = time.Since(start)
 				fdb.totalFlushTime += elapsed
+				if icmd.existCh != nil {
+					icmd.existCh <- exists
+				}
 
 			case []byte:
 				dcmd = c.([]byte)
@@ -333,6 +365,7 @@ loop:
 
 			fdb.idxStats.numItemsFlushed.Add(int64(nmut))
 			fdb.idxStats.numDocsIndexed.Add(1)
+			platform.AddInt64(&fdb.numDocsIndexed, 1)
 			platform.AddInt64(&fdb.qCount, -1)
 
 		case <-fdb.stopCh[workerId]:
@@ -348,6 +381,16 @@ loop:
 	}
 }
 
+//exists returns true if docid is indexed in the slice, entries of
+//primary index are not looked up.
+func (fdb *fdbSlice) exists(docid []byte, workerId int) bool {
+	if fdb.isPrimary {
+		return false
+	}
+	oldkey, err := fdb.getBackIndexEntry(docid, workerId)
+	return err == nil && oldkey != nil
+}
+
 //insert does the actual insert in forestdb
 func (fdb *fdbSlice) insert(key []byte, rawKey []byte, docid []byte, workerId int) int {
 	var nmut int
@@ -1274,10 +1317,41 @@ func (fdb *fdbSlice) IsDirty() bool {
 	return fdb.isDirty
 }
 
+// NumDocsIndexed returns the number of documents indexed by the slice
+// since it was opened.
+func (fdb *fdbSlice) NumDocsIndexed() int64 {
+	return platform.LoadInt64(&fdb.numDocsIndexed)
+}
+
+//pinSnapshots keeps the file from being compacted, until unpinSnapshots
+//is called. It waits for a running compaction to finish.
+func (fdb *fdbSlice) pinSnapshots() {
+	fdb.pinLock.Lock()
+	defer fdb.pinLock.Unlock()
+
+	fdb.pins++
+}
+
+func (fdb *fdbSlice) unpinSnapshots() {
+	fdb.pinLock.Lock()
+	defer fdb.pinLock.Unlock()
+
+	fdb.pins--
+}
+
 func (fdb *fdbSlice) Compact(abortTime time.Time) error {
 	fdb.IncrRef()
 	defer fdb.DecrRef()
 
+	fdb.pinLock.Lock()
+	defer fdb.pinLock.Unlock()
+
+	if fdb.pins > 0 {
+		logging.Infof("ForestDBSlice::Skip Compaction of pinned slice."+
+			"Slice Id %v, IndexInstId %v, IndexDefnId %v", fdb.id, fdb.idxInstId, fdb.idxDefnId)
+		return nil
+	}
+
 	fdb.setIsCompacting(true)
 	defer fdb.setIsCompacting(false)
 
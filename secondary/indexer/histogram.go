@@ -0,0 +1,623 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const histogramFileName = "histogram.json"
+
+var errHistogramSamplerStopped = errors.New("Histogram sampler stopped")
+var errHistogramBatchDone = errors.New("Histogram sample batch done")
+
+// histogramBin is one bucket of an equi-depth histogram. Low and High are
+// collatejson encoded secondary keys (raw docids for primary index) in
+// ascending collation order, both inclusive.
+type histogramBin struct {
+	Low      []byte `json:"low"`
+	High     []byte `json:"high"`
+	Count    uint64 `json:"count"`
+	Distinct uint64 `json:"distinct"`
+}
+
+// indexHistogram is an equi-depth histogram over the keys of an index
+// partition, built from a uniform sample of the partition snapshot.
+type indexHistogram struct {
+	InstId     common.IndexInstId `json:"instId"`
+	PartnId    common.PartitionId `json:"partnId"`
+	IsPrimary  bool               `json:"isPrimary"`
+	NumItems   uint64             `json:"numItems"`
+	SampleSize uint64             `json:"sampleSize"`
+	Created    int64              `json:"created"`
+	Bins       []histogramBin     `json:"bins"`
+
+	// docs indexed by the partition slice when histogram was built or
+	// loaded, used to decide when histogram needs a refresh.
+	mutations int64
+}
+
+// histogramSampler collects a uniform sample of keys with reservoir
+// sampling while the index snapshot is iterated in storage order.
+type histogramSampler struct {
+	isPrimary bool
+	desc      []bool
+	size      int
+
+	visited uint64
+	keys    [][]byte
+	revbuf  []byte
+	rnd     *rand.Rand
+}
+
+func newHistogramSampler(size int, isPrimary bool, desc []bool) *histogramSampler {
+	return &histogramSampler{
+		isPrimary: isPrimary,
+		desc:      desc,
+		size:      size,
+		keys:      make([][]byte, 0, size),
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (hs *histogramSampler) add(entry []byte) error {
+	var key []byte
+
+	if hs.isPrimary {
+		key = entry
+	} else {
+		//get the key in original format
+		if hs.desc != nil {
+			hs.revbuf = append(hs.revbuf[:0], entry...)
+			jsonEncoder.ReverseCollate(hs.revbuf, hs.desc)
+			entry = hs.revbuf
+		}
+		e := secondaryIndexEntry(entry)
+		key = entry[:e.lenKey()]
+	}
+
+	hs.visited++
+	if len(hs.keys) < hs.size {
+		hs.keys = append(hs.keys, append([]byte(nil), key...))
+	} else if j := hs.rnd.Int63n(int64(hs.visited)); j < int64(hs.size) {
+		hs.keys[j] = append(hs.keys[j][:0], key...)
+	}
+	return nil
+}
+
+// build an equi-depth histogram with at most numBins bins from the
+// collected sample. Bin counts are scaled up to the number of entries
+// visited by the sampler.
+func (hs *histogramSampler) build(instId common.IndexInstId,
+	partnId common.PartitionId, numBins int) *indexHistogram {
+
+	h := &indexHistogram{
+		InstId:     instId,
+		PartnId:    partnId,
+		IsPrimary:  hs.isPrimary,
+		NumItems:   hs.visited,
+		SampleSize: uint64(len(hs.keys)),
+		Created:    time.Now().UnixNano(),
+	}
+
+	if len(hs.keys) == 0 || numBins <= 0 {
+		return h
+	}
+
+	sort.Sort(byteSlices(hs.keys))
+
+	scale := float64(hs.visited) / float64(len(hs.keys))
+	depth := (len(hs.keys) + numBins - 1) / numBins
+
+	for i := 0; i < len(hs.keys); {
+		j := i + depth
+		if j > len(hs.keys) {
+			j = len(hs.keys)
+		}
+		// do not split a key across two bins.
+		for j < len(hs.keys) && bytes.Equal(hs.keys[j], hs.keys[j-1]) {
+			j++
+		}
+
+		distinct := uint64(1)
+		for k := i + 1; k < j; k++ {
+			if !bytes.Equal(hs.keys[k], hs.keys[k-1]) {
+				distinct++
+			}
+		}
+
+		count := uint64(float64(j-i) * scale)
+		if distinct == uint64(j-i) {
+			// every sampled key is unique, assume the same for the
+			// population.
+			distinct = count
+		}
+
+		h.Bins = append(h.Bins, histogramBin{
+			Low:      hs.keys[i],
+			High:     hs.keys[j-1],
+			Count:    count,
+			Distinct: distinct,
+		})
+		i = j
+	}
+	return h
+}
+
+// overlaps returns true if the bin may contain entries within the span
+// [low, high]. Keys are compared as prefixes like in range scans.
+func (b *histogramBin) overlaps(low, high IndexKey, isPrimary bool) bool {
+	var bl, bh IndexKey
+	if isPrimary {
+		bl, _ = NewPrimaryKey(b.Low)
+		bh, _ = NewPrimaryKey(b.High)
+	} else {
+		l, h := secondaryKey(b.Low), secondaryKey(b.High)
+		bl, bh = &l, &h
+	}
+	return bh.ComparePrefixIndexKey(low) >= 0 && bl.ComparePrefixIndexKey(high) <= 0
+}
+
+// binsForSpan returns bins that overlap with the span requested in `req`.
+func (h *indexHistogram) binsForSpan(req *ScanRequest) []histogramBin {
+	if h == nil {
+		return nil
+	}
+
+	var bins []histogramBin
+	for i := range h.Bins {
+		b := &h.Bins[i]
+		if len(req.Keys) > 0 {
+			for _, key := range req.Keys {
+				if b.overlaps(key, key, req.isPrimary) {
+					bins = append(bins, *b)
+					break
+				}
+			}
+		} else if b.overlaps(req.Low, req.High, req.isPrimary) {
+			bins = append(bins, *b)
+		}
+	}
+	return bins
+}
+
+// binsToProto converts histogram bins into IndexStatistics that are
+// returned as part of StatisticsResponse.
+func binsToProto(bins []histogramBin, isPrimary bool) ([]*protobuf.IndexStatistics, error) {
+	var pbins []*protobuf.IndexStatistics
+	for _, b := range bins {
+		low, err := decodeStatsKey(b.Low, isPrimary)
+		if err != nil {
+			return nil, err
+		}
+		high, err := decodeStatsKey(b.High, isPrimary)
+		if err != nil {
+			return nil, err
+		}
+		pbins = append(pbins, &protobuf.IndexStatistics{
+			KeysCount:       proto.Uint64(b.Count),
+			UniqueKeysCount: proto.Uint64(b.Distinct),
+			KeyMin:          low,
+			KeyMax:          high,
+			Sampled:         proto.Bool(true),
+		})
+	}
+	return pbins, nil
+}
+
+// histogramBinStat is the shape of a histogram bin reported by /stats.
+type histogramBinStat struct {
+	Low      json.RawMessage `json:"low"`
+	High     json.RawMessage `json:"high"`
+	Count    uint64          `json:"count"`
+	Distinct uint64          `json:"distinct"`
+}
+
+// binStats returns histogram bins with keys decoded to JSON.
+func (h *indexHistogram) binStats(isPrimary bool) []histogramBinStat {
+	stats := make([]histogramBinStat, 0, len(h.Bins))
+	for _, b := range h.Bins {
+		low, err := decodeStatsKey(b.Low, isPrimary)
+		if err != nil {
+			continue
+		}
+		high, err := decodeStatsKey(b.High, isPrimary)
+		if err != nil {
+			continue
+		}
+		stats = append(stats, histogramBinStat{
+			Low: low, High: high, Count: b.Count, Distinct: b.Distinct,
+		})
+	}
+	return stats
+}
+
+// saveHistogram persists the histogram in the slice directory, next to
+// slice snapshot files, so that it survives an indexer restart.
+func saveHistogram(path string, h *indexHistogram) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(path, histogramFileName)
+	tmpfile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpfile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, file)
+}
+
+// loadHistogram from slice directory, returns nil if the histogram was
+// never persisted for this slice.
+func loadHistogram(path string) (*indexHistogram, error) {
+	file := filepath.Join(path, histogramFileName)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	h := new(indexHistogram)
+	if err := json.Unmarshal(data, h); err != nil {
+		logging.Errorf("loadHistogram: ignoring corrupted histogram %v (%v)", file, err)
+		return nil, nil
+	}
+	return h, nil
+}
+
+//
+// Background sampler owned by scan coordinator.
+//
+
+// histogramPass samples the entries of an index partition to build its
+// next histogram. At most scan_batch entries are sampled on each refresh,
+// resuming after the last sampled entry, so that the partition is never
+// scanned at once.
+type histogramPass struct {
+	sampler   *histogramSampler
+	last      []byte // last sampled entry in storage format.
+	mutations int64  // docs indexed by the partition when the pass started.
+	started   time.Time
+}
+
+// runHistogramSampler periodically refreshes histograms of active index
+// partitions whose mutation volume has crossed the refresh threshold.
+func (s *scanCoordinator) runHistogramSampler() {
+	cfg := s.config.Load()
+	interval := time.Duration(cfg["settings.histogram.refresh_interval"].Int())
+	ticker := time.NewTicker(interval * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.histStopch:
+			return
+
+		case <-ticker.C:
+			cfg := s.config.Load()
+			if !cfg["settings.histogram.enable"].Bool() || s.isBootstrapMode() {
+				continue
+			}
+			s.refreshHistograms(cfg)
+		}
+	}
+}
+
+func (s *scanCoordinator) refreshHistograms(cfg common.Config) {
+	slices := make(map[common.IndexInstId]map[common.PartitionId]Slice)
+
+	s.mu.RLock()
+	for instId, inst := range s.indexInstMap {
+		if inst.State != common.INDEX_STATE_ACTIVE {
+			continue
+		}
+		if pmap, ok := s.indexPartnMap[instId]; ok {
+			slices[instId] = make(map[common.PartitionId]Slice)
+			for partnId, partnInst := range pmap {
+				slices[instId][partnId] = partnInst.Sc.GetSliceById(0)
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	// passes are only touched by the sampler goroutine.
+	for instId, passes := range s.histPasses {
+		for partnId := range passes {
+			if _, ok := slices[instId][partnId]; !ok {
+				delete(passes, partnId)
+			}
+		}
+		if len(passes) == 0 {
+			delete(s.histPasses, instId)
+		}
+	}
+
+	for instId, partnSlices := range slices {
+		for partnId, slice := range partnSlices {
+			select {
+			case <-s.histStopch:
+				return
+			default:
+			}
+
+			err := s.refreshHistogram(instId, partnId, slice, cfg)
+			if err != nil {
+				logging.Errorf("%v: Unable to refresh histogram for index %v "+
+					"partition %v (%v)", s.logPrefix, instId, partnId, err)
+			}
+		}
+	}
+}
+
+// refreshHistogram loads the persisted histogram for an index partition,
+// if it is not loaded yet. Once enough mutations have been indexed by the
+// partition slice since it was built, a new sampling pass is started over the latest snapshot.
+// Each call samples the next batch of entries of the pass and the
+// histogram is rebuilt when the pass reaches the end of the partition.
+func (s *scanCoordinator) refreshHistogram(instId common.IndexInstId,
+	partnId common.PartitionId, slice Slice, cfg common.Config) error {
+
+	path := slice.Path()
+	mutations := slice.NumDocsIndexed()
+
+	pass := s.histPasses[instId][partnId]
+	if pass == nil {
+		h := s.getHistogram(instId, partnId)
+		if h == nil {
+			var err error
+			if h, err = loadHistogram(path); err != nil {
+				return err
+			} else if h != nil {
+				h.InstId, h.PartnId = instId, partnId
+				h.mutations = mutations
+				s.setHistogram(h)
+			}
+		}
+
+		if h != nil {
+			delta := mutations - h.mutations
+			if delta < 0 { // slice has been re-opened.
+				h.mutations, delta = mutations, 0
+			}
+			ratio := cfg["settings.histogram.refresh_ratio"].Float64()
+			threshold := int64(ratio * float64(h.NumItems))
+			if threshold < 1 {
+				threshold = 1
+			}
+			if delta < threshold {
+				return nil
+			}
+		}
+	}
+
+	s.mu.RLock()
+	ss, ok := s.lastSnapshot[instId]
+	inst, ok1 := s.indexInstMap[instId]
+	pmap, ok2 := s.indexPartnMap[instId]
+	partnInst, ok3 := pmap[partnId]
+	if !ok || ss == nil || !ok1 || !ok2 || !ok3 {
+		s.mu.RUnlock()
+		return nil
+	}
+	is := CloneIndexSnapshot(ss)
+	ctx := partnInst.Sc.GetSliceById(0).GetReaderContext()
+	s.mu.RUnlock()
+
+	defer DestroyIndexSnapshot(is)
+	ctx.Init()
+	defer ctx.Done()
+
+	if pass == nil {
+		sampleSize := cfg["settings.histogram.sample_size"].Int()
+		pass = &histogramPass{
+			sampler:   newHistogramSampler(sampleSize, inst.Defn.IsPrimary, inst.Defn.Desc),
+			mutations: mutations,
+			started:   time.Now(),
+		}
+		if s.histPasses[instId] == nil {
+			s.histPasses[instId] = make(map[common.PartitionId]*histogramPass)
+		}
+		s.histPasses[instId][partnId] = pass
+	}
+
+	done, err := pass.sampleBatch(is, partnId, ctx,
+		cfg["settings.histogram.scan_batch"].Int(), s.histStopch)
+	if err != nil || !done {
+		if err == errHistogramSamplerStopped {
+			return nil
+		}
+		return err
+	}
+	delete(s.histPasses[instId], partnId)
+
+	h := pass.sampler.build(instId, partnId, cfg["settings.histogram.num_bins"].Int())
+	h.mutations = pass.mutations
+	s.setHistogram(h)
+
+	logging.Infof("%v: Built histogram for index %v partition %v with %v bins "+
+		"over %v items in %v", s.logPrefix, instId, partnId, len(h.Bins),
+		h.NumItems, time.Since(pass.started))
+
+	return saveHistogram(path, h)
+}
+
+// sampleBatch samples at most `batch` entries of the partition that sort
+// after the last sampled entry. Returns true once all entries of the
+// partition have been sampled.
+func (p *histogramPass) sampleBatch(is IndexSnapshot, partnId common.PartitionId,
+	ctx IndexReaderContext, batch int, stopch chan bool) (bool, error) {
+
+	low := p.resumeKey()
+	count := 0
+	fn := func(entry []byte) error {
+		select {
+		case <-stopch:
+			return errHistogramSamplerStopped
+		default:
+		}
+		return p.sample(entry, batch, &count)
+	}
+
+	partnIds := []common.PartitionId{partnId}
+	for _, ss := range GetPartitionSliceSnapshots(is, partnIds) {
+		err := ss.Snapshot().Range(ctx, low, MaxIndexKey, Both, fn)
+		if err == errHistogramBatchDone {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// resumeKey returns the low key of the range that resumes the pass. The
+// range includes the last sampled entry, which is skipped by sample().
+func (p *histogramPass) resumeKey() IndexKey {
+	if p.last == nil {
+		return MinIndexKey
+	}
+
+	// p.last is overwritten while the range is iterated.
+	last := append([]byte(nil), p.last...)
+	if p.sampler.isPrimary {
+		k := primaryKey(last)
+		return &k
+	}
+	k := secondaryKey(last)
+	return &k
+}
+
+// sample adds an entry, in storage order, to the pass. Entries up to the
+// last sampled entry have been sampled by a previous batch and are
+// skipped. Returns errHistogramBatchDone once `count` reaches `batch`.
+func (p *histogramPass) sample(entry []byte, batch int, count *int) error {
+	if p.last != nil && bytes.Compare(entry, p.last) <= 0 {
+		return nil
+	}
+	if batch > 0 && *count == batch {
+		return errHistogramBatchDone
+	}
+	*count++
+	p.last = append(p.last[:0], entry...)
+	return p.sampler.add(entry)
+}
+
+func (s *scanCoordinator) getHistogram(instId common.IndexInstId,
+	partnId common.PartitionId) *indexHistogram {
+
+	s.histMu.RLock()
+	defer s.histMu.RUnlock()
+	return s.histograms[instId][partnId]
+}
+
+func (s *scanCoordinator) setHistogram(h *indexHistogram) {
+	s.histMu.Lock()
+	defer s.histMu.Unlock()
+	if s.histograms[h.InstId] == nil {
+		s.histograms[h.InstId] = make(map[common.PartitionId]*indexHistogram)
+	}
+	s.histograms[h.InstId][h.PartnId] = h
+}
+
+// getHistograms returns histograms of the requested partitions of an
+// index instance, all partitions if partnIds is nil, in partition order.
+func (s *scanCoordinator) getHistograms(instId common.IndexInstId,
+	partnIds []common.PartitionId) []*indexHistogram {
+
+	s.histMu.RLock()
+	defer s.histMu.RUnlock()
+
+	partns := s.histograms[instId]
+	if partnIds == nil {
+		for partnId := range partns {
+			partnIds = append(partnIds, partnId)
+		}
+		sort.Sort(partitionIds(partnIds))
+	}
+
+	var hs []*indexHistogram
+	for _, partnId := range partnIds {
+		if h, ok := partns[partnId]; ok {
+			hs = append(hs, h)
+		}
+	}
+	return hs
+}
+
+// histogramBins returns bins of the scanned partitions that overlap with
+// the span requested in `req`.
+func (s *scanCoordinator) histogramBins(req *ScanRequest) []histogramBin {
+	var bins []histogramBin
+	for _, h := range s.getHistograms(req.IndexInstId, req.PartitionIds) {
+		bins = append(bins, h.binsForSpan(req)...)
+	}
+	return bins
+}
+
+// pruneHistograms forgets histograms of index instances and partitions
+// that are no longer hosted by this indexer.
+func (s *scanCoordinator) pruneHistograms(indexInstMap common.IndexInstMap,
+	indexPartnMap IndexPartnMap) {
+
+	s.histMu.Lock()
+	defer s.histMu.Unlock()
+	for instId, partns := range s.histograms {
+		if _, ok := indexInstMap[instId]; !ok {
+			delete(s.histograms, instId)
+			continue
+		}
+		for partnId := range partns {
+			if _, ok := indexPartnMap[instId][partnId]; !ok {
+				delete(partns, partnId)
+			}
+		}
+	}
+}
+
+func (s *scanCoordinator) updateHistogramStats(instId common.IndexInstId,
+	idxStats *IndexStats) {
+
+	hs := s.getHistograms(instId, nil)
+	if len(hs) == 0 {
+		return
+	}
+
+	var stats []histogramBinStat
+	for _, h := range hs {
+		stats = append(stats, h.binStats(h.IsPrimary)...)
+	}
+	idxStats.histogram.Store(stats)
+}
+
+type byteSlices [][]byte
+
+func (b byteSlices) Len() int           { return len(b) }
+func (b byteSlices) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byteSlices) Less(i, j int) bool { return bytes.Compare(b[i], b[j]) < 0 }
+
+type partitionIds []common.PartitionId
+
+func (p partitionIds) Len() int           { return len(p) }
+func (p partitionIds) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p partitionIds) Less(i, j int) bool { return p[i] < p[j] }
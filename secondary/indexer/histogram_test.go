@@ -0,0 +1,117 @@
+package indexer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistogramEquiDepth(t *testing.T) {
+	hs := newHistogramSampler(1000, false, nil)
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf(`[%d]`, i%100))
+		e, err := newSKEntry(key, []byte(fmt.Sprintf("doc-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hs.add(e)
+	}
+
+	h := hs.build(1, 0, 10)
+	if h.NumItems != 1000 {
+		t.Errorf("Expected 1000 items, received %v", h.NumItems)
+	}
+	if len(h.Bins) != 10 {
+		t.Fatalf("Expected 10 bins, received %v", len(h.Bins))
+	}
+
+	var total uint64
+	for i, b := range h.Bins {
+		if b.Count != 100 || b.Distinct != 10 {
+			t.Errorf("Unexpected bin %v count:%v distinct:%v", i, b.Count, b.Distinct)
+		}
+		total += b.Count
+	}
+	if total != 1000 {
+		t.Errorf("Expected total count 1000, received %v", total)
+	}
+}
+
+func TestHistogramPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "histogram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if h, err := loadHistogram(dir); err != nil || h != nil {
+		t.Fatalf("Expected no histogram, received %v (%v)", h, err)
+	}
+
+	hs := newHistogramSampler(10, false, nil)
+	for i := 0; i < 10; i++ {
+		e, _ := newSKEntry([]byte(fmt.Sprintf(`["k%d"]`, i)), []byte("doc"))
+		hs.add(e)
+	}
+	h := hs.build(7, 3, 2)
+	if err := saveHistogram(dir, h); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, histogramFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0644 {
+		t.Errorf("Expected %v, received %v", os.FileMode(0644), fi.Mode().Perm())
+	}
+
+	h2, err := loadHistogram(dir)
+	if err != nil || h2 == nil {
+		t.Fatalf("Unable to load histogram (%v)", err)
+	}
+	if h2.InstId != 7 || h2.PartnId != 3 || len(h2.Bins) != 2 || h2.NumItems != 10 {
+		t.Errorf("Unexpected histogram after load %+v", h2)
+	}
+}
+
+func TestHistogramPassBatches(t *testing.T) {
+	var entries [][]byte
+	for i := 0; i < 25; i++ {
+		e, _ := newSKEntry([]byte(fmt.Sprintf(`["k%02d"]`, i)), []byte("doc"))
+		entries = append(entries, e)
+	}
+
+	pass := &histogramPass{sampler: newHistogramSampler(100, false, nil)}
+	if pass.resumeKey() != MinIndexKey {
+		t.Errorf("Expected a pass to start from MinIndexKey")
+	}
+
+	// every batch rescans from the resume key, which includes the last
+	// sampled entry.
+	batches := 0
+	for done := false; !done; batches++ {
+		done = true
+		count := 0
+		for _, e := range entries {
+			if err := pass.sample(e, 10, &count); err == errHistogramBatchDone {
+				done = false
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if batches != 3 {
+		t.Errorf("Expected %v, received %v", 3, batches)
+	}
+	if pass.sampler.visited != 25 {
+		t.Errorf("Expected %v, received %v", 25, pass.sampler.visited)
+	}
+	if h := pass.sampler.build(1, 0, 5); h.NumItems != 25 || len(h.Bins) != 5 {
+		t.Errorf("Unexpected histogram %+v", h)
+	}
+}
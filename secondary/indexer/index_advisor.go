@@ -0,0 +1,489 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/planner"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The index advisor records the shape of every scan served by this
+// indexer, without any key values, and reports index hygiene findings for
+// the indexes hosted on this node: indexes that have not been scanned,
+// indexes with equivalent definitions, and indexes whose scans only
+// constrain a prefix of the composite key. For the latter a narrower index
+// is suggested, and the suggestions are checked for placement against the
+// current cluster layout with the planner.
+
+// scanShape is the anonymized shape of a scan request.
+type scanShape struct {
+	// number of leading index keys with an equality filter
+	EqKeys int `json:"eqKeys"`
+	// number of leading index keys up to the last one with a filter
+	UsedKeys int `json:"usedKeys"`
+	// whether the request was answered from the index alone
+	Covered bool `json:"covered"`
+	// whether group by or aggregates were pushed down
+	Aggregate bool `json:"aggregate"`
+}
+
+// indexScanWorkload accumulates the scan shapes of an index instance since
+// the instance was first seen by the scan coordinator.
+type indexScanWorkload struct {
+	since    time.Time
+	numScans uint64
+	shapes   map[scanShape]uint64
+}
+
+type scanShapeCount struct {
+	scanShape
+	Count uint64 `json:"count"`
+}
+
+type indexWorkloadReport struct {
+	Bucket   string           `json:"bucket"`
+	Name     string           `json:"name"`
+	NumKeys  int              `json:"numKeys"`
+	NumScans uint64           `json:"numScans"`
+	Since    string           `json:"since"`
+	Shapes   []scanShapeCount `json:"shapes,omitempty"`
+}
+
+type scanShapesByCount []scanShapeCount
+
+func (s scanShapesByCount) Len() int           { return len(s) }
+func (s scanShapesByCount) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s scanShapesByCount) Less(i, j int) bool { return s[i].Count > s[j].Count }
+
+type indexInstsByName []common.IndexInst
+
+func (s indexInstsByName) Len() int      { return len(s) }
+func (s indexInstsByName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s indexInstsByName) Less(i, j int) bool {
+	if s[i].Defn.Bucket != s[j].Defn.Bucket {
+		return s[i].Defn.Bucket < s[j].Defn.Bucket
+	}
+	return s[i].Defn.Name < s[j].Defn.Name
+}
+
+type unusedIndex struct {
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+	Since  string `json:"since"`
+}
+
+type duplicateIndexes struct {
+	Bucket  string   `json:"bucket"`
+	Indexes []string `json:"indexes"`
+}
+
+type prefixScanIndex struct {
+	Bucket   string `json:"bucket"`
+	Name     string `json:"name"`
+	NumKeys  int    `json:"numKeys"`
+	UsedKeys int    `json:"usedKeys"`
+	NumScans uint64 `json:"numScans"`
+}
+
+type indexSuggestion struct {
+	Bucket    string   `json:"bucket"`
+	Reason    string   `json:"reason"`
+	Statement string   `json:"statement"`
+	Nodes     []string `json:"nodes,omitempty"`
+
+	spec *planner.IndexSpec
+}
+
+type indexAdvice struct {
+	Indexes     []*indexWorkloadReport `json:"indexes"`
+	Unused      []*unusedIndex         `json:"unused"`
+	Duplicates  []*duplicateIndexes    `json:"duplicates"`
+	PrefixScans []*prefixScanIndex     `json:"prefixScans"`
+	Suggestions []*indexSuggestion     `json:"suggestions"`
+
+	// error from checking placement of the suggestions, if any
+	PlacementError string `json:"placementError,omitempty"`
+}
+
+// newScanShape computes the shape of a scan request from its spans and
+// composite filters.
+func newScanShape(r *ScanRequest) scanShape {
+
+	shape := scanShape{
+		Covered: r.ScanType == CountReq || r.ScanType == MultiScanCountReq ||
+			r.GroupAggr != nil ||
+			(r.Indexprojection != nil && len(r.Indexprojection.EntryKeys) != 0),
+		Aggregate: r.GroupAggr != nil,
+	}
+
+	isBounded := func(low, high IndexKey) bool {
+		return (low != nil && low != MinIndexKey) || (high != nil && high != MaxIndexKey)
+	}
+
+	isEqual := func(low, high IndexKey) bool {
+		return low != nil && high != nil &&
+			low != MinIndexKey && low != MaxIndexKey &&
+			high != MinIndexKey && high != MaxIndexKey &&
+			bytes.Equal(low.Bytes(), high.Bytes())
+	}
+
+	update := func(eq, used int) {
+		if eq > shape.EqKeys {
+			shape.EqKeys = eq
+		}
+		if used > shape.UsedKeys {
+			shape.UsedKeys = used
+		}
+	}
+
+	if r.ScanType == CountReq {
+		if len(r.Keys) != 0 {
+			update(1, 1)
+		} else if isBounded(r.Low, r.High) {
+			update(0, 1)
+		}
+		return shape
+	}
+
+	for _, scan := range r.Scans {
+		switch {
+		case scan.ScanType == AllReq:
+		case len(scan.Filters) == 0:
+			if scan.ScanType == LookupReq {
+				update(1, 1)
+			} else if isBounded(scan.Low, scan.High) {
+				update(0, 1)
+			}
+		default:
+			for _, filter := range scan.Filters {
+				if len(filter.CompositeFilters) == 0 {
+					// primary index
+					if isEqual(filter.Low, filter.High) {
+						update(1, 1)
+					} else if isBounded(filter.Low, filter.High) {
+						update(0, 1)
+					}
+					continue
+				}
+
+				eq, used := 0, 0
+				for i, cf := range filter.CompositeFilters {
+					if eq == i && isEqual(cf.Low, cf.High) {
+						eq = i + 1
+					}
+					if isBounded(cf.Low, cf.High) {
+						used = i + 1
+					}
+				}
+				update(eq, used)
+			}
+		}
+	}
+
+	return shape
+}
+
+// recordScanShape adds a scan request to the workload of its index.
+// Statistics requests are issued by the query planner and are not part of
+// the workload.
+func (s *scanCoordinator) recordScanShape(r *ScanRequest) {
+
+	if r.ScanType == StatsReq || r.ScanType == HeloReq {
+		return
+	}
+
+	shape := newScanShape(r)
+
+	s.advisorMu.Lock()
+	defer s.advisorMu.Unlock()
+	if wl, ok := s.workloads[r.IndexInstId]; ok {
+		wl.numScans++
+		wl.shapes[shape]++
+	}
+}
+
+// syncScanWorkloads starts tracking the workload of new index instances
+// and forgets instances that are no longer hosted by this indexer.
+func (s *scanCoordinator) syncScanWorkloads(indexInstMap common.IndexInstMap) {
+	s.advisorMu.Lock()
+	defer s.advisorMu.Unlock()
+
+	for instId := range s.workloads {
+		if _, ok := indexInstMap[instId]; !ok {
+			delete(s.workloads, instId)
+		}
+	}
+
+	now := time.Now()
+	for instId := range indexInstMap {
+		if _, ok := s.workloads[instId]; !ok {
+			s.workloads[instId] = &indexScanWorkload{
+				since:  now,
+				shapes: make(map[scanShape]uint64),
+			}
+		}
+	}
+}
+
+func (s *scanCoordinator) copyScanWorkloads() map[common.IndexInstId]*indexScanWorkload {
+	s.advisorMu.Lock()
+	defer s.advisorMu.Unlock()
+
+	workloads := make(map[common.IndexInstId]*indexScanWorkload)
+	for instId, wl := range s.workloads {
+		shapes := make(map[scanShape]uint64)
+		for shape, n := range wl.shapes {
+			shapes[shape] = n
+		}
+		workloads[instId] = &indexScanWorkload{
+			since:    wl.since,
+			numScans: wl.numScans,
+			shapes:   shapes,
+		}
+	}
+	return workloads
+}
+
+// adviseIndexes analyzes the scan workload of the active index instances.
+// stats returns the number of items and the data size of an instance, used
+// to size the suggested indexes.
+func adviseIndexes(insts []common.IndexInst,
+	workloads map[common.IndexInstId]*indexScanWorkload,
+	stats func(common.IndexInstId) (uint64, uint64)) *indexAdvice {
+
+	advice := &indexAdvice{}
+
+	sort.Sort(indexInstsByName(insts))
+
+	seen := make(map[common.IndexDefnId]bool)
+	equivalent := make(map[string]*duplicateIndexes)
+	var keys []string
+
+	for _, inst := range insts {
+		defn := &inst.Defn
+		wl, ok := workloads[inst.InstId]
+		if !ok || inst.State != common.INDEX_STATE_ACTIVE {
+			continue
+		}
+
+		since := wl.since.Format(time.RFC3339)
+		report := &indexWorkloadReport{
+			Bucket:   defn.Bucket,
+			Name:     defn.Name,
+			NumKeys:  len(defn.SecExprs),
+			NumScans: wl.numScans,
+			Since:    since,
+		}
+
+		maxUsed, covered := 0, false
+		for shape, n := range wl.shapes {
+			report.Shapes = append(report.Shapes, scanShapeCount{shape, n})
+			if shape.UsedKeys > maxUsed {
+				maxUsed = shape.UsedKeys
+			}
+			covered = covered || shape.Covered
+		}
+		sort.Sort(scanShapesByCount(report.Shapes))
+		advice.Indexes = append(advice.Indexes, report)
+
+		if wl.numScans == 0 {
+			advice.Unused = append(advice.Unused,
+				&unusedIndex{Bucket: defn.Bucket, Name: defn.Name, Since: since})
+		}
+
+		// a defn can have more than one instance on a node, e.g. while
+		// an index is being moved or altered
+		if !seen[defn.DefnId] {
+			seen[defn.DefnId] = true
+			key := equivalenceKey(defn)
+			if dup, ok := equivalent[key]; ok {
+				dup.Indexes = append(dup.Indexes, defn.Name)
+			} else {
+				equivalent[key] = &duplicateIndexes{Bucket: defn.Bucket, Indexes: []string{defn.Name}}
+				keys = append(keys, key)
+			}
+		}
+
+		// Scans that never filter on the trailing keys and never read
+		// them back are served equally well by an index on the prefix.
+		if defn.IsPrimary || wl.numScans == 0 || covered ||
+			maxUsed == 0 || maxUsed >= len(defn.SecExprs) {
+			continue
+		}
+
+		advice.PrefixScans = append(advice.PrefixScans, &prefixScanIndex{
+			Bucket:   defn.Bucket,
+			Name:     defn.Name,
+			NumKeys:  len(defn.SecExprs),
+			UsedKeys: maxUsed,
+			NumScans: wl.numScans,
+		})
+
+		items, dataSize := stats(inst.InstId)
+		advice.Suggestions = append(advice.Suggestions,
+			newPrefixSuggestion(defn, maxUsed, items, dataSize))
+	}
+
+	for _, key := range keys {
+		if dup := equivalent[key]; len(dup.Indexes) > 1 {
+			advice.Duplicates = append(advice.Duplicates, dup)
+		}
+	}
+
+	return advice
+}
+
+// equivalenceKey identifies the indexes that can serve the same scans.
+func equivalenceKey(defn *common.IndexDefn) string {
+	var desc []string
+	for i := range defn.SecExprs {
+		if defn.Desc != nil && defn.Desc[i] {
+			desc = append(desc, "desc")
+		} else {
+			desc = append(desc, "asc")
+		}
+	}
+
+	bs, _ := json.Marshal([]interface{}{defn.Bucket, defn.IsPrimary,
+		defn.SecExprs, desc, defn.WhereExpr})
+	return string(bs)
+}
+
+// newPrefixSuggestion suggests an index on the first numKeys keys of defn.
+// Without per-key sizes, the docid is counted as one more key when
+// splitting the average entry size.
+func newPrefixSuggestion(defn *common.IndexDefn, numKeys int,
+	items uint64, dataSize uint64) *indexSuggestion {
+
+	sdefn := common.IndexDefn{
+		Name:       fmt.Sprintf("%s_prefix%d", defn.Name, numKeys),
+		Bucket:     defn.Bucket,
+		SecExprs:   defn.SecExprs[:numKeys],
+		WhereExpr:  defn.WhereExpr,
+		NumReplica: defn.NumReplica,
+	}
+	if defn.Desc != nil {
+		sdefn.Desc = defn.Desc[:numKeys]
+	}
+
+	spec := &planner.IndexSpec{
+		Name:         sdefn.Name,
+		Bucket:       sdefn.Bucket,
+		SecExprs:     sdefn.SecExprs,
+		WhereExpr:    sdefn.WhereExpr,
+		IsArrayIndex: defn.IsArrayIndex,
+		Replica:      uint64(defn.NumReplica) + 1,
+		NumDoc:       items,
+	}
+	if items != 0 {
+		keySize := dataSize / items / uint64(len(defn.SecExprs)+1)
+		spec.SecKeySize = keySize * uint64(numKeys)
+		spec.DocKeySize = keySize
+	}
+
+	return &indexSuggestion{
+		Bucket: defn.Bucket,
+		Reason: fmt.Sprintf("Scans on %v only use the first %v of %v index keys",
+			defn.Name, numKeys, len(defn.SecExprs)),
+		Statement: common.IndexStatement(sdefn, false),
+		spec:      spec,
+	}
+}
+
+// checkPlacement plans the suggested indexes together on the current
+// cluster layout, and fills in the nodes they would be placed on.
+func checkPlacement(clusterUrl string, suggestions []*indexSuggestion) error {
+
+	if len(suggestions) == 0 {
+		return nil
+	}
+
+	plan, err := planner.RetrievePlanFromCluster(clusterUrl)
+	if err != nil {
+		return err
+	}
+
+	var specs []*planner.IndexSpec
+	for _, sg := range suggestions {
+		specs = append(specs, sg.spec)
+	}
+
+	solution, err := planner.ExecutePlanWithOptions(plan, specs, false, "", "", 0, -1, -1, -1, "", false)
+	if err != nil {
+		return err
+	}
+
+	for _, indexer := range solution.Placement {
+		for _, index := range indexer.Indexes {
+			for _, sg := range suggestions {
+				if index.Bucket == sg.spec.Bucket && index.Name == sg.spec.Name {
+					sg.Nodes = append(sg.Nodes, indexer.NodeId)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *scanCoordinator) handleIndexAdvisorReq(w http.ResponseWriter, r *http.Request) {
+
+	if !s.validateAuth(w, r) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	var insts []common.IndexInst
+	s.mu.RLock()
+	for _, inst := range s.indexInstMap {
+		insts = append(insts, inst)
+	}
+	idxStats := s.stats.Get()
+	s.mu.RUnlock()
+
+	stats := func(instId common.IndexInstId) (uint64, uint64) {
+		if idxStats != nil {
+			if st, ok := idxStats.indexes[instId]; ok {
+				return uint64(st.itemsCount.Value()), uint64(st.dataSize.Value())
+			}
+		}
+		return 0, 0
+	}
+
+	advice := adviseIndexes(insts, s.copyScanWorkloads(), stats)
+	clusterAddr := s.config.Load()["clusterAddr"].String()
+	if err := checkPlacement(clusterAddr, advice.Suggestions); err != nil {
+		logging.Errorf("%v: Index advisor failed to place suggested indexes: %v", s.logPrefix, err)
+		advice.PlacementError = err.Error()
+	}
+
+	data, err := json.Marshal(advice)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
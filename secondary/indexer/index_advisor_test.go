@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+func TestScanShape(t *testing.T) {
+	k1, k2 := secondaryKey("[1]"), secondaryKey("[2]")
+
+	r := &ScanRequest{
+		ScanType: ScanReq,
+		Scans: []Scan{{
+			ScanType: FilterRangeReq,
+			Filters: []Filter{{
+				CompositeFilters: []CompositeElementFilter{
+					{Low: &k1, High: &k1, Inclusion: Both},
+					{Low: MinIndexKey, High: MaxIndexKey, Inclusion: Both},
+					{Low: &k1, High: &k2, Inclusion: Both},
+				},
+			}},
+		}},
+		Indexprojection: &protobuf.IndexProjection{},
+	}
+
+	expected := scanShape{EqKeys: 1, UsedKeys: 3}
+	if shape := newScanShape(r); shape != expected {
+		t.Errorf("Expected shape %+v, received %+v", expected, shape)
+	}
+
+	r.Indexprojection.EntryKeys = []int64{0}
+	r.Scans[0].Filters[0].CompositeFilters = r.Scans[0].Filters[0].CompositeFilters[:2]
+	expected = scanShape{EqKeys: 1, UsedKeys: 1, Covered: true}
+	if shape := newScanShape(r); shape != expected {
+		t.Errorf("Expected shape %+v, received %+v", expected, shape)
+	}
+
+	r = &ScanRequest{ScanType: ScanAllReq, Scans: []Scan{{ScanType: AllReq}}}
+	expected = scanShape{}
+	if shape := newScanShape(r); shape != expected {
+		t.Errorf("Expected shape %+v, received %+v", expected, shape)
+	}
+}
+
+func TestAdviseIndexes(t *testing.T) {
+	newInst := func(instId common.IndexInstId, name string, exprs ...string) common.IndexInst {
+		return common.IndexInst{
+			InstId: instId,
+			State:  common.INDEX_STATE_ACTIVE,
+			Defn: common.IndexDefn{
+				DefnId:   common.IndexDefnId(instId),
+				Name:     name,
+				Bucket:   "default",
+				SecExprs: exprs,
+			},
+		}
+	}
+
+	insts := []common.IndexInst{
+		newInst(1, "idx_abc", "`a`", "`b`", "`c`"),
+		newInst(2, "idx_abc_copy", "`a`", "`b`", "`c`"),
+		newInst(3, "idx_d", "`d`"),
+	}
+
+	since := time.Now()
+	workloads := map[common.IndexInstId]*indexScanWorkload{
+		1: {since: since, numScans: 10, shapes: map[scanShape]uint64{
+			{EqKeys: 1, UsedKeys: 1}: 7,
+			{EqKeys: 0, UsedKeys: 2}: 3,
+		}},
+		2: {since: since, shapes: map[scanShape]uint64{}},
+		3: {since: since, numScans: 5, shapes: map[scanShape]uint64{
+			{EqKeys: 1, UsedKeys: 1, Covered: true}: 5,
+		}},
+	}
+
+	stats := func(common.IndexInstId) (uint64, uint64) { return 100, 4000 }
+	advice := adviseIndexes(insts, workloads, stats)
+
+	if len(advice.Indexes) != 3 {
+		t.Errorf("Expected 3 index reports, received %v", len(advice.Indexes))
+	}
+
+	if len(advice.Unused) != 1 || advice.Unused[0].Name != "idx_abc_copy" {
+		t.Errorf("Expected idx_abc_copy to be unused, received %+v", advice.Unused)
+	}
+
+	if len(advice.Duplicates) != 1 || len(advice.Duplicates[0].Indexes) != 2 {
+		t.Errorf("Expected one pair of duplicates, received %+v", advice.Duplicates)
+	}
+
+	if len(advice.PrefixScans) != 1 || advice.PrefixScans[0].Name != "idx_abc" ||
+		advice.PrefixScans[0].UsedKeys != 2 {
+		t.Fatalf("Expected prefix scans on idx_abc, received %+v", advice.PrefixScans)
+	}
+
+	if len(advice.Suggestions) != 1 {
+		t.Fatalf("Expected one suggestion, received %v", len(advice.Suggestions))
+	}
+
+	sg := advice.Suggestions[0]
+	stmt := "CREATE INDEX `idx_abc_prefix2` ON `default`(`a`,`b`)"
+	if sg.Statement != stmt {
+		t.Errorf("Expected statement %v, received %v", stmt, sg.Statement)
+	}
+	if sg.spec.Replica != 1 || sg.spec.NumDoc != 100 || sg.spec.SecKeySize != 20 {
+		t.Errorf("Unexpected index spec %+v", sg.spec)
+	}
+}
@@ -0,0 +1,470 @@
+// @copyright 2016 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package indexer
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	l "github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/manager"
+	"github.com/couchbase/indexing/secondary/manager/client"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+)
+
+// Index data backup archives the latest committed snapshot of every
+// active index of a bucket on this node, using the peer snapshot transfer
+// format. Each index is stored under its instance id, with a backup.json
+// entry holding its definition and snapshot timestamp:
+//
+//   <instId>/backup.json
+//   <instId>/<partitionId>/<path relative to the slice directory>
+//
+// Restore unpacks an archive into the indexes of the same name, which must
+// have been created (deferred) on this node from the backed up metadata,
+// and builds them. The build resumes the stream from the snapshot timestamp,
+// which is only possible if the bucket has not failed over to a different
+// branch since the backup.
+
+// archive entry of an index holding its indexBackupInfo
+const indexBackupInfoFile = "backup.json"
+
+// directory under storage_dir used to stage an archive being restored
+const indexRestoreDirName = "index_restore"
+
+type indexBackupInfo struct {
+	Defn        c.IndexDefn   `json:"defn"`
+	InstId      c.IndexInstId `json:"instId"`
+	Ts          *c.TsVbuuid   `json:"ts"`
+	StorageMode string        `json:"storageMode"`
+}
+
+type indexBackupInst struct {
+	info    indexBackupInfo
+	files   []peerSnapshotFile
+	release func() // unpins the snapshot once the files are copied
+}
+
+type indexBackup struct {
+	insts []*indexBackupInst
+	err   error
+}
+
+func (b *indexBackup) size() int64 {
+	var sz int64
+	for _, inst := range b.insts {
+		for _, f := range inst.files {
+			sz += f.size
+		}
+	}
+	return sz
+}
+
+//release unpins the snapshots of the indexes in the backup
+func (b *indexBackup) release() {
+	for _, inst := range b.insts {
+		inst.release()
+	}
+}
+
+type indexRestoreResult struct {
+	defnId c.IndexDefnId
+	err    error
+}
+
+//handleBackupIndexData streams an archive of the committed snapshots of
+//the indexes of a bucket
+func (m *ServiceMgr) handleBackupIndexData(w http.ResponseWriter, r *http.Request) {
+
+	if !m.validateAuth(w, r) {
+		l.Errorf("ServiceMgr::handleBackupIndexData Validation Failure for Request %v", r)
+		return
+	}
+
+	if r.Method != "GET" {
+		sendIndexResponseWithError(http.StatusBadRequest, w, "Unsupported method")
+		return
+	}
+
+	bucket := r.FormValue("bucket")
+	if bucket == "" {
+		sendIndexResponseWithError(http.StatusBadRequest, w, "Missing bucket")
+		return
+	}
+
+	respch := make(chan *indexBackup)
+	m.supvMsgch <- &MsgGetIndexBackup{bucket: bucket, respch: respch}
+	backup := <-respch
+
+	if backup.err != nil {
+		l.Errorf("ServiceMgr::handleBackupIndexData Bucket %v %v", bucket, backup.err)
+		sendIndexResponseWithError(http.StatusInternalServerError, w, backup.err.Error())
+		return
+	}
+
+	l.Infof("ServiceMgr::handleBackupIndexData Sending Bucket %v Indexes %v Size %v",
+		bucket, len(backup.insts), backup.size())
+
+	header := w.Header()
+	header["Content-Type"] = []string{"application/x-tar"}
+	header.Set(peerSnapshotSizeHeader, strconv.FormatInt(backup.size(), 10))
+	w.WriteHeader(http.StatusOK)
+
+	start := time.Now()
+	defer backup.release()
+	if err := writeIndexBackup(w, backup); err != nil {
+		//the client sees a truncated archive
+		l.Errorf("ServiceMgr::handleBackupIndexData Bucket %v Error %v", bucket, err)
+		return
+	}
+
+	l.Infof("ServiceMgr::handleBackupIndexData Sent Bucket %v Took %v", bucket, time.Since(start))
+}
+
+//handleRestoreIndexData restores the indexes of an archive produced by
+//handleBackupIndexData and builds them from the restored snapshots
+func (m *ServiceMgr) handleRestoreIndexData(w http.ResponseWriter, r *http.Request) {
+
+	if !m.validateAuth(w, r) {
+		l.Errorf("ServiceMgr::handleRestoreIndexData Validation Failure for Request %v", r)
+		return
+	}
+
+	if r.Method != "POST" {
+		sendIndexResponseWithError(http.StatusBadRequest, w, "Unsupported method")
+		return
+	}
+
+	m.restoreMu.Lock()
+	defer m.restoreMu.Unlock()
+
+	dir := filepath.Join(m.config.Load()["storage_dir"].String(), indexRestoreDirName)
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	if err := readPeerSnapshot(r.Body, dir, nil, func(int64) {}); err != nil {
+		l.Errorf("ServiceMgr::handleRestoreIndexData Error reading archive %v", err)
+		sendIndexResponseWithError(http.StatusBadRequest, w, err.Error())
+		return
+	}
+
+	infos, err := readIndexBackupInfos(dir)
+	if err != nil {
+		l.Errorf("ServiceMgr::handleRestoreIndexData Error reading archive %v", err)
+		sendIndexResponseWithError(http.StatusBadRequest, w, err.Error())
+		return
+	}
+
+	l.Infof("ServiceMgr::handleRestoreIndexData Received Indexes %v Took %v", len(infos), time.Since(start))
+
+	bucketInfos := make(map[string][]*indexBackupInfo)
+	for _, info := range infos {
+		bucketInfos[info.Defn.Bucket] = append(bucketInfos[info.Defn.Bucket], info)
+	}
+
+	var idList client.IndexIdList
+	var errList []string
+	for bucket, infos := range bucketInfos {
+
+		flogs, err := m.getFailoverLogs(bucket, backupVbnos(infos))
+		if err != nil {
+			l.Errorf("ServiceMgr::handleRestoreIndexData Bucket %v Error fetching failover logs %v", bucket, err)
+			errList = append(errList, fmt.Sprintf("Bucket %v: %v", bucket, err))
+			continue
+		}
+
+		for _, info := range infos {
+			name := info.Defn.Name
+			if err := validateBackupTs(info.Ts, flogs); err != nil {
+				l.Errorf("ServiceMgr::handleRestoreIndexData Index %v:%v Cannot resume from backup %v",
+					bucket, name, err)
+				errList = append(errList, fmt.Sprintf("Index %v:%v: %v", bucket, name, err))
+				continue
+			}
+
+			respch := make(chan *indexRestoreResult)
+			m.supvMsgch <- &MsgRestoreIndexBackup{info: info,
+				dir:    filepath.Join(dir, strconv.FormatUint(uint64(info.InstId), 10)),
+				respch: respch}
+			res := <-respch
+
+			if res.err != nil {
+				l.Errorf("ServiceMgr::handleRestoreIndexData Index %v:%v Error %v", bucket, name, res.err)
+				errList = append(errList, fmt.Sprintf("Index %v:%v: %v", bucket, name, res.err))
+				continue
+			}
+			idList.DefnIds = append(idList.DefnIds, uint64(res.defnId))
+		}
+	}
+
+	if len(idList.DefnIds) != 0 {
+		if err := m.buildRestoredIndexes(idList); err != nil {
+			l.Errorf("ServiceMgr::handleRestoreIndexData Error building indexes %v", err)
+			errList = append(errList, err.Error())
+		}
+	}
+
+	if len(errList) != 0 {
+		sendIndexResponseWithError(http.StatusInternalServerError, w, strings.Join(errList, ", "))
+		return
+	}
+
+	l.Infof("ServiceMgr::handleRestoreIndexData Restored Indexes %v", idList.DefnIds)
+	sendIndexResponse(w)
+}
+
+func (m *ServiceMgr) buildRestoredIndexes(idList client.IndexIdList) error {
+
+	ir := manager.IndexRequest{IndexIds: idList}
+	body, _ := json.Marshal(&ir)
+
+	resp, err := postWithAuth(m.localhttp+"/buildIndex", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	response := new(manager.IndexResponse)
+	if err := convertResponse(resp, response); err != nil {
+		return err
+	}
+	if response.Code == manager.RESP_ERROR {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
+func (m *ServiceMgr) getFailoverLogs(bucket string, vbnos []uint32) (*protobuf.FailoverLogResponse, error) {
+
+	m.cinfo.Lock()
+	if err := m.cinfo.Fetch(); err != nil {
+		m.cinfo.Unlock()
+		return nil, err
+	}
+
+	var addrs []string
+	for _, nid := range m.cinfo.GetNodesByServiceType("projector") {
+		addr, err := m.cinfo.GetServiceAddress(nid, "projector")
+		if err != nil {
+			m.cinfo.Unlock()
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	m.cinfo.Unlock()
+
+	err := errors.New("No projector available")
+	for _, addr := range addrs {
+		var res *protobuf.FailoverLogResponse
+		if res, err = newProjClient(addr).GetFailoverLogs(DEFAULT_POOL, bucket, vbnos); err == nil {
+			return res, nil
+		}
+	}
+	return nil, err
+}
+
+//writeIndexBackup writes the backup of every index to w as a tar archive
+func writeIndexBackup(w io.Writer, backup *indexBackup) error {
+
+	var files []peerSnapshotFile
+	for _, inst := range backup.insts {
+		files = append(files, inst.files...)
+	}
+
+	fds, err := openPeerSnapshotFiles(files)
+	defer closePeerSnapshotFiles(fds)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, inst := range backup.insts {
+		prefix := fmt.Sprintf("%d/", inst.info.InstId)
+
+		bs, err := json.Marshal(&inst.info)
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Name:     prefix + indexBackupInfoFile,
+			Mode:     0644,
+			Size:     int64(len(bs)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(bs); err != nil {
+			return err
+		}
+
+		if err := writePeerSnapshotFiles(tw, prefix, inst.files, fds[:len(inst.files)]); err != nil {
+			return err
+		}
+		fds = fds[len(inst.files):]
+	}
+	return tw.Close()
+}
+
+//readIndexBackupInfos returns the indexes of an archive unpacked into dir
+func readIndexBackupInfos(dir string) ([]*indexBackupInfo, error) {
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*", indexBackupInfoFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []*indexBackupInfo
+	for _, path := range paths {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		info := &indexBackupInfo{}
+		if err := json.Unmarshal(bs, info); err != nil {
+			return nil, err
+		}
+
+		if info.Ts == nil ||
+			filepath.Base(filepath.Dir(path)) != strconv.FormatUint(uint64(info.InstId), 10) {
+			return nil, fmt.Errorf("Invalid index backup %v", path)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+//checkBackupDefn returns an error unless the backed up index has the
+//same definition and storage mode as the index it is restored into, as
+//the index data cannot be used otherwise
+func checkBackupDefn(info *indexBackupInfo, defn *c.IndexDefn) error {
+
+	if info.StorageMode != c.GetStorageMode().String() {
+		return fmt.Errorf("Storage mode %v of backup does not match %v",
+			info.StorageMode, c.GetStorageMode())
+	}
+
+	backup := &info.Defn
+	isDesc := func(desc []bool, i int) bool {
+		return i < len(desc) && desc[i]
+	}
+
+	var mismatch string
+	switch {
+	case backup.Bucket != defn.Bucket || backup.Scope != defn.Scope ||
+		backup.Collection != defn.Collection:
+		mismatch = "keyspace"
+	case backup.IsPrimary != defn.IsPrimary:
+		mismatch = "primary"
+	case backup.ExprType != defn.ExprType ||
+		!reflect.DeepEqual(backup.SecExprs, defn.SecExprs):
+		mismatch = "index keys"
+	case backup.WhereExpr != defn.WhereExpr:
+		mismatch = "where clause"
+	case backup.PartitionScheme != defn.PartitionScheme ||
+		backup.PartitionKey != defn.PartitionKey ||
+		backup.GetNumPartitions() != defn.GetNumPartitions() ||
+		!reflect.DeepEqual(backup.PartitionSplits, defn.PartitionSplits):
+		mismatch = "partitioning"
+	}
+	for i := range defn.SecExprs {
+		if mismatch == "" && isDesc(backup.Desc, i) != isDesc(defn.Desc, i) {
+			mismatch = "collation order"
+		}
+	}
+
+	if mismatch != "" {
+		return fmt.Errorf("Index %v:%v does not match the backup, %v differs",
+			defn.Bucket, defn.Name, mismatch)
+	}
+	return nil
+}
+
+//backupVbnos returns the vbuckets of the backup timestamps
+func backupVbnos(infos []*indexBackupInfo) []uint32 {
+
+	vbs := make(map[uint16]bool)
+	for _, info := range infos {
+		for _, vbno := range info.Ts.GetVbnos() {
+			vbs[vbno] = true
+		}
+	}
+
+	vbnos := make([]uint32, 0, len(vbs))
+	for vbno := range vbs {
+		vbnos = append(vbnos, uint32(vbno))
+	}
+	sort.Sort(vbnoList(vbnos))
+	return vbnos
+}
+
+type vbnoList []uint32
+
+func (v vbnoList) Len() int           { return len(v) }
+func (v vbnoList) Less(i, j int) bool { return v[i] < v[j] }
+func (v vbnoList) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+//validateBackupTs checks that a stream can be resumed from a backup
+//timestamp. The vbuuid of every vbucket has to be in its failover log,
+//with the seqno not past the point where a newer branch was started.
+func validateBackupTs(ts *c.TsVbuuid, flogs *protobuf.FailoverLogResponse) error {
+
+	logs := make(map[uint16]*protobuf.FailoverLog)
+	for _, flog := range flogs.GetLogs() {
+		logs[uint16(flog.GetVbno())] = flog
+	}
+
+	for _, vbno := range ts.GetVbnos() {
+		flog, ok := logs[vbno]
+		if !ok {
+			return fmt.Errorf("Missing failover log for vbucket %v", vbno)
+		}
+
+		vbuuid, seqno := ts.Vbuuids[vbno], ts.Seqnos[vbno]
+		vbuuids, seqnos := flog.GetVbuuids(), flog.GetSeqnos()
+
+		valid := false
+		//failover log entries are ordered from the latest branch
+		for i := range vbuuids {
+			if vbuuids[i] == vbuuid {
+				valid = seqnos[i] <= seqno && (i == 0 || seqno <= seqnos[i-1])
+				break
+			}
+		}
+
+		if !valid {
+			return fmt.Errorf("Vbucket %v vbuuid %v seqno %v does not match failover log",
+				vbno, vbuuid, seqno)
+		}
+	}
+
+	return nil
+}
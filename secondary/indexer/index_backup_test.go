@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestValidateBackupTs(t *testing.T) {
+	// vbucket 0 failed over at seqno 100 from branch 1 to branch 2
+	flogs := &protobuf.FailoverLogResponse{
+		Logs: []*protobuf.FailoverLog{
+			{
+				Vbno:    proto.Uint32(0),
+				Vbuuids: []uint64{2, 1},
+				Seqnos:  []uint64{100, 0},
+			},
+		},
+	}
+
+	tests := []struct {
+		vbuuid uint64
+		seqno  uint64
+		valid  bool
+	}{
+		{2, 150, true},
+		{2, 100, true},
+		{1, 80, true},
+		{1, 100, true},
+		{1, 120, false}, // past the failover point of branch 1
+		{3, 10, false},  // unknown branch
+	}
+
+	for _, test := range tests {
+		ts := common.NewTsVbuuid("default", 2)
+		ts.Vbuuids[0], ts.Seqnos[0] = test.vbuuid, test.seqno
+
+		err := validateBackupTs(ts, flogs)
+		if (err == nil) != test.valid {
+			t.Errorf("vbuuid %v seqno %v: expected valid %v, received %v",
+				test.vbuuid, test.seqno, test.valid, err)
+		}
+	}
+
+	// vbucket 1 has no failover log
+	ts := common.NewTsVbuuid("default", 2)
+	ts.Vbuuids[1], ts.Seqnos[1] = 1, 10
+	if err := validateBackupTs(ts, flogs); err == nil {
+		t.Errorf("Expected error for vbucket without failover log")
+	}
+}
+
+func TestCheckBackupDefn(t *testing.T) {
+	defn := common.IndexDefn{
+		Bucket:    "default",
+		Name:      "idx",
+		SecExprs:  []string{"`a`", "`b`"},
+		WhereExpr: "`a` > 10",
+	}
+	info := &indexBackupInfo{Defn: defn, StorageMode: common.GetStorageMode().String()}
+
+	// same definition, a missing desc means ascending
+	target := defn
+	target.Desc = []bool{false, false}
+	if err := checkBackupDefn(info, &target); err != nil {
+		t.Errorf("Expected no error, received %v", err)
+	}
+
+	mismatches := []func(d *common.IndexDefn){
+		func(d *common.IndexDefn) { d.SecExprs = []string{"`a`"} },
+		func(d *common.IndexDefn) { d.WhereExpr = "" },
+		func(d *common.IndexDefn) { d.IsPrimary = true },
+		func(d *common.IndexDefn) { d.Desc = []bool{false, true} },
+		func(d *common.IndexDefn) {
+			d.PartitionScheme, d.NumPartitions = common.HASH, 4
+		},
+	}
+	for i, mismatch := range mismatches {
+		target := defn
+		mismatch(&target)
+		if err := checkBackupDefn(info, &target); err == nil {
+			t.Errorf("Expected error for mismatch %v", i)
+		}
+	}
+
+	info.StorageMode = "unknown"
+	if err := checkBackupDefn(info, &defn); err == nil {
+		t.Errorf("Expected error for storage mode mismatch")
+	}
+}
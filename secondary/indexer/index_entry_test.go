@@ -99,6 +99,30 @@ func TestSecondaryIndexEntry(t *testing.T) {
 	}
 }
 
+func TestSecondaryIndexEntryCollatedSplit(t *testing.T) {
+	docid := []byte("doc-1")
+	sk := []byte(`["field1",10]`)
+
+	for _, count := range []int{1, 3} {
+		buf := make([]byte, 0, 4096*3)
+		e, err := NewSecondaryIndexEntry(sk, docid, true, count, nil, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, id := siSplitCollatedEntry(e, make([]byte, 0, 300))
+		if !bytes.Equal(docid, id) {
+			t.Errorf("Expected %v, received %v", string(docid), string(id))
+		}
+		text, err := jsonEncoder.Decode(code, make([]byte, 0, 300))
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(sk, text) {
+			t.Errorf("Expected %v, received %v", string(sk), string(text))
+		}
+	}
+}
+
 func TestPrimaryIndexEntryMatch(t *testing.T) {
 	e1, _ := NewPrimaryIndexEntry([]byte("prefixmatch"))
 	k1, _ := NewPrimaryKey([]byte("prefix"))
@@ -126,3 +126,27 @@ func GetSliceSnapshots(is IndexSnapshot) (s []SliceSnapshot) {
 
 	return
 }
+
+// GetPartitionSliceSnapshots returns slice snapshots for the requested
+// partitions of the index snapshot, nil partnIds means all partitions
+// and an empty partnIds means none.
+func GetPartitionSliceSnapshots(is IndexSnapshot,
+	partnIds []common.PartitionId) (s []SliceSnapshot) {
+
+	if partnIds == nil {
+		return GetSliceSnapshots(is)
+	} else if is == nil {
+		return
+	}
+
+	partitions := is.Partitions()
+	for _, partnId := range partnIds {
+		if p, ok := partitions[partnId]; ok {
+			for _, sl := range p.Slices() {
+				s = append(s, sl)
+			}
+		}
+	}
+
+	return
+}
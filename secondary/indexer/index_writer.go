@@ -33,6 +33,10 @@ type IndexWriter interface {
 	//Persist a key/value pair
 	Insert(key []byte, docid []byte, meta *MutationMeta) error
 
+	//Persist a key/value pair and wait till it is applied, returns
+	//true if docid was already indexed in the slice
+	InsertSync(key []byte, docid []byte, meta *MutationMeta) (bool, error)
+
 	//Delete a key/value pair by docId
 	Delete(docid []byte, meta *MutationMeta) error
 
@@ -91,6 +91,10 @@ type indexer struct {
 
 	bucketBuildTs map[string]Timestamp
 
+	//snapshot timestamp of indexes restored from a peer snapshot,
+	//used as restart timestamp when these indexes get built
+	peerRestartTs map[common.IndexInstId]*common.TsVbuuid
+
 	//TODO Remove this once cbq bridge support goes away
 	bucketCreateClientChMap map[string]MsgChannel
 
@@ -190,6 +194,7 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 		streamBucketRequestQueue:     make(map[common.StreamId]map[string]chan *kvRequest),
 		streamBucketRequestLock:      make(map[common.StreamId]map[string]chan *sync.Mutex),
 		bucketBuildTs:                make(map[string]Timestamp),
+		peerRestartTs:                make(map[common.IndexInstId]*common.TsVbuuid),
 		bucketCreateClientChMap:      make(map[string]MsgChannel),
 	}
 
@@ -845,6 +850,21 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 	case INDEXER_UPDATE_RSTATE:
 		idx.handleUpdateIndexRState(msg)
 
+	case INDEXER_GET_SNAPSHOT_FILES:
+		idx.handleGetSnapshotFiles(msg)
+
+	case INDEXER_RESTORE_PEER_SNAPSHOT:
+		idx.handleRestorePeerSnapshot(msg)
+
+	case INDEXER_UPDATE_TRANSFER_PROGRESS:
+		idx.handleUpdateTransferProgress(msg)
+
+	case INDEXER_GET_INDEX_BACKUP:
+		idx.handleGetIndexBackup(msg)
+
+	case INDEXER_RESTORE_INDEX_BACKUP:
+		idx.handleRestoreIndexBackup(msg)
+
 	default:
 		logging.Fatalf("Indexer::handleWorkerMsgs Unknown Message %+v", msg)
 		common.CrashOnError(errors.New("Unknown Msg On Worker Channel"))
@@ -1269,6 +1289,32 @@ func (idx *indexer) handleBuildIndex(msg Message) {
 			continue
 		}
 
+		//indexes restored from a peer snapshot only need to catch up
+		//from the snapshot timestamp
+		restartTs, err := idx.getPeerRestartTs(instIdList)
+		if err != nil {
+			errStr := err.Error()
+			logging.Errorf("Indexer::handleBuildIndex %v %v", errStr, instIdList)
+			if idx.enableManager {
+				idx.bulkUpdateError(instIdList, errStr)
+				for _, instId := range instIdList {
+					errMap[instId] = &common.IndexerError{Reason: errStr, Code: common.TransientError}
+				}
+				delete(bucketIndexList, bucket)
+				continue
+			} else if clientCh != nil {
+				clientCh <- &MsgError{
+					err: Error{code: ERROR_INDEXER_INTERNAL_ERROR,
+						severity: FATAL,
+						cause:    err,
+						category: INDEXER}}
+				return
+			}
+		}
+		for _, instId := range instIdList {
+			delete(idx.peerRestartTs, instId)
+		}
+
 		//if there is already an index for this bucket in MAINT_STREAM,
 		//add this index to INIT_STREAM
 		var buildStream common.StreamId
@@ -1310,7 +1356,7 @@ func (idx *indexer) handleBuildIndex(msg Message) {
 		}
 
 		//send Stream Update to workers
-		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, clientCh)
+		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, restartTs, clientCh)
 
 		idx.stateLock.Lock()
 		if _, ok := idx.streamBucketStatus[buildStream]; !ok {
@@ -1857,6 +1903,7 @@ func (idx *indexer) cleanupIndexData(indexInst common.IndexInst,
 	//update internal maps
 	delete(idx.indexInstMap, indexInstId)
 	delete(idx.indexPartnMap, indexInstId)
+	delete(idx.peerRestartTs, indexInstId)
 
 	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
 	msgUpdateIndexPartnMap := &MsgUpdatePartnMap{indexPartnMap: idx.indexPartnMap}
@@ -1942,7 +1989,8 @@ func (idx *indexer) Shutdown() Message {
 }
 
 func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstId,
-	buildStream common.StreamId, bucket string, buildTs Timestamp, clientCh MsgChannel) bool {
+	buildStream common.StreamId, bucket string, buildTs Timestamp,
+	restartTs *common.TsVbuuid, clientCh MsgChannel) bool {
 
 	var cmd Message
 	var indexList []common.IndexInst
@@ -1961,7 +2009,7 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 		indexList: indexList,
 		buildTs:   buildTs,
 		respCh:    respCh,
-		restartTs: nil}
+		restartTs: restartTs}
 
 	//send stream update to timekeeper
 	if resp := idx.sendStreamUpdateToWorker(cmd, idx.tkCmdCh,
@@ -2034,6 +2082,19 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 					}
 
 				case INDEXER_ROLLBACK:
+					//a build restarting from a peer snapshot can be rolled back,
+					//recover the stream the same way as on restart
+					if restartTs != nil {
+						logging.Infof("Indexer::sendStreamUpdateForBuildIndex Rollback from "+
+							"Projector For Stream %v Bucket %v", buildStream, bucket)
+						rollbackTs := resp.(*MsgRollback).GetRollbackTs()
+						idx.internalRecvCh <- &MsgRecovery{mType: INDEXER_INIT_PREP_RECOVERY,
+							streamId:  buildStream,
+							bucket:    bucket,
+							restartTs: rollbackTs}
+						break retryloop
+					}
+
 					//an initial build request should never receive rollback message
 					logging.Errorf("Indexer::sendStreamUpdateForBuildIndex Unexpected Rollback from "+
 						"Projector during Initial Stream Request %v", resp)
@@ -2233,13 +2294,20 @@ func (idx *indexer) initPartnInstance(indexInst common.IndexInst,
 		logging.Infof("Indexer::initPartnInstance Initialized Partition: \n\t Index: %v Partition: %v",
 			indexInst.InstId, partnInst)
 
+		//for hash partitioned index, partition id is the hash bucket
+		//of the partition key, see flusher.
+		partnId := common.PartitionId(i)
+		if indexInst.Defn.IsPartitioned() {
+			partnId = partnDefn.GetPartitionId()
+		}
+
 		//add a single slice per partition for now
-		if slice, err := NewSlice(SliceId(0), &indexInst, idx.config, idx.stats); err == nil {
+		if slice, err := NewSlice(partnId, SliceId(0), &indexInst, idx.config, idx.stats); err == nil {
 			partnInst.Sc.AddSlice(0, slice)
 			logging.Infof("Indexer::initPartnInstance Initialized Slice: \n\t Index: %v Slice: %v",
 				indexInst.InstId, slice)
 
-			partnInstMap[common.PartitionId(i)] = partnInst
+			partnInstMap[partnId] = partnInst
 		} else {
 			errStr := fmt.Sprintf("Error creating slice %v", err)
 			logging.Errorf("Indexer::initPartnInstance %v. Abort.", errStr)
@@ -2386,12 +2454,14 @@ func (idx *indexer) checkDuplicateIndex(indexInst common.IndexInst,
 	}
 
 	//if the index name already exists for the same bucket,
-	//return error
+	//return error. shadow index shares the name of the index
+	//it replaces.
 	for _, index := range idx.indexInstMap {
 
 		if index.Defn.Name == indexInst.Defn.Name &&
 			index.Defn.Bucket == indexInst.Defn.Bucket &&
-			index.State != common.INDEX_STATE_DELETED {
+			index.State != common.INDEX_STATE_DELETED &&
+			index.Defn.DefnId != indexInst.Defn.ShadowOf {
 
 			logging.Errorf("Indexer::checkDuplicateIndex Duplicate Index Name. "+
 				"Name: %v, Duplicate Index: %v", indexInst.Defn.Name, index)
@@ -2491,6 +2561,322 @@ func (idx *indexer) handleUpdateIndexRState(msg Message) {
 	respCh <- true
 }
 
+//handleGetSnapshotFiles lists the files of the latest committed snapshot
+//of every partition of an index, to be streamed to a peer indexer.
+func (idx *indexer) handleGetSnapshotFiles(msg Message) {
+
+	instId := msg.(*MsgGetSnapshotFiles).GetInstId()
+	respCh := msg.(*MsgGetSnapshotFiles).GetRespCh()
+
+	inst, ok := idx.indexInstMap[instId]
+	if !ok || inst.State != common.INDEX_STATE_ACTIVE {
+		logging.Errorf("Indexer::handleGetSnapshotFiles Index %v Not Found Or Not Active", instId)
+		respCh <- &peerSnapshot{err: common.ErrIndexNotFound}
+		return
+	}
+
+	files, _, release, err := idx.getSnapshotFiles(instId)
+	if err != nil {
+		respCh <- &peerSnapshot{err: err}
+		return
+	}
+
+	ps := &peerSnapshot{files: files, release: release}
+
+	logging.Infof("Indexer::handleGetSnapshotFiles Index %v Files %v Size %v",
+		instId, len(ps.files), ps.size())
+
+	respCh <- ps
+}
+
+//getSnapshotFiles returns the files of the latest committed snapshot of
+//every partition of an index, along with the oldest timestamp of those
+//snapshots. The slices are pinned until release is called, once the
+//files have been copied.
+func (idx *indexer) getSnapshotFiles(instId common.IndexInstId) (files []peerSnapshotFile,
+	snapTs *common.TsVbuuid, release func(), err error) {
+
+	var pinned []snapshotPinner
+	release = func() {
+		for _, p := range pinned {
+			p.unpinSnapshots()
+		}
+	}
+
+	for partnId, partnInst := range idx.indexPartnMap[instId] {
+		slice := partnInst.Sc.GetSliceById(0)
+		pinner, ok := slice.(snapshotPinner)
+		if !ok {
+			err = ErrPeerSnapshotUnsupported
+		} else {
+			pinner.pinSnapshots()
+			pinned = append(pinned, pinner)
+
+			var pfiles []peerSnapshotFile
+			var ts *common.TsVbuuid
+			if pfiles, ts, err = listPeerSnapshotFiles(partnId, slice); err == nil {
+				files = append(files, pfiles...)
+				if snapTs == nil || !ts.AsRecent(snapTs) {
+					snapTs = ts
+				}
+			}
+		}
+		if err != nil {
+			logging.Errorf("Indexer::getSnapshotFiles Index %v Partition %v Error %v",
+				instId, partnId, err)
+			release()
+			return nil, nil, nil, err
+		}
+	}
+
+	return files, snapTs, release, nil
+}
+
+//handleRestorePeerSnapshot replaces the slices of indexes of a bucket,
+//which have not been built yet, with the snapshot files copied from a
+//peer indexer. Indexes of a bucket are built together, so either all of
+//them are restored or, on error, none of them and they are built from
+//scratch.
+func (idx *indexer) handleRestorePeerSnapshot(msg Message) {
+
+	dirs := msg.(*MsgRestorePeerSnapshot).GetDirs()
+	respCh := msg.(*MsgRestorePeerSnapshot).GetRespCh()
+
+	var err error
+	for instId, dir := range dirs {
+		if err = idx.restorePeerSnapshot(instId, dir); err != nil {
+			break
+		}
+	}
+
+	if err != nil {
+		for instId, dir := range dirs {
+			idx.discardPeerSnapshot(instId)
+			os.RemoveAll(dir)
+		}
+	}
+
+	respCh <- err
+}
+
+//restorePeerSnapshot moves the partition snapshots staged in dir into the
+//slices of an index which has not been built yet. The snapshot timestamp
+//is remembered so that the build only needs to catch up from it. If the
+//snapshot cannot be restored, the index is left with empty slices and
+//is built from scratch.
+func (idx *indexer) restorePeerSnapshot(instId common.IndexInstId, dir string) error {
+
+	logging.Infof("Indexer::restorePeerSnapshot Index %v Dir %v", instId, dir)
+
+	defer os.RemoveAll(dir)
+
+	inst, ok := idx.indexInstMap[instId]
+	if !ok || inst.State != common.INDEX_STATE_READY {
+		errStr := fmt.Sprintf("Index %v Not Found Or Already Built", instId)
+		logging.Errorf("Indexer::restorePeerSnapshot %v", errStr)
+		return errors.New(errStr)
+	}
+
+	restartTs, err := idx.replaceSlices(inst, dir)
+	if err == nil && restartTs == nil {
+		err = fmt.Errorf("No Valid Snapshot Found For Index %v", instId)
+	}
+	if err != nil {
+		logging.Errorf("Indexer::restorePeerSnapshot Index %v %v", instId, err)
+		idx.discardPeerSnapshot(instId)
+		return err
+	}
+
+	logging.Infof("Indexer::restorePeerSnapshot Index %v Restored To %v", instId, restartTs)
+
+	idx.peerRestartTs[instId] = restartTs
+	return nil
+}
+
+//discardPeerSnapshot replaces the slices of an index, which has not been
+//built yet, with empty slices so that it is built from scratch.
+func (idx *indexer) discardPeerSnapshot(instId common.IndexInstId) {
+
+	delete(idx.peerRestartTs, instId)
+
+	inst, ok := idx.indexInstMap[instId]
+	if !ok || inst.State != common.INDEX_STATE_READY {
+		return
+	}
+
+	logging.Infof("Indexer::discardPeerSnapshot Index %v", instId)
+
+	if _, err := idx.replaceSlices(inst, ""); err != nil {
+		common.CrashOnError(err)
+	}
+}
+
+//replaceSlices replaces the slices of an index which has not been built
+//yet with the partition snapshots staged in dir, or with empty slices if
+//dir is empty. Returns the oldest snapshot timestamp across partitions.
+func (idx *indexer) replaceSlices(inst common.IndexInst, dir string) (*common.TsVbuuid, error) {
+
+	//the slices have never been flushed, so there cannot be any snapshot
+	//holding a reference and Destroy removes the files right away
+	var restartTs *common.TsVbuuid
+	var err error
+	partnInstMap := idx.indexPartnMap[inst.InstId]
+	for partnId, partnInst := range partnInstMap {
+		slice := partnInst.Sc.GetSliceById(0)
+		path := slice.Path()
+		slice.Close()
+		slice.Destroy()
+
+		if dir != "" && err == nil {
+			if err = os.Rename(peerPartnDir(dir, partnId), path); err != nil {
+				err = fmt.Errorf("Error moving snapshot of partition %v: %v", partnId, err)
+			}
+		}
+
+		newSlice, err1 := NewSlice(partnId, SliceId(0), &inst, idx.config, idx.stats)
+		if err1 != nil {
+			errStr := fmt.Sprintf("Error reopening slice %v", err1)
+			logging.Errorf("Indexer::replaceSlices Index %v %v", inst.InstId, errStr)
+			common.CrashOnError(errors.New(errStr))
+		}
+		partnInst.Sc.UpdateSlice(SliceId(0), newSlice)
+
+		if dir == "" || err != nil {
+			continue
+		}
+
+		infos, err1 := newSlice.GetSnapshots()
+		if err1 != nil {
+			common.CrashOnError(err1)
+		}
+
+		//restart from the oldest snapshot across partitions
+		latest := NewSnapshotInfoContainer(infos).GetLatest()
+		if latest == nil {
+			err = fmt.Errorf("No Valid Snapshot Found For Partition %v", partnId)
+		} else if ts := latest.Timestamp(); restartTs == nil || !ts.AsRecent(restartTs) {
+			restartTs = ts
+		}
+	}
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+	msgUpdateIndexPartnMap := &MsgUpdatePartnMap{indexPartnMap: idx.indexPartnMap}
+
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, msgUpdateIndexPartnMap); err != nil {
+		common.CrashOnError(err)
+	}
+
+	idx.storageMgrCmdCh <- &MsgUpdateSnapMap{idxInstId: inst.InstId}
+	<-idx.storageMgrCmdCh
+
+	if err != nil {
+		return nil, err
+	}
+	return restartTs, nil
+}
+
+func (idx *indexer) handleUpdateTransferProgress(msg Message) {
+
+	instId := msg.(*MsgUpdateTransferProgress).GetInstId()
+	progress := msg.(*MsgUpdateTransferProgress).GetProgress()
+
+	if stats, ok := idx.stats.indexes[instId]; ok {
+		stats.transferProgress.Set(progress)
+	}
+}
+
+//handleGetIndexBackup collects the committed snapshot files and timestamp
+//of every active index of a bucket for a backup
+func (idx *indexer) handleGetIndexBackup(msg Message) {
+
+	bucket := msg.(*MsgGetIndexBackup).GetBucket()
+	respCh := msg.(*MsgGetIndexBackup).GetRespCh()
+
+	backup := &indexBackup{}
+	for instId, inst := range idx.indexInstMap {
+		if inst.Defn.Bucket != bucket || inst.State != common.INDEX_STATE_ACTIVE {
+			continue
+		}
+
+		files, ts, release, err := idx.getSnapshotFiles(instId)
+		if err != nil {
+			backup.release()
+			respCh <- &indexBackup{err: err}
+			return
+		}
+
+		backup.insts = append(backup.insts, &indexBackupInst{
+			info: indexBackupInfo{
+				Defn:        inst.Defn,
+				InstId:      instId,
+				Ts:          ts,
+				StorageMode: common.GetStorageMode().String(),
+			},
+			files:   files,
+			release: release,
+		})
+	}
+
+	logging.Infof("Indexer::handleGetIndexBackup Bucket %v Indexes %v", bucket, len(backup.insts))
+
+	respCh <- backup
+}
+
+//handleRestoreIndexBackup restores the snapshot of a backed up index into
+//the index of the same name, which must have been created but not built
+//with the same definition
+func (idx *indexer) handleRestoreIndexBackup(msg Message) {
+
+	info := msg.(*MsgRestoreIndexBackup).GetInfo()
+	dir := msg.(*MsgRestoreIndexBackup).GetDir()
+	respCh := msg.(*MsgRestoreIndexBackup).GetRespCh()
+
+	bucket, name := info.Defn.Bucket, info.Defn.Name
+	for instId, inst := range idx.indexInstMap {
+		if inst.Defn.Bucket == bucket && inst.Defn.Name == name &&
+			inst.Defn.KeyspaceId() == info.Defn.KeyspaceId() {
+
+			if err := checkBackupDefn(info, &inst.Defn); err != nil {
+				logging.Errorf("Indexer::handleRestoreIndexBackup %v", err)
+				respCh <- &indexRestoreResult{defnId: inst.Defn.DefnId, err: err}
+				return
+			}
+
+			err := idx.restorePeerSnapshot(instId, dir)
+			respCh <- &indexRestoreResult{defnId: inst.Defn.DefnId, err: err}
+			return
+		}
+	}
+
+	logging.Errorf("Indexer::handleRestoreIndexBackup Index %v:%v Not Found", bucket, name)
+	respCh <- &indexRestoreResult{err: common.ErrIndexNotFound}
+}
+
+//getPeerRestartTs returns the timestamp from which a bucket's indexes
+//can be built, if all of them were restored from a peer snapshot.
+//Indexes built from scratch cannot share a stream with restored ones.
+func (idx *indexer) getPeerRestartTs(instIdList []common.IndexInstId) (*common.TsVbuuid, error) {
+
+	var restartTs *common.TsVbuuid
+	var numRestored int
+
+	for _, instId := range instIdList {
+		if ts, ok := idx.peerRestartTs[instId]; ok {
+			numRestored++
+			if restartTs == nil || !ts.AsRecent(restartTs) {
+				restartTs = ts
+			}
+		}
+	}
+
+	if numRestored != 0 && numRestored != len(instIdList) {
+		return nil, errors.New("Cannot Build Indexes Restored From Peer " +
+			"Snapshot Together With Other Indexes")
+	}
+
+	return restartTs, nil
+}
+
 //TODO If this function gets error before its finished, the state
 //can be inconsistent. This needs to be fixed.
 func (idx *indexer) handleInitialBuildDone(msg Message) {
@@ -3428,17 +3814,21 @@ func (idx *indexer) initFromPersistedState() error {
 			idx.stats.AddIndex(inst.InstId, inst.Defn.Bucket, inst.Defn.Name, inst.ReplicaId)
 		}
 
-		newpc := common.NewKeyPartitionContainer()
-
-		//Add one partition for now
-		partnId := common.PartitionId(0)
 		addr := net.JoinHostPort("", idx.config["streamMaintPort"].String())
-		endpt := []common.Endpoint{common.Endpoint(addr)}
-		partnDefn := common.KeyPartitionDefn{Id: partnId,
-			Endpts: endpt}
-		newpc.AddPartition(partnId, partnDefn)
+		if inst.Defn.IsPartitioned() {
+			inst.Pc = makePartitionContainer(&inst.Defn, addr, inst.ReplicaId)
+		} else {
+			newpc := common.NewKeyPartitionContainer()
 
-		inst.Pc = newpc
+			//Add one partition for now
+			partnId := common.PartitionId(0)
+			endpt := []common.Endpoint{common.Endpoint(addr)}
+			partnDefn := common.KeyPartitionDefn{Id: partnId,
+				Endpts: endpt}
+			newpc.AddPartition(partnId, partnDefn)
+
+			inst.Pc = newpc
+		}
 
 		//allocate partition/slice
 		var partnInstMap PartitionInstMap
@@ -4198,7 +4588,7 @@ func (idx *indexer) memoryUsedStorage() int64 {
 	return mem_used
 }
 
-func NewSlice(id SliceId, indInst *common.IndexInst,
+func NewSlice(partnId common.PartitionId, id SliceId, indInst *common.IndexInst,
 	conf common.Config, stats *IndexerStats) (slice Slice, err error) {
 	// Default storage is forestdb
 	storage_dir := conf["storage_dir"].String()
@@ -4206,7 +4596,7 @@ func NewSlice(id SliceId, indInst *common.IndexInst,
 	if _, e := os.Stat(storage_dir); e != nil {
 		common.CrashOnError(e)
 	}
-	path := filepath.Join(storage_dir, IndexPath(indInst, id))
+	path := filepath.Join(storage_dir, IndexPartnPath(indInst, partnId, id))
 
 	switch indInst.Defn.Using {
 	case common.MemDB, common.MemoryOptimized:
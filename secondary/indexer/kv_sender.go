@@ -281,6 +281,9 @@ func (k *kvSender) openMutationStream(streamId c.StreamId, indexInstList []c.Ind
 	var rollbackTs *protobuf.TsVbuuid
 	var activeTs *protobuf.TsVbuuid
 	topic := getTopicForStreamId(streamId)
+	//indexes are built from only their collections, while MAINT_STREAM
+	//streams all collections of the bucket as indexes get added to it
+	filter := streamId == c.INIT_STREAM
 
 	fn := func(r int, err error) error {
 
@@ -290,7 +293,7 @@ func (k *kvSender) openMutationStream(streamId c.StreamId, indexInstList []c.Ind
 
 			execWithStopCh(func() {
 				ap := newProjClient(addr)
-				if res, ret := k.sendMutationTopicRequest(ap, topic, restartTsList, protoInstList); ret != nil {
+				if res, ret := k.sendMutationTopicRequest(ap, topic, restartTsList, protoInstList, filter); ret != nil {
 					//for all errors, retry
 					logging.Errorf("KVSender::openMutationStream %v %v Error Received %v from %v",
 						streamId, bucket, ret, addr)
@@ -685,7 +688,7 @@ func (k *kvSender) closeMutationStream(streamId c.StreamId, bucket string,
 //send the actual MutationStreamRequest on adminport
 func (k *kvSender) sendMutationTopicRequest(ap *projClient.Client, topic string,
 	reqTimestamps *protobuf.TsVbuuid,
-	instances []*protobuf.Instance) (*protobuf.TopicResponse, error) {
+	instances []*protobuf.Instance, filterCollections bool) (*protobuf.TopicResponse, error) {
 
 	logging.Infof("KVSender::sendMutationTopicRequest Projector %v Topic %v %v \n\tInstances %v",
 		ap, topic, reqTimestamps.GetBucket(), instances)
@@ -695,7 +698,7 @@ func (k *kvSender) sendMutationTopicRequest(ap *projClient.Client, topic string,
 	endpointType := "dataport"
 
 	if res, err := ap.MutationTopicRequest(topic, endpointType,
-		[]*protobuf.TsVbuuid{reqTimestamps}, instances); err != nil {
+		[]*protobuf.TsVbuuid{reqTimestamps}, instances, filterCollections); err != nil {
 		logging.Errorf("KVSender::sendMutationTopicRequest Projector %v Topic %v %v \n\tUnexpected Error %v", ap,
 			topic, reqTimestamps.GetBucket(), err)
 
@@ -1172,6 +1175,11 @@ func convertIndexDefnToProtobuf(indexDefn c.IndexDefn) *protobuf.IndexDefn {
 		PartnExpression: proto.String(indexDefn.PartitionKey),
 		WhereExpression: proto.String(indexDefn.WhereExpr),
 	}
+	if !indexDefn.IsDefaultCollection() {
+		defn.Scope = proto.String(indexDefn.Scope)
+		defn.Collection = proto.String(indexDefn.Collection)
+		defn.CollectionID = proto.Uint32(indexDefn.CollectionId)
+	}
 
 	return defn
 
@@ -1193,7 +1201,7 @@ func addPartnInfoToProtoInst(cfg c.Config, cinfo *c.ClusterInfoCache,
 	indexInst c.IndexInst, streamId c.StreamId, protoInst *protobuf.IndexInst) {
 
 	switch partn := indexInst.Pc.(type) {
-	case *c.KeyPartitionContainer:
+	case *c.KeyPartitionContainer, *c.RangePartitionContainer:
 
 		//Right now the fill the SinglePartition as that is the only
 		//partition structure supported
@@ -1214,19 +1222,49 @@ func addPartnInfoToProtoInst(cfg c.Config, cinfo *c.ClusterInfoCache,
 		streamInitAddr := net.JoinHostPort(host, cfg["streamInitPort"].String())
 		streamCatchupAddr := net.JoinHostPort(host, cfg["streamCatchupPort"].String())
 
+		//Set the right endpoint based on streamId
+		streamEndpoint := func(e c.Endpoint) string {
+			switch streamId {
+			case c.MAINT_STREAM:
+				e = c.Endpoint(streamMaintAddr)
+			case c.CATCHUP_STREAM:
+				e = c.Endpoint(streamCatchupAddr)
+			case c.INIT_STREAM:
+				e = c.Endpoint(streamInitAddr)
+			}
+			return string(e)
+		}
+
+		if indexInst.Defn.IsPartitioned() {
+			//endpoint for each partition, ordered by partition id, so that
+			//projector routes the partition key to the same partition as
+			//the flusher. Partitions hosted by other indexer nodes are
+			//left without an endpoint.
+			endpoints := make([]string, indexInst.Defn.GetNumPartitions())
+			for _, p := range partnDefn {
+				id := int(p.GetPartitionId())
+				if id < 0 || id >= len(endpoints) {
+					logging.Errorf("KVSender::addPartnInfoToProtoInst Invalid Partition "+
+						"Id %v for Index %v", id, indexInst.InstId)
+					continue
+				}
+				for _, e := range p.Endpoints() {
+					endpoints[id] = streamEndpoint(e)
+				}
+			}
+			if indexInst.Defn.PartitionScheme == c.RANGE {
+				protoInst.RangePartn = protobuf.NewRangePartition(
+					endpoints, indexInst.Defn.PartitionSplits)
+			} else {
+				protoInst.HashPartn = protobuf.NewHashPartition(endpoints)
+			}
+			return
+		}
+
 		var endpoints []string
 		for _, p := range partnDefn {
 			for _, e := range p.Endpoints() {
-				//Set the right endpoint based on streamId
-				switch streamId {
-				case c.MAINT_STREAM:
-					e = c.Endpoint(streamMaintAddr)
-				case c.CATCHUP_STREAM:
-					e = c.Endpoint(streamCatchupAddr)
-				case c.INIT_STREAM:
-					e = c.Endpoint(streamInitAddr)
-				}
-				endpoints = append(endpoints, string(e))
+				endpoints = append(endpoints, streamEndpoint(e))
 			}
 		}
 		protoInst.SinglePartn = &protobuf.SinglePartition{
@@ -41,11 +41,14 @@ const (
 )
 
 const tmpDirName = ".tmp"
+const mergeDirName = ".tmp.merge"
 
 type indexMutation struct {
 	op    int
 	key   []byte
 	docid []byte
+	// if not nil, whether docid was indexed is sent once applied.
+	existCh chan bool
 }
 
 func docIdFromEntryBytes(e []byte) []byte {
@@ -117,6 +120,7 @@ type memdbSlice struct {
 	flushedCount                          platform.AlignedUint64
 	committedCount                        platform.AlignedUint64
 	qCount                                platform.AlignedInt64
+	numDocsIndexed                        platform.AlignedInt64
 
 	path string
 	id   SliceId
@@ -162,6 +166,18 @@ type memdbSlice struct {
 	confLock sync.RWMutex
 
 	isPersistorActive int32
+	isMergerActive    int32
+
+	// Last persisted snapshot, kept open as the base of the next
+	// incremental disk snapshot
+	persistLock   sync.Mutex
+	persistedSnap *memdb.Snapshot
+	persistedDir  string
+	storeGen      uint64
+
+	// Disk snapshots are not cleaned up while pinned for a copy
+	pinLock sync.Mutex
+	pins    int
 
 	// Array processing
 	arrayExprPosition int
@@ -295,6 +311,19 @@ func (mdb *memdbSlice) Insert(key []byte, docid []byte, meta *MutationMeta) erro
 	return mdb.fatalDbErr
 }
 
+func (mdb *memdbSlice) InsertSync(key []byte, docid []byte, meta *MutationMeta) (bool, error) {
+	mut := indexMutation{
+		op:      opUpdate,
+		key:     key,
+		docid:   docid,
+		existCh: make(chan bool, 1),
+	}
+	platform.AddInt64(&mdb.qCount, 1)
+	mdb.cmdCh[int(meta.vbucket)%mdb.numWriters] <- mut
+	mdb.idxStats.numDocsFlushQueued.Add(1)
+	return <-mut.existCh, mdb.fatalDbErr
+}
+
 func (mdb *memdbSlice) Delete(docid []byte, meta *MutationMeta) error {
 	mdb.idxStats.numDocsFlushQueued.Add(1)
 	platform.AddInt64(&mdb.qCount, 1)
@@ -315,9 +344,16 @@ loop:
 			switch icmd.op {
 			case opUpdate:
 				start = time.Now()
+				var exists bool
+				if icmd.existCh != nil {
+					exists = mdb.exists(icmd.docid, workerId)
+				}
 				nmut = mdb.insert(icmd.key, icmd.docid, workerId)
 				elapsed = time.Since(start)
 				mdb.totalFlushTime += elapsed
+				if icmd.existCh != nil {
+					icmd.existCh <- exists
+				}
 
 			case opDelete:
 				start = time.Now()
@@ -332,6 +368,7 @@ loop:
 
 			mdb.idxStats.numItemsFlushed.Add(int64(nmut))
 			mdb.idxStats.numDocsIndexed.Add(1)
+			platform.AddInt64(&mdb.numDocsIndexed, 1)
 			platform.AddInt64(&mdb.qCount, -1)
 
 		case <-mdb.stopCh[workerId]:
@@ -345,6 +382,15 @@ loop:
 	}
 }
 
+//exists returns true if docid is indexed in the slice, entries of
+//primary index are not looked up.
+func (mdb *memdbSlice) exists(docid []byte, workerId int) bool {
+	if mdb.isPrimary {
+		return false
+	}
+	return mdb.back[workerId].Get(entryBytesFromDocId(docid)) != nil
+}
+
 func (mdb *memdbSlice) insert(key []byte, docid []byte, workerId int) int {
 	var nmut int
 
@@ -686,6 +732,7 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 		os.RemoveAll(tmpdir)
 		mdb.confLock.RLock()
 		maxThreads := mdb.sysconf["settings.moi.persistence_threads"].Int()
+		maxIncrementals := mdb.sysconf["settings.moi.persistence.max_incrementals"].Int()
 		total := platform.LoadInt64(&totalMemDBItems)
 		indexCount := mdb.GetCommittedCount()
 		// Compute number of workers to be used for taking backup
@@ -694,7 +741,26 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 		}
 
 		mdb.confLock.RUnlock()
-		err := mdb.mainstore.StoreToDisk(tmpdir, s.info.MainSnap, concurrency, nil)
+
+		var base *memdb.Snapshot
+		var baseDir string
+		var gen uint64
+		var retain bool
+		if maxIncrementals > 0 {
+			base, baseDir, gen = mdb.getPersistedBase()
+			retain = s.info.MainSnap.Open()
+		} else {
+			mdb.releasePersistedBase()
+		}
+
+		var err error
+		if base != nil {
+			err = mdb.mainstore.StoreIncrementalToDisk(tmpdir, baseDir, base, s.info.MainSnap, concurrency)
+			base.Close()
+		} else {
+			err = mdb.mainstore.StoreToDisk(tmpdir, s.info.MainSnap, concurrency, nil)
+		}
+
 		if err == nil {
 			var fd *os.File
 			var bs []byte
@@ -715,10 +781,29 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 			}
 		}
 
+		if retain {
+			if err == nil {
+				mdb.setPersistedBase(s.info.MainSnap, dir, gen)
+			} else {
+				s.info.MainSnap.Close()
+			}
+		}
+
 		if err == nil {
 			dur := time.Since(t0)
-			logging.Infof("MemDBSlice Slice Id %v, Threads %d, IndexInstId %v created ondisk"+
-				" snapshot %v. Took %v", mdb.id, concurrency, mdb.idxInstId, dir, dur)
+			if base != nil {
+				logging.Infof("MemDBSlice Slice Id %v, Threads %d, IndexInstId %v created incremental"+
+					" ondisk snapshot %v on %v. Took %v", mdb.id, concurrency, mdb.idxInstId, dir, baseDir, dur)
+
+				// The chain is merged into a full snapshot once it reaches its maximum
+				// length, which lets the older snapshots get cleaned up
+				if chain, err := memdb.DiskSnapshotChain(dir); err == nil && len(chain) > maxIncrementals {
+					go mdb.mergeSnapshotChain(dir)
+				}
+			} else {
+				logging.Infof("MemDBSlice Slice Id %v, Threads %d, IndexInstId %v created ondisk"+
+					" snapshot %v. Took %v", mdb.id, concurrency, mdb.idxInstId, dir, dur)
+			}
 			mdb.idxStats.diskSnapStoreDuration.Set(int64(dur / time.Millisecond))
 		} else {
 			logging.Errorf("MemDBSlice Slice Id %v, IndexInstId %v failed to"+
@@ -733,19 +818,153 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 	}
 }
 
+//mergeSnapshotChain rewrites the incremental disk snapshot in dir as a full
+//snapshot in the background. The merge is not committed while the disk
+//snapshots are pinned, it is retried after the next incremental snapshot.
+func (mdb *memdbSlice) mergeSnapshotChain(dir string) {
+	if !platform.CompareAndSwapInt32(&mdb.isMergerActive, 0, 1) {
+		return
+	}
+	defer platform.StoreInt32(&mdb.isMergerActive, 0)
+
+	if mdb.isPinned() {
+		logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v disk snapshots are pinned."+
+			" Skipping merge of %v.", mdb.id, mdb.idxInstId, dir)
+		return
+	}
+
+	t0 := time.Now()
+	tmpdir := filepath.Join(mdb.path, mergeDirName)
+	err := mdb.mainstore.MergeDiskSnapshotChain(dir, tmpdir)
+	if err == nil {
+		mdb.pinLock.Lock()
+		if mdb.pins > 0 {
+			err = errors.New("disk snapshots are pinned")
+		} else {
+			err = memdb.CommitMergedDiskSnapshot(dir, tmpdir)
+		}
+		mdb.pinLock.Unlock()
+	}
+
+	if err != nil {
+		logging.Errorf("MemDBSlice Slice Id %v, IndexInstId %v failed to merge"+
+			" ondisk snapshot %v (error=%v)", mdb.id, mdb.idxInstId, dir, err)
+		os.RemoveAll(tmpdir)
+		return
+	}
+
+	logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v merged ondisk snapshot %v."+
+		" Took %v", mdb.id, mdb.idxInstId, dir, time.Since(t0))
+	mdb.cleanupOldSnapshotFiles(mdb.maxRollbacks)
+}
+
 func (mdb *memdbSlice) cleanupOldSnapshotFiles(keepn int) {
+	mdb.pinLock.Lock()
+	defer mdb.pinLock.Unlock()
+
+	if mdb.pins > 0 {
+		logging.Infof("MemDBSlice Slice Id %v, IndexInstId %v disk snapshots are pinned."+
+			" Skipping cleanup.", mdb.id, mdb.idxInstId)
+		return
+	}
+
 	manifests := mdb.getSnapshotManifests()
 	if len(manifests) > keepn {
 		toRemove := len(manifests) - keepn
+
+		// Incremental snapshots need the snapshots they are based on
+		required := make(map[string]bool)
+		for _, m := range manifests[toRemove:] {
+			chain, err := memdb.DiskSnapshotChain(filepath.Dir(m))
+			if err != nil {
+				logging.Errorf("MemDBSlice Slice Id %v, IndexInstId %v unable to read disk"+
+					" snapshot %v (error=%v). Skipping cleanup.", mdb.id, mdb.idxInstId, filepath.Dir(m), err)
+				return
+			}
+			for _, dir := range chain {
+				required[dir] = true
+			}
+		}
+
 		manifests = manifests[:toRemove]
 		for _, m := range manifests {
 			dir := filepath.Dir(m)
+			if required[dir] {
+				continue
+			}
 			logging.Infof("MemDBSlice Removing disk snapshot %v", dir)
 			os.RemoveAll(dir)
 		}
 	}
 }
 
+//pinSnapshots keeps the disk snapshots from being cleaned up, until
+//unpinSnapshots is called
+func (mdb *memdbSlice) pinSnapshots() {
+	mdb.pinLock.Lock()
+	defer mdb.pinLock.Unlock()
+
+	mdb.pins++
+}
+
+func (mdb *memdbSlice) unpinSnapshots() {
+	mdb.pinLock.Lock()
+	defer mdb.pinLock.Unlock()
+
+	mdb.pins--
+}
+
+func (mdb *memdbSlice) isPinned() bool {
+	mdb.pinLock.Lock()
+	defer mdb.pinLock.Unlock()
+
+	return mdb.pins > 0
+}
+
+//getPersistedBase returns the last persisted snapshot with a reference
+//held on it, its directory and the current store generation
+func (mdb *memdbSlice) getPersistedBase() (*memdb.Snapshot, string, uint64) {
+	mdb.persistLock.Lock()
+	defer mdb.persistLock.Unlock()
+
+	if mdb.persistedSnap != nil && mdb.persistedSnap.Open() {
+		return mdb.persistedSnap, mdb.persistedDir, mdb.storeGen
+	}
+	return nil, "", mdb.storeGen
+}
+
+//setPersistedBase keeps snap as the base of the next incremental snapshot.
+//The reference on snap is dropped if the stores were reset after gen.
+func (mdb *memdbSlice) setPersistedBase(snap *memdb.Snapshot, dir string, gen uint64) {
+	mdb.persistLock.Lock()
+	defer mdb.persistLock.Unlock()
+
+	if gen != mdb.storeGen {
+		snap.Close()
+		return
+	}
+
+	if mdb.persistedSnap != nil {
+		mdb.persistedSnap.Close()
+	}
+	mdb.persistedSnap = snap
+	mdb.persistedDir = dir
+}
+
+//releasePersistedBase drops the reference on the last persisted snapshot.
+//MemDB.Close waits until all snapshots are closed.
+func (mdb *memdbSlice) releasePersistedBase() {
+	mdb.persistLock.Lock()
+	defer mdb.persistLock.Unlock()
+
+	mdb.storeGen++
+	if mdb.persistedSnap != nil {
+		mdb.persistedSnap.Close()
+		mdb.persistedSnap = nil
+		mdb.persistedDir = ""
+	}
+}
+
 func (mdb *memdbSlice) diskSize() int64 {
 	var sz int64
 	snapdirs, _ := filepath.Glob(filepath.Join(mdb.path, "snapshot.*"))
@@ -806,6 +1025,8 @@ func (mdb *memdbSlice) GetCommittedCount() uint64 {
 }
 
 func (mdb *memdbSlice) resetStores() {
+	mdb.releasePersistedBase()
+
 	// This is blocking call if snap refcounts != 0
 	go mdb.mainstore.Close()
 	if !mdb.isPrimary {
@@ -893,8 +1114,13 @@ func (mdb *memdbSlice) loadSnapshot(snapInfo *memdbSnapshotInfo) error {
 
 	mdb.confLock.RLock()
 	concurrency := mdb.sysconf["settings.moi.recovery_threads"].Int()
+	maxIncrementals := mdb.sysconf["settings.moi.persistence.max_incrementals"].Int()
 	mdb.confLock.RUnlock()
 
+	mdb.persistLock.Lock()
+	gen := mdb.storeGen
+	mdb.persistLock.Unlock()
+
 	snap, err := mdb.mainstore.LoadFromDisk(snapInfo.dataPath, concurrency, backIndexCallback)
 
 	if !mdb.isPrimary {
@@ -907,6 +1133,9 @@ func (mdb *memdbSlice) loadSnapshot(snapInfo *memdbSnapshotInfo) error {
 	dur := time.Since(t0)
 	if err == nil {
 		snapInfo.MainSnap = snap
+		if maxIncrementals > 0 && snap.Open() {
+			mdb.setPersistedBase(snap, snapInfo.dataPath, gen)
+		}
 		mdb.setCommittedCount()
 		logging.Infof("MemDBSlice::loadSnapshot Slice Id %v, IndexInstId %v finished reading %v. Took %v",
 			mdb.id, mdb.idxInstId, snapInfo.dataPath, dur)
@@ -1089,6 +1318,12 @@ func (mdb *memdbSlice) IsDirty() bool {
 	return mdb.isDirty
 }
 
+// NumDocsIndexed returns the number of documents indexed by the slice
+// since it was opened.
+func (mdb *memdbSlice) NumDocsIndexed() int64 {
+	return platform.LoadInt64(&mdb.numDocsIndexed)
+}
+
 func (mdb *memdbSlice) Compact(abortTime time.Time) error {
 	return nil
 }
@@ -1142,6 +1377,7 @@ func tryDeletememdbSlice(mdb *memdbSlice) {
 }
 
 func tryClosememdbSlice(mdb *memdbSlice) {
+	mdb.releasePersistedBase()
 	mdb.mainstore.Close()
 	if !mdb.isPrimary {
 		for i := 0; i < mdb.numWriters; i++ {
@@ -65,6 +65,7 @@ const (
 	STORAGE_INDEX_STORAGE_STATS
 	STORAGE_INDEX_COMPACT
 	STORAGE_SNAP_DONE
+	STORAGE_UPDATE_SNAP_MAP
 
 	//KVSender
 	KV_SENDER_SHUTDOWN
@@ -116,6 +117,11 @@ const (
 	INDEXER_DEL_LOCAL_META
 	INDEXER_CHECK_DDL_IN_PROGRESS
 	INDEXER_UPDATE_RSTATE
+	INDEXER_GET_SNAPSHOT_FILES
+	INDEXER_RESTORE_PEER_SNAPSHOT
+	INDEXER_UPDATE_TRANSFER_PROGRESS
+	INDEXER_GET_INDEX_BACKUP
+	INDEXER_RESTORE_INDEX_BACKUP
 
 	//SCAN COORDINATOR
 	SCAN_COORD_SHUTDOWN
@@ -1210,6 +1216,114 @@ func (m *MsgUpdateIndexRState) GetRState() common.RebalanceState {
 	return m.rstate
 }
 
+//INDEXER_GET_SNAPSHOT_FILES
+type MsgGetSnapshotFiles struct {
+	instId common.IndexInstId
+	respch chan *peerSnapshot
+}
+
+func (m *MsgGetSnapshotFiles) GetMsgType() MsgType {
+	return INDEXER_GET_SNAPSHOT_FILES
+}
+
+func (m *MsgGetSnapshotFiles) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgGetSnapshotFiles) GetRespCh() chan *peerSnapshot {
+	return m.respch
+}
+
+//INDEXER_RESTORE_PEER_SNAPSHOT
+type MsgRestorePeerSnapshot struct {
+	dirs   map[common.IndexInstId]string
+	respch chan error
+}
+
+func (m *MsgRestorePeerSnapshot) GetMsgType() MsgType {
+	return INDEXER_RESTORE_PEER_SNAPSHOT
+}
+
+func (m *MsgRestorePeerSnapshot) GetDirs() map[common.IndexInstId]string {
+	return m.dirs
+}
+
+func (m *MsgRestorePeerSnapshot) GetRespCh() chan error {
+	return m.respch
+}
+
+//INDEXER_UPDATE_TRANSFER_PROGRESS
+type MsgUpdateTransferProgress struct {
+	instId   common.IndexInstId
+	progress int64
+}
+
+func (m *MsgUpdateTransferProgress) GetMsgType() MsgType {
+	return INDEXER_UPDATE_TRANSFER_PROGRESS
+}
+
+func (m *MsgUpdateTransferProgress) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgUpdateTransferProgress) GetProgress() int64 {
+	return m.progress
+}
+
+//INDEXER_GET_INDEX_BACKUP
+type MsgGetIndexBackup struct {
+	bucket string
+	respch chan *indexBackup
+}
+
+func (m *MsgGetIndexBackup) GetMsgType() MsgType {
+	return INDEXER_GET_INDEX_BACKUP
+}
+
+func (m *MsgGetIndexBackup) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgGetIndexBackup) GetRespCh() chan *indexBackup {
+	return m.respch
+}
+
+//INDEXER_RESTORE_INDEX_BACKUP
+type MsgRestoreIndexBackup struct {
+	info   *indexBackupInfo
+	dir    string
+	respch chan *indexRestoreResult
+}
+
+func (m *MsgRestoreIndexBackup) GetMsgType() MsgType {
+	return INDEXER_RESTORE_INDEX_BACKUP
+}
+
+func (m *MsgRestoreIndexBackup) GetInfo() *indexBackupInfo {
+	return m.info
+}
+
+func (m *MsgRestoreIndexBackup) GetDir() string {
+	return m.dir
+}
+
+func (m *MsgRestoreIndexBackup) GetRespCh() chan *indexRestoreResult {
+	return m.respch
+}
+
+//STORAGE_UPDATE_SNAP_MAP
+type MsgUpdateSnapMap struct {
+	idxInstId common.IndexInstId
+}
+
+func (m *MsgUpdateSnapMap) GetMsgType() MsgType {
+	return STORAGE_UPDATE_SNAP_MAP
+}
+
+func (m *MsgUpdateSnapMap) GetInstId() common.IndexInstId {
+	return m.idxInstId
+}
+
 //Helper function to return string for message type
 
 func (m MsgType) String() string {
@@ -1333,6 +1447,16 @@ func (m MsgType) String() string {
 		return "INDEXER_CHECK_DDL_IN_PROGRESS"
 	case INDEXER_UPDATE_RSTATE:
 		return "INDEXER_UPDATE_RSTATE"
+	case INDEXER_GET_SNAPSHOT_FILES:
+		return "INDEXER_GET_SNAPSHOT_FILES"
+	case INDEXER_RESTORE_PEER_SNAPSHOT:
+		return "INDEXER_RESTORE_PEER_SNAPSHOT"
+	case INDEXER_UPDATE_TRANSFER_PROGRESS:
+		return "INDEXER_UPDATE_TRANSFER_PROGRESS"
+	case INDEXER_GET_INDEX_BACKUP:
+		return "INDEXER_GET_INDEX_BACKUP"
+	case INDEXER_RESTORE_INDEX_BACKUP:
+		return "INDEXER_RESTORE_INDEX_BACKUP"
 
 	case SCAN_COORD_SHUTDOWN:
 		return "SCAN_COORD_SHUTDOWN"
@@ -1398,6 +1522,8 @@ func (m MsgType) String() string {
 		return "STORAGE_INDEX_COMPACT"
 	case STORAGE_SNAP_DONE:
 		return "STORAGE_SNAP_DONE"
+	case STORAGE_UPDATE_SNAP_MAP:
+		return "STORAGE_UPDATE_SNAP_MAP"
 
 	case CONFIG_SETTINGS_UPDATE:
 		return "CONFIG_SETTINGS_UPDATE"
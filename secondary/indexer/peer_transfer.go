@@ -0,0 +1,279 @@
+// @copyright 2016 Couchbase, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package indexer
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/memdb"
+)
+
+// Peer snapshot transfer lets a rebalance destination copy the committed
+// snapshot of an index from the source indexer instead of rebuilding it
+// from DCP. The source streams the files of the latest committed snapshot
+// of every partition as a tar archive, with each entry named
+// <partitionId>/<path relative to the slice directory>. The destination
+// unpacks the archive into a staging directory which then replaces the
+// slice directory of its (not yet built) clone.
+
+// header carrying the total number of file bytes in a peer snapshot
+const peerSnapshotSizeHeader = "X-Snapshot-Size"
+
+// directory under storage_dir used to stage incoming peer snapshots
+const peerTransferDirName = "peer_transfer"
+
+var ErrNoPeerSnapshot = errors.New("No committed snapshot available for transfer")
+var ErrPeerSnapshotUnsupported = errors.New("Storage does not support snapshot transfer")
+var ErrPeerTransferCancelled = errors.New("Snapshot transfer cancelled")
+
+type peerSnapshotFile struct {
+	partnId common.PartitionId
+	path    string // absolute path of the file
+	name    string // path relative to the slice directory
+	size    int64
+}
+
+type peerSnapshot struct {
+	files   []peerSnapshotFile
+	release func() // unpins the snapshot once the files are copied
+	err     error
+}
+
+//snapshotPinner is implemented by slices whose committed snapshot files
+//can be held unchanged on disk while they are copied. Cleanup of older
+//snapshots and compaction of the slice are suspended until unpinned.
+type snapshotPinner interface {
+	pinSnapshots()
+	unpinSnapshots()
+}
+
+func (ps *peerSnapshot) size() int64 {
+	var sz int64
+	for _, f := range ps.files {
+		sz += f.size
+	}
+	return sz
+}
+
+//listPeerSnapshotFiles returns the files making up the latest committed
+//snapshot of a slice, along with its timestamp. The slice must have been
+//pinned, so that the files stay as listed until they are copied. MemDB
+//keeps every persisted snapshot in its own directory, so only that
+//directory and the directories of the snapshots it is incrementally
+//based on are needed. ForestDB only appends to its file between
+//compactions; the size of the file is captured here and only that many
+//bytes are transferred, which recovers to the committed snapshot. Plasma
+//is not supported as its log cleaner relocates data and reclaims the log
+//in the background.
+func listPeerSnapshotFiles(partnId common.PartitionId, slice Slice) ([]peerSnapshotFile,
+	*common.TsVbuuid, error) {
+
+	infos, err := slice.GetSnapshots()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	latest := NewSnapshotInfoContainer(infos).GetLatest()
+	if latest == nil {
+		return nil, nil, ErrNoPeerSnapshot
+	}
+
+	var roots []string
+	switch slice.(type) {
+	case *memdbSlice:
+		roots, err = memdb.DiskSnapshotChain(latest.(*memdbSnapshotInfo).dataPath)
+		if err != nil {
+			return nil, nil, err
+		}
+	case *fdbSlice:
+		roots = []string{slice.Path()}
+	default:
+		return nil, nil, ErrPeerSnapshotUnsupported
+	}
+
+	var files []peerSnapshotFile
+	walkFn := func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(slice.Path(), path)
+		if err != nil {
+			return err
+		}
+		files = append(files, peerSnapshotFile{
+			partnId: partnId,
+			path:    path,
+			name:    filepath.ToSlash(name),
+			size:    fi.Size(),
+		})
+		return nil
+	}
+
+	for _, root := range roots {
+		if err := filepath.Walk(root, walkFn); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return files, latest.Timestamp(), nil
+}
+
+//writePeerSnapshot writes the snapshot files to w as a tar archive
+func writePeerSnapshot(w io.Writer, files []peerSnapshotFile) error {
+
+	fds, err := openPeerSnapshotFiles(files)
+	defer closePeerSnapshotFiles(fds)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writePeerSnapshotFiles(tw, "", files, fds); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+//openPeerSnapshotFiles opens all snapshot files upfront, so that a
+//snapshot which gets cleaned up by the slice while streaming can still
+//be read. The files opened are returned even on error.
+func openPeerSnapshotFiles(files []peerSnapshotFile) ([]*os.File, error) {
+
+	fds := make([]*os.File, 0, len(files))
+	for _, f := range files {
+		fd, err := os.Open(f.path)
+		if err != nil {
+			return fds, err
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+func closePeerSnapshotFiles(fds []*os.File) {
+	for _, fd := range fds {
+		fd.Close()
+	}
+}
+
+//writePeerSnapshotFiles adds the snapshot files to a tar archive, with
+//entries named <prefix><partitionId>/<name>
+func writePeerSnapshotFiles(tw *tar.Writer, prefix string, files []peerSnapshotFile,
+	fds []*os.File) error {
+
+	for i, f := range files {
+		hdr := &tar.Header{
+			Name:     fmt.Sprintf("%s%d/%s", prefix, f.partnId, f.name),
+			Mode:     0644,
+			Size:     f.size,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tw, fds[i], f.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//readPeerSnapshot unpacks a tar archive written by writePeerSnapshot
+//into dir. progress is called with the number of file bytes written so
+//far. The transfer is aborted if cancel is closed.
+func readPeerSnapshot(r io.Reader, dir string, cancel <-chan struct{},
+	progress func(int64)) error {
+
+	var done int64
+	buf := make([]byte, 1024*1024)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(hdr.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return fmt.Errorf("Invalid file %v in peer snapshot", hdr.Name)
+		}
+
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		fd, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+
+		for {
+			select {
+			case <-cancel:
+				fd.Close()
+				return ErrPeerTransferCancelled
+			default:
+			}
+
+			n, rerr := tr.Read(buf)
+			if n > 0 {
+				if _, err := fd.Write(buf[:n]); err != nil {
+					fd.Close()
+					return err
+				}
+				done += int64(n)
+				progress(done)
+			}
+			if rerr == io.EOF {
+				break
+			} else if rerr != nil {
+				fd.Close()
+				return rerr
+			}
+		}
+
+		if err := fd.Sync(); err != nil {
+			fd.Close()
+			return err
+		}
+		if err := fd.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+//peerTransferDir returns the staging directory of an incoming peer
+//snapshot. Partition data is unpacked into numbered subdirectories.
+func peerTransferDir(storageDir string, instId common.IndexInstId) string {
+	return filepath.Join(storageDir, peerTransferDirName, strconv.FormatUint(uint64(instId), 10))
+}
+
+//peerPartnDir returns the staging directory of a single partition
+func peerPartnDir(dir string, partnId common.PartitionId) string {
+	return filepath.Join(dir, fmt.Sprintf("%d", partnId))
+}
@@ -0,0 +1,114 @@
+package indexer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeerSnapshotRoundTrip(t *testing.T) {
+	src, err := ioutil.TempDir("", "peer_src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "peer_dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	contents := map[string]string{
+		"snapshot.1/manifest.json": `{"Count":2}`,
+		"snapshot.1/data/shard-0":  "0123456789",
+	}
+
+	var files []peerSnapshotFile
+	for name, data := range contents {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, peerSnapshotFile{partnId: 1, path: path, name: name, size: int64(len(data))})
+	}
+
+	// appends after listing the files must not be transferred
+	f, err := os.OpenFile(filepath.Join(src, "snapshot.1/data/shard-0"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("uncommitted")
+	f.Close()
+
+	var buf bytes.Buffer
+	if err := writePeerSnapshot(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+
+	var done int64
+	if err := readPeerSnapshot(&buf, dst, nil, func(n int64) { done = n }); err != nil {
+		t.Fatal(err)
+	}
+
+	var total int64
+	for name, data := range contents {
+		bs, err := ioutil.ReadFile(filepath.Join(peerPartnDir(dst, 1), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bs) != data {
+			t.Errorf("Expected %v for %v, received %v", data, name, string(bs))
+		}
+		total += int64(len(data))
+	}
+
+	if done != total {
+		t.Errorf("Expected progress %v, received %v", total, done)
+	}
+}
+
+func TestPeerSnapshotPinned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peer_pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	snaps := []string{"snapshot.1", "snapshot.2", "snapshot.3"}
+	for _, snap := range snaps {
+		if err := os.MkdirAll(filepath.Join(dir, snap), 0755); err != nil {
+			t.Fatal(err)
+		}
+		manifest := filepath.Join(dir, snap, "manifest.json")
+		if err := ioutil.WriteFile(manifest, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exists := func(snap string) bool {
+		_, err := os.Stat(filepath.Join(dir, snap))
+		return err == nil
+	}
+
+	// snapshots being copied are not cleaned up
+	mdb := &memdbSlice{path: dir}
+	mdb.pinSnapshots()
+	mdb.cleanupOldSnapshotFiles(1)
+	for _, snap := range snaps {
+		if !exists(snap) {
+			t.Errorf("Expected pinned snapshot %v to be retained", snap)
+		}
+	}
+
+	mdb.unpinSnapshots()
+	mdb.cleanupOldSnapshotFiles(1)
+	if exists(snaps[0]) || exists(snaps[1]) || !exists(snaps[2]) {
+		t.Errorf("Expected only %v to be retained after unpin", snaps[2])
+	}
+}
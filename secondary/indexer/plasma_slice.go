@@ -32,6 +32,7 @@ type plasmaSlice struct {
 	flushedCount                          platform.AlignedUint64
 	committedCount                        platform.AlignedUint64
 	qCount                                platform.AlignedInt64
+	numDocsIndexed                        platform.AlignedInt64
 
 	path string
 	id   SliceId
@@ -342,6 +343,19 @@ func (mdb *plasmaSlice) Insert(key []byte, docid []byte, meta *MutationMeta) err
 	return mdb.fatalDbErr
 }
 
+func (mdb *plasmaSlice) InsertSync(key []byte, docid []byte, meta *MutationMeta) (bool, error) {
+	mut := indexMutation{
+		op:      opUpdate,
+		key:     key,
+		docid:   docid,
+		existCh: make(chan bool, 1),
+	}
+	platform.AddInt64(&mdb.qCount, 1)
+	mdb.cmdCh[int(meta.vbucket)%mdb.numWriters] <- mut
+	mdb.idxStats.numDocsFlushQueued.Add(1)
+	return <-mut.existCh, mdb.fatalDbErr
+}
+
 func (mdb *plasmaSlice) Delete(docid []byte, meta *MutationMeta) error {
 	mdb.idxStats.numDocsFlushQueued.Add(1)
 	platform.AddInt64(&mdb.qCount, 1)
@@ -362,9 +376,16 @@ loop:
 			switch icmd.op {
 			case opUpdate:
 				start = time.Now()
+				var exists bool
+				if icmd.existCh != nil {
+					exists = mdb.exists(icmd.docid, workerId)
+				}
 				nmut = mdb.insert(icmd.key, icmd.docid, workerId)
 				elapsed = time.Since(start)
 				mdb.totalFlushTime += elapsed
+				if icmd.existCh != nil {
+					icmd.existCh <- exists
+				}
 
 			case opDelete:
 				start = time.Now()
@@ -379,6 +400,7 @@ loop:
 
 			mdb.idxStats.numItemsFlushed.Add(int64(nmut))
 			mdb.idxStats.numDocsIndexed.Add(1)
+			platform.AddInt64(&mdb.numDocsIndexed, 1)
 			platform.AddInt64(&mdb.qCount, -1)
 
 		case <-mdb.stopCh[workerId]:
@@ -392,6 +414,18 @@ loop:
 	}
 }
 
+//exists returns true if docid is indexed in the slice, entries of
+//primary index are not looked up.
+func (mdb *plasmaSlice) exists(docid []byte, workerId int) bool {
+	if mdb.isPrimary {
+		return false
+	}
+	tokB := mdb.back[workerId].BeginTx()
+	defer mdb.back[workerId].EndTx(tokB)
+	_, err := mdb.back[workerId].LookupKV(docid)
+	return err == nil
+}
+
 func (mdb *plasmaSlice) insert(key []byte, docid []byte, workerId int) int {
 	var nmut int
 
@@ -1213,6 +1247,12 @@ func (mdb *plasmaSlice) IsDirty() bool {
 	return mdb.isDirty
 }
 
+// NumDocsIndexed returns the number of documents indexed by the slice
+// since it was opened.
+func (mdb *plasmaSlice) NumDocsIndexed() int64 {
+	return platform.LoadInt64(&mdb.numDocsIndexed)
+}
+
 func (mdb *plasmaSlice) Compact(abortTime time.Time) error {
 	return nil
 }
@@ -27,6 +27,7 @@ import (
 	"errors"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"encoding/json"
@@ -73,6 +74,8 @@ type ServiceMgr struct {
 	localhttp string
 
 	moveStatusCh chan error
+
+	restoreMu sync.Mutex //serializes index data restores
 }
 
 type rebalanceContext struct {
@@ -164,6 +167,9 @@ func (m *ServiceMgr) initService() {
 	http.HandleFunc("/cleanupRebalance", m.handleCleanupRebalance)
 	http.HandleFunc("/moveIndex", m.handleMoveIndex)
 	http.HandleFunc("/nodeuuid", m.handleNodeuuid)
+	http.HandleFunc("/transferIndexSnapshot", m.handleTransferIndexSnapshot)
+	http.HandleFunc("/backupIndexData", m.handleBackupIndexData)
+	http.HandleFunc("/restoreIndexData", m.handleRestoreIndexData)
 }
 
 //run starts the rebalance manager loop which listens to messages
@@ -514,7 +520,7 @@ func (m *ServiceMgr) startFailover(change service.TopologyChange) error {
 
 	//TODO Directly call rebalanceDone?
 	m.rebalancer = NewRebalancer(nil, nil, string(m.nodeInfo.NodeID), true,
-		m.rebalanceProgressCallback, m.rebalanceDoneCallback, m.supvMsgch, "")
+		m.rebalanceProgressCallback, m.rebalanceDoneCallback, m.supvMsgch, "", m.config.Load())
 
 	return nil
 }
@@ -604,8 +610,11 @@ func (m *ServiceMgr) startRebalance(change service.TopologyChange) error {
 	m.rebalanceCtx = ctx
 	m.updateRebalanceProgressLOCKED(0)
 
+	m.setPeerBuildSource(transferTokens)
+
 	m.rebalancer = NewRebalancer(transferTokens, m.rebalanceToken, string(m.nodeInfo.NodeID),
-		true, m.rebalanceProgressCallback, m.rebalanceDoneCallback, m.supvMsgch, m.localhttp)
+		true, m.rebalanceProgressCallback, m.rebalanceDoneCallback, m.supvMsgch, m.localhttp,
+		m.config.Load())
 
 	return nil
 }
@@ -1766,7 +1775,7 @@ func (m *ServiceMgr) handleRegisterRebalanceToken(w http.ResponseWriter, r *http
 			}
 
 			m.rebalancerF = NewRebalancer(nil, &rebalToken, string(m.nodeInfo.NodeID), false, nil,
-				m.rebalanceDoneCallback, m.supvMsgch, m.localhttp)
+				m.rebalanceDoneCallback, m.supvMsgch, m.localhttp, m.config.Load())
 			m.writeOk(w)
 			return
 
@@ -1870,7 +1879,7 @@ func (m *ServiceMgr) processMoveIndex(path string, value []byte, rev interface{}
 				m.runCleanupPhaseLOCKED(MoveIndexTokenPath, true)
 				return nil
 			}
-			m.rebalancerF = NewRebalancer(nil, &rebalToken, string(m.nodeInfo.NodeID), false, nil, m.moveIndexDoneCallback, m.supvMsgch, m.localhttp)
+			m.rebalancerF = NewRebalancer(nil, &rebalToken, string(m.nodeInfo.NodeID), false, nil, m.moveIndexDoneCallback, m.supvMsgch, m.localhttp, m.config.Load())
 		}
 	}
 
@@ -1929,6 +1938,57 @@ func (m *ServiceMgr) handleMoveIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+//handleTransferIndexSnapshot streams the latest committed snapshot of an
+//index to a rebalance destination building the index from this node
+func (m *ServiceMgr) handleTransferIndexSnapshot(w http.ResponseWriter, r *http.Request) {
+
+	if !m.validateAuth(w, r) {
+		l.Errorf("ServiceMgr::handleTransferIndexSnapshot Validation Failure for Request %v", r)
+		return
+	}
+
+	if r.Method != "GET" {
+		sendIndexResponseWithError(http.StatusBadRequest, w, "Unsupported method")
+		return
+	}
+
+	instId, err := strconv.ParseUint(r.FormValue("instId"), 10, 64)
+	if err != nil {
+		l.Errorf("ServiceMgr::handleTransferIndexSnapshot Invalid InstId %v", err)
+		sendIndexResponseWithError(http.StatusBadRequest, w, err.Error())
+		return
+	}
+
+	respch := make(chan *peerSnapshot)
+	m.supvMsgch <- &MsgGetSnapshotFiles{instId: c.IndexInstId(instId),
+		respch: respch}
+	ps := <-respch
+
+	if ps.err != nil {
+		l.Errorf("ServiceMgr::handleTransferIndexSnapshot Index %v %v", instId, ps.err)
+		sendIndexResponseWithError(http.StatusInternalServerError, w, ps.err.Error())
+		return
+	}
+
+	l.Infof("ServiceMgr::handleTransferIndexSnapshot Sending Index %v Files %v Size %v",
+		instId, len(ps.files), ps.size())
+
+	header := w.Header()
+	header["Content-Type"] = []string{"application/x-tar"}
+	header.Set(peerSnapshotSizeHeader, strconv.FormatInt(ps.size(), 10))
+	w.WriteHeader(http.StatusOK)
+
+	start := time.Now()
+	defer ps.release()
+	if err := writePeerSnapshot(w, ps.files); err != nil {
+		//the destination sees a truncated archive and fails the transfer
+		l.Errorf("ServiceMgr::handleTransferIndexSnapshot Index %v Error %v", instId, err)
+		return
+	}
+
+	l.Infof("ServiceMgr::handleTransferIndexSnapshot Sent Index %v Took %v", instId, time.Since(start))
+}
+
 func (m *ServiceMgr) initMoveIndex(req *manager.IndexRequest, nodes []string) (error, bool) {
 
 	m.mu.Lock()
@@ -1971,8 +2031,10 @@ func (m *ServiceMgr) initMoveIndex(req *manager.IndexRequest, nodes []string) (e
 		return err, false
 	}
 
+	m.setPeerBuildSource(transferTokens)
+
 	rebalancer := NewRebalancer(transferTokens, m.rebalanceToken, string(m.nodeInfo.NodeID),
-		true, nil, m.moveIndexDoneCallback, m.supvMsgch, m.localhttp)
+		true, nil, m.moveIndexDoneCallback, m.supvMsgch, m.localhttp, m.config.Load())
 
 	m.rebalancer = rebalancer
 	m.rebalanceRunning = true
@@ -2108,6 +2170,68 @@ func (m *ServiceMgr) generateTransferTokenForMoveIndex(req *manager.IndexRequest
 
 }
 
+//setPeerBuildSource marks the transfer tokens of built indexes to be
+//built from a snapshot copied from the source indexer, if enabled
+func (m *ServiceMgr) setPeerBuildSource(transferTokens map[string]*c.TransferToken) {
+
+	cfg := m.config.Load()
+	if !cfg["rebalance.peer_transfer"].Bool() || len(transferTokens) == 0 {
+		return
+	}
+
+	hosts, err := m.getIndexerHttpAddrs()
+	if err != nil {
+		l.Warnf("ServiceMgr::setPeerBuildSource Unable to find indexer addresses. "+
+			"Indexes will be built from DCP. %v", err)
+		return
+	}
+
+	for ttid, tt := range transferTokens {
+		if tt.SourceId == "" || tt.IndexInst.State != c.INDEX_STATE_ACTIVE {
+			continue
+		}
+		if host, ok := hosts[tt.SourceId]; ok {
+			tt.BuildSource = c.TokenBuildSourcePeer
+			tt.SourceHost = host
+			l.Infof("ServiceMgr::setPeerBuildSource Build %v From Peer %v", ttid, host)
+		}
+	}
+}
+
+//getIndexerHttpAddrs returns the http address of the reachable indexer
+//nodes keyed by node uuid
+func (m *ServiceMgr) getIndexerHttpAddrs() (map[string]string, error) {
+
+	m.cinfo.Lock()
+	defer m.cinfo.Unlock()
+
+	if err := m.cinfo.Fetch(); err != nil {
+		l.Errorf("ServiceMgr::getIndexerHttpAddrs Error Fetching Cluster Information %v", err)
+		return nil, err
+	}
+
+	addrs := make(map[string]string)
+	for _, nid := range m.cinfo.GetNodesByServiceType(c.INDEX_HTTP_SERVICE) {
+
+		haddr, err := m.cinfo.GetServiceAddress(nid, c.INDEX_HTTP_SERVICE)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := getWithAuth(haddr + "/nodeuuid")
+		if err != nil {
+			l.Warnf("ServiceMgr::getIndexerHttpAddrs Unable to Fetch Node UUID %v %v", haddr, err)
+			continue
+		}
+		bytes, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		addrs[string(bytes)] = haddr
+	}
+
+	return addrs, nil
+}
+
 func (m *ServiceMgr) getNodeIdFromDest(dest string) (string, error) {
 
 	m.cinfo.Lock()
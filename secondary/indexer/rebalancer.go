@@ -20,10 +20,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/couchbase/cbauth"
 	"github.com/couchbase/cbauth/metakv"
 	c "github.com/couchbase/indexing/secondary/common"
 	l "github.com/couchbase/indexing/secondary/logging"
@@ -31,6 +34,9 @@ import (
 	"github.com/couchbase/indexing/secondary/manager/client"
 )
 
+//share of the progress of a peer build taken by the snapshot transfer
+const peerTransferProgressWeight = 80
+
 type DoneCallback func(err error, cancel <-chan struct{})
 type ProgressCallback func(progress float64, cancel <-chan struct{})
 
@@ -61,6 +67,8 @@ type Rebalancer struct {
 
 	localaddr string
 
+	config c.Config
+
 	wg sync.WaitGroup
 
 	progressInitOnce sync.Once
@@ -72,7 +80,8 @@ type Rebalancer struct {
 }
 
 func NewRebalancer(transferTokens map[string]*c.TransferToken, rebalToken *RebalanceToken,
-	nodeId string, master bool, progress ProgressCallback, done DoneCallback, supvMsgch MsgChannel, localaddr string) *Rebalancer {
+	nodeId string, master bool, progress ProgressCallback, done DoneCallback, supvMsgch MsgChannel,
+	localaddr string, config c.Config) *Rebalancer {
 
 	l.Infof("NewRebalancer nodeId %v rebalToken %v master %v localaddr %v", nodeId, rebalToken, master, localaddr)
 
@@ -93,6 +102,7 @@ func NewRebalancer(transferTokens map[string]*c.TransferToken, rebalToken *Rebal
 
 		acceptedTokens: make(map[string]*c.TransferToken),
 		localaddr:      localaddr,
+		config:         config,
 
 		waitForTokenPublish: make(chan struct{}),
 	}
@@ -487,11 +497,13 @@ func (r *Rebalancer) buildAcceptedIndexes() {
 
 	defer r.wg.Done()
 
+	r.transferPeerSnapshots()
+
 	var idList client.IndexIdList
 	var errStr string
 	r.mu.Lock()
 	for _, tt := range r.acceptedTokens {
-		if tt.State != c.TransferTokenReady {
+		if tt.State != c.TransferTokenReady && tt.Error == "" {
 			idList.DefnIds = append(idList.DefnIds, uint64(tt.IndexInst.Defn.DefnId))
 		}
 	}
@@ -541,6 +553,142 @@ cleanup:
 
 }
 
+//transferPeerSnapshots copies the committed snapshot of every accepted
+//index with a peer build source from its source indexer. Indexes of a
+//bucket are built on a single stream, so a bucket falls back to building
+//all its indexes from DCP unless every snapshot of it could be copied
+//and restored.
+func (r *Rebalancer) transferPeerSnapshots() {
+
+	bucketTokens := make(map[string]map[string]*c.TransferToken)
+	dcpBuckets := make(map[string]bool)
+
+	r.mu.Lock()
+	for ttid, tt := range r.acceptedTokens {
+		if tt.State == c.TransferTokenReady {
+			continue
+		}
+		bucket := tt.IndexInst.Defn.Bucket
+		if tt.BuildSource != c.TokenBuildSourcePeer {
+			dcpBuckets[bucket] = true
+			continue
+		}
+		if _, ok := bucketTokens[bucket]; !ok {
+			bucketTokens[bucket] = make(map[string]*c.TransferToken)
+		}
+		bucketTokens[bucket][ttid] = tt
+	}
+	r.mu.Unlock()
+
+	storageDir := r.config["storage_dir"].String()
+
+	for bucket, tokens := range bucketTokens {
+
+		ok := !dcpBuckets[bucket]
+		if ok {
+			for ttid, tt := range tokens {
+				dir := peerTransferDir(storageDir, tt.InstId)
+				if err := r.fetchPeerSnapshot(tt, dir); err != nil {
+					l.Errorf("Rebalancer::transferPeerSnapshots Error copying snapshot for %v "+
+						"from %v. %v", ttid, tt.SourceHost, err)
+					ok = false
+					break
+				}
+			}
+		}
+
+		if ok {
+			dirs := make(map[c.IndexInstId]string)
+			for _, tt := range tokens {
+				dirs[tt.InstId] = peerTransferDir(storageDir, tt.InstId)
+			}
+			respch := make(chan error)
+			r.supvMsgch <- &MsgRestorePeerSnapshot{dirs: dirs, respch: respch}
+			if err := <-respch; err != nil {
+				l.Errorf("Rebalancer::transferPeerSnapshots Error restoring snapshots of bucket %v %v",
+					bucket, err)
+				ok = false
+			}
+		}
+
+		if !ok {
+			l.Infof("Rebalancer::transferPeerSnapshots Building indexes of bucket %v from DCP", bucket)
+			r.mu.Lock()
+			for ttid, tt := range tokens {
+				os.RemoveAll(peerTransferDir(storageDir, tt.InstId))
+				tt.BuildSource = c.TokenBuildSourceDcp
+				r.setTransferTokenInMetakv(ttid, tt)
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+//fetchPeerSnapshot downloads the committed snapshot of the source index
+//of a transfer token into dir, reporting progress as the index's
+//transfer_progress stat.
+func (r *Rebalancer) fetchPeerSnapshot(tt *c.TransferToken, dir string) error {
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://%v/transferIndexSnapshot?instId=%v", tt.SourceHost, tt.IndexInst.InstId)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if err := cbauth.SetRequestAuthVia(req, nil); err != nil {
+		l.Errorf("Rebalancer::fetchPeerSnapshot Error setting auth %v", err)
+	}
+
+	//no client timeout, the transfer of a large index can take a while
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		response := new(manager.IndexResponse)
+		if err := convertResponse(resp, response); err != nil {
+			return fmt.Errorf("Unexpected response status %v", resp.Status)
+		}
+		return errors.New(response.Error)
+	}
+
+	total, _ := strconv.ParseInt(resp.Header.Get(peerSnapshotSizeHeader), 10, 64)
+
+	l.Infof("Rebalancer::fetchPeerSnapshot Copying snapshot of index %v from %v. Size %v",
+		tt.IndexInst.InstId, tt.SourceHost, total)
+
+	start := time.Now()
+	lastReport := start
+	progress := func(done int64) {
+		if total > 0 && time.Since(lastReport) > time.Second {
+			lastReport = time.Now()
+			r.supvMsgch <- &MsgUpdateTransferProgress{instId: tt.InstId,
+				progress: done * 100 / total}
+		}
+	}
+
+	if err := readPeerSnapshot(resp.Body, dir, r.cancel, progress); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	r.supvMsgch <- &MsgUpdateTransferProgress{instId: tt.InstId, progress: 100}
+
+	l.Infof("Rebalancer::fetchPeerSnapshot Copied snapshot of index %v from %v. Took %v",
+		tt.IndexInst.InstId, tt.SourceHost, time.Since(start))
+
+	return nil
+}
+
 func (r *Rebalancer) waitForIndexBuild() {
 
 	allTokensReady := true
@@ -813,8 +961,15 @@ func (r *Rebalancer) computeProgress() (progress float64) {
 		state := tt.State
 		if state == c.TransferTokenCommit || state == c.TransferTokenDeleted {
 			totalProgress += 100
+		} else if tt.BuildSource == c.TokenBuildSourcePeer {
+			//copying the snapshot is the bulk of the work, the build
+			//only catches up from the snapshot timestamp
+			transfer := getTransferProgressFromStatus(statusResp, tt.IndexInst.Defn.DefnId)
+			build := getBuildProgressFromStatus(statusResp, tt.IndexInst.Defn.DefnId)
+			totalProgress += (transfer*peerTransferProgressWeight +
+				build*(100-peerTransferProgressWeight)) / 100
 		} else {
-			totalProgress = getBuildProgressFromStatus(statusResp, tt.IndexInst.Defn.DefnId)
+			totalProgress += getBuildProgressFromStatus(statusResp, tt.IndexInst.Defn.DefnId)
 		}
 	}
 
@@ -851,6 +1006,20 @@ func getBuildProgressFromStatus(status *manager.IndexStatusResponse, defnId c.In
 
 }
 
+//the index being copied is not yet replicating, so the transfer progress
+//is taken from whichever instance of the index reports it
+func getTransferProgressFromStatus(status *manager.IndexStatusResponse, defnId c.IndexDefnId) int {
+
+	var progress int
+	for _, idx := range status.Status {
+		if idx.DefnId == defnId && idx.TransferProgress > progress {
+			progress = idx.TransferProgress
+		}
+	}
+	return progress
+
+}
+
 //
 // This function gets the indexer stats for a specific indexer host.
 //
@@ -0,0 +1,237 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"sync"
+	"time"
+)
+
+// scanAdmission limits the number of scans running concurrently on a
+// bucket and on an index. Scans over a limit wait in a bounded queue,
+// ordered by priority and then by arrival, and are rejected with
+// common.ErrScanRejected when the queue is full or when they could not
+// be admitted within the wait timeout.
+type scanAdmission struct {
+	mu sync.Mutex
+
+	bucketLimit int
+	indexLimit  int
+	queueSize   int
+	waitTimeout time.Duration
+
+	buckets map[string]int
+	indexes map[common.IndexInstId]int
+	running int
+
+	// waiting scans, in the order they are to be admitted.
+	waiters []*scanWaiter
+	seqno   uint64
+}
+
+type scanWaiter struct {
+	bucket string
+	instId common.IndexInstId
+	rank   int
+	seqno  uint64
+
+	admitted bool
+	admitch  chan bool
+}
+
+func newScanAdmission(config common.Config) *scanAdmission {
+	a := &scanAdmission{
+		buckets: make(map[string]int),
+		indexes: make(map[common.IndexInstId]int),
+	}
+	a.setConfig(config)
+	return a
+}
+
+// setConfig applies the admission settings from the indexer config,
+// scans already waiting are admitted if the limits were raised.
+func (a *scanAdmission) setConfig(config common.Config) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.bucketLimit = config["settings.scan_admission.bucket_limit"].Int()
+	a.indexLimit = config["settings.scan_admission.index_limit"].Int()
+	a.queueSize = config["settings.scan_admission.queue_size"].Int()
+	timeout := config["settings.scan_admission.wait_timeout"].Int()
+	a.waitTimeout = time.Duration(timeout) * time.Millisecond
+
+	a.dispatch()
+}
+
+// admit blocks until a scan on `instId` of `bucket` can run, it returns
+// whether the scan had to wait. Every scan that is admitted must be
+// released once it completes.
+func (a *scanAdmission) admit(bucket string, instId common.IndexInstId,
+	priority protobuf.ScanPriority, cancelCh <-chan bool) (bool, error) {
+
+	a.mu.Lock()
+
+	if len(a.waiters) == 0 && a.canRun(bucket, instId) {
+		a.run(bucket, instId)
+		a.mu.Unlock()
+		return false, nil
+	}
+
+	if len(a.waiters) >= a.queueSize {
+		a.mu.Unlock()
+		return false, common.ErrScanRejected
+	}
+
+	a.seqno++
+	waiter := &scanWaiter{
+		bucket:  bucket,
+		instId:  instId,
+		rank:    priorityRank(priority),
+		seqno:   a.seqno,
+		admitch: make(chan bool),
+	}
+	a.enqueue(waiter)
+	a.dispatch()
+	timeout := a.waitTimeout
+	a.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-waiter.admitch:
+		return true, nil
+	case <-timer.C:
+		err = common.ErrScanRejected
+	case <-cancelCh:
+		err = common.ErrClientCancel
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// admitted while giving up, let the scan run.
+	if waiter.admitted {
+		return true, nil
+	}
+	a.dequeue(waiter)
+	return true, err
+}
+
+// release ends an admitted scan and admits the waiting scans that can
+// now run.
+func (a *scanAdmission) release(bucket string, instId common.IndexInstId) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.buckets[bucket]--; a.buckets[bucket] <= 0 {
+		delete(a.buckets, bucket)
+	}
+	if a.indexes[instId]--; a.indexes[instId] <= 0 {
+		delete(a.indexes, instId)
+	}
+	a.running--
+
+	a.dispatch()
+}
+
+func (a *scanAdmission) canRun(bucket string, instId common.IndexInstId) bool {
+	if a.bucketLimit > 0 && a.buckets[bucket] >= a.bucketLimit {
+		return false
+	}
+	if a.indexLimit > 0 && a.indexes[instId] >= a.indexLimit {
+		return false
+	}
+	return true
+}
+
+func (a *scanAdmission) run(bucket string, instId common.IndexInstId) {
+	a.buckets[bucket]++
+	a.indexes[instId]++
+	a.running++
+}
+
+// counts returns the number of scans running and waiting for admission.
+func (a *scanAdmission) counts() (running, queued int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running, len(a.waiters)
+}
+
+// dispatch admits waiting scans in order. A waiter that cannot run does
+// not hold back the ones behind it on other buckets and indexes, those
+// behind it on the same bucket or index cannot run either.
+func (a *scanAdmission) dispatch() {
+	waiters := a.waiters[:0]
+	for _, w := range a.waiters {
+		if a.canRun(w.bucket, w.instId) {
+			a.run(w.bucket, w.instId)
+			w.admitted = true
+			close(w.admitch)
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	for i := len(waiters); i < len(a.waiters); i++ {
+		a.waiters[i] = nil
+	}
+	a.waiters = waiters
+}
+
+func (a *scanAdmission) enqueue(waiter *scanWaiter) {
+	i := len(a.waiters)
+	for i > 0 && waiter.before(a.waiters[i-1]) {
+		i--
+	}
+	a.waiters = append(a.waiters, nil)
+	copy(a.waiters[i+1:], a.waiters[i:])
+	a.waiters[i] = waiter
+}
+
+func (a *scanAdmission) dequeue(waiter *scanWaiter) {
+	for i, w := range a.waiters {
+		if w == waiter {
+			copy(a.waiters[i:], a.waiters[i+1:])
+			a.waiters[len(a.waiters)-1] = nil
+			a.waiters = a.waiters[:len(a.waiters)-1]
+			return
+		}
+	}
+}
+
+func (w *scanWaiter) before(other *scanWaiter) bool {
+	if w.rank != other.rank {
+		return w.rank < other.rank
+	}
+	return w.seqno < other.seqno
+}
+
+func priorityRank(priority protobuf.ScanPriority) int {
+	switch priority {
+	case protobuf.ScanPriority_PRIORITY_HIGH:
+		return 0
+	case protobuf.ScanPriority_PRIORITY_LOW:
+		return 2
+	}
+	return 1
+}
+
+// needsAdmission tells whether the request runs a scan that is subject
+// to admission control.
+func (r *ScanRequest) needsAdmission() bool {
+	switch r.ScanType {
+	case ScanReq, ScanAllReq, CountReq, MultiScanCountReq:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+func newTestScanAdmission(bucketLimit, queueSize, timeout int) *scanAdmission {
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	conf.SetValue("settings.scan_admission.bucket_limit", bucketLimit)
+	conf.SetValue("settings.scan_admission.queue_size", queueSize)
+	conf.SetValue("settings.scan_admission.wait_timeout", timeout)
+	return newScanAdmission(conf)
+}
+
+func TestScanAdmissionPriority(t *testing.T) {
+	a := newTestScanAdmission(1, 10, 10000)
+
+	if queued, err := a.admit("default", 1, protobuf.ScanPriority_PRIORITY_NORMAL, nil); queued || err != nil {
+		t.Fatalf("Expected scan to run, received queued %v err %v", queued, err)
+	}
+
+	// other buckets are not limited by a busy one
+	if queued, err := a.admit("other", 2, protobuf.ScanPriority_PRIORITY_NORMAL, nil); queued || err != nil {
+		t.Fatalf("Expected scan on other bucket to run, received queued %v err %v", queued, err)
+	}
+
+	admitted := make(chan protobuf.ScanPriority, 3)
+	for i, priority := range []protobuf.ScanPriority{
+		protobuf.ScanPriority_PRIORITY_LOW,
+		protobuf.ScanPriority_PRIORITY_NORMAL,
+		protobuf.ScanPriority_PRIORITY_HIGH,
+	} {
+		go func(priority protobuf.ScanPriority) {
+			if _, err := a.admit("default", 1, priority, nil); err != nil {
+				t.Errorf("Expected scan to be admitted, received %v", err)
+			}
+			admitted <- priority
+		}(priority)
+
+		for waiting := 0; waiting != i+1; {
+			time.Sleep(time.Millisecond)
+			a.mu.Lock()
+			waiting = len(a.waiters)
+			a.mu.Unlock()
+		}
+	}
+
+	expected := []protobuf.ScanPriority{
+		protobuf.ScanPriority_PRIORITY_HIGH,
+		protobuf.ScanPriority_PRIORITY_NORMAL,
+		protobuf.ScanPriority_PRIORITY_LOW,
+	}
+	for _, priority := range expected {
+		a.release("default", 1)
+		if p := <-admitted; p != priority {
+			t.Errorf("Expected %v scan to be admitted, received %v", priority, p)
+		}
+	}
+}
+
+func TestScanAdmissionReject(t *testing.T) {
+	a := newTestScanAdmission(1, 1, 10)
+
+	if _, err := a.admit("default", 1, protobuf.ScanPriority_PRIORITY_NORMAL, nil); err != nil {
+		t.Fatalf("Expected scan to run, received %v", err)
+	}
+
+	// waits for the timeout
+	if queued, err := a.admit("default", 1, protobuf.ScanPriority_PRIORITY_NORMAL, nil); !queued || err != common.ErrScanRejected {
+		t.Errorf("Expected queued scan to be rejected, received queued %v err %v", queued, err)
+	}
+
+	a.waitTimeout = time.Minute
+	cancelCh, donech := make(chan bool), make(chan bool)
+	go func() {
+		if _, err := a.admit("default", 1, protobuf.ScanPriority_PRIORITY_NORMAL, cancelCh); err != common.ErrClientCancel {
+			t.Errorf("Expected scan to be cancelled, received %v", err)
+		}
+		close(donech)
+	}()
+
+	// queue is full
+	for {
+		a.mu.Lock()
+		waiting := len(a.waiters)
+		a.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if queued, err := a.admit("default", 1, protobuf.ScanPriority_PRIORITY_HIGH, nil); queued || err != common.ErrScanRejected {
+		t.Errorf("Expected scan to be rejected, received queued %v err %v", queued, err)
+	}
+	close(cancelCh)
+	<-donech
+
+	a.release("default", 1)
+	if len(a.buckets) != 0 || len(a.indexes) != 0 || len(a.waiters) != 0 {
+		t.Errorf("Expected no running or waiting scans, received %v %v %v",
+			a.buckets, a.indexes, a.waiters)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	ErrContinuationUnsupported = errors.New("Scan continuation is not supported for this request")
+	ErrInvalidContinuation     = errors.New("Invalid scan continuation token")
+)
+
+// size of the header that precedes the index entry in a position item.
+const scanPositionHeaderLen = 8
+
+// scanContinuation tracks the position of a scan after the last row
+// written to the client, from which the continuation token returned with
+// every page is built.
+//
+// A position is the scan of the request, the raw storage entry and the
+// number of copies of the entry already returned, entries of an array
+// index can be returned several times. It is only meaningful for rows
+// returned in storage order, that is with no aggregation, distinct or
+// reverse, from a single slice snapshot.
+type scanContinuation struct {
+	snapshot *protobuf.TsConsistency
+	rows     uint64 // rows returned by this and the resumed scans
+
+	scanIndex uint32
+	duplicate uint32
+	entry     []byte
+}
+
+func newScanContinuation(resumeFrom *protobuf.ScanContinuation) *scanContinuation {
+	return &scanContinuation{rows: resumeFrom.GetRows()}
+}
+
+// setSnapshot records the timestamp of the snapshot being scanned, a
+// resumed scan needs a snapshot at least as recent.
+func (c *scanContinuation) setSnapshot(ts *common.TsVbuuid) {
+	if ts == nil {
+		return
+	}
+	vbnos := ts.GetVbnos()
+	seqnos := make([]uint64, len(vbnos))
+	vbuuids := make([]uint64, len(vbnos))
+	for i, vbno := range vbnos {
+		seqnos[i], vbuuids[i] = ts.Seqnos[vbno], ts.Vbuuids[vbno]
+	}
+	c.snapshot = protobuf.NewTsConsistency(vbnos, seqnos, vbuuids, ts.Crc64)
+}
+
+// advance moves the position to the row written from position item
+// `pos`, see encodeScanPosition.
+func (c *scanContinuation) advance(pos []byte) {
+	c.scanIndex = binary.BigEndian.Uint32(pos[:4])
+	c.duplicate = binary.BigEndian.Uint32(pos[4:scanPositionHeaderLen])
+	c.entry = append(c.entry[:0], pos[scanPositionHeaderLen:]...)
+	c.rows++
+}
+
+// token returns the continuation token of the current position, nil if
+// no row was returned yet.
+func (c *scanContinuation) token() []byte {
+	if c == nil || c.entry == nil {
+		return nil
+	}
+	data, err := proto.Marshal(&protobuf.ScanContinuation{
+		ScanIndex: proto.Uint32(c.scanIndex),
+		Entry:     c.entry,
+		Duplicate: proto.Uint32(c.duplicate),
+		Rows:      proto.Uint64(c.rows),
+		Snapshot:  c.snapshot,
+	})
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// encodeScanPosition encodes the position of a row as an item passed down
+// the scan pipeline along with the row.
+func encodeScanPosition(buf []byte, scanIndex, duplicate int, entry []byte) []byte {
+	var hdr [scanPositionHeaderLen]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(scanIndex))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(duplicate))
+	buf = append(buf[:0], hdr[:]...)
+	return append(buf, entry...)
+}
+
+// decodeContinuation parses the continuation token a scan is resumed from.
+func decodeContinuation(token []byte) (*protobuf.ScanContinuation, error) {
+	resumeFrom := &protobuf.ScanContinuation{}
+	if err := proto.Unmarshal(token, resumeFrom); err != nil {
+		return nil, ErrInvalidContinuation
+	}
+	if resumeFrom.GetEntry() == nil || resumeFrom.GetSnapshot() == nil {
+		return nil, ErrInvalidContinuation
+	}
+	return resumeFrom, nil
+}
+
+// resumeScan narrows the low bound of `scan`, the scan a request resumes
+// in, to the entry of the resume position, inclusive. Storage seeks to the
+// entry instead of the scan going over the entries already returned.
+func resumeScan(scan Scan, resumeFrom *protobuf.ScanContinuation, isPrimary bool) Scan {
+	var low IndexKey
+	if isPrimary {
+		k := primaryKey(resumeFrom.GetEntry())
+		low = &k
+	} else {
+		k := secondaryKey(resumeFrom.GetEntry())
+		low = &k
+	}
+
+	switch scan.ScanType {
+	case AllReq:
+		scan.High, scan.Incl = MaxIndexKey, Both
+	case LookupReq:
+		// entries returned by a lookup match the key on all fields, a
+		// prefix range up to the key returns the same entries.
+		scan.High, scan.Incl = scan.Equals, Both
+	case RangeReq, FilterRangeReq:
+		switch scan.Incl {
+		case Neither:
+			scan.Incl = Low
+		case High:
+			scan.Incl = Both
+		}
+	}
+	if scan.ScanType != FilterRangeReq {
+		scan.ScanType = RangeReq
+	}
+	scan.Low = low
+	return scan
+}
+
+// resumeSkip tells how many copies of `entry`, found by scan `scanIndex`
+// of a resumed request, were returned before the scan was interrupted,
+// -1 if all of them were. Entries up to the resume position were all
+// returned, and so were those of the scans before the one it is in.
+func resumeSkip(resumeFrom *protobuf.ScanContinuation, scanIndex int, entry []byte) int {
+	if resumeFrom == nil || scanIndex > int(resumeFrom.GetScanIndex()) {
+		return 0
+	}
+	if scanIndex < int(resumeFrom.GetScanIndex()) {
+		return -1
+	}
+	switch bytes.Compare(entry, resumeFrom.GetEntry()) {
+	case -1:
+		return -1
+	case 0:
+		return int(resumeFrom.GetDuplicate()) + 1
+	}
+	return 0
+}
+
+// canContinue tells whether rows of the request are returned in an order
+// a continuation token can resume from.
+func (r *ScanRequest) canContinue() bool {
+	return r.ScanType == ScanReq && r.GroupAggr == nil && !r.Distinct &&
+		!r.Reverse
+}
+
+// setResumeFrom applies the continuation token of a resumed request, the
+// rows returned before the token count towards the limit and the offset
+// was already applied.
+func (r *ScanRequest) setResumeFrom(resumeFrom *protobuf.ScanContinuation) error {
+	if int(resumeFrom.GetScanIndex()) >= len(r.Scans) {
+		return ErrInvalidContinuation
+	}
+
+	r.resumeFrom = resumeFrom
+	r.Offset = 0
+	if r.Limit > 0 {
+		if r.Limit -= int64(resumeFrom.GetRows()); r.Limit <= 0 {
+			r.Scans = nil // nothing left to return
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"bytes"
+	"testing"
+
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestScanContinuationAdvance(t *testing.T) {
+	cont := newScanContinuation(&protobuf.ScanContinuation{Rows: proto.Uint64(10)})
+	if cont.token() != nil {
+		t.Errorf("Expected no token before any row is returned")
+	}
+
+	var buf []byte
+	for i, entry := range []string{"abc", "abcd", "b"} {
+		buf = encodeScanPosition(buf, 1, i, []byte(entry))
+		cont.advance(buf)
+	}
+	if cont.scanIndex != 1 || cont.duplicate != 2 || string(cont.entry) != "b" || cont.rows != 13 {
+		t.Errorf("Unexpected position scan %v duplicate %v entry %s rows %v",
+			cont.scanIndex, cont.duplicate, cont.entry, cont.rows)
+	}
+
+	resumeFrom, err := decodeContinuation(cont.token())
+	if err == nil {
+		t.Errorf("Expected token without snapshot to be invalid")
+	}
+
+	cont.snapshot = protobuf.NewTsConsistency([]uint16{1}, []uint64{100}, []uint64{1234}, 0)
+	if resumeFrom, err = decodeContinuation(cont.token()); err != nil {
+		t.Fatalf("Unexpected error decoding token %v", err)
+	}
+	if resumeFrom.GetScanIndex() != 1 || resumeFrom.GetDuplicate() != 2 ||
+		!bytes.Equal(resumeFrom.GetEntry(), []byte("b")) || resumeFrom.GetRows() != 13 {
+		t.Errorf("Unexpected continuation %v", resumeFrom)
+	}
+}
+
+func TestScanContinuationResumeSkip(t *testing.T) {
+	resumeFrom := &protobuf.ScanContinuation{
+		ScanIndex: proto.Uint32(1),
+		Entry:     []byte("m"),
+		Duplicate: proto.Uint32(1),
+	}
+
+	tests := []struct {
+		scanIndex int
+		entry     string
+		skip      int
+	}{
+		{0, "z", -1}, // earlier scan
+		{1, "a", -1}, // before the position
+		{1, "m", 2},  // two copies returned
+		{1, "n", 0},  // after the position
+		{2, "a", 0},  // later scan
+	}
+	for _, test := range tests {
+		skip := resumeSkip(resumeFrom, test.scanIndex, []byte(test.entry))
+		if skip != test.skip {
+			t.Errorf("Expected skip %v for scan %v entry %v, received %v",
+				test.skip, test.scanIndex, test.entry, skip)
+		}
+	}
+
+	if skip := resumeSkip(nil, 0, []byte("a")); skip != 0 {
+		t.Errorf("Expected no skip for a scan not resumed, received %v", skip)
+	}
+}
+
+func TestScanContinuationResumeScan(t *testing.T) {
+	resumeFrom := &protobuf.ScanContinuation{
+		ScanIndex: proto.Uint32(0),
+		Entry:     []byte("m"),
+	}
+
+	high := secondaryKey("z")
+	tests := []struct {
+		scan Scan
+		incl Inclusion
+		high IndexKey
+	}{
+		{Scan{ScanType: AllReq}, Both, MaxIndexKey},
+		{Scan{ScanType: LookupReq, Equals: &high}, Both, &high},
+		{Scan{ScanType: RangeReq, High: &high, Incl: Neither}, Low, &high},
+		{Scan{ScanType: RangeReq, High: &high, Incl: High}, Both, &high},
+		{Scan{ScanType: FilterRangeReq, High: &high, Incl: Both}, Both, &high},
+	}
+	for _, test := range tests {
+		scan := resumeScan(test.scan, resumeFrom, false)
+		if !bytes.Equal(scan.Low.Bytes(), []byte("m")) || scan.Incl != test.incl || scan.High != test.high {
+			t.Errorf("Unexpected resumed scan %v of %v", scan, test.scan)
+		}
+		expected := ScanFilterType(RangeReq)
+		if test.scan.ScanType == FilterRangeReq {
+			expected = FilterRangeReq
+		}
+		if scan.ScanType != expected {
+			t.Errorf("Expected %v, received %v", expected, scan.ScanType)
+		}
+	}
+
+	if scan := resumeScan(Scan{ScanType: AllReq}, resumeFrom, true); scan.Low.(*primaryKey) == nil {
+		t.Errorf("Expected primary key low bound")
+	}
+}
@@ -11,6 +11,7 @@ package indexer
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/couchbase/indexing/secondary/collatejson"
@@ -22,6 +23,7 @@ import (
 	"github.com/couchbase/indexing/secondary/queryport"
 	"github.com/golang/protobuf/proto"
 	"net"
+	"net/http"
 	"sort"
 	"strings"
 	"sync"
@@ -36,6 +38,7 @@ var (
 	ErrSnapNotAvailable   = errors.New("No snapshot available for scan")
 	ErrUnsupportedRequest = errors.New("Unsupported query request")
 	ErrVbuuidMismatch     = errors.New("Mismatch in session vbuuids")
+	ErrGroupAggrPrimary   = errors.New("Aggregate pushdown is not supported on primary index")
 )
 
 var secKeyBufPool *common.BytesBufPool
@@ -79,6 +82,9 @@ type ScanRequest struct {
 	Limit     int64
 	isPrimary bool
 
+	// Partitions to scan for a partitioned index, nil means all.
+	PartitionIds []common.PartitionId
+
 	// New parameters for spock
 	Scans             []Scan
 	Indexprojection   *protobuf.IndexProjection
@@ -87,6 +93,9 @@ type ScanRequest struct {
 	Offset            int64
 	projectPrimaryKey bool
 
+	// Group keys and aggregates evaluated while scanning, nil if none.
+	GroupAggr *protobuf.GroupAggr
+
 	ScanId      uint64
 	ExpiredTime time.Time
 	Timeout     *time.Timer
@@ -95,6 +104,26 @@ type ScanRequest struct {
 	RequestId string
 	LogPrefix string
 
+	// admission priority class of the scan
+	Priority protobuf.ScanPriority
+
+	// send the indexer load in the StreamEndResponse trailer
+	reportLoad bool
+
+	// stage timings, nil unless the client asked for a trace
+	trace *scanTrace
+
+	// position of the last row returned, nil unless the client asked for
+	// continuation tokens, and the position a resumed scan starts after.
+	continuation *scanContinuation
+	resumeFrom   *protobuf.ScanContinuation
+
+	// lag of the scanned snapshot behind Ts, for BestEffortConsistency
+	staleness *protobuf.ScanStaleness
+
+	// return entry keys in collatejson encoding, client decodes them
+	collatedKeys bool
+
 	keyBufList []*[]byte
 }
 
@@ -347,6 +376,23 @@ type scanCoordinator struct {
 	stats IndexerStatsHolder
 
 	indexerState atomic.Value
+
+	histMu     sync.RWMutex
+	histograms map[common.IndexInstId]map[common.PartitionId]*indexHistogram
+	histPasses map[common.IndexInstId]map[common.PartitionId]*histogramPass
+	histStopch chan bool
+
+	advisorMu sync.Mutex
+	workloads map[common.IndexInstId]*indexScanWorkload
+
+	traceMu   sync.Mutex
+	traces    []*scanTrace
+	traceNext int
+
+	admission *scanAdmission
+
+	load       atomic.Value // *sampledLoad
+	loadStopch chan bool
 }
 
 func (s *scanCoordinator) getIndexerState() common.IndexerState {
@@ -373,12 +419,19 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 		snapshotNotifych: snapshotNotifych,
 		logPrefix:        "ScanCoordinator",
 		reqCounter:       platform.NewAlignedUint64(0),
+		histograms:       make(map[common.IndexInstId]map[common.PartitionId]*indexHistogram),
+		histPasses:       make(map[common.IndexInstId]map[common.PartitionId]*histogramPass),
+		histStopch:       make(chan bool),
+		workloads:        make(map[common.IndexInstId]*indexScanWorkload),
+		admission:        newScanAdmission(config),
+		loadStopch:       make(chan bool),
 	}
 
 	s.config.Store(config)
 
 	addr := net.JoinHostPort("", config["scanPort"].String())
 	queryportCfg := config.SectionConfig("queryport.", true)
+	queryportCfg = queryportCfg.Set("certFile", config["certFile"]).Set("keyFile", config["keyFile"])
 	s.serv, err = queryport.NewServer(addr, s.serverCallback, queryportCfg)
 
 	if err != nil {
@@ -393,9 +446,14 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 
 	s.setIndexerState(common.INDEXER_BOOTSTRAP)
 
+	http.HandleFunc("/indexAdvisor", s.handleIndexAdvisorReq)
+	http.HandleFunc("/debug/scans", s.handleDebugScansReq)
+
 	// main loop
 	go s.run()
 	go s.listenSnapshot()
+	go s.runHistogramSampler()
+	go s.runLoadSampler()
 
 	return s, &MsgSuccess{}
 
@@ -444,6 +502,7 @@ func (s *scanCoordinator) handleStats(cmd Message) {
 				logging.Errorf("%v: Unable compute index count for %v/%v (%v)", s.logPrefix,
 					idxStats.bucket, idxStats.name, err)
 			}
+			s.updateHistogramStats(id, idxStats)
 		}
 		replych <- true
 	}()
@@ -458,6 +517,8 @@ loop:
 				if cmd.GetMsgType() == SCAN_COORD_SHUTDOWN {
 					logging.Infof("ScanCoordinator: Shutting Down")
 					s.serv.Close()
+					close(s.histStopch)
+					close(s.loadStopch)
 					s.supvCmdch <- &MsgSuccess{}
 					break loop
 				}
@@ -1069,14 +1130,15 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 		}()
 		r.Consistency = &cons
 		cfg := s.config.Load()
-		if cons == common.QueryConsistency && vector != nil {
+		bestEffort := cons == common.BestEffortConsistency
+		if (cons == common.QueryConsistency || bestEffort) && vector != nil {
 			r.Ts = common.NewTsVbuuid(r.Bucket, cfg["numVbuckets"].Int())
 			// if vector == nil, it is similar to AnyConsistency
 			for i, vbno := range vector.Vbnos {
 				r.Ts.Seqnos[vbno] = vector.Seqnos[i]
 				r.Ts.Vbuuids[vbno] = vector.Vbuuids[i]
 			}
-		} else if cons == common.SessionConsistency {
+		} else if cons == common.SessionConsistency || bestEffort {
 			cluster := cfg["clusterAddr"].String()
 			r.Ts = &common.TsVbuuid{}
 			t0 := time.Now()
@@ -1126,13 +1188,21 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 	case *protobuf.StatisticsRequest:
 		r.DefnID = req.GetDefnID()
 		r.RequestId = req.GetRequestId()
+		cons := common.Consistency(req.GetCons())
+		if cons == 0 {
+			// older clients do not specify consistency for statistics.
+			cons = common.AnyConsistency
+		}
+		vector := req.GetVector()
 		r.ScanType = StatsReq
 		r.Incl = Inclusion(req.GetSpan().GetRange().GetInclusion())
+		r.PartitionIds = getPartitionIds(req.GetPartitionIds())
 		if isBootstrapMode {
 			err = common.ErrIndexerInBootstrap
 			return
 		}
 		setIndexParams()
+		setConsistency(cons, vector)
 		fillRanges(
 			req.GetSpan().GetRange().GetLow(),
 			req.GetSpan().GetRange().GetHigh(),
@@ -1145,6 +1215,8 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 		vector := req.GetVector()
 		r.ScanType = CountReq
 		r.Incl = Inclusion(req.GetSpan().GetRange().GetInclusion())
+		r.PartitionIds = getPartitionIds(req.GetPartitionIds())
+		r.Priority = req.GetPriority()
 
 		if isBootstrapMode {
 			err = common.ErrIndexerInBootstrap
@@ -1182,6 +1254,13 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 		}
 
 		r.Offset = req.GetOffset()
+		r.PartitionIds = getPartitionIds(req.GetPartitionIds())
+		r.Priority = req.GetPriority()
+		r.reportLoad = req.GetReportLoad()
+		r.collatedKeys = req.GetCollatedKeys()
+		if req.GetTrace() {
+			r.trace = newScanTrace(r.RequestId)
+		}
 		if isBootstrapMode {
 			err = common.ErrIndexerInBootstrap
 			return
@@ -1193,6 +1272,34 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 			req.GetSpan().GetRange().GetHigh(),
 			req.GetSpan().GetEquals())
 		fillScans(req.GetScans())
+		if err == nil && r.IndexInst.Defn.CanPrunePartitions() {
+			r.PartitionIds, err = pruneRangePartitions(
+				&r.IndexInst.Defn, req, r.PartitionIds)
+		}
+		if err == nil && req.GetGroupAggr() != nil {
+			err = setGroupAggr(r, req.GetGroupAggr())
+		}
+		if err == nil && (req.GetContinuations() || req.GetResumeFrom() != nil) {
+			if !r.canContinue() {
+				err = ErrContinuationUnsupported
+				return
+			}
+			var resumeFrom *protobuf.ScanContinuation
+			if token := req.GetResumeFrom(); token != nil {
+				if resumeFrom, err = decodeContinuation(token); err != nil {
+					return
+				}
+				if err = r.setResumeFrom(resumeFrom); err != nil {
+					return
+				}
+				// any replica with a snapshot at least as recent as the
+				// one the scan started on can resume it.
+				setConsistency(common.QueryConsistency, resumeFrom.GetSnapshot())
+			}
+			if req.GetContinuations() {
+				r.continuation = newScanContinuation(resumeFrom)
+			}
+		}
 
 	case *protobuf.ScanAllRequest:
 		r.DefnID = req.GetDefnID()
@@ -1203,6 +1310,13 @@ func (s *scanCoordinator) newRequest(protoReq interface{},
 		r.Limit = req.GetLimit()
 		r.Scans = make([]Scan, 1)
 		r.Scans[0].ScanType = AllReq
+		r.PartitionIds = getPartitionIds(req.GetPartitionIds())
+		r.Priority = req.GetPriority()
+		r.reportLoad = req.GetReportLoad()
+		r.collatedKeys = req.GetCollatedKeys()
+		if req.GetTrace() {
+			r.trace = newScanTrace(r.RequestId)
+		}
 
 		if isBootstrapMode {
 			err = common.ErrIndexerInBootstrap
@@ -1294,6 +1408,9 @@ func isSnapshotConsistent(
 			return false
 		} else if cons == common.AnyConsistency {
 			return true
+		} else if cons == common.BestEffortConsistency {
+			// staleness is reported instead
+			return true
 		}
 	}
 	return false
@@ -1342,6 +1459,18 @@ func (s *scanCoordinator) handleError(prefix string, err error) {
 	}
 }
 
+func (s *scanCoordinator) validateAuth(w http.ResponseWriter, r *http.Request) bool {
+	valid, err := common.IsAuthValid(r, s.config.Load()["clusterAddr"].String())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error() + "\n"))
+	} else if valid == false {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("401 Unauthorized\n"))
+	}
+	return valid
+}
+
 func (s *scanCoordinator) tryRespondWithError(w ScanResponseWriter, req *ScanRequest, err error) bool {
 	if err != nil {
 		if err == common.ErrIndexNotReady && req.Stats != nil {
@@ -1349,6 +1478,11 @@ func (s *scanCoordinator) tryRespondWithError(w ScanResponseWriter, req *ScanReq
 		} else if err == common.ErrIndexNotFound {
 			stats := s.stats.Get()
 			stats.notFoundError.Add(1)
+		} else if err == common.ErrScanRejected {
+			if req.Stats != nil {
+				req.Stats.numScansRejected.Add(1)
+			}
+			logging.Verbosef("%s RESPONSE status:(error = %s), requestId: %v", req.LogPrefix, err, req.RequestId)
 		} else if err == common.ErrIndexerInBootstrap {
 			logging.Verbosef("%s REQUEST %s", req.LogPrefix, req)
 			logging.Verbosef("%s RESPONSE status:(error = %s), requestId: %v", req.LogPrefix, err, req.RequestId)
@@ -1375,10 +1509,22 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, conn net.Conn,
 		}
 	}()
 
+	if req.trace != nil {
+		conn = &tracedConn{Conn: conn, trace: req.trace}
+	}
+
 	atime := time.Now()
 	w := NewProtoWriter(req.ScanType, conn)
+	w.continuation = req.continuation
+	w.collatedKeys = req.collatedKeys
 	defer func() {
+		t := time.Now()
 		s.handleError(req.LogPrefix, w.Done())
+		if req.trace != nil {
+			req.trace.Write += int64(time.Since(t))
+			s.endScanTrace(req)
+		}
+		s.writeStreamEnd(req, conn)
 		req.Done()
 	}()
 
@@ -1408,11 +1554,27 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, conn net.Conn,
 	}
 
 	req.Stats.numRequests.Add(1)
+	s.recordScanShape(req)
+
+	if req.needsAdmission() {
+		queued, err := s.admission.admit(req.Bucket, req.IndexInstId,
+			req.Priority, req.CancelCh)
+		if queued {
+			req.Stats.numScansQueued.Add(1)
+		}
+		if s.tryRespondWithError(w, req, err) {
+			return
+		}
+		defer s.admission.release(req.Bucket, req.IndexInstId)
+	}
 
 	req.Stats.scanReqInitDuration.Add(time.Now().Sub(ttime).Nanoseconds())
 
 	t0 := time.Now()
 	is, err := s.getRequestedIndexSnapshot(req)
+	if req.trace != nil {
+		req.trace.SnapshotWait = int64(time.Since(t0))
+	}
 	if s.tryRespondWithError(w, req, err) {
 		return
 	}
@@ -1424,6 +1586,13 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, conn net.Conn,
 			req.LogPrefix, ScanTStoString(is.Timestamp()))
 	})
 
+	if *req.Consistency == common.BestEffortConsistency {
+		req.staleness = scanStaleness(is.Timestamp(), req.Ts, req.Stats)
+		if req.staleness.GetBehind() > 0 {
+			req.Stats.numStaleScans.Add(1)
+		}
+	}
+
 	defer func() {
 		req.Stats.scanReqDuration.Add(time.Now().Sub(ttime).Nanoseconds())
 	}()
@@ -1447,7 +1616,7 @@ func (s *scanCoordinator) processRequest(req *ScanRequest, w ScanResponseWriter,
 }
 
 func (s *scanCoordinator) handleHeloRequest(req *ScanRequest, w ScanResponseWriter) {
-	err := w.Helo()
+	err := w.Helo(s.currentLoad())
 	s.handleError(req.LogPrefix, err)
 }
 
@@ -1466,6 +1635,9 @@ func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWrit
 	scanTime := time.Now().Sub(t0)
 
 	req.Stats.numRowsReturned.Add(int64(scanPipeline.RowsReturned()))
+	if req.trace != nil {
+		req.trace.RowsReturned = scanPipeline.RowsReturned()
+	}
 	req.Stats.scanBytesRead.Add(int64(scanPipeline.BytesRead()))
 	req.Stats.scanDuration.Add(scanTime.Nanoseconds())
 	req.Stats.scanWaitDuration.Add(waitTime.Nanoseconds())
@@ -1502,7 +1674,7 @@ func (s *scanCoordinator) handleCountRequest(req *ScanRequest, w ScanResponseWri
 	cancelCb.Run()
 	defer cancelCb.Done()
 
-	for _, s := range GetSliceSnapshots(is) {
+	for _, s := range GetPartitionSliceSnapshots(is, req.PartitionIds) {
 		var r uint64
 		snap := s.Snapshot()
 		if len(req.Keys) > 0 {
@@ -1542,7 +1714,7 @@ func (s *scanCoordinator) handleMultiScanCountRequest(req *ScanRequest, w ScanRe
 	defer cancelCb.Done()
 
 	for _, scan := range req.Scans {
-		for _, s := range GetSliceSnapshots(is) {
+		for _, s := range GetPartitionSliceSnapshots(is, req.PartitionIds) {
 			var r uint64
 			snap := s.Snapshot()
 			if scan.ScanType == AllReq {
@@ -1571,7 +1743,7 @@ func (s *scanCoordinator) handleMultiScanCountRequest(req *ScanRequest, w ScanRe
 
 func (s *scanCoordinator) handleStatsRequest(req *ScanRequest, w ScanResponseWriter,
 	is IndexSnapshot) {
-	var rows uint64
+	var stats *indexStatistics
 	var err error
 
 	stopch := make(StopChannel)
@@ -1582,28 +1754,24 @@ func (s *scanCoordinator) handleStatsRequest(req *ScanRequest, w ScanResponseWri
 	cancelCb.Run()
 	defer cancelCb.Done()
 
-	for _, s := range GetSliceSnapshots(is) {
-		var r uint64
-		snap := s.Snapshot()
-		if req.Low.Bytes() == nil && req.Low.Bytes() == nil {
-			r, err = snap.StatCountTotal()
-		} else {
-			r, err = snap.CountRange(req.ctx, req.Low, req.High, req.Incl, stopch)
-		}
-
-		if err != nil {
-			break
-		}
+	stats, err = computeIndexStatistics(req, is, stopch)
+	if s.tryRespondWithError(w, req, err) {
+		return
+	}
 
-		rows += r
+	min, max, err := stats.decodeMinMax(req.isPrimary)
+	if s.tryRespondWithError(w, req, err) {
+		return
 	}
 
+	bins, err := binsToProto(s.histogramBins(req), req.isPrimary)
 	if s.tryRespondWithError(w, req, err) {
 		return
 	}
 
-	logging.Verbosef("%s RESPONSE status:ok", req.LogPrefix)
-	err = w.Stats(rows, 0, nil, nil)
+	logging.Verbosef("%s RESPONSE count:%d distinct:%d sampled:%v bins:%d status:ok",
+		req.LogPrefix, stats.count, stats.distinct, stats.sampled, len(bins))
+	err = w.Stats(stats.count, stats.distinct, min, max, stats.sampled, bins)
 	s.handleError(req.LogPrefix, err)
 }
 
@@ -1633,6 +1801,8 @@ func (s *scanCoordinator) handleUpdateIndexInstMap(cmd Message) {
 	indexInstMap := req.GetIndexInstMap()
 	s.stats.Set(req.GetStatsObject())
 	s.indexInstMap = common.CopyIndexInstMap(indexInstMap)
+	s.pruneHistograms(s.indexInstMap, s.indexPartnMap)
+	s.syncScanWorkloads(s.indexInstMap)
 
 	s.supvCmdch <- &MsgSuccess{}
 }
@@ -1644,6 +1814,7 @@ func (s *scanCoordinator) handleUpdateIndexPartnMap(cmd Message) {
 	logging.Tracef("ScanCoordinator::handleUpdateIndexPartnMap %v", cmd)
 	indexPartnMap := cmd.(*MsgUpdatePartnMap).GetIndexPartnMap()
 	s.indexPartnMap = CopyIndexPartnMap(indexPartnMap)
+	s.pruneHistograms(s.indexInstMap, s.indexPartnMap)
 
 	s.supvCmdch <- &MsgSuccess{}
 }
@@ -1651,6 +1822,7 @@ func (s *scanCoordinator) handleUpdateIndexPartnMap(cmd Message) {
 func (s *scanCoordinator) handleConfigUpdate(cmd Message) {
 	cfgUpdate := cmd.(*MsgConfigUpdate)
 	s.config.Store(cfgUpdate.GetConfig())
+	s.admission.setConfig(cfgUpdate.GetConfig())
 	s.supvCmdch <- &MsgSuccess{}
 }
 
@@ -1734,6 +1906,142 @@ func ScanTStoString(ts *common.TsVbuuid) string {
 	return seqsStr
 }
 
+func getPartitionIds(ids []uint64) []common.PartitionId {
+	if len(ids) == 0 {
+		return nil
+	}
+	partnIds := make([]common.PartitionId, len(ids))
+	for i, id := range ids {
+		partnIds[i] = common.PartitionId(id)
+	}
+	return partnIds
+}
+
+// setGroupAggr validates key positions of group keys and aggregates
+// against the index, aggregated rows replace index projection and
+// carry no primary key.
+func setGroupAggr(r *ScanRequest, groupAggr *protobuf.GroupAggr) error {
+	if r.isPrimary {
+		return ErrGroupAggrPrimary
+	}
+
+	numKeys := int32(len(r.IndexInst.Defn.SecExprs))
+	for _, gk := range groupAggr.GetGroupKeys() {
+		if pos := gk.GetKeyPos(); pos < 0 || pos >= numKeys {
+			return fmt.Errorf("Invalid group key position %v", pos)
+		}
+	}
+	for _, aggr := range groupAggr.GetAggrs() {
+		pos := aggr.GetKeyPos()
+		if pos >= numKeys || pos < -1 ||
+			(pos == -1 && aggr.GetAggrFunc() != protobuf.AggrFuncType_AGG_COUNT) {
+			return fmt.Errorf("Invalid key position %v for aggregate %v",
+				pos, aggr.GetAggrFunc())
+		}
+	}
+
+	r.GroupAggr = groupAggr
+	r.Indexprojection = nil
+	r.Distinct = false
+	r.projectPrimaryKey = false
+	return nil
+}
+
+// pruneRangePartitions returns partitions, among partnIds, of a range
+// partitioned index that can hold rows for the spans in the request.
+// Spans are matched against split keys on their leading key, which is
+// the partition key of the index.
+func pruneRangePartitions(defn *common.IndexDefn, req *protobuf.ScanRequest,
+	partnIds []common.PartitionId) ([]common.PartitionId, error) {
+
+	numPartitions := defn.GetNumPartitions()
+	selected := make([]bool, numPartitions)
+	add := func(low, high []byte) error {
+		ids, err := common.RangePartitionIds(low, high, defn.PartitionSplits)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			selected[id] = true
+		}
+		return nil
+	}
+
+	if scans := req.GetScans(); len(scans) > 0 {
+		for _, scan := range scans {
+			if len(scan.GetEquals()) > 0 {
+				if err := add(scan.Equals[0], scan.Equals[0]); err != nil {
+					return nil, err
+				}
+			} else if len(scan.GetFilters()) == 0 {
+				return partnIds, nil
+			} else {
+				fl := scan.Filters[0]
+				if err := add(fl.GetLow(), fl.GetHigh()); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+	} else if span := req.GetSpan(); len(span.GetEquals()) > 0 {
+		for _, key := range span.GetEquals() {
+			leading, err := leadingJsonKey(key)
+			if err != nil {
+				return nil, err
+			} else if leading == nil {
+				return partnIds, nil
+			}
+			if err := add(leading, leading); err != nil {
+				return nil, err
+			}
+		}
+
+	} else {
+		low, err := leadingJsonKey(span.GetRange().GetLow())
+		if err != nil {
+			return nil, err
+		}
+		high, err := leadingJsonKey(span.GetRange().GetHigh())
+		if err != nil {
+			return nil, err
+		}
+		if err := add(low, high); err != nil {
+			return nil, err
+		}
+	}
+
+	pruned := make([]common.PartitionId, 0, numPartitions)
+	if partnIds == nil {
+		for id, ok := range selected {
+			if ok {
+				pruned = append(pruned, common.PartitionId(id))
+			}
+		}
+	} else {
+		for _, id := range partnIds {
+			if int(id) >= 0 && int(id) < numPartitions && selected[id] {
+				pruned = append(pruned, id)
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// leadingJsonKey returns the first element of a JSON encoded composite
+// key, nil if the key is unbounded.
+func leadingJsonKey(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	var vals []json.RawMessage
+	if err := json.Unmarshal(key, &vals); err != nil {
+		return nil, err
+	} else if len(vals) == 0 {
+		return nil, nil
+	}
+	return vals[0], nil
+}
+
 func readDeallocSnapshot(ch chan interface{}) {
 	msg := <-ch
 	if msg == nil {
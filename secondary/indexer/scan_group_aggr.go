@@ -0,0 +1,303 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+// groupAggr evaluates GROUP BY and aggregates of a scan request over the
+// composite keys of qualifying index entries. Group keys and MIN/MAX
+// values are kept in collatejson encoding, so that they are compared and
+// ordered the way index collates them.
+//
+// If group keys are the leading keys of the index, groups arrive
+// contiguously while scanning and each group is emitted as soon as the
+// next one starts, otherwise groups are hashed and emitted once the scan
+// is done. Either way groups are emitted in index order of group keys,
+// descending for desc keys, so that client can merge groups from
+// partitions as they stream.
+type groupAggr struct {
+	spec      *protobuf.GroupAggr
+	streaming bool
+	desc      []bool // of group keys, nil if all are ascending
+	current   *aggrGroup
+	groups    map[string]*aggrGroup
+	emit      func(row []byte) error
+
+	codec  *collatejson.Codec
+	keyBuf []byte
+	rowBuf []byte
+}
+
+type aggrGroup struct {
+	key   []byte // group key values concatenated in collatejson encoding
+	keys  [][]byte
+	aggrs []*aggrValue
+}
+
+type aggrValue struct {
+	fn       protobuf.AggrFuncType
+	keyPos   int
+	value    []byte // MIN/MAX in collatejson encoding
+	sum      float64
+	count    int64
+	distinct map[string]bool
+}
+
+// newGroupAggr return an aggregator for `spec` on an index with `desc`
+// keys, `emit` is called with a secondary index entry for each result
+// row, whose key is the array of group key values followed by aggregate
+// values.
+func newGroupAggr(spec *protobuf.GroupAggr, streaming bool, desc []bool,
+	emit func(row []byte) error) *groupAggr {
+
+	g := &groupAggr{
+		spec:      spec,
+		streaming: streaming,
+		groups:    make(map[string]*aggrGroup),
+		emit:      emit,
+		codec:     collatejson.NewCodec(16),
+	}
+	for i, gk := range spec.GetGroupKeys() {
+		if pos := int(gk.GetKeyPos()); pos < len(desc) && desc[pos] {
+			if g.desc == nil {
+				g.desc = make([]bool, len(spec.GetGroupKeys()))
+			}
+			g.desc[i] = true
+		}
+	}
+	return g
+}
+
+// canStreamGroups return true if rows for a group are contiguous in the
+// scan, when group keys are the leading keys of the index in order and
+// entries are read from a single ordered range.
+func canStreamGroups(spec *protobuf.GroupAggr, numScans, numSlices int) bool {
+	groupKeys := spec.GetGroupKeys()
+	if len(groupKeys) == 0 {
+		return true
+	}
+	for i, gk := range groupKeys {
+		if int(gk.GetKeyPos()) != i {
+			return false
+		}
+	}
+	return numScans == 1 && numSlices == 1
+}
+
+// add composite keys of an index entry, occuring `count` times, to its group.
+func (g *groupAggr) add(compositekeys [][]byte, count int) error {
+	key := g.keyBuf[:0]
+	for _, gk := range g.spec.GetGroupKeys() {
+		key = append(key, compositekeys[gk.GetKeyPos()]...)
+	}
+	g.keyBuf = key
+
+	var group *aggrGroup
+	if g.streaming {
+		if g.current == nil || !bytes.Equal(g.current.key, key) {
+			if g.current != nil {
+				if err := g.emitGroup(g.current); err != nil {
+					return err
+				}
+			}
+			g.current = g.newGroup(key, compositekeys)
+		}
+		group = g.current
+
+	} else if group = g.groups[string(key)]; group == nil {
+		group = g.newGroup(key, compositekeys)
+		g.groups[string(group.key)] = group
+	}
+
+	for _, v := range group.aggrs {
+		if err := v.add(compositekeys, count, g.codec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush emits pending groups once the scan is done. Aggregates without
+// group keys always produce a single row, even if no entry qualified.
+func (g *groupAggr) flush() error {
+	if g.streaming {
+		if g.current == nil && len(g.spec.GetGroupKeys()) == 0 {
+			g.current = g.newGroup(nil, nil)
+		}
+		if g.current != nil {
+			return g.emitGroup(g.current)
+		}
+		return nil
+	}
+
+	if len(g.groups) == 0 && len(g.spec.GetGroupKeys()) == 0 {
+		group := g.newGroup(nil, nil)
+		g.groups[string(group.key)] = group
+	}
+	keys := make([]string, 0, len(g.groups))
+	ordered := make(map[string]*aggrGroup, len(g.groups))
+	for _, group := range g.groups {
+		key := g.orderKey(group)
+		keys = append(keys, key)
+		ordered[key] = group
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := g.emitGroup(ordered[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderKey return group key with values of desc group keys reversed, the
+// way storage collates them.
+func (g *groupAggr) orderKey(group *aggrGroup) string {
+	if g.desc == nil {
+		return string(group.key)
+	}
+	key := make([]byte, 0, len(group.key))
+	for i, val := range group.keys {
+		n := len(key)
+		key = append(key, val...)
+		if g.desc[i] {
+			for j := n; j < len(key); j++ {
+				key[j] = ^key[j]
+			}
+		}
+	}
+	return string(key)
+}
+
+func (g *groupAggr) newGroup(key []byte, compositekeys [][]byte) *aggrGroup {
+	// group key values are sliced from a copy, since storage may reuse
+	// the entry buffer.
+	group := &aggrGroup{key: append([]byte(nil), key...)}
+	rest := group.key
+	for _, gk := range g.spec.GetGroupKeys() {
+		n := len(compositekeys[gk.GetKeyPos()])
+		group.keys = append(group.keys, rest[:n])
+		rest = rest[n:]
+	}
+
+	for _, aggr := range g.spec.GetAggrs() {
+		v := &aggrValue{fn: aggr.GetAggrFunc(), keyPos: int(aggr.GetKeyPos())}
+		if aggr.GetDistinct() {
+			v.distinct = make(map[string]bool)
+		}
+		group.aggrs = append(group.aggrs, v)
+	}
+	return group
+}
+
+func (g *groupAggr) emitGroup(group *aggrGroup) error {
+	vals := make([][]byte, 0, len(group.keys)+len(group.aggrs))
+	vals = append(vals, group.keys...)
+	for _, v := range group.aggrs {
+		val, err := v.result(g.codec)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, val)
+	}
+
+	code, err := g.codec.JoinArray(vals, nil)
+	if err != nil {
+		return err
+	}
+	// entry is built in place and needs room for the docid length.
+	if size := len(code) + MAX_KEY_EXTRABYTES_LEN; cap(g.rowBuf) < size {
+		g.rowBuf = make([]byte, 0, size)
+	}
+	entry, err := NewSecondaryIndexEntry(code, nil, false, 1, nil, g.rowBuf[:0])
+	if err != nil {
+		return err
+	}
+	g.rowBuf = entry
+	return g.emit(entry)
+}
+
+// add value at aggregate's key position, null and missing values are
+// ignored by all aggregates except COUNT(*).
+func (v *aggrValue) add(compositekeys [][]byte, count int, codec *collatejson.Codec) error {
+	if v.keyPos < 0 {
+		v.count += int64(count)
+		return nil
+	}
+
+	val := compositekeys[v.keyPos]
+	if val[0] == collatejson.TypeMissing || val[0] == collatejson.TypeNull {
+		return nil
+	}
+	if v.distinct != nil {
+		if v.distinct[string(val)] {
+			return nil
+		}
+		v.distinct[string(val)] = true
+		count = 1
+	}
+
+	switch v.fn {
+	case protobuf.AggrFuncType_AGG_MIN:
+		if v.value == nil || bytes.Compare(val, v.value) < 0 {
+			v.value = append(v.value[:0], val...)
+		}
+
+	case protobuf.AggrFuncType_AGG_MAX:
+		if v.value == nil || bytes.Compare(val, v.value) > 0 {
+			v.value = append(v.value[:0], val...)
+		}
+
+	case protobuf.AggrFuncType_AGG_COUNT:
+		v.count += int64(count)
+
+	case protobuf.AggrFuncType_AGG_SUM:
+		if val[0] != collatejson.TypeNumber {
+			return nil // SUM ignores non-numeric values
+		}
+		n, err := codec.DecodeValue(val)
+		if err != nil {
+			return err
+		}
+		v.sum += n.(float64) * float64(count)
+		v.count += int64(count)
+	}
+	return nil
+}
+
+// result return aggregate value in collatejson encoding, MIN/MAX/SUM
+// over no values is null.
+func (v *aggrValue) result(codec *collatejson.Codec) ([]byte, error) {
+	var text string
+	switch v.fn {
+	case protobuf.AggrFuncType_AGG_MIN, protobuf.AggrFuncType_AGG_MAX:
+		if v.value != nil {
+			return v.value, nil
+		}
+		text = "null"
+
+	case protobuf.AggrFuncType_AGG_COUNT:
+		text = strconv.FormatInt(v.count, 10)
+
+	case protobuf.AggrFuncType_AGG_SUM:
+		text = "null"
+		if v.count > 0 {
+			text = strconv.FormatFloat(v.sum, 'f', -1, 64)
+		}
+	}
+	return codec.Encode([]byte(text), make([]byte, 0, 3*len(text)+collatejson.MinBufferSize))
+}
@@ -0,0 +1,154 @@
+package indexer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+)
+
+func testAggregate(fn protobuf.AggrFuncType, keyPos int32, distinct bool) *protobuf.Aggregate {
+	return &protobuf.Aggregate{
+		AggrFunc: fn.Enum(),
+		KeyPos:   proto.Int32(keyPos),
+		Distinct: proto.Bool(distinct),
+	}
+}
+
+// rows decoded from collatejson carry numbers in exponent notation,
+// compare them as JSON values.
+func equalJsonRows(rows, expected []string) bool {
+	if len(rows) != len(expected) {
+		return false
+	}
+	for i := range rows {
+		var x, y interface{}
+		if json.Unmarshal([]byte(rows[i]), &x) != nil ||
+			json.Unmarshal([]byte(expected[i]), &y) != nil ||
+			!reflect.DeepEqual(x, y) {
+			return false
+		}
+	}
+	return true
+}
+
+func runGroupAggr(t *testing.T, spec *protobuf.GroupAggr, streaming bool,
+	desc []bool, keys []string) []string {
+
+	var rows []string
+	aggr := newGroupAggr(spec, streaming, desc, func(row []byte) error {
+		sk, docid, _ := siSplitEntry(row, make([]byte, 0, 3*len(row)))
+		if len(docid) != 0 {
+			t.Errorf("Unexpected primary key %s in aggregated row", docid)
+		}
+		rows = append(rows, string(sk))
+		return nil
+	})
+
+	codec := collatejson.NewCodec(16)
+	for _, key := range keys {
+		code, err := codec.Encode([]byte(key), make([]byte, 0, 3*len(key)+collatejson.MinBufferSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ck, err := codec.ExplodeArray(code, make([]byte, 0, 3*len(code)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := aggr.add(ck, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := aggr.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestGroupAggr(t *testing.T) {
+	spec := &protobuf.GroupAggr{
+		GroupKeys: []*protobuf.GroupKey{{KeyPos: proto.Int32(0)}},
+		Aggrs: []*protobuf.Aggregate{
+			testAggregate(protobuf.AggrFuncType_AGG_SUM, 1, false),
+			testAggregate(protobuf.AggrFuncType_AGG_MIN, 1, false),
+			testAggregate(protobuf.AggrFuncType_AGG_MAX, 1, false),
+			testAggregate(protobuf.AggrFuncType_AGG_COUNT, -1, false),
+			testAggregate(protobuf.AggrFuncType_AGG_COUNT, 1, true),
+		},
+	}
+	sorted := []string{
+		`["austin",10,"x"]`, `["austin",null,"x"]`, `["austin",10,"y"]`,
+		`["boston",2.5,"x"]`, `["boston","n","x"]`,
+	}
+	shuffled := []string{sorted[3], sorted[0], sorted[4], sorted[2], sorted[1]}
+	expected := []string{
+		`["austin",20,10,10,3,1]`,
+		`["boston",2.5,2.5,"n",2,2]`,
+	}
+
+	for _, streaming := range []bool{true, false} {
+		keys := sorted
+		if !streaming {
+			keys = shuffled
+		}
+		rows := runGroupAggr(t, spec, streaming, nil, keys)
+		if !equalJsonRows(rows, expected) {
+			t.Errorf("Expected rows %v, received %v (streaming %v)", expected, rows, streaming)
+		}
+	}
+}
+
+func TestGroupAggrNoGroups(t *testing.T) {
+	spec := &protobuf.GroupAggr{
+		Aggrs: []*protobuf.Aggregate{
+			testAggregate(protobuf.AggrFuncType_AGG_SUM, 0, false),
+			testAggregate(protobuf.AggrFuncType_AGG_COUNT, -1, false),
+		},
+	}
+
+	rows := runGroupAggr(t, spec, true, nil, nil)
+	if !equalJsonRows(rows, []string{`[null,0]`}) {
+		t.Errorf("Expected single row [null,0], received %v", rows)
+	}
+
+	rows = runGroupAggr(t, spec, false, nil, []string{`[1,"a"]`, `[2,"b"]`})
+	if !equalJsonRows(rows, []string{`[3,2]`}) {
+		t.Errorf("Expected single row [3,2], received %v", rows)
+	}
+
+	if !canStreamGroups(spec, 2, 2) {
+		t.Errorf("Expected aggregates without group keys to stream")
+	}
+	spec.GroupKeys = []*protobuf.GroupKey{{KeyPos: proto.Int32(1)}}
+	if canStreamGroups(spec, 1, 1) {
+		t.Errorf("Expected group on non-leading key to be hashed")
+	}
+}
+
+func TestGroupAggrDescOrder(t *testing.T) {
+	spec := &protobuf.GroupAggr{
+		GroupKeys: []*protobuf.GroupKey{
+			{KeyPos: proto.Int32(1)}, {KeyPos: proto.Int32(0)},
+		},
+		Aggrs: []*protobuf.Aggregate{
+			testAggregate(protobuf.AggrFuncType_AGG_COUNT, -1, false),
+		},
+	}
+	keys := []string{`[1,"a"]`, `[2,"b"]`, `[1,"b"]`, `[2,"a"]`, `[1,"a"]`}
+
+	// hashed groups are emitted in index order, descending on desc keys.
+	rows := runGroupAggr(t, spec, false, []bool{true, false}, keys)
+	expected := []string{`["a",2,1]`, `["a",1,2]`, `["b",2,1]`, `["b",1,1]`}
+	if !equalJsonRows(rows, expected) {
+		t.Errorf("Expected rows %v, received %v", expected, rows)
+	}
+
+	rows = runGroupAggr(t, spec, false, nil, keys)
+	expected = []string{`["a",1,2]`, `["a",2,1]`, `["b",1,1]`, `["b",2,1]`}
+	if !equalJsonRows(rows, expected) {
+		t.Errorf("Expected rows %v, received %v", expected, rows)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"github.com/couchbase/indexing/secondary/logging"
+	p "github.com/couchbase/indexing/secondary/pipeline"
+	"github.com/couchbase/indexing/secondary/platform"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+	"net"
+	"time"
+)
+
+// sampledLoad is the part of the indexer load that is too costly to
+// compute for every response, it is refreshed by the load sampler.
+type sampledLoad struct {
+	snapshotWaiters uint64
+	cpuUtilization  float64
+	memoryPressure  float64
+}
+
+// runLoadSampler periodically samples the load that is reported to scan
+// clients for picking the replica to scan.
+func (s *scanCoordinator) runLoadSampler() {
+	cfg := s.config.Load()
+	interval := time.Duration(cfg["settings.scan_load.sample_interval"].Int())
+	ticker := time.NewTicker(interval * time.Millisecond)
+	defer ticker.Stop()
+
+	lastCpu, err := platform.ProcessCPUTime()
+	if err != nil {
+		logging.Warnf("%v unable to read process cpu time: %v", s.logPrefix, err)
+	}
+	lastTime := time.Now()
+
+	for {
+		select {
+		case <-s.loadStopch:
+			return
+
+		case now := <-ticker.C:
+			load := &sampledLoad{}
+
+			if cpu, err := platform.ProcessCPUTime(); err == nil {
+				elapsed := now.Sub(lastTime) * time.Duration(num_cpu_core)
+				if elapsed > 0 && lastCpu > 0 {
+					load.cpuUtilization = float64(cpu-lastCpu) / float64(elapsed)
+				}
+				lastCpu, lastTime = cpu, now
+			}
+
+			if stats := s.stats.Get(); stats != nil {
+				if quota := stats.memoryQuota.Value(); quota > 0 {
+					load.memoryPressure = float64(stats.memoryUsed.Value()) / float64(quota)
+				}
+				for _, idxStats := range stats.indexes {
+					if n := idxStats.numSnapshotWaiters.Value(); n > 0 {
+						load.snapshotWaiters += uint64(n)
+					}
+				}
+			}
+
+			s.load.Store(load)
+		}
+	}
+}
+
+// currentLoad returns the load of the indexer, made of the live scan
+// admission counts and the last sample.
+func (s *scanCoordinator) currentLoad() *protobuf.IndexerLoad {
+	running, queued := s.admission.counts()
+	load := &protobuf.IndexerLoad{
+		ScansRunning: proto.Uint64(uint64(running)),
+		ScansQueued:  proto.Uint64(uint64(queued)),
+	}
+	if sample, ok := s.load.Load().(*sampledLoad); ok {
+		load.SnapshotWaiters = proto.Uint64(sample.snapshotWaiters)
+		load.CpuUtilization = proto.Float64(sample.cpuUtilization)
+		load.MemoryPressure = proto.Float64(sample.memoryPressure)
+	}
+	return load
+}
+
+// writeStreamEnd sends the StreamEndResponse trailer of scan requests
+// that asked for a trace or for the indexer load, and of scans with
+// BestEffortConsistency.
+func (s *scanCoordinator) writeStreamEnd(req *ScanRequest, conn net.Conn) {
+	if req.ScanType != ScanReq && req.ScanType != ScanAllReq {
+		return
+	}
+	if req.trace == nil && !req.reportLoad && req.staleness == nil {
+		return
+	}
+
+	res := &protobuf.StreamEndResponse{}
+	if req.trace != nil {
+		res.Trace = req.trace.toProto()
+	}
+	if req.reportLoad {
+		res.Load = s.currentLoad()
+	}
+	res.Staleness = req.staleness
+
+	buf := p.GetBlock()
+	defer p.PutBlock(buf)
+	s.handleError(req.LogPrefix, protobuf.EncodeAndWrite(conn, *buf, res))
+}
@@ -17,6 +17,7 @@ import (
 	c "github.com/couchbase/indexing/secondary/common"
 	p "github.com/couchbase/indexing/secondary/pipeline"
 	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"time"
 )
 
 var (
@@ -52,6 +53,10 @@ func NewScanPipeline(req *ScanRequest, w ScanResponseWriter, is IndexSnapshot) *
 	scanPipeline := new(ScanPipeline)
 	scanPipeline.req = req
 
+	if req.continuation != nil {
+		req.continuation.setSnapshot(is.Timestamp())
+	}
+
 	src := &IndexScanSource{is: is, p: scanPipeline}
 	src.InitWriter()
 	dec := &IndexScanDecoder{p: scanPipeline}
@@ -106,10 +111,68 @@ func (s *IndexScanSource) Routine() error {
 	revbuf := secKeyBufPool.Get()
 	r.keyBufList = append(r.keyBufList, revbuf)
 
+	// time spent in the entry callback, and blocked on the decoder within
+	// it, for a traced request
+	trace := r.trace
+	var callbTime, writeWait time.Duration
+
+	writeItem := func(items ...[]byte) error {
+		if trace == nil {
+			return s.WriteItem(items...)
+		}
+		t0 := time.Now()
+		err := s.WriteItem(items...)
+		writeWait += time.Since(t0)
+		return err
+	}
+
+	// entries are in collation order only within a partition, client
+	// scans one partition per request and merges them.
+	sliceSnapshots := GetPartitionSliceSnapshots(s.is, r.PartitionIds)
+
+	// rows are passed down with their position for continuation tokens,
+	// a resumed scan starts from the entry of the position it resumes
+	// from and skips the copies of it already returned.
+	cont, resume := r.continuation, r.resumeFrom
+	if (cont != nil || resume != nil) && len(sliceSnapshots) > 1 {
+		s.CloseWithError(ErrContinuationUnsupported)
+		return nil
+	}
+	var scanIndex int
+	var posBuf []byte
+
+	// aggregate pushdown, offset and limit apply to aggregated rows.
+	var aggr *groupAggr
+	if r.GroupAggr != nil {
+		streaming := canStreamGroups(r.GroupAggr, len(r.Scans), len(sliceSnapshots))
+		aggr = newGroupAggr(r.GroupAggr, streaming, r.IndexInst.Defn.Desc, func(row []byte) error {
+			if currOffset < r.Offset {
+				currOffset++
+				return nil
+			}
+			s.p.rowsReturned++
+			if wrErr := writeItem(row); wrErr != nil {
+				return wrErr
+			}
+			if s.p.rowsReturned == uint64(r.Limit) {
+				return ErrLimitReached
+			}
+			return nil
+		})
+	}
+
 	fn := func(entry []byte) error {
 		skipRow := false
 		var ck [][]byte
 
+		raw, skip := entry, 0
+		if resume != nil {
+			if skip = resumeSkip(resume, scanIndex, raw); skip < 0 {
+				return nil
+			}
+			resume = nil
+		}
+
 		//get the key in original format
 		if s.p.req.IndexInst.Defn.Desc != nil {
 			revbuf := (*revbuf)[:0]
@@ -133,6 +196,19 @@ func (s *IndexScanSource) Routine() error {
 			return nil
 		}
 
+		if aggr != nil {
+			if ck == nil {
+				if len(entry) > cap(*buf) {
+					*buf = make([]byte, 0, len(entry)+1024)
+				}
+				codec := collatejson.NewCodec(16)
+				if ck, err = codec.ExplodeArray(entry, (*buf)[:0]); err != nil {
+					return err
+				}
+			}
+			return aggr.add(ck, secondaryIndexEntry(entry).Count())
+		}
+
 		if !r.isPrimary && r.Indexprojection != nil {
 			entry, err = projectKeys(ck, entry, (*buf)[:0], r.Indexprojection)
 			if err != nil {
@@ -151,13 +227,19 @@ func (s *IndexScanSource) Routine() error {
 			count = e.Count()
 		}
 
-		for i := 0; i < count; i++ {
+		for i := skip; i < count; i++ {
 			if r.Distinct && i > 0 {
 				break
 			}
 			if currOffset >= r.Offset {
 				s.p.rowsReturned++
-				wrErr := s.WriteItem(entry)
+				var wrErr error
+				if cont != nil {
+					posBuf = encodeScanPosition(posBuf, scanIndex, i, raw)
+					wrErr = writeItem(entry, posBuf)
+				} else {
+					wrErr = writeItem(entry)
+				}
 				if wrErr != nil {
 					return wrErr
 				}
@@ -176,18 +258,34 @@ func (s *IndexScanSource) Routine() error {
 		return nil
 	}
 
-	sliceSnapshots := GetSliceSnapshots(s.is)
+	scanFn := fn
+	if trace != nil {
+		scanFn = func(entry []byte) error {
+			t0 := time.Now()
+			err := fn(entry)
+			callbTime += time.Since(t0)
+			trace.RowsScanned++
+			return err
+		}
+	}
 
+	t0 := time.Now()
 loop:
-	for _, scan := range r.Scans {
-		currentScan = scan
+	for i, scan := range r.Scans {
+		if resume != nil && i < int(resume.GetScanIndex()) {
+			continue
+		}
+		currentScan, scanIndex = scan, i
+		if resume != nil && i == int(resume.GetScanIndex()) {
+			scan = resumeScan(scan, resume, r.isPrimary)
+		}
 		for _, snap := range sliceSnapshots {
 			if scan.ScanType == AllReq {
-				err = snap.Snapshot().All(r.ctx, fn)
+				err = snap.Snapshot().All(r.ctx, scanFn)
 			} else if scan.ScanType == LookupReq {
-				err = snap.Snapshot().Lookup(r.ctx, scan.Equals, fn)
+				err = snap.Snapshot().Lookup(r.ctx, scan.Equals, scanFn)
 			} else if scan.ScanType == RangeReq || scan.ScanType == FilterRangeReq {
-				err = snap.Snapshot().Range(r.ctx, scan.Low, scan.High, scan.Incl, fn)
+				err = snap.Snapshot().Range(r.ctx, scan.Low, scan.High, scan.Incl, scanFn)
 			}
 			switch err {
 			case nil:
@@ -199,6 +297,23 @@ loop:
 			}
 		}
 	}
+
+	if trace != nil {
+		trace.Storage = int64(time.Since(t0) - callbTime)
+		t0 = time.Now()
+	}
+
+	if aggr != nil && err == nil {
+		switch err = aggr.flush(); err {
+		case nil, p.ErrSupervisorKill, ErrLimitReached:
+		default:
+			s.CloseWithError(err)
+		}
+	}
+
+	if trace != nil {
+		trace.Filter = int64(callbTime + time.Since(t0) - writeWait)
+	}
 	return nil
 }
 
@@ -210,6 +325,8 @@ func (d *IndexScanDecoder) Routine() error {
 	tmpBuf := p.GetBlock()
 	defer p.PutBlock(tmpBuf)
 
+	trace := d.p.req.trace
+
 loop:
 	for {
 		row, err := d.ReadItem()
@@ -226,18 +343,38 @@ loop:
 			(*tmpBuf) = make([]byte, len(row)*3, len(row)*3)
 		}
 
+		var t0 time.Time
+		if trace != nil {
+			t0 = time.Now()
+		}
+
 		t := (*tmpBuf)[:0]
 		if d.p.req.isPrimary {
 			sk, docid = piSplitEntry(row, t)
+		} else if d.p.req.collatedKeys {
+			sk, docid = siSplitCollatedEntry(row, t)
 		} else {
 			sk, docid, _ = siSplitEntry(row, t)
 		}
 
+		if trace != nil {
+			trace.Decode += int64(time.Since(t0))
+		}
+
 		d.p.bytesRead += uint64(len(sk) + len(docid))
 		if !d.p.req.isPrimary && !d.p.req.projectPrimaryKey {
 			docid = nil
 		}
-		err = d.WriteItem(sk, docid)
+		if d.p.req.continuation != nil {
+			var pos []byte
+			if pos, err = d.ReadItem(); err != nil {
+				d.CloseWithError(err)
+				break
+			}
+			err = d.WriteItem(sk, docid, pos)
+		} else {
+			err = d.WriteItem(sk, docid)
+		}
 		if err != nil {
 			break // TODO: Old code. Should it be ClosedWithError?
 		}
@@ -248,7 +385,10 @@ loop:
 
 func (d *IndexScanWriter) Routine() error {
 	var err error
-	var sk, pk []byte
+	var sk, pk, pos []byte
+
+	trace := d.p.req.trace
+	cont := d.p.req.continuation
 
 	defer func() {
 		// Send error to the client if not client requested cancel.
@@ -275,9 +415,27 @@ loop:
 			return err
 		}
 
+		if cont != nil {
+			if pos, err = d.ReadItem(); err != nil {
+				return err
+			}
+		}
+
+		var t0 time.Time
+		if trace != nil {
+			t0 = time.Now()
+		}
+
 		if err = d.w.Row(pk, sk); err != nil {
 			return err
 		}
+		if cont != nil {
+			cont.advance(pos)
+		}
+
+		if trace != nil {
+			trace.Write += int64(time.Since(t0))
+		}
 
 		/*
 		   TODO(sarath): Use block chunk send protocol
@@ -316,6 +474,15 @@ func siSplitEntry(entry []byte, tmp []byte) ([]byte, []byte, int) {
 	return sk, docid[len(sk):], count
 }
 
+// siSplitCollatedEntry is siSplitEntry without decoding the key, for
+// clients that decode collatejson entry keys themselves.
+func siSplitCollatedEntry(entry []byte, tmp []byte) ([]byte, []byte) {
+	e := secondaryIndexEntry(entry)
+	docid, err := e.ReadDocId(tmp)
+	c.CrashOnError(err)
+	return entry[:e.lenKey()], docid
+}
+
 // Return true if the row needs to be skipped based on the filter
 func filterScanRow(key []byte, scan Scan, buf []byte) (bool, [][]byte, error) {
 	codec := collatejson.NewCodec(16)
@@ -20,12 +20,13 @@ import (
 
 type ScanResponseWriter interface {
 	Error(err error) error
-	Stats(rows, unique uint64, min, max []byte) error
+	Stats(rows, unique uint64, min, max []byte, sampled bool,
+		bins []*protobuf.IndexStatistics) error
 	Count(count uint64) error
 	RawBytes([]byte) error
 	Row(pk, sk []byte) error
 	Done() error
-	Helo() error
+	Helo(load *protobuf.IndexerLoad) error
 }
 
 type protoResponseWriter struct {
@@ -35,6 +36,13 @@ type protoResponseWriter struct {
 	rowBuf     *[]byte
 	rowEntries []*protobuf.IndexEntry
 	rowSize    int
+
+	// position of the last row, nil unless the client asked for
+	// continuation tokens.
+	continuation *scanContinuation
+
+	// rows carry collatejson encoded entry keys instead of JSON.
+	collatedKeys bool
 }
 
 func NewProtoWriter(t ScanReqType, conn net.Conn) *protoResponseWriter {
@@ -78,22 +86,26 @@ func (w *protoResponseWriter) Error(err error) error {
 	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 }
 
-func (w *protoResponseWriter) Stats(rows, unique uint64, min, max []byte) error {
+func (w *protoResponseWriter) Stats(rows, unique uint64, min, max []byte,
+	sampled bool, bins []*protobuf.IndexStatistics) error {
 	res := &protobuf.StatisticsResponse{
 		Stats: &protobuf.IndexStatistics{
 			KeysCount:       proto.Uint64(rows),
 			UniqueKeysCount: proto.Uint64(unique),
 			KeyMin:          min,
 			KeyMax:          max,
+			Sampled:         proto.Bool(sampled),
+			Histogram:       bins,
 		},
 	}
 
 	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 }
 
-func (w *protoResponseWriter) Helo() error {
+func (w *protoResponseWriter) Helo(load *protobuf.IndexerLoad) error {
 	res := &protobuf.HeloResponse{
 		Version: proto.Uint32(common.INDEXER_CUR_VERSION),
+		Load:    load,
 	}
 
 	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
@@ -120,7 +132,11 @@ func (w *protoResponseWriter) RawBytes(b []byte) error {
 func (w *protoResponseWriter) Row(pk, sk []byte) error {
 
 	if w.rowSize != 0 && w.rowSize+len(pk)+len(sk) > len(*w.rowBuf) {
-		res := &protobuf.ResponseStream{IndexEntries: w.rowEntries}
+		res := &protobuf.ResponseStream{
+			IndexEntries: w.rowEntries,
+			Continuation: w.continuation.token(),
+			CollatedKeys: w.collated(),
+		}
 		err := protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 		if err != nil {
 			return err
@@ -158,7 +174,11 @@ func (w *protoResponseWriter) Done() error {
 	defer p.PutBlock(w.rowBuf)
 
 	if (w.scanType == ScanReq || w.scanType == ScanAllReq) && w.rowSize > 0 {
-		res := &protobuf.ResponseStream{IndexEntries: w.rowEntries}
+		res := &protobuf.ResponseStream{
+			IndexEntries: w.rowEntries,
+			Continuation: w.continuation.token(),
+			CollatedKeys: w.collated(),
+		}
 		err := protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 		if err != nil {
 			return err
@@ -167,3 +187,12 @@ func (w *protoResponseWriter) Done() error {
 
 	return nil
 }
+
+// collated flags rows with collatejson encoded entry keys, older clients
+// never ask for them and the flag is left out.
+func (w *protoResponseWriter) collated() *bool {
+	if w.collatedKeys {
+		return proto.Bool(true)
+	}
+	return nil
+}
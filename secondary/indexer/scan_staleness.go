@@ -0,0 +1,53 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+)
+
+// scanStaleness reports the vbuckets of snapshot timestamp `snapTs` that
+// are behind timestamp `reqTs` requested by a BestEffortConsistency scan.
+// The time for the index to catch up is estimated from the mutations it
+// processed into recent snapshots, and the interval between them.
+func scanStaleness(snapTs, reqTs *common.TsVbuuid,
+	idxStats *IndexStats) *protobuf.ScanStaleness {
+
+	staleness := &protobuf.ScanStaleness{}
+	var behind uint64
+	if reqTs != nil {
+		for vbno, seqno := range reqTs.Seqnos {
+			var snapSeqno uint64
+			if snapTs != nil && vbno < len(snapTs.Seqnos) {
+				snapSeqno = snapTs.Seqnos[vbno]
+			}
+			if seqno <= snapSeqno {
+				continue
+			}
+			staleness.Vbnos = append(staleness.Vbnos, uint32(vbno))
+			staleness.Seqnos = append(staleness.Seqnos, snapSeqno)
+			staleness.Requested = append(staleness.Requested, seqno)
+			behind += seqno - snapSeqno
+		}
+	}
+	staleness.Behind = proto.Uint64(behind)
+
+	if behind > 0 && idxStats != nil {
+		interval := idxStats.avgTsInterval.Value()
+		items := idxStats.avgTsItemsCount.Value()
+		if interval > 0 && items > 0 {
+			lag := float64(behind) / float64(items) * float64(interval)
+			staleness.EstimatedLag = proto.Int64(int64(lag))
+		}
+	}
+	return staleness
+}
@@ -0,0 +1,42 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestScanStaleness(t *testing.T) {
+	snapTs := common.NewTsVbuuid("default", 4)
+	reqTs := common.NewTsVbuuid("default", 4)
+	copy(snapTs.Seqnos, []uint64{10, 20, 30, 40})
+	copy(reqTs.Seqnos, []uint64{10, 25, 20, 50})
+
+	stats := &IndexStats{}
+	stats.Init()
+	stats.avgTsInterval.Set(int64(100 * time.Millisecond))
+	stats.avgTsItemsCount.Set(5)
+
+	staleness := scanStaleness(snapTs, reqTs, stats)
+	if vbnos := staleness.GetVbnos(); len(vbnos) != 2 || vbnos[0] != 1 || vbnos[1] != 3 {
+		t.Errorf("Expected vbuckets 1 and 3 to be behind, received %v", vbnos)
+	}
+	if seqnos := staleness.GetSeqnos(); len(seqnos) != 2 || seqnos[0] != 20 || seqnos[1] != 40 {
+		t.Errorf("Unexpected snapshot seqnos %v", seqnos)
+	}
+	if requested := staleness.GetRequested(); len(requested) != 2 || requested[0] != 25 || requested[1] != 50 {
+		t.Errorf("Unexpected requested seqnos %v", requested)
+	}
+	if behind := staleness.GetBehind(); behind != 15 {
+		t.Errorf("Expected 15 mutations behind, received %v", behind)
+	}
+	if lag := time.Duration(staleness.GetEstimatedLag()); lag != 300*time.Millisecond {
+		t.Errorf("Expected estimated lag of 300ms, received %v", lag)
+	}
+
+	staleness = scanStaleness(reqTs, snapTs, stats)
+	if staleness.GetBehind() != 10 || staleness.GetEstimatedLag() != 200*int64(time.Millisecond) {
+		t.Errorf("Unexpected staleness %v", staleness)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// indexStatistics is computed by the scan coordinator for a span of an
+// index snapshot. min and max are collatejson encoded secondary keys (or
+// raw docids for primary index) in ascending collation order. When sampled
+// is set, distinct is an estimate.
+type indexStatistics struct {
+	count    uint64
+	distinct uint64
+	min      []byte
+	max      []byte
+	sampled  bool
+}
+
+// statsAccumulator visits index entries in storage order and keeps track
+// of count, distinct keys and the smallest and largest key of the span.
+type statsAccumulator struct {
+	req *ScanRequest
+
+	count    uint64
+	distinct uint64
+	min, max []byte
+	prev     []byte
+	revbuf   []byte
+}
+
+func (a *statsAccumulator) reset() {
+	a.prev = a.prev[:0]
+}
+
+func (a *statsAccumulator) add(entry []byte) error {
+	var key []byte
+
+	if a.req.isPrimary {
+		key = entry
+	} else {
+		//get the key in original format
+		if a.req.IndexInst.Defn.Desc != nil {
+			a.revbuf = append(a.revbuf[:0], entry...)
+			jsonEncoder.ReverseCollate(a.revbuf, a.req.IndexInst.Defn.Desc)
+			entry = a.revbuf
+		}
+		e := secondaryIndexEntry(entry)
+		key = entry[:e.lenKey()]
+	}
+	a.count++
+
+	// min and max are taken over the whole span, entries are in storage
+	// order which differs from collation order for descending keys.
+	if a.min == nil || bytes.Compare(key, a.min) < 0 {
+		a.min = append(a.min[:0], key...)
+	}
+	if a.max == nil || bytes.Compare(key, a.max) > 0 {
+		a.max = append(a.max[:0], key...)
+	}
+
+	// entries with same key are adjacent within a slice snapshot.
+	if len(a.prev) == 0 || !bytes.Equal(key, a.prev) {
+		a.distinct++
+	}
+	a.prev = append(a.prev[:0], key...)
+	return nil
+}
+
+// computeIndexStatistics for the span requested in `req`, over partitions
+// req.PartitionIds of the snapshot, all partitions if nil. count, min and
+// max are exact and so is distinct within a partition. Partitions are
+// visited one after the other and their distinct counts are added up,
+// unless the index is range partitioned on its leading key equal keys can
+// be in more than one partition, then distinct is an upper bound and the
+// statistics are marked as sampled.
+func computeIndexStatistics(req *ScanRequest, is IndexSnapshot,
+	stopch StopChannel) (*indexStatistics, error) {
+
+	var err error
+
+	acc := &statsAccumulator{req: req}
+	fn := func(entry []byte) error {
+		select {
+		case <-stopch:
+			return common.ErrClientCancel
+		default:
+		}
+		return acc.add(entry)
+	}
+
+	sliceSnapshots := GetPartitionSliceSnapshots(is, req.PartitionIds)
+	isScanAll := req.Low.Bytes() == nil && req.High.Bytes() == nil
+
+	nonEmpty := 0
+	for _, ss := range sliceSnapshots {
+		snap := ss.Snapshot()
+		count := acc.count
+		acc.reset()
+		if len(req.Keys) > 0 {
+			for _, key := range req.Keys {
+				if err = snap.Lookup(req.ctx, key, fn); err != nil {
+					break
+				}
+			}
+		} else if isScanAll {
+			err = snap.All(req.ctx, fn)
+		} else {
+			err = snap.Range(req.ctx, req.Low, req.High, req.Incl, fn)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if acc.count > count {
+			nonEmpty++
+		}
+	}
+
+	stats := &indexStatistics{
+		count:    acc.count,
+		distinct: acc.distinct,
+		min:      acc.min,
+		max:      acc.max,
+		sampled:  nonEmpty > 1 && !req.IndexInst.Defn.CanPrunePartitions(),
+	}
+	return stats, nil
+}
+
+// decodeMinMax returns min and max keys as JSON encoded arrays, the shape
+// expected by common.IndexStatistics.
+func (stats *indexStatistics) decodeMinMax(isPrimary bool) (min, max []byte, err error) {
+	if min, err = decodeStatsKey(stats.min, isPrimary); err != nil {
+		return nil, nil, err
+	}
+	if max, err = decodeStatsKey(stats.max, isPrimary); err != nil {
+		return nil, nil, err
+	}
+	return min, max, nil
+}
+
+// decodeStatsKey converts a collatejson encoded secondary key, or a raw
+// docid for primary index, into a JSON encoded array.
+func decodeStatsKey(key []byte, isPrimary bool) ([]byte, error) {
+	if key == nil {
+		return nil, nil
+	}
+	if isPrimary {
+		return json.Marshal([]string{string(key)})
+	}
+	buf := make([]byte, 0, len(key)*3)
+	return jsonEncoder.Decode(key, buf)
+}
@@ -0,0 +1,159 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+func TestStatsAccumulator(t *testing.T) {
+	keys := []string{`["a"]`, `["a"]`, `["b"]`, `["c"]`, `["c"]`, `["d"]`}
+
+	req := &ScanRequest{}
+	acc := &statsAccumulator{req: req}
+	for i, k := range keys {
+		e, err := newSKEntry([]byte(k), []byte{byte('0' + i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := acc.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if acc.count != uint64(len(keys)) {
+		t.Errorf("Expected count %v, received %v", len(keys), acc.count)
+	}
+	if acc.distinct != 4 {
+		t.Errorf("Expected distinct count 4, received %v", acc.distinct)
+	}
+
+	stats := &indexStatistics{min: acc.min, max: acc.max}
+	min, max, err := stats.decodeMinMax(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(min) != `["a"]` || string(max) != `["d"]` {
+		t.Errorf("Unexpected min/max %s/%s", min, max)
+	}
+}
+
+// testStatsSnapshot is a slice snapshot holding `entries` in storage order.
+type testStatsSnapshot struct {
+	Snapshot
+	entries [][]byte
+}
+
+func (s *testStatsSnapshot) All(ctx IndexReaderContext, callb EntryCallback) error {
+	for _, entry := range s.entries {
+		if err := callb(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testStatsWriter captures the statistics response of the scan coordinator.
+type testStatsWriter struct {
+	ScanResponseWriter
+	err          error
+	rows, unique uint64
+	min, max     []byte
+	sampled      bool
+}
+
+func (w *testStatsWriter) Error(err error) error {
+	w.err = err
+	return nil
+}
+
+func (w *testStatsWriter) Stats(rows, unique uint64, min, max []byte, sampled bool,
+	bins []*protobuf.IndexStatistics) error {
+
+	w.rows, w.unique, w.min, w.max, w.sampled = rows, unique, min, max, sampled
+	return nil
+}
+
+// testStatsIndexSnapshot returns a snapshot with a partition for each
+// element of `partitions`, each holding the keys in storage order.
+func testStatsIndexSnapshot(t *testing.T, partitions [][]string) IndexSnapshot {
+	is := &indexSnapshot{partns: make(map[common.PartitionId]PartitionSnapshot)}
+	for i, keys := range partitions {
+		snap := &testStatsSnapshot{}
+		for j, k := range keys {
+			e, err := newSKEntry([]byte(k), []byte{byte('0' + i), byte('0' + j)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			snap.entries = append(snap.entries, e)
+		}
+		partnId := common.PartitionId(i)
+		is.partns[partnId] = &partitionSnapshot{
+			id:     partnId,
+			slices: map[SliceId]SliceSnapshot{0: &sliceSnapshot{id: 0, snap: snap}},
+		}
+	}
+	return is
+}
+
+func TestStatsRequest(t *testing.T) {
+	// key "b" is hashed to both partitions.
+	hashed := testStatsIndexSnapshot(t, [][]string{
+		{`["a"]`, `["b"]`, `["b"]`},
+		{`["b"]`, `["c"]`},
+	})
+	ranged := testStatsIndexSnapshot(t, [][]string{
+		{`["a"]`, `["b"]`, `["b"]`},
+		{`["c"]`, `["c"]`},
+	})
+	s := &scanCoordinator{
+		histograms: make(map[common.IndexInstId]map[common.PartitionId]*indexHistogram),
+	}
+
+	testcases := []struct {
+		scheme   common.PartitionScheme
+		is       IndexSnapshot
+		partnIds []common.PartitionId
+		rows     uint64
+		unique   uint64
+		min, max string
+		sampled  bool
+	}{
+		{common.HASH, hashed, nil, 5, 4, `["a"]`, `["c"]`, true},
+		{common.HASH, hashed, []common.PartitionId{0}, 3, 2, `["a"]`, `["b"]`, false},
+		{common.HASH, hashed, []common.PartitionId{1}, 2, 2, `["b"]`, `["c"]`, false},
+		{common.RANGE, ranged, nil, 5, 3, `["a"]`, `["c"]`, false},
+	}
+
+	for i, tc := range testcases {
+		req := &ScanRequest{
+			ScanType:     StatsReq,
+			Low:          &NilIndexKey{},
+			High:         &NilIndexKey{},
+			PartitionIds: tc.partnIds,
+			IndexInst: common.IndexInst{Defn: common.IndexDefn{
+				PartitionScheme: tc.scheme,
+				PartitionKey:    "name",
+				SecExprs:        []string{"name"},
+				NumPartitions:   2,
+			}},
+		}
+		w := &testStatsWriter{}
+		s.handleStatsRequest(req, w, tc.is)
+
+		if w.err != nil {
+			t.Fatalf("%v: %v", i, w.err)
+		}
+		if w.rows != tc.rows || w.unique != tc.unique {
+			t.Errorf("%v: Expected %v/%v, received %v/%v",
+				i, tc.rows, tc.unique, w.rows, w.unique)
+		}
+		if string(w.min) != tc.min || string(w.max) != tc.max {
+			t.Errorf("%v: Expected %v/%v, received %s/%s", i, tc.min, tc.max, w.min, w.max)
+		}
+		if w.sampled != tc.sampled {
+			t.Errorf("%v: Expected sampled %v, received %v", i, tc.sampled, w.sampled)
+		}
+	}
+}
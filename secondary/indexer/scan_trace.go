@@ -0,0 +1,173 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"encoding/json"
+	"github.com/couchbase/indexing/secondary/logging"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/couchbase/indexing/secondary/transport"
+	"github.com/golang/protobuf/proto"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// scanTrace records where the time of a scan request went, for requests
+// that asked to be traced. Pipeline stages run concurrently, each stage
+// only updates its own fields and the trace is read once the pipeline
+// has finished. Durations are in nanoseconds.
+type scanTrace struct {
+	RequestId string `json:"requestId"`
+	Bucket    string `json:"bucket"`
+	Index     string `json:"index"`
+	Start     string `json:"start"`
+
+	SnapshotWait int64 `json:"snapshotWait"`
+	Storage      int64 `json:"storage"`
+	Filter       int64 `json:"filter"`
+	Decode       int64 `json:"decode"`
+	Write        int64 `json:"write"`
+	Total        int64 `json:"total"`
+
+	RowsScanned  uint64 `json:"rowsScanned"`
+	RowsReturned uint64 `json:"rowsReturned"`
+	BytesWritten uint64 `json:"bytesWritten"`
+
+	start time.Time
+}
+
+func newScanTrace(requestId string) *scanTrace {
+	now := time.Now()
+	return &scanTrace{
+		RequestId: requestId,
+		Start:     now.Format(time.RFC3339Nano),
+		start:     now,
+	}
+}
+
+func (t *scanTrace) toProto() *protobuf.ScanTrace {
+	return &protobuf.ScanTrace{
+		RequestId:    proto.String(t.RequestId),
+		SnapshotWait: proto.Int64(t.SnapshotWait),
+		Storage:      proto.Int64(t.Storage),
+		Filter:       proto.Int64(t.Filter),
+		Decode:       proto.Int64(t.Decode),
+		Write:        proto.Int64(t.Write),
+		RowsScanned:  proto.Uint64(t.RowsScanned),
+		RowsReturned: proto.Uint64(t.RowsReturned),
+		BytesWritten: proto.Uint64(t.BytesWritten),
+		Total:        proto.Int64(t.Total),
+	}
+}
+
+// tracedConn counts the response bytes written for a traced request.
+type tracedConn struct {
+	net.Conn
+	trace *scanTrace
+}
+
+func (c *tracedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.trace.BytesWritten += uint64(n)
+	return n, err
+}
+
+// Compression implements transport.Compressed{} interface, responses of
+// a traced request are compressed like those of any other request.
+func (c *tracedConn) Compression() byte {
+	return transport.ConnCompression(c.Conn)
+}
+
+// endScanTrace completes the trace of a scan request and keeps it for
+// /debug/scans, the trace is sent to the client by writeStreamEnd.
+func (s *scanCoordinator) endScanTrace(req *ScanRequest) {
+	trace := req.trace
+	trace.Bucket, trace.Index = req.Bucket, req.IndexName
+	trace.Total = int64(time.Since(trace.start))
+
+	logging.LazyVerbose(func() string {
+		bs, _ := json.Marshal(trace)
+		return req.LogPrefix + " TRACE " + string(bs)
+	})
+
+	size := s.config.Load()["settings.scan_trace.log_size"].Int()
+
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+
+	if len(s.traces) > size {
+		s.traces, s.traceNext = s.traces[:0], 0
+	}
+	if size == 0 {
+		return
+	}
+
+	if len(s.traces) < size {
+		s.traces = append(s.traces, trace)
+		s.traceNext = len(s.traces) % size
+	} else {
+		s.traces[s.traceNext] = trace
+		s.traceNext = (s.traceNext + 1) % size
+	}
+}
+
+type scanTracesByTotal []*scanTrace
+
+func (s scanTracesByTotal) Len() int           { return len(s) }
+func (s scanTracesByTotal) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s scanTracesByTotal) Less(i, j int) bool { return s[i].Total > s[j].Total }
+
+// handleDebugScansReq lists the recent traced scan requests, slowest
+// first. The number of requests listed can be limited with ?limit=n.
+func (s *scanCoordinator) handleDebugScansReq(w http.ResponseWriter, r *http.Request) {
+
+	if !s.validateAuth(w, r) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	s.traceMu.Lock()
+	traces := make([]*scanTrace, len(s.traces))
+	copy(traces, s.traces)
+	s.traceMu.Unlock()
+
+	sort.Sort(scanTracesByTotal(traces))
+
+	if str := r.FormValue("limit"); str != "" {
+		limit, err := strconv.Atoi(str)
+		if err != nil || limit < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid limit"))
+			return
+		}
+		if limit < len(traces) {
+			traces = traces[:limit]
+		}
+	}
+
+	data, err := json.Marshal(traces)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/couchbase/indexing/secondary/transport"
+)
+
+func TestScanTraceLog(t *testing.T) {
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	conf.SetValue("settings.scan_trace.log_size", 3)
+
+	s := &scanCoordinator{}
+	s.config.Store(conf)
+
+	for i := 1; i <= 5; i++ {
+		req := &ScanRequest{ScanType: CountReq, trace: newScanTrace("req")}
+		req.trace.SnapshotWait = int64(i)
+		s.endScanTrace(req)
+	}
+
+	if len(s.traces) != 3 {
+		t.Fatalf("Expected 3 traces, received %v", len(s.traces))
+	}
+
+	// only the latest requests are kept
+	var waits []int
+	for _, trace := range s.traces {
+		waits = append(waits, int(trace.SnapshotWait))
+	}
+	sort.Ints(waits)
+	if waits[0] != 3 || waits[2] != 5 {
+		t.Errorf("Expected traces of requests 3 to 5, received %v", waits)
+	}
+
+	traces := append([]*scanTrace(nil), s.traces...)
+	sort.Sort(scanTracesByTotal(traces))
+	for i := 1; i < len(traces); i++ {
+		if traces[i-1].Total < traces[i].Total {
+			t.Errorf("Expected traces slowest first")
+		}
+	}
+}
+
+// testCompressedConn is a connection that negotiated `compression`.
+type testCompressedConn struct {
+	net.Conn
+	compression byte
+}
+
+func (c *testCompressedConn) Compression() byte {
+	return c.compression
+}
+
+func TestScanTraceCompression(t *testing.T) {
+	compression, err := transport.ParseCompression("snappy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	trace := newScanTrace("req")
+	conn := &tracedConn{
+		Conn:  &testCompressedConn{Conn: server, compression: compression},
+		trace: trace,
+	}
+	errch := make(chan error, 1)
+	go func() {
+		w := NewProtoWriter(CountReq, conn)
+		errch <- w.Count(10)
+		server.Close()
+	}()
+
+	rpkt := transport.NewTransportPacket(64*1024, transport.TransportFlag(0).SetProtobuf())
+	rpkt.SetDecoder(transport.EncodingProtobuf, protobuf.ProtobufDecode)
+	payload, err := rpkt.Receive(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errch; err != nil {
+		t.Fatal(err)
+	}
+
+	if rpkt.Flags().GetCompression() != compression {
+		t.Errorf("Expected compression %v, received %v",
+			compression, rpkt.Flags().GetCompression())
+	}
+	if count := payload.(*protobuf.CountResponse).GetCount(); count != 10 {
+		t.Errorf("Expected %v, received %v", 10, count)
+	}
+	if trace.BytesWritten == 0 {
+		t.Errorf("Expected bytes written to be traced")
+	}
+}
@@ -36,6 +36,9 @@ type Slice interface {
 	IsActive() bool
 	IsDirty() bool
 
+	//NumDocsIndexed returns the number of documents indexed by the slice
+	NumDocsIndexed() int64
+
 	SetActive(bool)
 	SetStatus(SliceStatus)
 
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -107,6 +108,7 @@ type IndexStats struct {
 	numRowsReturned       stats.Int64Val
 	diskSize              stats.Int64Val
 	buildProgress         stats.Int64Val
+	transferProgress      stats.Int64Val
 	numDocsQueued         stats.Int64Val
 	deleteBytes           stats.Int64Val
 	dataSize              stats.Int64Val
@@ -131,6 +133,12 @@ type IndexStats struct {
 	diskSnapLoadDuration  stats.Int64Val
 	notReadyError         stats.Int64Val
 	clientCancelError     stats.Int64Val
+	numScansQueued        stats.Int64Val
+	numScansRejected      stats.Int64Val
+	numStaleScans         stats.Int64Val
+
+	// []histogramBinStat, refreshed by scan coordinator.
+	histogram atomic.Value
 
 	Timings IndexTimingStats
 }
@@ -162,6 +170,7 @@ func (s *IndexStats) Init() {
 	s.numRowsReturned.Init()
 	s.diskSize.Init()
 	s.buildProgress.Init()
+	s.transferProgress.Init()
 	s.numDocsQueued.Init()
 	s.deleteBytes.Init()
 	s.dataSize.Init()
@@ -186,6 +195,9 @@ func (s *IndexStats) Init() {
 	s.diskSnapLoadDuration.Init()
 	s.notReadyError.Init()
 	s.clientCancelError.Init()
+	s.numScansQueued.Init()
+	s.numScansRejected.Init()
+	s.numStaleScans.Init()
 
 	s.Timings.Init()
 }
@@ -319,6 +331,7 @@ func (is IndexerStats) MarshalJSON() ([]byte, error) {
 		addStat("num_rows_returned", s.numRowsReturned.Value())
 		addStat("disk_size", s.diskSize.Value())
 		addStat("build_progress", s.buildProgress.Value())
+		addStat("transfer_progress", s.transferProgress.Value())
 		addStat("num_docs_queued", s.numDocsQueued.Value())
 		addStat("delete_bytes", s.deleteBytes.Value())
 		addStat("data_size", s.dataSize.Value())
@@ -347,6 +360,12 @@ func (is IndexerStats) MarshalJSON() ([]byte, error) {
 		addStat("disk_load_duration", s.diskSnapLoadDuration.Value())
 		addStat("not_ready_errcount", s.notReadyError.Value())
 		addStat("client_cancel_errcount", s.clientCancelError.Value())
+		addStat("num_scans_queued", s.numScansQueued.Value())
+		addStat("num_scans_rejected", s.numScansRejected.Value())
+		addStat("num_stale_scans", s.numStaleScans.Value())
+		if bins, ok := s.histogram.Load().([]histogramBinStat); ok {
+			addStat("histogram", bins)
+		}
 
 		addStat("timings/dcp_getseqs", s.Timings.dcpSeqs.Value())
 		addStat("timings/storage_clone_handle", s.Timings.stCloneHandle.Value())
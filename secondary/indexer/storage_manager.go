@@ -186,6 +186,9 @@ func (s *storageMgr) handleSupvervisorCommands(cmd Message) {
 
 	case STORAGE_STATS:
 		s.handleStats(cmd)
+
+	case STORAGE_UPDATE_SNAP_MAP:
+		s.handleUpdateSnapMap(cmd)
 	}
 }
 
@@ -694,6 +697,21 @@ func (s *storageMgr) handleUpdateIndexPartnMap(cmd Message) {
 	s.supvCmdch <- &MsgSuccess{}
 }
 
+//handleUpdateSnapMap reopens the latest snapshot of an index whose
+//slice has been replaced on disk, e.g. by a snapshot copied from a peer
+func (s *storageMgr) handleUpdateSnapMap(cmd Message) {
+
+	idxInstId := cmd.(*MsgUpdateSnapMap).GetInstId()
+	logging.Infof("StorageMgr::handleUpdateSnapMap IndexInst:%v", idxInstId)
+
+	if partnMap, ok := s.indexPartnMap[idxInstId]; ok {
+		indexPartnMap := IndexPartnMap{idxInstId: partnMap}
+		s.updateIndexSnapMap(indexPartnMap, common.ALL_STREAMS, "")
+	}
+
+	s.supvCmdch <- &MsgSuccess{}
+}
+
 // Process req for providing an index snapshot for index scan.
 // The request contains atleast-timestamp and the storage
 // manager will reply with a index snapshot soon after a
@@ -888,7 +906,8 @@ func (s *storageMgr) handleIndexCompaction(cmd Message) {
 
 // Update index-snapshot map using index partition map
 // This function should be called only during initialization
-// of storage manager and during rollback.
+// of storage manager, during rollback and after restoring a
+// peer snapshot.
 // FIXME: Current implementation makes major assumption that
 // single slice is supported.
 func (s *storageMgr) updateIndexSnapMap(indexPartnMap IndexPartnMap,
@@ -72,6 +72,7 @@ func CreateMutationStreamReader(streamId common.StreamId, bucketQueueMap BucketQ
 	streamMutch := make(chan interface{}, getMutationBufferSize(config))
 	dpconf := config.SectionConfig(
 		"dataport.", true /*trim*/)
+	dpconf = dpconf.Set("certFile", config["certFile"]).Set("keyFile", config["keyFile"])
 	stream, err := dataport.NewServer(
 		string(StreamAddrMap[streamId]),
 		common.SystemConfig["maxVbuckets"].Int(),
@@ -568,6 +569,9 @@ func (w *streamWorker) handleSingleKeyVersion(bucket string, vbucket Vbucket, vb
 			mut.uuid = common.IndexInstId(kv.GetUuids()[i])
 			mut.key = append(mut.key, kv.GetKeys()[i]...)
 			mut.command = byte(kv.GetCommands()[i])
+			if partnkeys := kv.GetPartnkeys(); i < len(partnkeys) {
+				mut.partnkey = append(mut.partnkey, partnkeys[i]...)
+			}
 
 			mutk.mut = append(mutk.mut, mut)
 
@@ -72,6 +72,15 @@ func IndexPath(inst *common.IndexInst, sliceId SliceId) string {
 	return fmt.Sprintf("%s_%s_%d_%d.index", inst.Defn.Bucket, inst.Defn.Name, inst.InstId, sliceId)
 }
 
+//IndexPartnPath is same as IndexPath for an index that is not partitioned,
+//otherwise each partition of the index is kept in its own path.
+func IndexPartnPath(inst *common.IndexInst, partnId common.PartitionId, sliceId SliceId) string {
+	if !inst.Defn.IsPartitioned() {
+		return IndexPath(inst, sliceId)
+	}
+	return fmt.Sprintf("%s_%s_%d_%d_%d.index", inst.Defn.Bucket, inst.Defn.Name, inst.InstId, partnId, sliceId)
+}
+
 func GetCurrentKVTs(cluster, pooln, bucketn string, numVbs int) (Timestamp, error) {
 
 	var seqnos []uint64
@@ -30,6 +30,8 @@ const (
 	OPCODE_INDEXER_READY                     = OPCODE_DELETE_BUCKET + 1
 	OPCODE_CLEANUP_INDEX                     = OPCODE_INDEXER_READY + 1
 	OPCODE_CLEANUP_DEFER_INDEX               = OPCODE_CLEANUP_INDEX + 1
+	OPCODE_ALTER_INDEX                       = OPCODE_CLEANUP_DEFER_INDEX + 1
+	OPCODE_SWAP_SHADOW_INDEX                 = OPCODE_ALTER_INDEX + 1
 )
 
 /////////////////////////////////////////////////////////////////////////
@@ -47,10 +49,12 @@ type IndexTopology struct {
 }
 
 type IndexDefnDistribution struct {
-	Bucket    string                  `json:"bucket,omitempty"`
-	Name      string                  `json:"name,omitempty"`
-	DefnId    uint64                  `json:"defnId,omitempty"`
-	Instances []IndexInstDistribution `json:"instances,omitempty"`
+	Bucket     string                  `json:"bucket,omitempty"`
+	Scope      string                  `json:"scope,omitempty"`
+	Collection string                  `json:"collection,omitempty"`
+	Name       string                  `json:"name,omitempty"`
+	DefnId     uint64                  `json:"defnId,omitempty"`
+	Instances  []IndexInstDistribution `json:"instances,omitempty"`
 }
 
 type IndexInstDistribution struct {
@@ -10,6 +10,7 @@
 package client
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/couchbase/gometa/common"
@@ -37,6 +38,7 @@ import (
 
 type Settings interface {
 	NumReplica() int32
+	NumPartition() int32
 }
 
 ///////////////////////////////////////////////////////
@@ -131,11 +133,13 @@ type InstanceDefn struct {
 	Endpts    []c.Endpoint
 	Version   uint64
 	RState    uint32
+	ReplicaId int
 }
 
 type event struct {
 	defnId   c.IndexDefnId
 	status   []c.IndexState
+	local    bool // only match the index instance on watched indexer
 	notifyCh chan error
 }
 
@@ -312,17 +316,17 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 	name, bucket, using, exprType, partnExpr, whereExpr string,
 	secExprs []string, desc []bool, isPrimary bool, plan map[string]interface{}) (c.IndexDefnId, error, bool) {
 
-	// FindIndexByName will only return valid index
-	if o.FindIndexByName(name, bucket) != nil {
-		return c.IndexDefnId(0), errors.New(fmt.Sprintf("Index %s already exists.", name)), false
-	}
-
 	// Create index definition
 	idxDefn, err, retry := o.PrepareIndexDefn(name, bucket, using, exprType, partnExpr, whereExpr, secExprs, desc, isPrimary, plan)
 	if err != nil {
 		return c.IndexDefnId(0), err, retry
 	}
 
+	// FindIndexByName will only return valid index
+	if o.FindIndexByName(name, idxDefn.KeyspaceId()) != nil {
+		return c.IndexDefnId(0), errors.New(fmt.Sprintf("Index %s already exists.", name)), false
+	}
+
 	//
 	// Make Index Creation Request
 	//
@@ -389,6 +393,175 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 	return defnID, nil, false
 }
 
+//
+// AlterIndex replaces the definition of an index without dropping it.  A shadow
+// index with the new definition is created and built on the indexer nodes given
+// by plan.  Once the shadow index has caught up on all nodes, it is swapped in
+// for the index, see swapShadowIndex().  If alter index does not complete (e.g.
+// an indexer node fails during swap), it is resumed by altering the index again.
+//
+func (o *MetadataProvider) AlterIndex(defnID c.IndexDefnId,
+	exprType, partnExpr, whereExpr string, secExprs []string, desc []bool,
+	plan map[string]interface{}) (c.IndexDefnId, error, bool) {
+
+	meta := o.FindIndex(defnID)
+	if meta == nil {
+		return c.IndexDefnId(0), errors.New("Index does not exist."), false
+	}
+	source := meta.Definition
+
+	if len(meta.InstsInRebalance) != 0 {
+		return c.IndexDefnId(0), errors.New(fmt.Sprintf("Fails to alter index.  Index %s is being rebalanced.", source.Name)), false
+	}
+
+	if shadow := o.repo.findShadowDefn(source.DefnId); shadow != nil {
+		logging.Infof("MetadataProvider.AlterIndex(): resume alter index %v with shadow index %v", source.DefnId, shadow.DefnId)
+
+		watchers := ([]*watcher)(nil)
+		for _, indexerId := range o.repo.getShadowIndexerIds(shadow.DefnId) {
+			watcher, err := o.findWatcherByIndexerId(indexerId)
+			if err != nil {
+				return c.IndexDefnId(0), errors.New("Fail to alter index.  Internal Error: Cannot locate indexer nodes"), false
+			}
+			watchers = append(watchers, watcher)
+		}
+
+		if err := o.swapShadowIndex(shadow, watchers); err != nil {
+			return c.IndexDefnId(0), err, false
+		}
+		return shadow.DefnId, nil, false
+	}
+
+	idxDefn, err, retry := o.PrepareIndexDefn(source.Name, source.Bucket, string(source.Using), exprType, partnExpr,
+		whereExpr, secExprs, desc, source.IsPrimary, plan)
+	if err != nil {
+		return c.IndexDefnId(0), err, retry
+	}
+
+	if idxDefn.Deferred {
+		return c.IndexDefnId(0), errors.New("Fails to alter index.  Parameter defer_build is not supported."), false
+	}
+	if _, ok := plan["collection"]; ok && idxDefn.KeyspaceId() != source.KeyspaceId() {
+		return c.IndexDefnId(0), errors.New("Fails to alter index.  Parameter scope and collection cannot be altered."), false
+	}
+	idxDefn.Scope, idxDefn.Collection = source.Scope, source.Collection
+	idxDefn.ShadowOf = source.DefnId
+
+	//
+	// Make Alter Index Request
+	//
+
+	watchers := ([]*watcher)(nil)
+	for _, indexerId := range idxDefn.Nodes {
+		watcher, err := o.findWatcherByIndexerId(c.IndexerId(indexerId))
+		if err != nil {
+			return c.IndexDefnId(0), errors.New("Fail to alter index.  Internal Error: Cannot locate indexer nodes"), false
+		}
+		watchers = append(watchers, watcher)
+	}
+
+	newDefnID := idxDefn.DefnId
+
+	key := fmt.Sprintf("%d", newDefnID)
+	errMap := make(map[string]bool)
+	for replicaId, watcher := range watchers {
+		idxDefn.ReplicaId = replicaId
+
+		content, err := c.MarshallIndexDefn(idxDefn)
+		if err != nil {
+			errMap[fmt.Sprintf("Fail to send alter index request.  Error=%v", err)] = true
+			continue
+		}
+
+		if _, err := watcher.makeRequest(OPCODE_ALTER_INDEX, key, content); err != nil {
+			errMap[err.Error()] = true
+		}
+	}
+
+	if len(errMap) != 0 {
+		// Cleanup shadow index on all nodes.  The index being altered is not affected.
+		for _, watcher := range watchers {
+			if _, err := watcher.makeRequest(OPCODE_DROP_INDEX, key, []byte("")); err != nil {
+				logging.Warnf("MetadataProvider.AlterIndex(): Fail to cleanup shadow index %v. Error=%v", newDefnID, err)
+			}
+		}
+
+		errStr := ""
+		for msg, _ := range errMap {
+			errStr += msg + "\n"
+		}
+		return c.IndexDefnId(0), errors.New(fmt.Sprintf("Fail to alter index on some or all indexer nodes.  Error=%s.", errStr)), false
+	}
+
+	//
+	// Swap in the shadow index
+	//
+
+	if err := o.swapShadowIndex(idxDefn, watchers); err != nil {
+		return c.IndexDefnId(0), err, false
+	}
+
+	return newDefnID, nil, false
+}
+
+//
+// swapShadowIndex swaps in shadow index for the index it replaces.  It waits for
+// the shadow index to catch up with the maintenance stream on every node hosting
+// it (watchers), before any node swaps.  Nodes hosting the shadow index swap
+// first, then nodes hosting only the replaced index drop it.  Shadow index is
+// hidden from scans until the replaced index is gone from all nodes, so a scan
+// sees exactly one of them.
+//
+func (o *MetadataProvider) swapShadowIndex(shadow *c.IndexDefn, watchers []*watcher) error {
+
+	var errStr string
+	for _, watcher := range watchers {
+		err := watcher.waitForLocalEvent(shadow.DefnId, []c.IndexState{c.INDEX_STATE_ACTIVE, c.INDEX_STATE_DELETED})
+		if err != nil {
+			errStr += err.Error() + "\n"
+		} else if !o.repo.hasInstMatchingStatus(watcher.getIndexerId(), shadow.DefnId, []c.IndexState{c.INDEX_STATE_ACTIVE}) {
+			errStr += fmt.Sprintf("Index %s is dropped on node %v while being altered.\n", shadow.Name, watcher.getAdminAddr())
+		}
+	}
+
+	if len(errStr) != 0 {
+		return errors.New(errStr)
+	}
+
+	content, err := c.MarshallIndexDefn(shadow)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Fail to send swap index request.  Error=%v", err))
+	}
+
+	hosts := make(map[c.IndexerId]bool)
+	for _, watcher := range watchers {
+		hosts[watcher.getIndexerId()] = true
+	}
+	if meta := o.FindIndex(shadow.ShadowOf); meta != nil {
+		for _, inst := range meta.Instances {
+			if hosts[inst.IndexerId] {
+				continue
+			}
+			watcher, err := o.findWatcherByIndexerId(inst.IndexerId)
+			if err != nil {
+				return errors.New("Fail to alter index.  Internal Error: Cannot locate indexer nodes")
+			}
+			hosts[inst.IndexerId] = true
+			watchers = append(watchers, watcher)
+		}
+	}
+
+	key := fmt.Sprintf("%d", shadow.DefnId)
+	for _, watcher := range watchers {
+		if _, err := watcher.makeRequest(OPCODE_SWAP_SHADOW_INDEX, key, content); err != nil {
+			return errors.New(fmt.Sprintf("Index %s is built, but fail to swap it in.  Alter the index again to complete.  Error=%v",
+				shadow.Name, err))
+		}
+	}
+
+	return nil
+}
+
 func (o *MetadataProvider) PrepareIndexDefn(
 	name, bucket, using, exprType, partnExpr, whereExpr string,
 	secExprs []string, desc []bool, isPrimary bool, plan map[string]interface{}) (*c.IndexDefn, error, bool) {
@@ -402,6 +575,10 @@ func (o *MetadataProvider) PrepareIndexDefn(
 	var wait bool = true
 	var nodes []string = nil
 	var numReplica int = 0
+	var numPartition int = 0
+	var partnSplits [][]byte = nil
+	var partnParam c.PartitionScheme = ""
+	var scope, collection string
 
 	version := o.GetIndexerVersion()
 
@@ -451,6 +628,71 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		if numReplica == 0 && len(nodes) != 0 {
 			numReplica = len(nodes) - 1
 		}
+
+		numPartition, err, retry = o.getPartitionParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		partnSplits, err, retry = o.getPartitionSplitsParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		partnParam, err, retry = o.getPartitionSchemeParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		scope, collection, err, retry = o.getCollectionParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+	}
+
+	// Partitioning is opt-in, index with partition key is hash partitioned
+	// if num_partition or partition_scheme is given, or range partitioned
+	// if split keys are given. Primary index is not partitioned.
+	partnScheme := c.PartitionScheme(c.SINGLE)
+	partitioned := numPartition != 0 || partnSplits != nil || len(partnParam) != 0
+	if partitioned && (len(partnExpr) == 0 || isPrimary) {
+		return nil, errors.New("Fails to create index.  Partitioning requires a partition key on a secondary index."), false
+	} else if partnSplits != nil {
+		if partnParam == c.HASH {
+			return nil, errors.New("Fails to create index.  Parameter partition_splits cannot be used with hash partitioning."), false
+		}
+		partnScheme = c.RANGE
+		if numPartition != 0 && numPartition != len(partnSplits)+1 {
+			return nil, errors.New("Fails to create index.  Parameter num_partition should be one more than number of partition_splits."), false
+		}
+		numPartition = len(partnSplits) + 1
+	} else if partnParam == c.RANGE {
+		return nil, errors.New("Fails to create index.  Range partitioning requires parameter partition_splits."), false
+	} else if partitioned {
+		partnScheme = c.HASH
+		if numPartition == 0 {
+			numPartition = int(o.settings.NumPartition())
+		}
+	}
+
+	// Partitions are spread across indexer nodes, instance on each node
+	// hosts a subset of partitions.  Partitioned index has no replica.
+	numNodes := numReplica + 1
+	if partitioned {
+		if _, ok := plan["num_replica"]; ok && numReplica != 0 {
+			return nil, errors.New("Fails to create index.  Parameter num_replica is not supported for a partitioned index."), false
+		}
+		numReplica = 0
+		if numNodes = len(nodes); numNodes > numPartition {
+			return nil, errors.New("Fails to create index.  Parameter nodes should not be more than num_partition."), false
+		} else if numNodes == 0 {
+			numNodes = int(atomic.LoadInt32(&o.numWatcher))
+			if numNodes > numPartition {
+				numNodes = numPartition
+			} else if numNodes == 0 {
+				numNodes = 1
+			}
+		}
 	}
 
 	logging.Debugf("MetadataProvider:CreateIndex(): deferred_build %v sync %v nodes %v", deferred, wait, nodes)
@@ -459,7 +701,7 @@ func (o *MetadataProvider) PrepareIndexDefn(
 	// Get the list of Watchers
 	//
 
-	watchers, err, retry := o.findWatchersWithRetry(nodes, numReplica)
+	watchers, err, retry := o.findWatchersWithRetry(nodes, numNodes-1)
 	if err != nil {
 		return nil, err, retry
 	}
@@ -470,9 +712,9 @@ func (o *MetadataProvider) PrepareIndexDefn(
 			false
 	}
 
-	if numReplica != 0 && len(watchers) != numReplica+1 {
+	if numNodes > 1 && len(watchers) != numNodes {
 		return nil,
-			errors.New(fmt.Sprintf("Fails to create index.  Cannot find enough indexer node for replica.  numReplica=%v.", numReplica)),
+			errors.New(fmt.Sprintf("Fails to create index.  Cannot find enough indexer node for replica.  numReplica=%v.", numNodes-1)),
 			false
 	}
 
@@ -524,12 +766,16 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		Name:            name,
 		Using:           c.IndexType(using),
 		Bucket:          bucket,
+		Scope:           scope,
+		Collection:      collection,
 		IsPrimary:       isPrimary,
 		SecExprs:        secExprs,
 		Desc:            desc,
 		ExprType:        c.ExprType(exprType),
-		PartitionScheme: c.SINGLE,
+		PartitionScheme: partnScheme,
 		PartitionKey:    partnExpr,
+		NumPartitions:   uint32(numPartition),
+		PartitionSplits: partnSplits,
 		WhereExpr:       whereExpr,
 		Deferred:        deferred,
 		Nodes:           nodes,
@@ -663,6 +909,115 @@ func (o *MetadataProvider) getReplicaParam(plan map[string]interface{}, version
 	return numReplica, nil, false
 }
 
+func (o *MetadataProvider) getPartitionParam(plan map[string]interface{}) (int, error, bool) {
+
+	numPartition := int(0)
+
+	numPartition2, ok := plan["num_partition"].(float64)
+	if !ok {
+		numPartition_str, ok := plan["num_partition"].(string)
+		if ok {
+			numPartition3, err := strconv.ParseInt(numPartition_str, 10, 64)
+			if err != nil {
+				return 0, errors.New("Fails to create index.  Parameter num_partition must be a integer value."), false
+			}
+			numPartition = int(numPartition3)
+
+		} else if _, ok := plan["num_partition"]; ok {
+			return 0, errors.New("Fails to create index.  Parameter num_partition must be a integer value."), false
+		}
+	} else {
+		numPartition = int(numPartition2)
+	}
+
+	if numPartition < 0 {
+		return 0, errors.New("Fails to create index.  Parameter num_partition must be a positive value."), false
+	}
+
+	return numPartition, nil, false
+}
+
+func (o *MetadataProvider) getPartitionSplitsParam(plan map[string]interface{}) ([][]byte, error, bool) {
+
+	param, ok := plan["partition_splits"]
+	if !ok {
+		return nil, nil, false
+	}
+
+	values, ok := param.([]interface{})
+	if !ok || len(values) == 0 {
+		return nil, errors.New("Fails to create index.  Parameter partition_splits must be a non-empty list of values."), false
+	}
+
+	splits := make([][]byte, 0, len(values))
+	for _, value := range values {
+		key, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Fails to create index.  Invalid partition_splits value %v.", value)), false
+		}
+		split, err := c.EncodeRangeKey(key)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Fails to create index.  Invalid partition_splits value %v.", value)), false
+		}
+		splits = append(splits, split)
+	}
+
+	if err := c.ValidateRangeSplits(splits); err != nil {
+		return nil, errors.New("Fails to create index.  Parameter partition_splits must be in ascending order."), false
+	}
+
+	return splits, nil, false
+}
+
+func (o *MetadataProvider) getPartitionSchemeParam(plan map[string]interface{}) (c.PartitionScheme, error, bool) {
+
+	param, ok := plan["partition_scheme"]
+	if !ok {
+		return "", nil, false
+	}
+
+	scheme, ok := param.(string)
+	if !ok {
+		return "", errors.New("Fails to create index.  Parameter partition_scheme must be a string value."), false
+	}
+
+	switch partnScheme := c.PartitionScheme(strings.ToUpper(scheme)); partnScheme {
+	case c.HASH, c.RANGE:
+		return partnScheme, nil, false
+	}
+	return "", errors.New(fmt.Sprintf("Fails to create index.  Invalid partition_scheme %v.", scheme)), false
+}
+
+//
+// Index is defined on the default collection of the bucket, unless a
+// collection is specified.  Default scope and collection are left empty.
+//
+func (o *MetadataProvider) getCollectionParam(plan map[string]interface{}) (string, string, error, bool) {
+
+	scope, ok := plan["scope"].(string)
+	if _, found := plan["scope"]; found && (!ok || len(scope) == 0) {
+		return "", "", errors.New("Fails to create index.  Parameter scope must be a non-empty string."), false
+	}
+
+	collection, ok := plan["collection"].(string)
+	if _, found := plan["collection"]; found && (!ok || len(collection) == 0) {
+		return "", "", errors.New("Fails to create index.  Parameter collection must be a non-empty string."), false
+	}
+
+	if len(scope) != 0 && len(collection) == 0 {
+		return "", "", errors.New("Fails to create index.  Parameter scope requires parameter collection."), false
+	}
+
+	if c.IsDefaultCollection(scope, collection) {
+		return "", "", nil, false
+	}
+	if len(scope) == 0 {
+		scope = c.DEFAULT_SCOPE
+	}
+
+	return scope, collection, nil, false
+}
+
 func (o *MetadataProvider) findWatchersWithRetry(nodes []string, numReplica int) ([]*watcher, error, bool) {
 
 	var watchers []*watcher
@@ -924,12 +1279,15 @@ func (o *MetadataProvider) UpdateServiceAddrForIndexer(id c.IndexerId, adminport
 	return watcher.updateServiceMap(adminport)
 }
 
-func (o *MetadataProvider) FindIndexByName(name string, bucket string) *IndexMetadata {
+//
+// Index names are unique within a keyspace (see common.KeyspaceId).
+//
+func (o *MetadataProvider) FindIndexByName(name string, keyspace string) *IndexMetadata {
 
 	indices, _ := o.repo.listDefnWithValidInst()
 	for _, meta := range indices {
 		if o.isValidIndexFromActiveIndexer(meta) {
-			if meta.Definition.Name == name && meta.Definition.Bucket == bucket {
+			if meta.Definition.Name == name && meta.Definition.KeyspaceId() == keyspace {
 				return meta
 			}
 		}
@@ -1611,6 +1969,106 @@ func (r *metadataRepo) getDefnError(defnId c.IndexDefnId) error {
 	return nil
 }
 
+func (r *metadataRepo) hasInstMatchingStatus(indexerId c.IndexerId, defnId c.IndexDefnId, status []c.IndexState) bool {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, instsByVersion := range r.instances[defnId] {
+		for _, inst := range instsByVersion {
+			if r.makeInstanceDefn(defnId, inst).IndexerId != indexerId {
+				continue
+			}
+			for _, s := range status {
+				if c.IndexState(inst.State) == s {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (r *metadataRepo) getInstError(indexerId c.IndexerId, defnId c.IndexDefnId) error {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var errStr string
+	for _, instsByVersion := range r.instances[defnId] {
+		for _, inst := range instsByVersion {
+			if len(inst.Error) != 0 && r.makeInstanceDefn(defnId, inst).IndexerId == indexerId {
+				errStr += inst.Error + "\n"
+			}
+		}
+	}
+
+	if len(errStr) != 0 {
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+// Find the shadow index (alter index) which has not replaced the given index yet.
+func (r *metadataRepo) findShadowDefn(defnId c.IndexDefnId) *c.IndexDefn {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for id, defn := range r.definitions {
+		if defn.ShadowOf == defnId && len(r.getShadowIndexerIdsNoLock(id)) != 0 {
+			return defn
+		}
+	}
+	return nil
+}
+
+func (r *metadataRepo) getShadowIndexerIds(defnId c.IndexDefnId) []c.IndexerId {
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.getShadowIndexerIdsNoLock(defnId)
+}
+
+func (r *metadataRepo) getShadowIndexerIdsNoLock(defnId c.IndexDefnId) []c.IndexerId {
+
+	var indexerIds []c.IndexerId
+	for _, instsByVersion := range r.instances[defnId] {
+		for _, inst := range instsByVersion {
+			if inst.Version == 0 &&
+				c.IndexState(inst.State) != c.INDEX_STATE_NIL &&
+				c.IndexState(inst.State) != c.INDEX_STATE_DELETED {
+				indexerIds = append(indexerIds, r.makeInstanceDefn(defnId, inst).IndexerId)
+			}
+		}
+	}
+	return indexerIds
+}
+
+//
+// Shadow index (alter index) is swapped in on each indexer node in turn.  Its
+// instances are hidden from scans until the index it replaces is gone from
+// every node.
+//
+func (r *metadataRepo) isHiddenShadowInstNoLock(defn *c.IndexDefn, inst *IndexInstDistribution) bool {
+
+	if defn.ShadowOf == 0 || inst.Version != 0 {
+		return false
+	}
+	return inst.RState == uint32(c.REBAL_PENDING) || len(r.findRecentValidIndexInstNoLock(defn.ShadowOf)) != 0
+}
+
+// Refresh shadow indexes, whose visibility depends on the index they replace.
+func (r *metadataRepo) updateShadowsNoLock() {
+
+	for defnId, defn := range r.definitions {
+		if defn.ShadowOf != 0 {
+			r.updateIndexMetadataNoLock(defnId)
+		}
+	}
+}
+
 func (r *metadataRepo) getValidDefnCount(indexerId c.IndexerId) int {
 
 	r.mutex.RLock()
@@ -1765,6 +2223,8 @@ func (r *metadataRepo) updateTopology(topology *IndexTopology, indexerId c.Index
 		r.cleanupOrphanDefnNoLock(indexerId, topology.Bucket)
 	}
 
+	r.updateShadowsNoLock()
+
 	r.version++
 }
 
@@ -1826,6 +2286,10 @@ func (r *metadataRepo) updateInstancesInIndexMetadata(defnId c.IndexDefnId, meta
 
 	chosens := r.findRecentValidIndexInstNoLock(defnId)
 	for _, inst := range chosens {
+		if r.isHiddenShadowInstNoLock(meta.Definition, inst) {
+			continue
+		}
+
 		idxInst := r.makeInstanceDefn(defnId, inst)
 
 		if idxInst.State > meta.State {
@@ -1851,6 +2315,7 @@ func (r *metadataRepo) makeInstanceDefn(defnId c.IndexDefnId, inst *IndexInstDis
 	idxInst.Error = inst.Error
 	idxInst.Version = inst.Version
 	idxInst.RState = inst.RState
+	idxInst.ReplicaId = int(inst.ReplicaId)
 
 	for _, partition := range inst.Partitions {
 		for _, slice := range partition.SinglePartition.Slices {
@@ -1869,6 +2334,11 @@ func (r *metadataRepo) updateRebalanceInstancesInIndexMetadata(defnId c.IndexDef
 	instsByInstId := r.instances[defnId]
 	for _, instsByVersion := range instsByInstId {
 		for _, inst := range instsByVersion {
+			// Shadow index (alter index) is not visible until it is swapped in.
+			if r.isHiddenShadowInstNoLock(meta.Definition, inst) {
+				continue
+			}
+
 			hasActiveRstate := false
 			isMoreRecent := false
 			for _, current := range meta.Instances {
@@ -2143,6 +2613,36 @@ func (w *watcher) waitForEvent(defnId c.IndexDefnId, status []c.IndexState) erro
 	return nil
 }
 
+// Wait for the index instance on the watched indexer to reach the given status.
+func (w *watcher) waitForLocalEvent(defnId c.IndexDefnId, status []c.IndexState) error {
+
+	event := &event{defnId: defnId, status: status, local: true, notifyCh: make(chan error, 1)}
+	if w.registerEvent(event) {
+		logging.Debugf("watcher.waitForLocalEvent(): wait event : id %v status %v", event.defnId, event.status)
+		err, ok := <-event.notifyCh
+		if ok && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *watcher) hasEventMatchingStatusNoLock(event *event) bool {
+
+	if event.local {
+		return w.provider.repo.hasInstMatchingStatus(w.getIndexerIdNoLock(), event.defnId, event.status)
+	}
+	return w.provider.repo.hasDefnMatchingStatus(event.defnId, event.status)
+}
+
+func (w *watcher) getEventErrorNoLock(event *event) error {
+
+	if event.local {
+		return w.provider.repo.getInstError(w.getIndexerIdNoLock(), event.defnId)
+	}
+	return w.provider.repo.getDefnError(event.defnId)
+}
+
 func (w *watcher) registerEvent(event *event) bool {
 
 	// by locking the watcher, it will not process any commit
@@ -2150,7 +2650,7 @@ func (w *watcher) registerEvent(event *event) bool {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	if !w.provider.repo.hasDefnMatchingStatus(event.defnId, event.status) {
+	if !w.hasEventMatchingStatusNoLock(event) {
 		logging.Debugf("watcher.registerEvent(): add event : id %v status %v", event.defnId, event.status)
 		w.notifiers[event.defnId] = event
 		return true
@@ -2163,10 +2663,10 @@ func (w *watcher) registerEvent(event *event) bool {
 func (w *watcher) notifyEventNoLock() {
 
 	for defnId, event := range w.notifiers {
-		if w.provider.repo.hasDefnMatchingStatus(defnId, event.status) {
+		if w.hasEventMatchingStatusNoLock(event) {
 			delete(w.notifiers, defnId)
 			close(event.notifyCh)
-		} else if err := w.provider.repo.getDefnError(defnId); err != nil {
+		} else if err := w.getEventErrorNoLock(event); err != nil {
 			delete(w.notifiers, defnId)
 			event.notifyCh <- err
 			close(event.notifyCh)
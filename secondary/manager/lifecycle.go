@@ -256,6 +256,10 @@ func (m *LifecycleMgr) dispatchRequest(request *requestHolder, factory *message.
 		err = m.handleCleanupIndex(key)
 	case client.OPCODE_CLEANUP_DEFER_INDEX:
 		err = m.handleCleanupDeferIndexFromBucket(key)
+	case client.OPCODE_ALTER_INDEX:
+		err = m.handleAlterIndex(key, content)
+	case client.OPCODE_SWAP_SHADOW_INDEX:
+		err = m.handleSwapShadowIndex(key, content)
 	}
 
 	logging.Debugf("LifecycleMgr.dispatchRequest () : send response for requestId %d, op %d, len(result) %d", reqId, op, len(result))
@@ -297,13 +301,15 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn, scheduled bool) error
 			defn.Bucket, defn.Name))
 	}
 
-	existDefn, err := m.repo.GetIndexDefnByName(defn.Bucket, defn.Name)
+	existDefn, err := m.repo.GetIndexDefnByName(defn.KeyspaceId(), defn.Name)
 	if err != nil {
 		logging.Errorf("LifecycleMgr.handleCreateIndex() : createIndex fails. Reason = %v", err)
 		return err
 	}
 
-	if existDefn != nil {
+	// A shadow index shares the name of the index it replaces.  Name
+	// conflict is checked by AlterIndex().
+	if existDefn != nil && defn.ShadowOf == 0 {
 		topology, err := m.repo.GetTopologyByBucket(existDefn.Bucket)
 		if err != nil {
 			logging.Errorf("LifecycleMgr.handleCreateIndex() : fails to find index instance. Reason = %v", err)
@@ -318,7 +324,7 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn, scheduled bool) error
 		if topology != nil {
 			state, _ := topology.GetStatusByDefn(existDefn.DefnId)
 			if state != common.INDEX_STATE_NIL && state != common.INDEX_STATE_DELETED {
-				return errors.New(fmt.Sprintf("Index %s.%s already exists", defn.Bucket, defn.Name))
+				return errors.New(fmt.Sprintf("Index %s.%s already exists", defn.KeyspaceId(), defn.Name))
 			}
 		}
 	}
@@ -340,6 +346,17 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn, scheduled bool) error
 	}
 	defn.BucketUUID = bucketUUID
 
+	// Mutations are routed to the index by collection-id, which is fixed
+	// for the lifetime of the collection.
+	if !defn.IsDefaultCollection() {
+		collectionId, err := m.getCollectionID(defn)
+		if err != nil {
+			return fmt.Errorf("Scope or collection does not exist or temporarily unavailable for creating new index."+
+				" Please retry the operation at a later time (err=%v).", err)
+		}
+		defn.CollectionId = collectionId
+	}
+
 	//if no index_type has been specified
 	if strings.ToLower(string(defn.Using)) == "gsi" {
 		if common.GetStorageMode() != common.NOT_SET {
@@ -455,6 +472,74 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn, scheduled bool) error
 	return nil
 }
 
+func (m *LifecycleMgr) handleAlterIndex(key string, content []byte) error {
+
+	defn, err := common.UnmarshallIndexDefn(content)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex() : alterIndex fails. Unable to unmarshall index definition. Reason = %v", err)
+		return err
+	}
+
+	return m.AlterIndex(defn)
+}
+
+//
+// AlterIndex creates and builds a shadow index with the new definition.
+// The shadow index is hidden from scans until metadata provider has seen
+// it caught up with the maintenance stream on every node, and asks every
+// node to swap it in for the index it replaces (defn.ShadowOf).
+//
+func (m *LifecycleMgr) AlterIndex(defn *common.IndexDefn) error {
+
+	if defn.ShadowOf == 0 {
+		return errors.New("Alter Index fails. Reason = Index to alter is not specified.")
+	}
+
+	source, err := m.repo.GetIndexDefnById(defn.ShadowOf)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex() : alterIndex fails. Reason = %v", err)
+		return err
+	}
+
+	// The index being altered may not reside on this node (e.g. new replica).  In this
+	// case, there is no index to drop when the shadow index is swapped in.
+	if source != nil {
+		if source.Bucket != defn.Bucket || source.Name != defn.Name {
+			return errors.New(fmt.Sprintf("Alter Index fails. Reason = Index %s.%s does not match the index being altered.",
+				defn.Bucket, defn.Name))
+		}
+
+		inst, err := m.FindLocalIndexInst(source.Bucket, source.DefnId)
+		if err != nil {
+			logging.Errorf("LifecycleMgr.handleAlterIndex() : alterIndex fails. Reason = %v", err)
+			return err
+		}
+		if inst == nil || inst.State == uint32(common.INDEX_STATE_DELETED) {
+			return errors.New(fmt.Sprintf("Index %s.%s does not exist.", source.Bucket, source.Name))
+		}
+		if m.isPendingShadow(source, inst) {
+			return errors.New(fmt.Sprintf("Index %s.%s is being altered.", source.Bucket, source.Name))
+		}
+
+		shadows, err := m.findPendingShadows(source.Bucket, source.DefnId)
+		if err != nil {
+			logging.Errorf("LifecycleMgr.handleAlterIndex() : alterIndex fails. Reason = %v", err)
+			return err
+		}
+		if len(shadows) != 0 {
+			return errors.New(fmt.Sprintf("Index %s.%s is being altered.", source.Bucket, source.Name))
+		}
+	}
+
+	// Shadow index is always built, since it replaces an index which is in use.
+	defn.Deferred = false
+
+	logging.Infof("LifecycleMgr.handleAlterIndex() : create shadow index %v for index (%v, %v) %v",
+		defn.DefnId, defn.Bucket, defn.Name, defn.ShadowOf)
+
+	return m.CreateIndex(defn, true)
+}
+
 func (m *LifecycleMgr) handleBuildIndexes(content []byte) error {
 
 	list, err := client.UnmarshallIndexIdList(content)
@@ -655,6 +740,18 @@ func (m *LifecycleMgr) DeleteIndex(id common.IndexDefnId, notify bool) error {
 		return nil
 	}
 
+	// Dropping an index cancels any pending alter on it.
+	shadows, err := m.findPendingShadows(defn.Bucket, defn.DefnId)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.DeleteIndex() : drop index fails for index defn %v.  Error = %v.", id, err)
+		return err
+	}
+	for _, shadowId := range shadows {
+		if err := m.DeleteIndex(shadowId, notify); err != nil {
+			return err
+		}
+	}
+
 	// updateIndexState will not return an error if there is no index inst
 	if err := m.updateIndexState(defn.Bucket, defn.DefnId, common.INDEX_STATE_DELETED); err != nil {
 		logging.Errorf("LifecycleMgr.handleDeleteIndex() : deleteIndex fails. Reason = %v", err)
@@ -730,6 +827,13 @@ func (m *LifecycleMgr) handleTopologyChange(content []byte) error {
 	state := inst.State
 	scheduled := inst.Scheduled
 
+	// A shadow index remains hidden from scans until it is swapped in, regardless
+	// of the rebalance state reported by indexer.
+	shadow := m.isPendingShadow(defn, inst)
+	if shadow {
+		change.RState = uint32(common.REBAL_PENDING)
+	}
+
 	// update the index instance
 	if err := m.UpdateIndexInstance(change.Bucket, common.IndexDefnId(change.DefnId), common.IndexState(change.State),
 		common.StreamId(change.StreamId), change.Error, change.BuildTime, change.RState); err != nil {
@@ -748,6 +852,98 @@ func (m *LifecycleMgr) handleTopologyChange(content []byte) error {
 	return nil
 }
 
+func (m *LifecycleMgr) handleSwapShadowIndex(key string, content []byte) error {
+
+	shadow, err := common.UnmarshallIndexDefn(content)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleSwapShadowIndex() : swap fails. Unable to unmarshall index definition. Reason = %v", err)
+		return err
+	}
+
+	return m.swapShadowIndex(shadow)
+}
+
+//
+// Swap in a shadow index for the index it replaces.  Metadata provider asks
+// every node hosting either index to swap, once the shadow index has caught
+// up on all of them.  Both index instances are updated in a single topology
+// change, and the replaced index is dropped after the swap.  A node which
+// does not host the shadow index (e.g. replica count is reduced) only drops
+// the replaced index.  Swap is idempotent, so metadata provider can retry it.
+//
+func (m *LifecycleMgr) swapShadowIndex(shadow *common.IndexDefn) error {
+
+	if shadow.ShadowOf == 0 {
+		return errors.New("Swap Index fails. Reason = Index to replace is not specified.")
+	}
+
+	source, err := m.repo.GetIndexDefnById(shadow.ShadowOf)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.swapShadowIndex() : fails to find index %v. Reason = %v", shadow.ShadowOf, err)
+		return err
+	}
+
+	inst, err := m.FindLocalIndexInst(shadow.Bucket, shadow.DefnId)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.swapShadowIndex() : fails to find index instance. Reason = %v", err)
+		return err
+	}
+
+	if inst == nil || inst.State == uint32(common.INDEX_STATE_DELETED) {
+		if source != nil {
+			if err := m.DeleteIndex(source.DefnId, true); err != nil {
+				logging.Errorf("LifecycleMgr.swapShadowIndex() : fails to drop index (%v, %v) %v. Reason = %v",
+					source.Bucket, source.Name, source.DefnId, err)
+				return err
+			}
+		}
+		return nil
+	}
+
+	if inst.State != uint32(common.INDEX_STATE_ACTIVE) {
+		return errors.New(fmt.Sprintf("Swap Index fails. Reason = Index %s.%s has not caught up with the maintenance stream.",
+			shadow.Bucket, shadow.Name))
+	}
+
+	topology, err := m.repo.GetTopologyByBucket(shadow.Bucket)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.swapShadowIndex() : fails to find index instance. Reason = %v", err)
+		return err
+	}
+	if topology == nil {
+		logging.Warnf("LifecycleMgr.swapShadowIndex() : fails to find index instance. Skip swap for %v.", shadow.DefnId)
+		return nil
+	}
+
+	changed := topology.UpdateRebalanceStateForIndexInstByDefn(shadow.DefnId, common.REBAL_ACTIVE)
+	if source != nil {
+		changed = topology.UpdateStateForIndexInstByDefn(source.DefnId, common.INDEX_STATE_DELETED) || changed
+	}
+
+	if changed {
+		if err := m.repo.SetTopologyByBucket(shadow.Bucket, topology); err != nil {
+			// Topology update is in place.  If there is any error, SetTopologyByBucket will purge the cache copy.
+			// The swap will be retried by metadata provider.
+			logging.Errorf("LifecycleMgr.swapShadowIndex() : fails to swap index. Reason = %v", err)
+			return err
+		}
+	}
+
+	logging.Infof("LifecycleMgr.swapShadowIndex() : index (%v, %v) %v is swapped in for %v",
+		shadow.Bucket, shadow.Name, shadow.DefnId, shadow.ShadowOf)
+
+	// If the replaced index cannot be dropped now, it is in DELETED state and
+	// will be cleaned up by janitor.
+	if source != nil {
+		if err := m.DeleteIndex(source.DefnId, true); err != nil {
+			logging.Warnf("LifecycleMgr.swapShadowIndex() : fails to drop index (%v, %v) %v. Reason = %v",
+				source.Bucket, source.Name, source.DefnId, err)
+		}
+	}
+
+	return nil
+}
+
 func (m *LifecycleMgr) handleDeleteBucket(bucket string, content []byte) error {
 
 	result := error(nil)
@@ -887,6 +1083,48 @@ func (m *LifecycleMgr) canRetryError(inst *IndexInstDistribution, err error) boo
 	return true
 }
 
+//
+// Return true if index is a shadow index that has not been swapped in yet.  An
+// index instance moved by rebalance has a non-zero version, and is never
+// considered as a shadow.
+//
+func (m *LifecycleMgr) isPendingShadow(defn *common.IndexDefn, inst *IndexInstDistribution) bool {
+
+	return defn.ShadowOf != 0 && inst != nil && inst.Version == 0 &&
+		inst.RState == uint32(common.REBAL_PENDING)
+}
+
+//
+// Find local shadow indexes which are pending to replace the given index.
+//
+func (m *LifecycleMgr) findPendingShadows(bucket string, id common.IndexDefnId) ([]common.IndexDefnId, error) {
+
+	topology, err := m.repo.GetTopologyByBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if topology == nil {
+		return nil, nil
+	}
+
+	var shadows []common.IndexDefnId
+	for _, defnRef := range topology.Definitions {
+		defn, err := m.repo.GetIndexDefnById(common.IndexDefnId(defnRef.DefnId))
+		if err != nil {
+			return nil, err
+		}
+		if defn == nil || defn.ShadowOf != id {
+			continue
+		}
+
+		if m.isPendingShadow(defn, topology.GetIndexInstByDefn(defn.DefnId)) {
+			shadows = append(shadows, defn.DefnId)
+		}
+	}
+
+	return shadows, nil
+}
+
 func (m *LifecycleMgr) UpdateIndexInstance(bucket string, defnId common.IndexDefnId, state common.IndexState,
 	streamId common.StreamId, errStr string, buildTime []uint64, rState uint32) error {
 
@@ -1096,6 +1334,22 @@ RETRY:
 	return uuid, nil
 }
 
+// This function returns an error if it cannot fetch the collection-id of the
+// index's scope and collection, or if they do not exist.
+//
+func (m *LifecycleMgr) getCollectionID(defn *common.IndexDefn) (uint32, error) {
+	count := 0
+RETRY:
+	collectionId, err := common.GetCollectionID(m.clusterURL, defn.Bucket, defn.Scope, defn.Collection)
+	if err != nil && count < 5 {
+		count++
+		time.Sleep(time.Duration(100) * time.Millisecond)
+		goto RETRY
+	}
+
+	return collectionId, err
+}
+
 // This function ensures:
 // 1) Bucket exists
 // 2) Existing Index Definition matches the UUID of exixisting bucket
@@ -259,13 +259,15 @@ func (c *MetadataRepo) GetIndexDefnById(id common.IndexDefnId) (*common.IndexDef
 	return defn, nil
 }
 
-func (c *MetadataRepo) GetIndexDefnByName(bucket string, name string) (*common.IndexDefn, error) {
+// GetIndexDefnByName returns the index `name` in `keyspace`, index names
+// are unique within the keyspace (see common.KeyspaceId).
+func (c *MetadataRepo) GetIndexDefnByName(keyspace string, name string) (*common.IndexDefn, error) {
 
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
 	for _, defn := range c.defnCache {
-		if defn.Name == name && defn.Bucket == bucket {
+		if defn.Name == name && defn.KeyspaceId() == keyspace {
 			return defn, nil
 		}
 	}
@@ -1004,12 +1006,13 @@ func (m *MetadataRepo) addIndexToTopology(defn *common.IndexDefn, instId common.
 		return err
 	}
 
+	// Instance of a shadow index remains pending until it is swapped in.
 	rState := uint32(common.REBAL_ACTIVE)
-	if defn.InstVersion != 0 {
+	if defn.InstVersion != 0 || defn.ShadowOf != 0 {
 		rState = uint32(common.REBAL_PENDING)
 	}
 
-	topology.AddIndexDefinition(defn.Bucket, defn.Name, uint64(defn.DefnId),
+	topology.AddIndexDefinition(defn.Bucket, defn.Scope, defn.Collection, defn.Name, uint64(defn.DefnId),
 		uint64(instId), uint32(common.INDEX_STATE_CREATED), string(indexerId),
 		uint64(defn.InstVersion), rState, uint64(replicaId), scheduled)
 
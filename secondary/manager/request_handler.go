@@ -99,6 +99,8 @@ type IndexStatus struct {
 	DefnId     common.IndexDefnId `json:"defnId,omitempty"`
 	Name       string             `json:"name,omitempty"`
 	Bucket     string             `json:"bucket,omitempty"`
+	Scope      string             `json:"scope,omitempty"`
+	Collection string             `json:"collection,omitempty"`
 	IsPrimary  bool               `json:"isPrimary,omitempty"`
 	SecExprs   []string           `json:"secExprs,omitempty"`
 	WhereExpr  string             `json:"where,omitempty"`
@@ -109,6 +111,8 @@ type IndexStatus struct {
 	Error      string             `json:"error,omitempty"`
 	Completion int                `json:"completion"`
 	Scheduled  bool               `json:"scheduled"`
+	// progress of copying a rebalanced index from its source indexer
+	TransferProgress int `json:"transferProgress,omitempty"`
 }
 
 type indexStatusSorter []IndexStatus
@@ -189,8 +193,8 @@ func (m *requestHandlerContext) createIndexRequest(w http.ResponseWriter, r *htt
 	}
 
 	// call the index manager to handle the DDL
-	logging.Debugf("RequestHandler::createIndexRequest: invoke IndexManager for create index bucket %s name %s",
-		indexDefn.Bucket, indexDefn.Name)
+	logging.Debugf("RequestHandler::createIndexRequest: invoke IndexManager for create index keyspace %s name %s",
+		indexDefn.KeyspaceId(), indexDefn.Name)
 
 	if err := m.mgr.HandleCreateIndexDDL(&indexDefn); err == nil {
 		// No error, return success
@@ -278,8 +282,9 @@ func (m *requestHandlerContext) handleIndexStatusRequest(w http.ResponseWriter,
 	}
 
 	bucket := m.getBucket(r)
+	keyspace := m.getKeyspace(r)
 
-	list, failedNodes, err := m.getIndexStatus(bucket)
+	list, failedNodes, err := m.getIndexStatus(bucket, keyspace)
 	if err == nil && len(failedNodes) == 0 {
 		sort.Sort(indexStatusSorter(list))
 		resp := &IndexStatusResponse{Code: RESP_SUCCESS, Status: list}
@@ -298,7 +303,26 @@ func (m *requestHandlerContext) getBucket(r *http.Request) string {
 	return r.FormValue("bucket")
 }
 
-func (m *requestHandlerContext) getIndexStatus(bucket string) ([]IndexStatus, []string, error) {
+//
+// Keyspace of the request, if scope or collection is given.  Otherwise,
+// the request is for all collections of the bucket.
+//
+func (m *requestHandlerContext) getKeyspace(r *http.Request) string {
+
+	scope, collection := r.FormValue("scope"), r.FormValue("collection")
+	if len(scope) == 0 && len(collection) == 0 {
+		return ""
+	}
+	if len(scope) == 0 {
+		scope = common.DEFAULT_SCOPE
+	}
+	if len(collection) == 0 {
+		collection = common.DEFAULT_COLLECTION
+	}
+	return common.KeyspaceId(m.getBucket(r), scope, collection)
+}
+
+func (m *requestHandlerContext) getIndexStatus(bucket string, keyspace string) ([]IndexStatus, []string, error) {
 
 	cinfo, err := m.mgr.FetchNewClusterInfoCache()
 	if err != nil {
@@ -361,6 +385,10 @@ func (m *requestHandlerContext) getIndexStatus(bucket string) ([]IndexStatus, []
 					continue
 				}
 
+				if len(keyspace) != 0 && keyspace != defn.KeyspaceId() {
+					continue
+				}
+
 				if topology := findTopologyByBucket(localMeta.IndexTopologies, defn.Bucket); topology != nil {
 
 					instances := topology.GetIndexInstancesByDefn(defn.DefnId)
@@ -386,6 +414,9 @@ func (m *requestHandlerContext) getIndexStatus(bucket string) ([]IndexStatus, []
 
 							if instance.RState == uint32(common.REBAL_PENDING) && state != common.INDEX_STATE_READY {
 								stateStr = "Replicating"
+								if defn.ShadowOf != 0 && instance.Version == 0 {
+									stateStr = "Altering"
+								}
 							}
 
 							if indexerState, ok := stats.ToMap()["indexer_state"]; ok {
@@ -408,10 +439,18 @@ func (m *requestHandlerContext) getIndexStatus(bucket string) ([]IndexStatus, []
 								completion = int(progress.(float64))
 							}
 
+							transfer := int(0)
+							key = fmt.Sprintf("%v:%v:transfer_progress", defn.Bucket, name)
+							if progress, ok := stats.ToMap()[key]; ok {
+								transfer = int(progress.(float64))
+							}
+
 							status := IndexStatus{
 								DefnId:     defn.DefnId,
 								Name:       name,
 								Bucket:     defn.Bucket,
+								Scope:      defn.Scope,
+								Collection: defn.Collection,
 								IsPrimary:  defn.IsPrimary,
 								SecExprs:   defn.SecExprs,
 								WhereExpr:  defn.WhereExpr,
@@ -422,6 +461,8 @@ func (m *requestHandlerContext) getIndexStatus(bucket string) ([]IndexStatus, []
 								Definition: common.IndexStatement(defn, false),
 								Completion: completion,
 								Scheduled:  instance.Scheduled,
+
+								TransferProgress: transfer,
 							}
 
 							list = append(list, status)
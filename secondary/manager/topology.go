@@ -31,10 +31,12 @@ type IndexTopology struct {
 }
 
 type IndexDefnDistribution struct {
-	Bucket    string                  `json:"bucket,omitempty"`
-	Name      string                  `json:"name,omitempty"`
-	DefnId    uint64                  `json:"defnId,omitempty"`
-	Instances []IndexInstDistribution `json:"instances,omitempty"`
+	Bucket     string                  `json:"bucket,omitempty"`
+	Scope      string                  `json:"scope,omitempty"`
+	Collection string                  `json:"collection,omitempty"`
+	Name       string                  `json:"name,omitempty"`
+	DefnId     uint64                  `json:"defnId,omitempty"`
+	Instances  []IndexInstDistribution `json:"instances,omitempty"`
 }
 
 type IndexInstDistribution struct {
@@ -112,13 +114,20 @@ func (g *GlobalTopology) RemoveTopologyKey(key string) {
 // Topology Maintenance
 ////////////////////////////////////////////////////////////////////////
 
+//
+// Keyspace of an index definition in Topology.
+//
+func (d *IndexDefnDistribution) KeyspaceId() string {
+	return common.KeyspaceId(d.Bucket, d.Scope, d.Collection)
+}
+
 //
 // Add an index definition to Topology.
 //
-func (t *IndexTopology) AddIndexDefinition(bucket string, name string, defnId uint64, instId uint64, state uint32, indexerId string,
-	instVersion uint64, rState uint32, replicaId uint64, scheduled bool) {
+func (t *IndexTopology) AddIndexDefinition(bucket string, scope string, collection string, name string, defnId uint64,
+	instId uint64, state uint32, indexerId string, instVersion uint64, rState uint32, replicaId uint64, scheduled bool) {
 
-	t.RemoveIndexDefinition(bucket, name)
+	t.RemoveIndexDefinition(common.KeyspaceId(bucket, scope, collection), name)
 
 	slice := new(IndexSliceLocator)
 	slice.SliceId = 0
@@ -140,6 +149,10 @@ func (t *IndexTopology) AddIndexDefinition(bucket string, name string, defnId ui
 
 	defn := new(IndexDefnDistribution)
 	defn.Bucket = bucket
+	if !common.IsDefaultCollection(scope, collection) {
+		defn.Scope = scope
+		defn.Collection = collection
+	}
 	defn.Name = name
 	defn.DefnId = defnId
 	defn.Instances = append(defn.Instances, *inst)
@@ -150,10 +163,10 @@ func (t *IndexTopology) AddIndexDefinition(bucket string, name string, defnId ui
 //
 // Remove an index definition to Topology.
 //
-func (t *IndexTopology) RemoveIndexDefinition(bucket string, name string) {
+func (t *IndexTopology) RemoveIndexDefinition(keyspace string, name string) {
 
 	for i, defnRef := range t.Definitions {
-		if defnRef.Bucket == bucket && defnRef.Name == name {
+		if defnRef.KeyspaceId() == keyspace && defnRef.Name == name {
 			if i == len(t.Definitions)-1 {
 				t.Definitions = t.Definitions[:i]
 			} else {
@@ -181,10 +194,10 @@ func (t *IndexTopology) RemoveIndexDefinitionById(id common.IndexDefnId) {
 //
 // Get all index instance Id's for a specific defnition
 //
-func (t *IndexTopology) FindIndexDefinition(bucket string, name string) *IndexDefnDistribution {
+func (t *IndexTopology) FindIndexDefinition(keyspace string, name string) *IndexDefnDistribution {
 
 	for _, defnRef := range t.Definitions {
-		if defnRef.Bucket == bucket && defnRef.Name == name {
+		if defnRef.KeyspaceId() == keyspace && defnRef.Name == name {
 			return &defnRef
 		}
 	}
@@ -607,6 +620,11 @@ func convertIndexDefnToProtoMsg(indexDefn *common.IndexDefn) *protobuf.IndexDefn
 		PartitionScheme: partnScheme,
 		PartnExpression: proto.String(indexDefn.PartitionKey),
 	}
+	if !indexDefn.IsDefaultCollection() {
+		defn.Scope = proto.String(indexDefn.Scope)
+		defn.Collection = proto.String(indexDefn.Collection)
+		defn.CollectionID = proto.Uint32(indexDefn.CollectionId)
+	}
 
 	return defn
 }
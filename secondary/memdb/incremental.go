@@ -0,0 +1,672 @@
+package memdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/couchbase/indexing/secondary/memdb/skiplist"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// An incremental disk snapshot holds only the items inserted and deleted
+// between a base snapshot and the snapshot being persisted, in the inserts
+// and deletes directories. Its nitro.json names the base snapshot directory,
+// which can itself be incremental. Loading replays the chain of incremental
+// snapshots on top of the full snapshot it starts from.
+
+var (
+	ErrInvalidBaseSnapshot  = fmt.Errorf("Base snapshot is not older than the snapshot")
+	ErrInvalidSnapshotChain = fmt.Errorf("Disk snapshot chain is invalid")
+	ErrMergeUnsupported     = fmt.Errorf("Disk snapshot merge is only supported for raw files")
+)
+
+type diskManifest struct {
+	Version int `json:"version"`
+	// Base snapshot directory relative to the parent directory
+	Base string `json:"base,omitempty"`
+}
+
+func readDiskManifest(dir string) (*diskManifest, error) {
+	mf := &diskManifest{}
+	if bs, err := ioutil.ReadFile(filepath.Join(dir, "nitro.json")); err == nil {
+		if err = json.Unmarshal(bs, mf); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return mf, nil
+}
+
+// DiskSnapshotChain returns the directories required to load the disk
+// snapshot in dir, starting from the full snapshot and ending with dir.
+func DiskSnapshotChain(dir string) ([]string, error) {
+	var chain []string
+	seen := make(map[string]bool)
+
+	for dir != "" {
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			return nil, ErrInvalidSnapshotChain
+		}
+		seen[dir] = true
+		chain = append(chain, dir)
+
+		mf, err := readDiskManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if mf.Base == "" {
+			dir = ""
+		} else {
+			dir = filepath.Join(filepath.Dir(dir), mf.Base)
+		}
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	return chain, nil
+}
+
+// StoreIncrementalToDisk persists the items inserted and deleted between
+// base and snap into dir. base must be the snapshot persisted in baseDir,
+// which has to be in the same parent directory as dir. Deleted items are
+// not garbage collected while base is open, hence the caller needs to keep
+// base open until this returns. snap is closed once it has been stored.
+func (m *MemDB) StoreIncrementalToDisk(dir string, baseDir string,
+	base, snap *Snapshot, concurr int) (err error) {
+
+	defer snap.Close()
+
+	if m.useMemoryMgmt {
+		m.shutdownWg1.Add(1)
+		defer m.shutdownWg1.Done()
+	}
+
+	if base.sn >= snap.sn {
+		return ErrInvalidBaseSnapshot
+	}
+
+	baseRel, err := filepath.Rel(filepath.Dir(dir), baseDir)
+	if err != nil {
+		return err
+	}
+
+	shards := runtime.NumCPU()
+	insdir := filepath.Join(dir, "inserts")
+	deldir := filepath.Join(dir, "deletes")
+
+	insWriters, insFiles, err := m.openShardWriters(insdir, shards)
+	defer closeWriters(insWriters)
+	if err != nil {
+		return err
+	}
+
+	delWriters, delFiles, err := m.openShardWriters(deldir, shards)
+	defer closeWriters(delWriters)
+	if err != nil {
+		return err
+	}
+
+	visitorCallback := func(itm *Item, shard int) error {
+		if m.hasShutdown {
+			return ErrShutdown
+		}
+
+		if itm.isVisible(snap.sn) {
+			return insWriters[shard].WriteItem(itm)
+		}
+		return delWriters[shard].WriteItem(itm)
+	}
+
+	manifest, _ := json.Marshal(diskManifest{Version: version, Base: baseRel})
+	if err = ioutil.WriteFile(filepath.Join(dir, "nitro.json"), manifest, 0660); err != nil {
+		return err
+	}
+
+	if err = m.visitor(base, snap, visitorCallback, shards, concurr); err != nil {
+		return err
+	}
+
+	bs, _ := json.Marshal(insFiles)
+	if err = ioutil.WriteFile(filepath.Join(insdir, "files.json"), bs, 0660); err != nil {
+		return err
+	}
+
+	bs, _ = json.Marshal(delFiles)
+	return ioutil.WriteFile(filepath.Join(deldir, "files.json"), bs, 0660)
+}
+
+func (m *MemDB) openShardWriters(dir string, shards int) ([]FileWriter, []string, error) {
+	writers := make([]FileWriter, shards)
+	files := make([]string, shards)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return writers, files, err
+	}
+
+	for shard := 0; shard < shards; shard++ {
+		w := m.newFileWriter(m.fileType)
+		file := fmt.Sprintf("shard-%d", shard)
+		if err := w.Open(filepath.Join(dir, file)); err != nil {
+			return writers, files, err
+		}
+
+		writers[shard] = w
+		files[shard] = file
+	}
+
+	return writers, files, nil
+}
+
+func closeWriters(writers []FileWriter) {
+	for _, w := range writers {
+		if w != nil {
+			w.Close()
+		}
+	}
+}
+
+// loadIncrementalFromDisk applies an incremental disk snapshot to the store.
+// Deletes are applied before inserts, since an item may have been deleted
+// and inserted again between the base and the snapshot.
+func (m *MemDB) loadIncrementalFromDisk(dir string, concurr int) error {
+	mf, err := readDiskManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	freelists := make([][]*skiplist.Node, concurr)
+	deleteFn := func(id int, w *Writer, itm *Item) {
+		if n := w.GetNode(itm.Bytes()); n != nil {
+			if w.store.DeleteNode(n, w.insCmp, w.buf, &w.slSts1) && m.useMemoryMgmt {
+				freelists[id] = append(freelists[id], n)
+			}
+		}
+		w.freeItem(itm)
+	}
+
+	if err := m.replayShards(filepath.Join(dir, "deletes"), mf.Version, concurr, deleteFn); err != nil {
+		return err
+	}
+
+	// No readers are active while loading, deleted nodes can be freed
+	// right away
+	for _, freelist := range freelists {
+		for _, n := range freelist {
+			m.freeItem((*Item)(n.Item()))
+			m.store.FreeNode(n, &m.store.Stats)
+		}
+	}
+
+	insertFn := func(id int, w *Writer, itm *Item) {
+		if _, success := w.store.Insert2(unsafe.Pointer(itm),
+			w.insCmp, w.existCmp, w.buf, w.rand.Float32, &w.slSts1); !success {
+			w.freeItem(itm)
+		}
+	}
+
+	return m.replayShards(filepath.Join(dir, "inserts"), mf.Version, concurr, insertFn)
+}
+
+// replayShards reads the shard files listed in dir/files.json concurrently
+// and calls fn with every item read
+func (m *MemDB) replayShards(dir string, ver int, concurr int,
+	fn func(id int, w *Writer, itm *Item)) error {
+
+	var wg sync.WaitGroup
+	var files []string
+
+	if bs, err := ioutil.ReadFile(filepath.Join(dir, "files.json")); err != nil {
+		return err
+	} else if err := json.Unmarshal(bs, &files); err != nil {
+		return err
+	}
+
+	readers := make([]FileReader, len(files))
+	errors := make([]error, len(files))
+	defer func() {
+		for _, r := range readers {
+			if r != nil {
+				r.Close()
+			}
+		}
+	}()
+
+	for i, file := range files {
+		r := m.newFileReader(m.fileType, ver)
+		if err := r.Open(filepath.Join(dir, file)); err != nil {
+			return err
+		}
+		readers[i] = r
+	}
+
+	wchan := make(chan int)
+	for i := 0; i < concurr; i++ {
+		wg.Add(1)
+		go func(wg *sync.WaitGroup, id int) {
+			defer wg.Done()
+
+			w := m.newWriter()
+			defer m.store.Stats.Merge(&w.slSts1)
+
+			for shard := range wchan {
+				r := readers[shard]
+				for {
+					itm, err := r.ReadItem()
+					if err != nil {
+						errors[shard] = err
+						break
+					}
+
+					if itm == nil {
+						break
+					}
+					fn(id, w, itm)
+				}
+			}
+		}(&wg, i)
+	}
+
+	for i := range files {
+		wchan <- i
+	}
+	close(wchan)
+	wg.Wait()
+
+	for _, err := range errors {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// visitNodes calls callb for every node in the store
+func (m *MemDB) visitNodes(callb ItemCallback) {
+	buf := m.store.MakeBuf()
+	defer m.store.FreeBuf(buf)
+
+	iter := m.store.NewIterator(m.iterCmp, buf)
+	defer iter.Close()
+
+	for iter.SeekFirst(); iter.Valid(); iter.Next() {
+		n := iter.GetNode()
+		callb(&ItemEntry{itm: (*Item)(n.Item()), n: n})
+	}
+}
+
+// MergeDiskSnapshotChain writes the items of the disk snapshot in dir, which
+// is incremental, as a full snapshot into tmpdir. The snapshot chain is merged
+// on disk without loading it in memory. Shard files of each snapshot are
+// sorted and hold consecutive key ranges, hence every snapshot is read as one
+// sorted stream and the streams are merged. Deletes of an incremental snapshot
+// apply to the snapshots it is based on, inserts are applied after them.
+// The merged snapshot replaces the incremental one once committed with
+// CommitMergedDiskSnapshot.
+func (m *MemDB) MergeDiskSnapshotChain(dir string, tmpdir string) (err error) {
+	if m.fileType != RawdbFile {
+		return ErrMergeUnsupported
+	}
+
+	if m.useMemoryMgmt {
+		m.shutdownWg1.Add(1)
+		defer m.shutdownWg1.Done()
+	}
+
+	chain, err := DiskSnapshotChain(dir)
+	if err != nil {
+		return err
+	}
+
+	var iters []*diskItemIter
+	deltas := &sliceItemIter{}
+	defer func() {
+		for _, it := range iters {
+			it.close()
+		}
+		for _, itm := range deltas.items {
+			m.freeItem(itm)
+		}
+	}()
+
+	mf, err := readDiskManifest(chain[0])
+	if err != nil {
+		return err
+	}
+
+	datadir := filepath.Join(chain[0], "data")
+	data, err := m.newDiskItemIter(datadir, mf.Version)
+	if err != nil {
+		return err
+	}
+	iters = append(iters, data)
+
+	// Items of the full snapshot are split into output shards the same way
+	bounds, err := m.shardBounds(datadir, mf.Version)
+	if err != nil {
+		return err
+	}
+
+	var merged itemIter = data
+	if deltas.items, err = m.readDeltaItems(filepath.Join(chain[0], "delta"), mf.Version); err != nil {
+		return err
+	} else if len(deltas.items) > 0 {
+		merged = &mergeItemIter{m: m, prev: data, ins: deltas}
+	}
+
+	for _, incrdir := range chain[1:] {
+		if mf, err = readDiskManifest(incrdir); err != nil {
+			return err
+		}
+
+		dels, err := m.newDiskItemIter(filepath.Join(incrdir, "deletes"), mf.Version)
+		if err != nil {
+			return err
+		}
+		iters = append(iters, dels)
+
+		ins, err := m.newDiskItemIter(filepath.Join(incrdir, "inserts"), mf.Version)
+		if err != nil {
+			return err
+		}
+		iters = append(iters, ins)
+
+		merged = &mergeItemIter{m: m, prev: merged, ins: ins, del: dels}
+	}
+
+	outdir := filepath.Join(tmpdir, "data")
+	os.RemoveAll(tmpdir)
+	writers, files, err := m.openShardWriters(outdir, len(bounds))
+	defer closeWriters(writers)
+	if err != nil {
+		return err
+	}
+
+	shard := 0
+	for {
+		itm, err := merged.peek()
+		if err != nil {
+			return err
+		} else if itm == nil {
+			break
+		}
+		merged.next()
+
+		if m.hasShutdown {
+			m.freeItem(itm)
+			return ErrShutdown
+		}
+
+		for shard+1 < len(bounds) && m.keyCmp(itm.Bytes(), bounds[shard+1]) >= 0 {
+			shard++
+		}
+		err = writers[shard].WriteItem(itm)
+		m.freeItem(itm)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, w := range writers {
+		writers[i] = nil
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	bs, _ := json.Marshal(files)
+	return ioutil.WriteFile(filepath.Join(outdir, "files.json"), bs, 0660)
+}
+
+// CommitMergedDiskSnapshot replaces the incremental disk snapshot in dir with
+// the full snapshot merged into tmpdir. The snapshot is switched by renaming
+// its nitro.json, a snapshot is never left unloadable by a crash.
+func CommitMergedDiskSnapshot(dir string, tmpdir string) error {
+	datadir := filepath.Join(dir, "data")
+	os.RemoveAll(datadir)
+	if err := os.Rename(filepath.Join(tmpdir, "data"), datadir); err != nil {
+		return err
+	}
+
+	manifest, _ := json.Marshal(diskManifest{Version: version})
+	tmpfile := filepath.Join(dir, "nitro.json.tmp")
+	if err := ioutil.WriteFile(tmpfile, manifest, 0660); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpfile, filepath.Join(dir, "nitro.json")); err != nil {
+		return err
+	}
+
+	os.RemoveAll(filepath.Join(dir, "inserts"))
+	os.RemoveAll(filepath.Join(dir, "deletes"))
+	return os.RemoveAll(tmpdir)
+}
+
+// shardBounds returns the first key of every non-empty shard file of a full
+// disk snapshot, the first bound is nil.
+func (m *MemDB) shardBounds(dir string, ver int) ([][]byte, error) {
+	files, err := readShardFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds [][]byte
+	for _, file := range files {
+		r := m.newFileReader(m.fileType, ver)
+		if err := r.Open(filepath.Join(dir, file)); err != nil {
+			return nil, err
+		}
+		itm, err := r.ReadItem()
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if itm != nil {
+			bounds = append(bounds, append([]byte(nil), itm.Bytes()...))
+			m.freeItem(itm)
+		}
+	}
+
+	if len(bounds) == 0 {
+		return [][]byte{nil}, nil
+	}
+	bounds[0] = nil
+	return bounds, nil
+}
+
+// readDeltaItems reads the items of the delta files of a full disk snapshot
+// sorted by key. Delta files only hold the items deleted while the snapshot
+// was written.
+func (m *MemDB) readDeltaItems(dir string, ver int) ([]*Item, error) {
+	if _, err := os.Stat(filepath.Join(dir, "files.json")); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	it, err := m.newDiskItemIter(dir, ver)
+	if err != nil {
+		return nil, err
+	}
+	defer it.close()
+
+	var items []*Item
+	for {
+		itm, err := it.peek()
+		if err != nil {
+			for _, itm := range items {
+				m.freeItem(itm)
+			}
+			return nil, err
+		} else if itm == nil {
+			break
+		}
+		it.next()
+		items = append(items, itm)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return m.keyCmp(items[i].Bytes(), items[j].Bytes()) < 0
+	})
+	return items, nil
+}
+
+func readShardFiles(dir string) ([]string, error) {
+	var files []string
+	if bs, err := ioutil.ReadFile(filepath.Join(dir, "files.json")); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(bs, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// itemIter is a stream of items sorted by key. Items returned by peek are
+// owned by the caller once next is called.
+type itemIter interface {
+	peek() (*Item, error)
+	next()
+}
+
+// diskItemIter reads the shard files of a directory one after the other
+type diskItemIter struct {
+	m       *MemDB
+	readers []FileReader
+	itm     *Item
+	err     error
+}
+
+func (m *MemDB) newDiskItemIter(dir string, ver int) (*diskItemIter, error) {
+	files, err := readShardFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	it := &diskItemIter{m: m}
+	for _, file := range files {
+		r := m.newFileReader(m.fileType, ver)
+		if err := r.Open(filepath.Join(dir, file)); err != nil {
+			it.close()
+			return nil, err
+		}
+		it.readers = append(it.readers, r)
+	}
+	return it, nil
+}
+
+func (it *diskItemIter) peek() (*Item, error) {
+	for it.itm == nil && it.err == nil && len(it.readers) > 0 {
+		if it.itm, it.err = it.readers[0].ReadItem(); it.itm == nil && it.err == nil {
+			it.readers[0].Close()
+			it.readers = it.readers[1:]
+		}
+	}
+	return it.itm, it.err
+}
+
+func (it *diskItemIter) next() {
+	it.itm = nil
+}
+
+func (it *diskItemIter) close() {
+	if it.itm != nil {
+		it.m.freeItem(it.itm)
+		it.itm = nil
+	}
+	for _, r := range it.readers {
+		r.Close()
+	}
+	it.readers = nil
+}
+
+type sliceItemIter struct {
+	items []*Item
+}
+
+func (it *sliceItemIter) peek() (*Item, error) {
+	if len(it.items) == 0 {
+		return nil, nil
+	}
+	return it.items[0], nil
+}
+
+func (it *sliceItemIter) next() {
+	it.items = it.items[1:]
+}
+
+// mergeItemIter applies deletes and inserts of an incremental snapshot to the
+// items of the snapshots it is based on. Duplicate items are dropped.
+type mergeItemIter struct {
+	m    *MemDB
+	prev itemIter
+	ins  itemIter
+	del  itemIter // optional
+	from itemIter // iterator of the item returned by peek
+}
+
+func (it *mergeItemIter) peek() (*Item, error) {
+	for {
+		p, err := it.prev.peek()
+		if err != nil {
+			return nil, err
+		}
+		i, err := it.ins.peek()
+		if err != nil {
+			return nil, err
+		}
+
+		if i != nil && (p == nil || it.m.keyCmp(i.Bytes(), p.Bytes()) <= 0) {
+			if p != nil && it.m.keyCmp(i.Bytes(), p.Bytes()) == 0 {
+				it.prev.next()
+				it.m.freeItem(p)
+			}
+			it.from = it.ins
+			return i, nil
+		}
+
+		if p == nil {
+			return nil, nil
+		}
+
+		deleted := false
+		for it.del != nil {
+			d, err := it.del.peek()
+			if err != nil {
+				return nil, err
+			} else if d == nil {
+				break
+			}
+
+			cmp := it.m.keyCmp(d.Bytes(), p.Bytes())
+			if cmp > 0 {
+				break
+			}
+			it.del.next()
+			it.m.freeItem(d)
+			if cmp == 0 {
+				deleted = true
+				break
+			}
+		}
+
+		if !deleted {
+			it.from = it.prev
+			return p, nil
+		}
+		it.prev.next()
+		it.m.freeItem(p)
+	}
+}
+
+func (it *mergeItemIter) next() {
+	it.from.next()
+}
@@ -96,6 +96,11 @@ func (itm *Item) Bytes() (bs []byte) {
 	return
 }
 
+// isVisible returns true if the item is part of snapshot sn
+func (itm *Item) isVisible(sn uint32) bool {
+	return itm.bornSn <= sn && (itm.deadSn == 0 || itm.deadSn > sn)
+}
+
 func ItemSize(p unsafe.Pointer) int {
 	itm := (*Item)(p)
 	return int(itemHeaderSize + uintptr(itm.dataLen))
@@ -10,6 +10,7 @@ type Iterator struct {
 	refreshRate int
 
 	snap *Snapshot
+	base *Snapshot // set for iterators over the changes since base
 	iter *skiplist.Iterator
 	buf  *skiplist.ActionBuffer
 }
@@ -20,7 +21,13 @@ loop:
 		return
 	}
 	itm := (*Item)(it.iter.Get())
-	if itm.bornSn > it.snap.sn || (itm.deadSn > 0 && itm.deadSn <= it.snap.sn) {
+	if it.base != nil {
+		if itm.isVisible(it.snap.sn) == itm.isVisible(it.base.sn) {
+			it.iter.Next()
+			it.count++
+			goto loop
+		}
+	} else if !itm.isVisible(it.snap.sn) {
 		it.iter.Next()
 		it.count++
 		goto loop
@@ -91,3 +98,13 @@ func (m *MemDB) NewIterator(snap *Snapshot) *Iterator {
 		buf:  buf,
 	}
 }
+
+// newDeltaIterator returns an iterator over the items inserted or deleted
+// between base and snap. Deleted items are only retained while base is open.
+func (m *MemDB) newDeltaIterator(base, snap *Snapshot) *Iterator {
+	itr := m.NewIterator(snap)
+	if itr != nil {
+		itr.base = base
+	}
+	return itr
+}
@@ -698,6 +698,12 @@ func (m *MemDB) ptrToItem(itmPtr unsafe.Pointer) *Item {
 }
 
 func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concurrency int) error {
+	return m.visitor(nil, snap, callb, shards, concurrency)
+}
+
+// visitor visits the items of snap, or only the items inserted or deleted
+// since base if base is not nil
+func (m *MemDB) visitor(base, snap *Snapshot, callb VisitorCallback, shards int, concurrency int) error {
 	var wg sync.WaitGroup
 	var pivotItems []*Item
 
@@ -708,7 +714,7 @@ func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concu
 	}
 
 	func() {
-		tmpIter := m.NewIterator(snap)
+		tmpIter := m.newDeltaIterator(base, snap)
 		if tmpIter == nil {
 			panic("iterator cannot be nil")
 		}
@@ -746,7 +752,7 @@ func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concu
 				startItem := pivotItems[shard]
 				endItem := pivotItems[shard+1]
 
-				itr := m.NewIterator(snap)
+				itr := m.newDeltaIterator(base, snap)
 				if itr == nil {
 					panic("iterator cannot be nil")
 				}
@@ -952,25 +958,51 @@ func (m *MemDB) StoreToDisk(dir string, snap *Snapshot, concurr int, itmCallback
 }
 
 func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snapshot, error) {
+	chain, err := DiskSnapshotChain(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes loaded from the base snapshot may be removed by the incremental
+	// snapshots, hence the callback is invoked once the chain is applied
+	baseCallb := callb
+	if len(chain) > 1 {
+		baseCallb = nil
+	}
+
+	if err := m.loadBaseFromDisk(chain[0], concurr, baseCallb); err != nil {
+		return nil, err
+	}
+
+	for _, incrdir := range chain[1:] {
+		if err := m.loadIncrementalFromDisk(incrdir, concurr); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(chain) > 1 && callb != nil {
+		m.visitNodes(callb)
+	}
+
+	stats := m.store.GetStats()
+	m.itemsCount = int64(stats.NodeCount)
+	return m.NewSnapshot()
+}
+
+// loadBaseFromDisk builds the store from a full disk snapshot
+func (m *MemDB) loadBaseFromDisk(dir string, concurr int, callb ItemCallback) error {
 	var wg sync.WaitGroup
 	datadir := filepath.Join(dir, "data")
 	var files []string
-	manifestdir := dir
-	var version int
 
-	// Read file version
-	if bs, err := ioutil.ReadFile(filepath.Join(manifestdir, "nitro.json")); err == nil {
-		mMap := make(map[string]int)
-		if err = json.Unmarshal(bs, &mMap); err != nil {
-			return nil, err
-		}
-		version = mMap["version"]
-	} else if !os.IsNotExist(err) {
-		return nil, err
+	mf, err := readDiskManifest(dir)
+	if err != nil {
+		return err
 	}
+	version := mf.Version
 
 	if bs, err := ioutil.ReadFile(filepath.Join(datadir, "files.json")); err != nil {
-		return nil, err
+		return err
 	} else {
 		json.Unmarshal(bs, &files)
 	}
@@ -1003,7 +1035,7 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 		r := m.newFileReader(m.fileType, version)
 		datafile := filepath.Join(datadir, file)
 		if err := r.Open(datafile); err != nil {
-			return nil, err
+			return err
 		}
 
 		readers[i] = r
@@ -1041,7 +1073,7 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 
 	for _, err := range errors {
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
@@ -1075,7 +1107,7 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 			r := m.newFileReader(m.fileType, version)
 			deltafile := filepath.Join(deltadir, file)
 			if err := r.Open(deltafile); err != nil {
-				return nil, err
+				return err
 			}
 
 			readers[i] = r
@@ -1132,14 +1164,12 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 
 		for _, err := range errors {
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
 
-	stats := m.store.GetStats()
-	m.itemsCount = int64(stats.NodeCount)
-	return m.NewSnapshot()
+	return nil
 }
 
 func (m *MemDB) DumpStats() string {
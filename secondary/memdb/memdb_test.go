@@ -727,3 +727,208 @@ func TestCloseWithActiveIterators(t *testing.T) {
 	wg.Wait()
 
 }
+
+func TestIncrementalStoreDisk(t *testing.T) {
+	os.RemoveAll("db.dump")
+	defer os.RemoveAll("db.dump")
+
+	db := NewWithConfig(testConf)
+	defer db.Close()
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("%010d", i))
+	}
+
+	w := db.NewWriter()
+	for i := 0; i < 10000; i++ {
+		w.Put(key(i))
+	}
+
+	snap0, _ := w.NewSnapshot()
+	snap0.Open()
+	if err := db.StoreToDisk("db.dump/snap0", snap0, 8, nil); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		w.Delete(key(i))
+	}
+	for i := 10000; i < 12000; i++ {
+		w.Put(key(i))
+	}
+	w.Delete(key(5000))
+	w.Put(key(5000))
+
+	snap1, _ := w.NewSnapshot()
+	snap1.Open()
+	err := db.StoreIncrementalToDisk("db.dump/snap1", "db.dump/snap0", snap0, snap1, 8)
+	if err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	snap0.Close()
+
+	for i := 10000; i < 10500; i++ {
+		w.Delete(key(i))
+	}
+	for i := 12000; i < 13000; i++ {
+		w.Put(key(i))
+	}
+
+	snap2, _ := w.NewSnapshot()
+	err = db.StoreIncrementalToDisk("db.dump/snap2", "db.dump/snap1", snap1, snap2, 8)
+	if err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	snap1.Close()
+
+	chain, err := DiskSnapshotChain("db.dump/snap2")
+	if err != nil || len(chain) != 3 {
+		t.Fatalf("Unexpected snapshot chain %v (err=%v)", chain, err)
+	}
+
+	var expected [][]byte
+	for i := 1000; i < 10000; i++ {
+		expected = append(expected, key(i))
+	}
+	for i := 10500; i < 13000; i++ {
+		expected = append(expected, key(i))
+	}
+
+	db2 := NewWithConfig(testConf)
+	defer db2.Close()
+
+	var callbCount int64
+	callb := func(*ItemEntry) {
+		atomic.AddInt64(&callbCount, 1)
+	}
+
+	snap, err := db2.LoadFromDisk("db.dump/snap2", 8, callb)
+	if err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	defer snap.Close()
+
+	if int(callbCount) != len(expected) {
+		t.Errorf("Expected %v callbacks, got %v", len(expected), callbCount)
+	}
+
+	if count := int(snap.Count()); count != len(expected) {
+		t.Errorf("Count mismatch on snapshot. Expected %d, got %d", len(expected), count)
+	}
+
+	itr := snap.NewIterator()
+	defer itr.Close()
+	i := 0
+	for itr.SeekFirst(); itr.Valid(); itr.Next() {
+		if i >= len(expected) || string(itr.Get()) != string(expected[i]) {
+			t.Fatalf("Unexpected item %s at position %d", itr.Get(), i)
+		}
+		i++
+	}
+
+	if i != len(expected) {
+		t.Errorf("Expected %v items, got %v", len(expected), i)
+	}
+}
+
+func TestMergeDiskSnapshotChain(t *testing.T) {
+	os.RemoveAll("db.dump")
+	defer os.RemoveAll("db.dump")
+
+	db := NewWithConfig(testConf)
+	defer db.Close()
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("%010d", i))
+	}
+
+	w := db.NewWriter()
+	for i := 0; i < 10000; i++ {
+		w.Put(key(i))
+	}
+
+	snap0, _ := w.NewSnapshot()
+	snap0.Open()
+	if err := db.StoreToDisk("db.dump/snap0", snap0, 8, nil); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		w.Delete(key(i))
+	}
+	for i := 10000; i < 12000; i++ {
+		w.Put(key(i))
+	}
+	w.Delete(key(5000))
+	w.Put(key(5000))
+
+	snap1, _ := w.NewSnapshot()
+	snap1.Open()
+	if err := db.StoreIncrementalToDisk("db.dump/snap1", "db.dump/snap0", snap0, snap1, 8); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	snap0.Close()
+
+	for i := 10000; i < 10500; i++ {
+		w.Delete(key(i))
+	}
+	for i := 12000; i < 13000; i++ {
+		w.Put(key(i))
+	}
+
+	snap2, _ := w.NewSnapshot()
+	if err := db.StoreIncrementalToDisk("db.dump/snap2", "db.dump/snap1", snap1, snap2, 8); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	snap1.Close()
+
+	if err := db.MergeDiskSnapshotChain("db.dump/snap2", "db.dump/.merge"); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	if err := CommitMergedDiskSnapshot("db.dump/snap2", "db.dump/.merge"); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+
+	// merged snapshot no longer needs the snapshots it was based on
+	os.RemoveAll("db.dump/snap0")
+	os.RemoveAll("db.dump/snap1")
+	chain, err := DiskSnapshotChain("db.dump/snap2")
+	if err != nil || len(chain) != 1 {
+		t.Fatalf("Unexpected snapshot chain %v (err=%v)", chain, err)
+	}
+
+	var expected [][]byte
+	for i := 1000; i < 10000; i++ {
+		expected = append(expected, key(i))
+	}
+	for i := 10500; i < 13000; i++ {
+		expected = append(expected, key(i))
+	}
+
+	db2 := NewWithConfig(testConf)
+	defer db2.Close()
+
+	snap, err := db2.LoadFromDisk("db.dump/snap2", 8, nil)
+	if err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	defer snap.Close()
+
+	if count := int(snap.Count()); count != len(expected) {
+		t.Errorf("Count mismatch on snapshot. Expected %d, got %d", len(expected), count)
+	}
+
+	itr := snap.NewIterator()
+	defer itr.Close()
+	i := 0
+	for itr.SeekFirst(); itr.Valid(); itr.Next() {
+		if i >= len(expected) || string(itr.Get()) != string(expected[i]) {
+			t.Fatalf("Unexpected item %s at position %d", itr.Get(), i)
+		}
+		i++
+	}
+
+	if i != len(expected) {
+		t.Errorf("Expected %v items, got %v", len(expected), i)
+	}
+}
@@ -46,6 +46,8 @@ type RunConfig struct {
 	MaxCpuUse      int
 	MemQuota       int64
 	CpuQuota       int
+	DiskQuota      int64
+	StorageMode    string
 	DataCostWeight float64
 	CpuCostWeight  float64
 	MemCostWeight  float64
@@ -78,10 +80,12 @@ type RunStats struct {
 
 type Plan struct {
 	// placement of indexes	in nodes
-	Placement []*IndexerNode `json:"placement,omitempty"`
-	MemQuota  uint64         `json:"memQuota,omitempty"`
-	CpuQuota  uint64         `json:"cpuQuota,omitempty"`
-	IsLive    bool           `json:"isLive,omitempty"`
+	Placement   []*IndexerNode `json:"placement,omitempty"`
+	MemQuota    uint64         `json:"memQuota,omitempty"`
+	CpuQuota    uint64         `json:"cpuQuota,omitempty"`
+	DiskQuota   uint64         `json:"diskQuota,omitempty"`
+	StorageMode string         `json:"storageMode,omitempty"`
+	IsLive      bool           `json:"isLive,omitempty"`
 }
 
 type IndexSpec struct {
@@ -221,7 +225,8 @@ func genTransferToken(solution *Solution, masterId string, topologyChange servic
 /////////////////////////////////////////////////////////////
 
 func ExecutePlanWithOptions(plan *Plan, indexSpecs []*IndexSpec, detail bool, genStmt string,
-	output string, addNode int, cpuQuota int, memQuota int64, allowUnpin bool) (*Solution, error) {
+	output string, addNode int, cpuQuota int, memQuota int64, diskQuota int64, storageMode string,
+	allowUnpin bool) (*Solution, error) {
 
 	resize := false
 	if plan == nil {
@@ -236,6 +241,8 @@ func ExecutePlanWithOptions(plan *Plan, indexSpecs []*IndexSpec, detail bool, ge
 	config.AddNode = addNode
 	config.MemQuota = memQuota
 	config.CpuQuota = cpuQuota
+	config.DiskQuota = diskQuota
+	config.StorageMode = storageMode
 	config.AllowUnpin = allowUnpin
 
 	p, _, err := execute(config, CommandPlan, plan, indexSpecs, ([]string)(nil))
@@ -313,11 +320,12 @@ func execute(config *RunConfig, command CommandType, p *Plan, indexSpecs []*Inde
 	var indexes []*IndexUsage
 	var err error
 
-	sizing := newMOISizingMethod()
+	storageMode := getStorageMode(config, p)
+	sizing := newSizingMethod(storageMode)
 
 	if command == CommandPlan {
 		if indexSpecs != nil {
-			indexes, err = indexUsagesFromSpec(sizing, indexSpecs)
+			indexes, err = indexUsagesFromSpec(sizing, storageMode, indexSpecs)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -351,7 +359,8 @@ func plan(config *RunConfig, plan *Plan, indexes []*IndexUsage) (*SAPlanner, *Ru
 	var solution *Solution
 	var initialIndexes []*IndexUsage
 
-	sizing = newMOISizingMethod()
+	storageMode := getStorageMode(config, plan)
+	sizing = newSizingMethod(storageMode)
 
 	// update runtime stats
 	s := &RunStats{}
@@ -396,7 +405,7 @@ func plan(config *RunConfig, plan *Plan, indexes []*IndexUsage) (*SAPlanner, *Ru
 	s.CpuQuota = constraint.GetCpuQuota()
 
 	if config.Output != "" {
-		if err := savePlan(config.Output, planner.Result, constraint); err != nil {
+		if err := savePlan(config.Output, planner.Result, constraint, storageMode); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -425,7 +434,8 @@ func rebalance(command CommandType, config *RunConfig, plan *Plan, indexes []*In
 
 	s := &RunStats{}
 
-	sizing = newMOISizingMethod()
+	storageMode := getStorageMode(config, plan)
+	sizing = newSizingMethod(storageMode)
 
 	// create an initial solution
 	if plan != nil {
@@ -473,7 +483,7 @@ func rebalance(command CommandType, config *RunConfig, plan *Plan, indexes []*In
 	s.CpuQuota = constraint.GetCpuQuota()
 
 	if config.Output != "" {
-		if err := savePlan(config.Output, planner.Result, constraint); err != nil {
+		if err := savePlan(config.Output, planner.Result, constraint, storageMode); err != nil {
 			return nil, nil, err
 		}
 	}
@@ -576,6 +586,8 @@ func DefaultRunConfig() *RunConfig {
 		MaxCpuUse:      -1,
 		MemQuota:       -1,
 		CpuQuota:       -1,
+		DiskQuota:      -1,
+		StorageMode:    "",
 		DataCostWeight: 1,
 		CpuCostWeight:  1,
 		MemCostWeight:  1,
@@ -626,9 +638,9 @@ func initialSolution(config *RunConfig,
 	maxCpuUse := config.MaxCpuUse
 	maxMemUse := config.MaxMemUse
 
-	memQuota, cpuQuota := computeQuota(config, sizing, indexes, false)
+	memQuota, cpuQuota, diskQuota := computeQuota(config, sizing, indexes, false)
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	indexers := indexerNodes(constraint, indexes, sizing, false)
 
@@ -649,9 +661,9 @@ func emptySolution(config *RunConfig,
 	maxCpuUse := config.MaxCpuUse
 	maxMemUse := config.MaxMemUse
 
-	memQuota, cpuQuota := computeQuota(config, sizing, indexes, false)
+	memQuota, cpuQuota, diskQuota := computeQuota(config, sizing, indexes, false)
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	r := newSolution(constraint, sizing, ([]*IndexerNode)(nil), false, false)
 
@@ -681,7 +693,7 @@ func solutionFromPlan(command CommandType, config *RunConfig, sizing SizingMetho
 		}
 	}
 
-	memQuota, cpuQuota := computeQuota(config, sizing, indexes, plan.IsLive && (command == CommandRebalance || command == CommandSwap))
+	memQuota, cpuQuota, diskQuota := computeQuota(config, sizing, indexes, plan.IsLive && (command == CommandRebalance || command == CommandSwap))
 
 	if config.MemQuota == -1 && plan.MemQuota != 0 {
 		memQuota = uint64(float64(plan.MemQuota) * memQuotaFactor)
@@ -691,7 +703,11 @@ func solutionFromPlan(command CommandType, config *RunConfig, sizing SizingMetho
 		cpuQuota = uint64(float64(plan.CpuQuota) * cpuQuotaFactor)
 	}
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	if config.DiskQuota == -1 && plan.DiskQuota != 0 {
+		diskQuota = plan.DiskQuota
+	}
+
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	r := newSolution(constraint, sizing, plan.Placement, plan.IsLive, (command == CommandRebalance || command == CommandSwap))
 	r.calculateSize() // in case sizing formula changes
@@ -710,7 +726,7 @@ func solutionFromPlan(command CommandType, config *RunConfig, sizing SizingMetho
 	return r, constraint, indexes, movedIndex, movedData
 }
 
-func computeQuota(config *RunConfig, sizing SizingMethod, indexes []*IndexUsage, useLive bool) (uint64, uint64) {
+func computeQuota(config *RunConfig, sizing SizingMethod, indexes []*IndexUsage, useLive bool) (uint64, uint64, uint64) {
 
 	memQuotaFactor := config.MemQuotaFactor
 	cpuQuotaFactor := config.CpuQuotaFactor
@@ -730,7 +746,32 @@ func computeQuota(config *RunConfig, sizing SizingMethod, indexes []*IndexUsage,
 	}
 	cpuQuota = uint64(float64(cpuQuota) * cpuQuotaFactor)
 
-	return memQuota, cpuQuota
+	// disk usage is not constrained unless disk quota is given
+	diskQuota := uint64(0)
+	if config.DiskQuota > 0 {
+		diskQuota = uint64(config.DiskQuota)
+	}
+
+	return memQuota, cpuQuota, diskQuota
+}
+
+//
+// This function returns the storage mode of the cluster.  Storage mode
+// in config takes precedence over storage mode of the plan.  MOI is assumed
+// if storage mode is not known.
+//
+func getStorageMode(config *RunConfig, plan *Plan) common.StorageMode {
+
+	storageMode := config.StorageMode
+	if storageMode == "" && plan != nil {
+		storageMode = plan.StorageMode
+	}
+
+	if mode := common.IndexTypeToStorageMode(common.IndexType(storageMode)); mode != common.NOT_SET {
+		return mode
+	}
+
+	return common.MOI
 }
 
 //
@@ -849,11 +890,11 @@ func setInitialLayoutStats(s *RunStats,
 // Index Generation (from Index Spec)
 /////////////////////////////////////////////////////////////
 
-func indexUsagesFromSpec(sizing SizingMethod, specs []*IndexSpec) ([]*IndexUsage, error) {
+func indexUsagesFromSpec(sizing SizingMethod, storageMode common.StorageMode, specs []*IndexSpec) ([]*IndexUsage, error) {
 
 	var indexes []*IndexUsage
 	for _, spec := range specs {
-		usages, err := indexUsageFromSpec(sizing, spec)
+		usages, err := indexUsageFromSpec(sizing, storageMode, spec)
 		if err != nil {
 			return nil, err
 		}
@@ -863,7 +904,7 @@ func indexUsagesFromSpec(sizing SizingMethod, specs []*IndexSpec) ([]*IndexUsage
 	return indexes, nil
 }
 
-func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, error) {
+func indexUsageFromSpec(sizing SizingMethod, storageMode common.StorageMode, spec *IndexSpec) ([]*IndexUsage, error) {
 
 	result := make([]*IndexUsage, spec.Replica)
 
@@ -878,7 +919,8 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 		index.InstId = common.IndexInstId(i)
 		index.Name = spec.Name
 		index.Bucket = spec.Bucket
-		index.IsMOI = true
+		index.IsMOI = storageMode == common.MOI
+		index.StorageMode = storageMode.String()
 		index.IsPrimary = spec.IsPrimary
 
 		index.Instance = &common.IndexInst{}
@@ -921,16 +963,24 @@ func printPlanSummary(plan *Plan) {
 	logging.Infof("--------------------------------------")
 	logging.Infof("Mem Quota:	%v", formatMemoryStr(plan.MemQuota))
 	logging.Infof("Cpu Quota:	%v", plan.CpuQuota)
+	if plan.DiskQuota != 0 {
+		logging.Infof("Disk Quota:	%v", formatMemoryStr(plan.DiskQuota))
+	}
+	if plan.StorageMode != "" {
+		logging.Infof("Storage Mode:	%v", plan.StorageMode)
+	}
 	logging.Infof("--------------------------------------")
 }
 
-func savePlan(output string, solution *Solution, constraint ConstraintMethod) error {
+func savePlan(output string, solution *Solution, constraint ConstraintMethod, storageMode common.StorageMode) error {
 
 	plan := &Plan{
-		Placement: solution.Placement,
-		MemQuota:  constraint.GetMemQuota(),
-		CpuQuota:  constraint.GetCpuQuota(),
-		IsLive:    solution.isLiveData,
+		Placement:   solution.Placement,
+		MemQuota:    constraint.GetMemQuota(),
+		CpuQuota:    constraint.GetCpuQuota(),
+		DiskQuota:   constraint.GetDiskQuota(),
+		StorageMode: storageMode.String(),
+		IsLive:      solution.isLiveData,
 	}
 
 	data, err := json.MarshalIndent(plan, "", "	")
@@ -54,6 +54,21 @@ const (
 	MOIScanTimeout                = 120
 )
 
+// constant - index sizing - Plasma and ForestDB
+const (
+	PlasmaItemOverhead      uint64  = 48
+	PlasmaResidentRatio             = 20
+	PlasmaFragmentation     float64 = 0.3
+	PlasmaWriteAmp                  = 2.0
+	ForestDBItemOverhead    uint64  = 70
+	ForestDBResidentRatio           = 20
+	ForestDBFragmentation   float64 = 0.3
+	ForestDBWriteAmp                = 4.0
+	DiskMutationRatePerCore uint64  = 25000
+	DiskScanRatePerCore             = 5000
+	DiskScanMissCost                = 4.0
+)
+
 // constant - command
 type CommandType string
 
@@ -102,6 +117,7 @@ type PlacementMethod interface {
 type ConstraintMethod interface {
 	GetMemQuota() uint64
 	GetCpuQuota() uint64
+	GetDiskQuota() uint64
 	SatisfyClusterResourceConstraint(s *Solution) bool
 	SatisfyNodeResourceConstraint(s *Solution, n *IndexerNode) bool
 	SatisfyNodeHAConstraint(s *Solution, n *IndexerNode, eligibles []*IndexUsage) bool
@@ -148,6 +164,7 @@ type IndexerNode struct {
 	ActualMemUsage    uint64  `json:"actualMemUsage"`
 	ActualMemOverhead uint64  `json:"actualMemOverhead"`
 	ActualCpuUsage    float64 `json:"actualCpuUsage"`
+	ActualDiskUsage   uint64  `json:"actualDiskUsage,omitempty"`
 
 	// input: index residing on the node
 	Indexes []*IndexUsage `json:"indexes"`
@@ -168,6 +185,7 @@ type IndexUsage struct {
 	// input: index sizing
 	IsPrimary        bool   `json:"isPrimary,omitempty"`
 	IsMOI            bool   `json:"isMOI,omitempty"`
+	StorageMode      string `json:"storageMode,omitempty"`
 	AvgSecKeySize    uint64 `json:"avgSecKeySize"`
 	AvgDocKeySize    uint64 `json:"avgDocKeySize"`
 	AvgArrSize       uint64 `json:"avgArrSize"`
@@ -188,6 +206,7 @@ type IndexUsage struct {
 	ActualMemOverhead uint64  `json:"actualMemOverhead"`
 	ActualKeySize     uint64  `json:"actualKeySize"`
 	ActualCpuUsage    float64 `json:"actualCpuUsage"`
+	ActualDiskUsage   uint64  `json:"actualDiskUsage,omitempty"`
 	NoUsage           bool    `json:"NoUsage"`
 
 	// input: index definition (optional)
@@ -221,15 +240,17 @@ type Violations struct {
 	Violations []*Violation
 	MemQuota   uint64
 	CpuQuota   uint64
+	DiskQuota  uint64
 }
 
 type Violation struct {
-	Name     string
-	Bucket   string
-	NodeId   string
-	CpuUsage float64
-	MemUsage uint64
-	Details  []string
+	Name      string
+	Bucket    string
+	NodeId    string
+	CpuUsage  float64
+	MemUsage  uint64
+	DiskUsage uint64
+	Details   []string
 }
 
 //////////////////////////////////////////////////////////////
@@ -298,6 +319,26 @@ type RandomPlacement struct {
 type MOISizingMethod struct {
 }
 
+//
+// Sizing for disk based storage engines.  Part of index data is kept
+// resident in buffer cache, while stale data is kept on disk until compaction.
+//
+type diskSizingMethod struct {
+	storageMode   common.StorageMode
+	itemOverhead  uint64  // per item overhead in main and back index
+	residentRatio uint64  // default percentage of index data kept in memory
+	fragmentation float64 // max ratio of stale data on disk before compaction
+	writeAmp      float64 // bytes written to disk per byte of mutation
+}
+
+type PlasmaSizingMethod struct {
+	diskSizingMethod
+}
+
+type ForestDBSizingMethod struct {
+	diskSizingMethod
+}
+
 //////////////////////////////////////////////////////////////
 // Interface Implementation - ConstraintMethod
 //////////////////////////////////////////////////////////////
@@ -306,6 +347,7 @@ type IndexerConstraint struct {
 	// system level constraint
 	MemQuota   uint64 `json:"memQuota,omitempty"`
 	CpuQuota   uint64 `json:"cpuQuota,omitempty"`
+	DiskQuota  uint64 `json:"diskQuota,omitempty"`
 	MaxMemUse  int64  `json:"maxMemUse,omitempty"`
 	MaxCpuUse  int64  `json:"maxCpuUse,omitempty"`
 	canResize  bool
@@ -901,6 +943,7 @@ func (s *Solution) addIndex(n *IndexerNode, idx *IndexUsage) {
 	n.Indexes = append(n.Indexes, idx)
 	n.AddMemUsageOverhead(s, idx.GetMemUsage(s.UseLiveData()), idx.GetMemOverhead(s.UseLiveData()))
 	n.AddCpuUsage(s, idx.GetCpuUsage(s.UseLiveData()))
+	n.AddDiskUsage(s, idx.GetDiskUsage(s.UseLiveData()))
 }
 
 //
@@ -917,6 +960,7 @@ func (s *Solution) removeIndex(n *IndexerNode, i int) {
 
 	n.SubtractMemUsageOverhead(s, idx.GetMemUsage(s.UseLiveData()), idx.GetMemOverhead(s.UseLiveData()))
 	n.SubtractCpuUsage(s, idx.GetCpuUsage(s.UseLiveData()))
+	n.SubtractDiskUsage(s, idx.GetDiskUsage(s.UseLiveData()))
 }
 
 //
@@ -1522,6 +1566,7 @@ func (s *Solution) markNewNodes() {
 //
 func newIndexerConstraint(memQuota uint64,
 	cpuQuota uint64,
+	diskQuota uint64,
 	canResize bool,
 	maxNumNode int,
 	maxCpuUse int,
@@ -1529,6 +1574,7 @@ func newIndexerConstraint(memQuota uint64,
 	return &IndexerConstraint{
 		MemQuota:   memQuota,
 		CpuQuota:   cpuQuota,
+		DiskQuota:  diskQuota,
 		canResize:  canResize,
 		maxNumNode: uint64(maxNumNode),
 		MaxCpuUse:  int64(maxCpuUse),
@@ -1542,6 +1588,9 @@ func newIndexerConstraint(memQuota uint64,
 func (c *IndexerConstraint) Print() {
 	logging.Infof("Memory Quota %v (%s)", c.MemQuota, formatMemoryStr(c.MemQuota))
 	logging.Infof("CPU Quota %v", c.CpuQuota)
+	if c.DiskQuota != 0 {
+		logging.Infof("Disk Quota %v (%s)", c.DiskQuota, formatMemoryStr(c.DiskQuota))
+	}
 	logging.Infof("Max Cpu Utilization %v", c.MaxCpuUse)
 	logging.Infof("Max Memory Utilization %v", c.MaxMemUse)
 }
@@ -1561,11 +1610,13 @@ func (c *IndexerConstraint) Validate(s *Solution) error {
 
 	var totalIndexMem uint64
 	var totalIndexCpu float64
+	var totalIndexDisk uint64
 
 	for _, indexer := range s.Placement {
 		for _, index := range indexer.Indexes {
 			totalIndexMem += index.GetMemTotal(s.UseLiveData())
 			totalIndexCpu += index.GetCpuUsage(s.UseLiveData())
+			totalIndexDisk += index.GetDiskUsage(s.UseLiveData())
 		}
 	}
 
@@ -1579,6 +1630,11 @@ func (c *IndexerConstraint) Validate(s *Solution) error {
 			totalIndexCpu, c.CpuQuota*uint64(s.findNumLiveNode())))
 	}
 
+	if c.DiskQuota != 0 && totalIndexDisk > c.DiskQuota*uint64(s.findNumLiveNode()) {
+		return errors.New(fmt.Sprintf("Total disk usage of all indexes (%v) exceed aggregated disk quota of all indexer nodes (%v)",
+			totalIndexDisk, c.DiskQuota*uint64(s.findNumLiveNode())))
+	}
+
 	return nil
 }
 
@@ -1588,8 +1644,9 @@ func (c *IndexerConstraint) Validate(s *Solution) error {
 func (c *IndexerConstraint) GetViolations(s *Solution, eligibles []*IndexUsage) *Violations {
 
 	violations := &Violations{
-		MemQuota: s.getConstraintMethod().GetMemQuota(),
-		CpuQuota: s.getConstraintMethod().GetCpuQuota(),
+		MemQuota:  s.getConstraintMethod().GetMemQuota(),
+		CpuQuota:  s.getConstraintMethod().GetCpuQuota(),
+		DiskQuota: s.getConstraintMethod().GetDiskQuota(),
 	}
 
 	for _, indexer := range s.Placement {
@@ -1604,12 +1661,13 @@ func (c *IndexerConstraint) GetViolations(s *Solution, eligibles []*IndexUsage)
 					}
 
 					violation := &Violation{
-						Name:     index.GetDisplayName(),
-						Bucket:   index.Bucket,
-						NodeId:   indexer.NodeId,
-						MemUsage: index.GetMemTotal(s.UseLiveData()),
-						CpuUsage: index.GetCpuUsage(s.UseLiveData()),
-						Details:  nil}
+						Name:      index.GetDisplayName(),
+						Bucket:    index.Bucket,
+						NodeId:    indexer.NodeId,
+						MemUsage:  index.GetMemTotal(s.UseLiveData()),
+						CpuUsage:  index.GetCpuUsage(s.UseLiveData()),
+						DiskUsage: index.GetDiskUsage(s.UseLiveData()),
+						Details:   nil}
 
 					// If this indexer node has a placeable index, then check if the
 					// index can be moved to other nodes.
@@ -1680,6 +1738,13 @@ func (c *IndexerConstraint) GetCpuQuota() uint64 {
 	return c.CpuQuota
 }
 
+//
+// Get disk quota.  Disk usage is not constrained if disk quota is 0.
+//
+func (c *IndexerConstraint) GetDiskQuota() uint64 {
+	return c.DiskQuota
+}
+
 //
 // Allow Add Node
 //
@@ -1769,6 +1834,10 @@ func (c *IndexerConstraint) CanAddIndex(s *Solution, n *IndexerNode, u *IndexUsa
 		return ResourceViolation
 	}
 
+	if c.DiskQuota != 0 && u.GetDiskUsage(s.UseLiveData())+n.GetDiskUsage(s.UseLiveData()) > c.DiskQuota {
+		return ResourceViolation
+	}
+
 	return NoViolation
 }
 
@@ -1826,6 +1895,10 @@ func (c *IndexerConstraint) CanSwapIndex(sol *Solution, n *IndexerNode, s *Index
 		return ResourceViolation
 	}
 
+	if c.DiskQuota != 0 && s.GetDiskUsage(sol.UseLiveData())+n.GetDiskUsage(sol.UseLiveData())-t.GetDiskUsage(sol.UseLiveData()) > c.DiskQuota {
+		return ResourceViolation
+	}
+
 	return NoViolation
 }
 
@@ -1857,6 +1930,10 @@ func (c *IndexerConstraint) SatisfyNodeResourceConstraint(s *Solution, n *Indexe
 		return false
 	}
 
+	if c.DiskQuota != 0 && n.GetDiskUsage(s.UseLiveData()) > c.DiskQuota {
+		return false
+	}
+
 	return true
 }
 
@@ -1949,6 +2026,9 @@ func (c *IndexerConstraint) SatisfyClusterResourceConstraint(s *Solution) bool {
 		if indexer.GetCpuUsage(s.UseLiveData()) > cpuQuota {
 			return false
 		}
+		if c.DiskQuota != 0 && indexer.GetDiskUsage(s.UseLiveData()) > c.DiskQuota {
+			return false
+		}
 	}
 
 	return true
@@ -2089,6 +2169,7 @@ func (o *IndexerNode) clone() *IndexerNode {
 		ActualMemUsage:    o.ActualMemUsage,
 		ActualMemOverhead: o.ActualMemOverhead,
 		ActualCpuUsage:    o.ActualCpuUsage,
+		ActualDiskUsage:   o.ActualDiskUsage,
 	}
 
 	for i, _ := range o.Indexes {
@@ -2216,6 +2297,42 @@ func (o *IndexerNode) SubtractMemUsageOverhead(s *Solution, usage uint64, overhe
 	}
 }
 
+//
+// Get disk usage
+//
+func (o *IndexerNode) GetDiskUsage(useLive bool) uint64 {
+
+	if useLive {
+		return o.ActualDiskUsage
+	}
+
+	return o.DiskUsage
+}
+
+//
+// Add disk
+//
+func (o *IndexerNode) AddDiskUsage(s *Solution, usage uint64) {
+
+	if s.UseLiveData() {
+		o.ActualDiskUsage += usage
+	} else {
+		o.DiskUsage += usage
+	}
+}
+
+//
+// Subtract disk
+//
+func (o *IndexerNode) SubtractDiskUsage(s *Solution, usage uint64) {
+
+	if s.UseLiveData() {
+		o.ActualDiskUsage -= usage
+	} else {
+		o.DiskUsage -= usage
+	}
+}
+
 //////////////////////////////////////////////////////////////
 // IndexUsage
 //////////////////////////////////////////////////////////////
@@ -2304,6 +2421,18 @@ func (o *IndexUsage) GetMemTotal(useLive bool) uint64 {
 	return o.MemUsage + o.MemOverhead
 }
 
+//
+// Get disk usage
+//
+func (o *IndexUsage) GetDiskUsage(useLive bool) uint64 {
+
+	if useLive {
+		return o.ActualDiskUsage
+	}
+
+	return o.DiskUsage
+}
+
 func (o *IndexUsage) GetDisplayName() string {
 
 	if o.Instance == nil {
@@ -3485,6 +3614,248 @@ func (s *MOISizingMethod) ComputeMinQuota(indexes []*IndexUsage, useLive bool) (
 	return memQuota, cpuQuota
 }
 
+//////////////////////////////////////////////////////////////
+// PlasmaSizingMethod / ForestDBSizingMethod
+//////////////////////////////////////////////////////////////
+
+//
+// Constructor
+//
+func newPlasmaSizingMethod() *PlasmaSizingMethod {
+	return &PlasmaSizingMethod{
+		diskSizingMethod{
+			storageMode:   common.PLASMA,
+			itemOverhead:  PlasmaItemOverhead,
+			residentRatio: PlasmaResidentRatio,
+			fragmentation: PlasmaFragmentation,
+			writeAmp:      PlasmaWriteAmp,
+		},
+	}
+}
+
+//
+// Constructor
+//
+func newForestDBSizingMethod() *ForestDBSizingMethod {
+	return &ForestDBSizingMethod{
+		diskSizingMethod{
+			storageMode:   common.FORESTDB,
+			itemOverhead:  ForestDBItemOverhead,
+			residentRatio: ForestDBResidentRatio,
+			fragmentation: ForestDBFragmentation,
+			writeAmp:      ForestDBWriteAmp,
+		},
+	}
+}
+
+//
+// This function returns the sizing method for the given storage mode.
+//
+func newSizingMethod(storageMode common.StorageMode) SizingMethod {
+
+	switch storageMode {
+	case common.PLASMA:
+		return newPlasmaSizingMethod()
+	case common.FORESTDB:
+		return newForestDBSizingMethod()
+	default:
+		return newMOISizingMethod()
+	}
+}
+
+//
+// Validate
+//
+func (s *diskSizingMethod) Validate(solution *Solution) error {
+
+	// If using cpu/mem usage from live cluster, no need to validate.
+	if solution.UseLiveData() {
+		return nil
+	}
+
+	for _, indexer := range solution.Placement {
+		for _, index := range indexer.Indexes {
+			mode := common.IndexTypeToStorageMode(common.IndexType(index.StorageMode))
+			if index.IsMOI || (mode != common.NOT_SET && mode != s.storageMode) {
+				return errors.New(fmt.Sprintf("Planner does not support non-%v index. Index=%v Bucket=%v",
+					s.storageMode, index.GetDisplayName(), index.Bucket))
+			}
+		}
+	}
+
+	return nil
+}
+
+//
+// This function computes the index size
+//
+func (s *diskSizingMethod) ComputeIndexSize(idx *IndexUsage) {
+
+	if idx.AvgSecKeySize == 0 && idx.AvgArrKeySize == 0 && idx.AvgDocKeySize == 0 && idx.ActualKeySize == 0 {
+		idx.MemOverhead = s.ComputeIndexOverhead(idx)
+		return
+	}
+
+	dataSize := s.computeDataSize(idx)
+	residentRatio := s.computeResidentRatio(idx)
+
+	// buffer cache to keep resident ratio of index data in memory
+	idx.MemUsage = uint64(float64(dataSize) * residentRatio)
+
+	// disk size : DataSize / (1 - Fragmentation), stale data is
+	// kept on disk until fragmentation triggers compaction.
+	idx.DiskUsage = uint64(float64(dataSize) / (1 - s.fragmentation))
+
+	// compute cpu usage.  Mutation cost is scaled by write amplification,
+	// and scan cost by the cost of fetching non-resident data from disk.
+	missRatio := 1 - residentRatio
+	idx.CpuUsage = float64(idx.MutationRate)*s.writeAmp/float64(DiskMutationRatePerCore) +
+		float64(idx.ScanRate)*(residentRatio+missRatio*DiskScanMissCost)/float64(DiskScanRatePerCore)
+
+	idx.MemOverhead = s.ComputeIndexOverhead(idx)
+}
+
+//
+// This function computes the size of index data, including main
+// index and back index.
+//
+func (s *diskSizingMethod) computeDataSize(idx *IndexUsage) uint64 {
+
+	if !idx.IsPrimary {
+		if idx.AvgSecKeySize != 0 {
+			// main index : KeyLen + DocIdLen + Overhead
+			// back index : DocIdLen + KeyLen + Overhead
+			return 2 * (idx.AvgSecKeySize + idx.AvgDocKeySize + s.itemOverhead) * idx.NumOfDocs
+		} else if idx.AvgArrKeySize != 0 {
+			// main index : (ArrElemSize + DocIdLen + Overhead) * NumArrElems
+			// back index : DocIdLen + ArrElemSize * NumArrElems + Overhead
+			mainIndex := (idx.AvgArrKeySize + idx.AvgDocKeySize + s.itemOverhead) * idx.AvgArrSize
+			backIndex := idx.AvgDocKeySize + idx.AvgArrKeySize*idx.AvgArrSize + s.itemOverhead
+			return (mainIndex + backIndex) * idx.NumOfDocs
+		} else if idx.ActualKeySize != 0 {
+			// ActualKeySize includes key and doc id of main index
+			return 2 * (idx.ActualKeySize + s.itemOverhead) * idx.NumOfDocs
+		}
+	} else {
+		// primary index has no back index
+		if idx.AvgDocKeySize != 0 {
+			return (idx.AvgDocKeySize + s.itemOverhead) * idx.NumOfDocs
+		} else if idx.ActualKeySize != 0 {
+			return idx.ActualKeySize * idx.NumOfDocs
+		}
+	}
+
+	return 0
+}
+
+//
+// This function returns the ratio of index data resident in memory.
+//
+func (s *diskSizingMethod) computeResidentRatio(idx *IndexUsage) float64 {
+
+	residentRatio := s.residentRatio
+	if idx.MemResidentRatio != 0 {
+		residentRatio = idx.MemResidentRatio
+	}
+
+	if residentRatio > 100 {
+		residentRatio = 100
+	}
+
+	return float64(residentRatio) / 100
+}
+
+//
+// This function computes the indexer memory, cpu and disk usage
+//
+func (s *diskSizingMethod) ComputeIndexerSize(o *IndexerNode) {
+
+	o.MemUsage = 0
+	o.CpuUsage = 0
+	o.DiskUsage = 0
+
+	for _, idx := range o.Indexes {
+		o.MemUsage += idx.MemUsage
+		o.CpuUsage += idx.CpuUsage
+		o.DiskUsage += idx.DiskUsage
+	}
+
+	s.ComputeIndexerOverhead(o)
+}
+
+//
+// This function computes the indexer memory overhead
+//
+func (s *diskSizingMethod) ComputeIndexerOverhead(o *IndexerNode) {
+
+	// channel overhead : 100MB
+	overhead := uint64(100 * 1024 * 1024)
+
+	for _, idx := range o.Indexes {
+		overhead += s.ComputeIndexOverhead(idx)
+	}
+
+	o.MemOverhead = uint64(overhead)
+}
+
+//
+// This function estimates the index memory overhead.  Unlike MOI, snapshots
+// are persisted on disk and do not hold on to memory.
+//
+func (s *diskSizingMethod) ComputeIndexOverhead(idx *IndexUsage) uint64 {
+
+	// protobuf overhead : 150MB per index
+	overhead := float64(150 * 1024 * 1024)
+
+	// incoming mutation buffer overhead: 30K * SizePerItem * NumberOfIndexes * MutationRate/500
+	if idx.AvgSecKeySize != 0 {
+		overhead += float64(30*1000*(idx.AvgSecKeySize+idx.AvgDocKeySize)) * float64(idx.MutationRate) / float64(500)
+	} else if idx.AvgArrKeySize != 0 {
+		overhead += float64(30*1000*(idx.AvgArrKeySize*idx.AvgArrSize+idx.AvgDocKeySize)) * float64(idx.MutationRate) / float64(500)
+	} else if idx.AvgDocKeySize != 0 {
+		overhead += float64(30*1000*idx.AvgDocKeySize) * float64(idx.MutationRate) / float64(500)
+	} else if idx.ActualKeySize != 0 {
+		overhead += float64(30*1000*(idx.ActualKeySize)) * float64(idx.MutationRate) / float64(500)
+	}
+
+	// mutation queue size : 10% of indexer memory usage
+	mutationQueueOverhead := float64(idx.MemUsage) * 0.1
+	overhead += mutationQueueOverhead
+
+	// golang overhead: 5% of total memory
+	golangOverhead := (float64(idx.MemUsage) + mutationQueueOverhead) * 0.05
+	overhead += golangOverhead
+
+	return uint64(overhead)
+}
+
+//
+// This function estimates the min memory quota given a set of indexes
+//
+func (s *diskSizingMethod) ComputeMinQuota(indexes []*IndexUsage, useLive bool) (uint64, uint64) {
+
+	maxCpuUsage := float64(0)
+	maxMemUsage := uint64(0)
+
+	for _, index := range indexes {
+		if index.GetMemTotal(useLive) > maxMemUsage {
+			maxMemUsage = index.GetMemTotal(useLive)
+		}
+
+		if index.GetCpuUsage(useLive) > maxCpuUsage {
+			maxCpuUsage = index.GetCpuUsage(useLive)
+		}
+	}
+
+	// channel overhead : 100MB
+	overhead := uint64(100 * 1024 * 1024)
+
+	memQuota := maxMemUsage + overhead
+	cpuQuota := uint64(math.Floor(maxCpuUsage)) + 1
+
+	return memQuota, cpuQuota
+}
+
 //////////////////////////////////////////////////////////////
 // Violations
 //////////////////////////////////////////////////////////////
@@ -3495,6 +3866,9 @@ func (s *MOISizingMethod) ComputeMinQuota(indexes []*IndexUsage, useLive bool) (
 func (v *Violations) Error() string {
 	err := fmt.Sprintf("\nMemoryQuota: %v\n", v.MemQuota)
 	err += fmt.Sprintf("CpuQuota: %v\n", v.CpuQuota)
+	if v.DiskQuota != 0 {
+		err += fmt.Sprintf("DiskQuota: %v\n", v.DiskQuota)
+	}
 
 	for _, violation := range v.Violations {
 		err += fmt.Sprintf("--- Violations for index <%v, %v> (mem %v, cpu %v) at node %v \n",
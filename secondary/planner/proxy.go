@@ -80,7 +80,7 @@ func RetrievePlanFromCluster(clusterUrl string) (*Plan, error) {
 //
 func recalculateIndexerSize(plan *Plan) {
 
-	sizing := newMOISizingMethod()
+	sizing := newSizingMethod(getStorageMode(DefaultRunConfig(), plan))
 
 	for _, indexer := range plan.Placement {
 		for _, index := range indexer.Indexes {
@@ -221,6 +221,7 @@ func ConvertToIndexUsage(defn *common.IndexDefn, localMeta *LocalIndexMetadata)
 		// update sizing
 		index.IsPrimary = defn.IsPrimary
 		index.IsMOI = (defn.Using == common.IndexType(common.MemoryOptimized) || defn.Using == common.IndexType(common.MemDB))
+		index.StorageMode = common.IndexTypeToStorageMode(defn.Using).String()
 		index.NoUsage = defn.Deferred && state == common.INDEX_STATE_READY
 
 		// Is the index being deleted by user?   Thsi will read the delete token from metakv.  If untable read from metakv,
@@ -370,6 +371,14 @@ func getIndexStats(clusterUrl string, plan *Plan) error {
 				totalDataSize += index.ActualMemUsage
 			}
 
+			// disk_size is the size of index files, including stale data
+			// pending compaction.  It is 0 for memory optimized index.
+			key = fmt.Sprintf("%v:%v:disk_size", index.Bucket, indexName)
+			if diskSize, ok := statsMap[key]; ok {
+				index.ActualDiskUsage = uint64(diskSize.(float64))
+				indexer.ActualDiskUsage += index.ActualDiskUsage
+			}
+
 			// avg_sec_key_size is currently unavailable in 4.5.   To estimate,
 			// the key size, it divides index data_size by items_count.  This
 			// contains sec key size + doc key size + main index overhead (74 bytes).
@@ -562,6 +571,11 @@ func getIndexSettings(clusterUrl string, plan *Plan) error {
 		plan.CpuQuota = uint64(quota.(float64) / 100)
 	}
 
+	// Storage mode of the cluster decides on the sizing method.
+	if storageMode, ok := settings["indexer.settings.storage_mode"]; ok {
+		plan.StorageMode = storageMode.(string)
+	}
+
 	return nil
 }
 
@@ -47,6 +47,8 @@ var gMaxCpuUse int
 var gMaxMemUse int
 var gMemQuota string
 var gCpuQuota int
+var gDiskQuota string
+var gStorageMode string
 var gDataCostWeight float64
 var gCpuCostWeight float64
 var gMemCostWeight float64
@@ -79,6 +81,8 @@ func init() {
 	flag.IntVar(&gMaxMemUse, "maxMemUse", -1, "maximum memory utilization (as percentage) per indexer node")
 	flag.StringVar(&gMemQuota, "memQuota", "", "memory quota per indexer node")
 	flag.IntVar(&gCpuQuota, "cpuQuota", -1, "cpu quota per indexer node")
+	flag.StringVar(&gDiskQuota, "diskQuota", "", "disk quota per indexer node")
+	flag.StringVar(&gStorageMode, "storageMode", "", "storage mode = memory_optimized, plasma, forestdb")
 
 	// cluster size
 	flag.BoolVar(&gResize, "resize", false, "allow new node to be dynamcially added to cluster while running the planner")
@@ -176,6 +180,8 @@ func TestSimulation(t *testing.T) {
 		MaxCpuUse:      gMaxCpuUse,
 		MemQuota:       parseMemoryStr(t, gMemQuota),
 		CpuQuota:       gCpuQuota,
+		DiskQuota:      parseMemoryStr(t, gDiskQuota),
+		StorageMode:    gStorageMode,
 		DataCostWeight: gDataCostWeight,
 		CpuCostWeight:  gCpuCostWeight,
 		MemCostWeight:  gMemCostWeight,
@@ -332,17 +332,18 @@ func (t *simulator) RunSingleTest(config *RunConfig, command CommandType, spec *
 	var indexes []*IndexUsage
 	var err error
 
-	sizing := newMOISizingMethod()
+	storageMode := getStorageMode(config, p)
+	sizing := newSizingMethod(storageMode)
 
 	if command == CommandPlan {
 		if spec != nil {
-			indexes, err = t.indexUsages(sizing, spec)
+			indexes, err = t.indexUsages(sizing, storageMode, spec)
 			if err != nil {
 				return nil, nil, err
 			}
 
 		} else if indexSpecs != nil {
-			indexes, err = indexUsagesFromSpec(sizing, indexSpecs)
+			indexes, err = indexUsagesFromSpec(sizing, storageMode, indexSpecs)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -355,7 +356,7 @@ func (t *simulator) RunSingleTest(config *RunConfig, command CommandType, spec *
 
 	} else if command == CommandRebalance || command == CommandSwap {
 		if spec != nil {
-			indexes, err = t.indexUsages(sizing, spec)
+			indexes, err = t.indexUsages(sizing, storageMode, spec)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -409,7 +410,7 @@ func (t *simulator) findNodesToDelete(config *RunConfig, plan *Plan) ([]string,
 // Index Usage Genreation
 /////////////////////////////////////////////////////////////
 
-func (t *simulator) indexUsages(s SizingMethod, spec *WorkloadSpec) ([]*IndexUsage, error) {
+func (t *simulator) indexUsages(s SizingMethod, storageMode common.StorageMode, spec *WorkloadSpec) ([]*IndexUsage, error) {
 
 	count := t.rs.Int63n(spec.MaxNumIndex + 1 - spec.MinNumIndex)
 	count += spec.MinNumIndex
@@ -424,7 +425,7 @@ func (t *simulator) indexUsages(s SizingMethod, spec *WorkloadSpec) ([]*IndexUsa
 		if err != nil {
 			return nil, err
 		}
-		indexes, err := t.indexUsage(s, bucket.Name, collection, bucket.Replica)
+		indexes, err := t.indexUsage(s, storageMode, bucket.Name, collection, bucket.Replica)
 		if err != nil {
 			return nil, err
 		}
@@ -434,7 +435,8 @@ func (t *simulator) indexUsages(s SizingMethod, spec *WorkloadSpec) ([]*IndexUsa
 	return result, nil
 }
 
-func (t *simulator) indexUsage(s SizingMethod, bucket string, spec *CollectionSpec, replica int64) ([]*IndexUsage, error) {
+func (t *simulator) indexUsage(s SizingMethod, storageMode common.StorageMode, bucket string,
+	spec *CollectionSpec, replica int64) ([]*IndexUsage, error) {
 
 	result := make([]*IndexUsage, replica)
 
@@ -456,7 +458,8 @@ func (t *simulator) indexUsage(s SizingMethod, bucket string, spec *CollectionSp
 		// TODO
 		//index.IsPrimary = t.isPrimary(spec)
 		index.IsPrimary = false
-		index.IsMOI = true
+		index.IsMOI = storageMode == common.MOI
+		index.StorageMode = storageMode.String()
 		index.AvgSecKeySize = t.avgSecKeySize(spec)
 		index.AvgDocKeySize = t.avgDocKeySize(spec)
 		//TODO
@@ -465,7 +468,9 @@ func (t *simulator) indexUsage(s SizingMethod, bucket string, spec *CollectionSp
 		index.AvgArrKeySize = 0
 		index.AvgArrSize = 0
 		index.NumOfDocs = t.numOfDocs(spec)
-		index.MemResidentRatio = 100
+		if index.IsMOI {
+			index.MemResidentRatio = 100
+		}
 		index.MutationRate = t.mutationRate(spec)
 		index.ScanRate = t.scanRate(spec)
 
@@ -495,11 +495,13 @@ func ValidateSolution(s *Solution) error {
 		totalMem := uint64(0)
 		totalOverhead := uint64(0)
 		totalCpu := float64(0)
+		totalDisk := uint64(0)
 
 		for _, index := range indexer.Indexes {
 			totalMem += index.GetMemUsage(s.UseLiveData())
 			totalOverhead += index.GetMemOverhead(s.UseLiveData())
 			totalCpu += index.GetCpuUsage(s.UseLiveData())
+			totalDisk += index.GetDiskUsage(s.UseLiveData())
 		}
 
 		if !s.UseLiveData() {
@@ -521,6 +523,10 @@ func ValidateSolution(s *Solution) error {
 		if indexer.GetMemTotal(s.UseLiveData()) != indexer.GetMemUsage(s.UseLiveData())+indexer.GetMemOverhead(s.UseLiveData()) {
 			return errors.New("validation fails: total indexer memory does not match sum of indexer memory usage + overhead")
 		}
+
+		if indexer.GetDiskUsage(s.UseLiveData()) != totalDisk {
+			return errors.New("validation fails: disk usage of indexer does not match sum of index disk use")
+		}
 	}
 
 	return nil
@@ -11,5 +11,20 @@
 
 package platform
 
+import (
+	"syscall"
+	"time"
+)
+
 func HideConsole(_ bool) {
 }
+
+// ProcessCPUTime returns the user and system CPU time consumed by the
+// process so far.
+func ProcessCPUTime() (time.Duration, error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, err
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), nil
+}
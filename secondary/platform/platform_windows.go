@@ -11,7 +11,10 @@
 
 package platform
 
-import "syscall"
+import (
+	"syscall"
+	"time"
+)
 
 // Hide console on windows without removing it unlike -H windowsgui.
 func HideConsole(hide bool) {
@@ -31,3 +34,20 @@ func HideConsole(hide bool) {
 		sw.Call(hwnd, SW_RESTORE)
 	}
 }
+
+// ProcessCPUTime returns the user and system CPU time consumed by the
+// process so far.
+func ProcessCPUTime() (time.Duration, error) {
+	var creation, exit, kernel, user syscall.Filetime
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, err
+	}
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	// Filetime counts 100-nanosecond intervals.
+	ticks := int64(kernel.HighDateTime)<<32 | int64(kernel.LowDateTime)
+	ticks += int64(user.HighDateTime)<<32 | int64(user.LowDateTime)
+	return time.Duration(ticks * 100), nil
+}
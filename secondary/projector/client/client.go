@@ -120,6 +120,9 @@ var ErrorStreamRequest = errors.New("feed.streamRequest")
 // ErrorStreamEnd
 var ErrorStreamEnd = errors.New("feed.streamEnd")
 
+// ErrorCollectionNotStreamed
+var ErrorCollectionNotStreamed = errors.New("feed.collectionNotStreamed")
+
 // ErrorResponseTimeout is sent when projector does not recieve
 // expected control message like StreamBegin (when stream is started)
 // and StreamEnd (when stream is closed).
@@ -279,7 +282,8 @@ func (client *Client) InitialTopicRequest(
 }
 
 // MutationTopicRequest topic from a kvnode, with initial set
-// of instances.
+// of instances. With `filterCollections` vbucket streams carry only
+// documents from collections of the topic's instances.
 //
 // Idempotent API.
 // - return TopicResponse that contain current set of
@@ -310,10 +314,12 @@ func (client *Client) InitialTopicRequest(
 func (client *Client) MutationTopicRequest(
 	topic, endpointType string,
 	reqTimestamps []*protobuf.TsVbuuid,
-	instances []*protobuf.Instance) (*protobuf.TopicResponse, error) {
+	instances []*protobuf.Instance,
+	filterCollections bool) (*protobuf.TopicResponse, error) {
 
 	req := protobuf.NewMutationTopicRequest(topic, endpointType, instances)
 	req.ReqTimestamps = reqTimestamps
+	req.FilterCollections = proto.Bool(filterCollections)
 	res := &protobuf.TopicResponse{}
 	err := client.withRetry(
 		func() error {
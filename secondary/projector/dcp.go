@@ -34,10 +34,12 @@ type BucketFeeder interface {
 	// GetChannel return a mutation channel.
 	GetChannel() (mutch <-chan *mc.DcpEvent)
 
-	// StartVbStreams starts a set of vbucket streams on this feed.
+	// StartVbStreams starts a set of vbucket streams on this feed,
+	// restricted to `collections` if specified.
 	// returns list of vbuckets for which StreamRequest is successfully
 	// posted.
-	StartVbStreams(opaque uint16, ts *protobuf.TsVbuuid) error
+	StartVbStreams(
+		opaque uint16, ts *protobuf.TsVbuuid, collections []uint32) error
 
 	// EndVbStreams ends an existing vbucket stream from this feed.
 	EndVbStreams(opaque uint16, endTs *protobuf.TsVbuuid) error
@@ -76,7 +78,7 @@ func (bdcp *bucketDcp) GetChannel() (mutch <-chan *mc.DcpEvent) {
 
 // StartVbStreams implements Feeder{} interface.
 func (bdcp *bucketDcp) StartVbStreams(
-	opaque uint16, reqTs *protobuf.TsVbuuid) error {
+	opaque uint16, reqTs *protobuf.TsVbuuid, collections []uint32) error {
 
 	var err error
 
@@ -91,7 +93,8 @@ func (bdcp *bucketDcp) StartVbStreams(
 		start, end := seqnos[i], uint64(0xFFFFFFFFFFFFFFFF)
 		snapStart, snapEnd := snapshots[i].GetStart(), snapshots[i].GetEnd()
 		e := bdcp.dcpFeed.DcpRequestStream(
-			vbno, opaque, flags, vbuuid, start, end, snapStart, snapEnd)
+			vbno, opaque, flags, vbuuid, start, end, snapStart, snapEnd,
+			collections...)
 		if e != nil {
 			err = e
 		}
@@ -0,0 +1,367 @@
+package projector
+
+import "bytes"
+import "fmt"
+import "net"
+import "sort"
+import "sync"
+import "testing"
+import "time"
+
+import c "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/collatejson"
+import "github.com/couchbase/indexing/secondary/dataport"
+import "github.com/couchbase/indexing/secondary/dcp/emulator"
+import "github.com/couchbase/indexing/secondary/logging"
+import "github.com/couchbase/indexing/secondary/queryport"
+import qclient "github.com/couchbase/indexing/secondary/queryport/client"
+import dataproto "github.com/couchbase/indexing/secondary/protobuf/data"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+import queryproto "github.com/couchbase/indexing/secondary/protobuf/query"
+import "github.com/golang/protobuf/proto"
+
+const testNumVbuckets = 8
+const testDefnID, testInstID = uint64(10), uint64(0x1)
+
+// TestEndToEnd streams documents from an emulated KV cluster through the
+// projector and dataport into an in-memory index, and scans it back over
+// queryport.
+func TestEndToEnd(t *testing.T) {
+	logging.SetLogLevel(logging.Silent)
+	c.SetServiceAuth(func(string) (string, string, error) {
+		return "Administrator", "asdasd", nil
+	})
+	defer c.SetServiceAuth(nil)
+
+	cluster, err := emulator.NewCluster(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	bucket, err := cluster.CreateBucket("default", testNumVbuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// indexer side, dataport and queryport.
+	indexer := newTestIndexer()
+	dataportAddr, queryportAddr := testFreeAddr(t), testFreeAddr(t)
+	dconfig := c.SystemConfig.SectionConfig("indexer.dataport.", true)
+	daemon, err := dataport.NewServer(dataportAddr, testNumVbuckets, dconfig, indexer.appch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer daemon.Close()
+	go indexer.run()
+	defer indexer.close()
+
+	qconfig := c.SystemConfig.SectionConfig("indexer.queryport.", true)
+	qserver, err := queryport.NewServer(queryportAddr, indexer.handleRequest, qconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qserver.Close()
+
+	// documents written before the topic is started are backfilled.
+	for i := 0; i < 50; i++ {
+		bucket.Set(fmt.Sprintf("user-%03d", i), testDocument("name", i))
+	}
+
+	p := newTestProjector(cluster.Nodes()[0].RestAddr())
+	req := protobuf.NewMutationTopicRequest(
+		"e2e", "dataport", []*protobuf.Instance{testInstance(dataportAddr)})
+	req.Append(testRestartTimestamp(bucket))
+	resp := p.doMutationTopic(req, 0xABBA).(*protobuf.TopicResponse)
+	if protoerr := resp.GetErr(); protoerr != nil {
+		t.Fatalf("MutationTopic(): %v", protoerr.GetError())
+	}
+	defer func() {
+		shutreq := &protobuf.ShutdownTopicRequest{Topic: proto.String("e2e")}
+		p.doShutdownTopic(shutreq, 0xABBA)
+	}()
+
+	for i := 50; i < 100; i++ {
+		bucket.Set(fmt.Sprintf("user-%03d", i), testDocument("name", i))
+	}
+	indexer.waitFor(t, func(entries map[string][]byte) bool {
+		return len(entries) == 100
+	})
+
+	qconf := c.SystemConfig.SectionConfig("queryport.client.", true)
+	qc, err := qclient.NewGsiScanClient(queryportAddr, qconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer qc.Close()
+
+	skeys, docids := testScanAll(t, qc)
+	if len(skeys) != 100 {
+		t.Fatalf("Expected %v entries, received %v", 100, len(skeys))
+	}
+	for i := range skeys {
+		name, docid := fmt.Sprintf("name-%03d", i), fmt.Sprintf("user-%03d", i)
+		if skeys[i][0] != name || docids[i] != docid {
+			t.Errorf("Expected %v %v, received %v %v", name, docid, skeys[i], docids[i])
+		}
+	}
+
+	// deletes remove entries, updates move them.
+	for i := 0; i < 10; i++ {
+		if _, err := bucket.Delete(fmt.Sprintf("user-%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+		bucket.Set(fmt.Sprintf("user-%03d", 10+i), testDocument("renamed", 10+i))
+	}
+	indexer.waitFor(t, func(entries map[string][]byte) bool {
+		renamed := 0
+		for _, key := range entries {
+			if bytes.Contains(key, []byte("renamed")) {
+				renamed++
+			}
+		}
+		return len(entries) == 90 && renamed == 10
+	})
+
+	skeys, docids = testScanAll(t, qc)
+	if len(skeys) != 90 {
+		t.Fatalf("Expected %v entries, received %v", 90, len(skeys))
+	}
+	for i := range skeys {
+		name, docid := fmt.Sprintf("name-%03d", 20+i), fmt.Sprintf("user-%03d", 20+i)
+		if i >= 80 { // renamed documents collate last.
+			name = fmt.Sprintf("renamed-%03d", 10+i-80)
+			docid = fmt.Sprintf("user-%03d", 10+i-80)
+		}
+		if skeys[i][0] != name || docids[i] != docid {
+			t.Errorf("Expected %v %v, received %v %v", name, docid, skeys[i], docids[i])
+		}
+	}
+}
+
+// testIndexer stands in for the indexer: mutations received by dataport
+// are applied to an in-memory index that is scanned over queryport.
+type testIndexer struct {
+	appch chan interface{}
+	finch chan bool
+
+	mu      sync.Mutex
+	entries map[string][]byte // docid -> collatejson encoded key
+}
+
+func newTestIndexer() *testIndexer {
+	return &testIndexer{
+		appch:   make(chan interface{}, 1000),
+		finch:   make(chan bool),
+		entries: make(map[string][]byte),
+	}
+}
+
+func (ti *testIndexer) run() {
+	for {
+		select {
+		case msg := <-ti.appch:
+			if vbs, ok := msg.([]*dataproto.VbKeyVersions); ok {
+				ti.apply(vbs)
+			}
+		case <-ti.finch:
+			return
+		}
+	}
+}
+
+func (ti *testIndexer) close() {
+	close(ti.finch)
+}
+
+func (ti *testIndexer) apply(vbs []*dataproto.VbKeyVersions) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	for _, vb := range vbs {
+		for _, kv := range vb.GetKvs() {
+			docid := string(kv.GetDocid())
+			for i, cmd := range kv.GetCommands() {
+				if kv.GetUuids()[i] != testInstID {
+					continue
+				}
+				switch byte(cmd) {
+				case c.Upsert:
+					if key := kv.GetKeys()[i]; len(key) > 0 {
+						ti.entries[docid] = append([]byte(nil), key...)
+					} else { // key is missing in document.
+						delete(ti.entries, docid)
+					}
+				case c.Deletion, c.UpsertDeletion:
+					delete(ti.entries, docid)
+				}
+			}
+		}
+	}
+}
+
+// waitFor `cond` to hold on the indexed entries.
+func (ti *testIndexer) waitFor(t *testing.T, cond func(map[string][]byte) bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		ti.mu.Lock()
+		ok := cond(ti.entries)
+		ti.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timeout waiting for mutations to be indexed")
+}
+
+// handleRequest implements queryport.RequestHandler, only helo and full
+// scans are served.
+func (ti *testIndexer) handleRequest(req interface{}, conn net.Conn, quitch <-chan bool) {
+	buf := make([]byte, 64*1024)
+	switch r := req.(type) {
+	case *queryproto.HeloRequest:
+		resp := &queryproto.HeloResponse{Version: proto.Uint32(c.INDEXER_CUR_VERSION)}
+		queryproto.EncodeAndWrite(conn, buf, resp)
+
+	case *queryproto.ScanAllRequest:
+		resp := &queryproto.ResponseStream{}
+		if r.GetDefnID() != testDefnID {
+			resp.Err = &queryproto.Error{Error: proto.String("index not found")}
+		} else if entries, err := ti.scanAll(); err != nil {
+			resp.Err = &queryproto.Error{Error: proto.String(err.Error())}
+		} else {
+			resp.IndexEntries = entries
+		}
+		queryproto.EncodeAndWrite(conn, buf, resp)
+		queryproto.EncodeAndWrite(conn, buf, &queryproto.StreamEndResponse{})
+
+	default:
+		resp := &queryproto.ResponseStream{
+			Err: &queryproto.Error{Error: proto.String("unsupported request")},
+		}
+		queryproto.EncodeAndWrite(conn, buf, resp)
+	}
+}
+
+// scanAll returns all entries in collation order, with keys decoded to
+// JSON.
+func (ti *testIndexer) scanAll() ([]*queryproto.IndexEntry, error) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	docids := make([]string, 0, len(ti.entries))
+	for docid := range ti.entries {
+		docids = append(docids, docid)
+	}
+	sort.Slice(docids, func(i, j int) bool {
+		ki, kj := ti.entries[docids[i]], ti.entries[docids[j]]
+		if cmp := bytes.Compare(ki, kj); cmp != 0 {
+			return cmp < 0
+		}
+		return docids[i] < docids[j]
+	})
+
+	codec := collatejson.NewCodec(16)
+	entries := make([]*queryproto.IndexEntry, 0, len(docids))
+	for _, docid := range docids {
+		key, err := codec.Decode(ti.entries[docid], make([]byte, 0, 1024))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &queryproto.IndexEntry{
+			EntryKey: key, PrimaryKey: []byte(docid),
+		})
+	}
+	return entries, nil
+}
+
+func newTestProjector(clusterAddr string) *Projector {
+	config := c.SystemConfig.Clone()
+	config.SetValue("projector.clusterAddr", clusterAddr)
+	config.SetValue("projector.routerEndpointFactory", c.RouterEndpointFactory(
+		func(topic, endpointType, addr string, config c.Config) (c.RouterEndpoint, error) {
+			return dataport.NewRouterEndpoint(
+				clusterAddr, topic, addr, testNumVbuckets, config)
+		}))
+	return &Projector{
+		topics:         make(map[string]*Feed),
+		topicSerialize: make(map[string]*sync.Mutex),
+		config:         config,
+		clusterAddr:    clusterAddr,
+		pooln:          "default",
+		maxvbs:         testNumVbuckets,
+		logPrefix:      "PROJ[e2e]",
+	}
+}
+
+func testInstance(dataportAddr string) *protobuf.Instance {
+	defn := &protobuf.IndexDefn{
+		DefnID:          proto.Uint64(testDefnID),
+		Bucket:          proto.String("default"),
+		IsPrimary:       proto.Bool(false),
+		Name:            proto.String("idx_name"),
+		Using:           protobuf.StorageType_memdb.Enum(),
+		ExprType:        protobuf.ExprType_N1QL.Enum(),
+		SecExpressions:  []string{"`name`"},
+		PartitionScheme: protobuf.PartitionScheme_SINGLE.Enum(),
+	}
+	return &protobuf.Instance{
+		IndexInstance: &protobuf.IndexInst{
+			InstId:      proto.Uint64(testInstID),
+			State:       protobuf.IndexState_IndexInitial.Enum(),
+			Definition:  defn,
+			SinglePartn: protobuf.NewSinglePartition([]string{dataportAddr}),
+		},
+	}
+}
+
+// testRestartTimestamp streams every vbucket of `bucket` from seqno 0 on
+// its latest branch.
+func testRestartTimestamp(bucket *emulator.Bucket) *protobuf.TsVbuuid {
+	ts := protobuf.NewTsVbuuid("default", bucket.Name(), bucket.NumVbuckets())
+	for vbno := 0; vbno < bucket.NumVbuckets(); vbno++ {
+		vbuuid := bucket.FailoverLog(uint16(vbno))[0][0]
+		ts.Append(uint16(vbno), 0, vbuuid, 0, 0)
+	}
+	return ts
+}
+
+func testDocument(name string, i int) []byte {
+	return []byte(fmt.Sprintf(`{"name":"%v-%03d","age":%v}`, name, i, i))
+}
+
+func testScanAll(t *testing.T, qc *qclient.GsiScanClient) ([]c.SecondaryKey, []string) {
+	var skeys []c.SecondaryKey
+	var docids []string
+	err, _ := qc.ScanAll(
+		testDefnID, "e2e", 0, c.AnyConsistency, nil,
+		func(resp qclient.ResponseReader) bool {
+			if err := resp.Error(); err != nil {
+				t.Errorf("ScanAll(): %v", err)
+				return false
+			}
+			sks, pks, err := resp.GetEntries()
+			if err != nil {
+				t.Errorf("GetEntries(): %v", err)
+				return false
+			}
+			skeys = append(skeys, sks...)
+			for _, pk := range pks {
+				docids = append(docids, string(pk))
+			}
+			return true
+		})
+	if err != nil {
+		t.Fatalf("ScanAll(): %v", err)
+	}
+	return skeys, docids
+}
+
+func testFreeAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
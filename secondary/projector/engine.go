@@ -32,6 +32,11 @@ func (engine *Engine) Endpoints() []string {
 	return engine.router.Endpoints()
 }
 
+// CollectionID of documents evaluated by this engine.
+func (engine *Engine) CollectionID() uint32 {
+	return engine.evaluator.CollectionID()
+}
+
 // StreamBeginData from this engine.
 func (engine *Engine) StreamBeginData(
 	vbno uint16, vbuuid, seqno uint64) interface{} {
@@ -40,6 +40,10 @@ type Feed struct {
 	opaque       uint16               // opaque that created this feed.
 	endpointType string               // immutable
 	projector    *Projector
+	// filterCollections, streams are restricted to the collections of
+	// instances on the bucket when they are requested.
+	filterCollections bool                // immutable
+	collections       map[string][]uint32 // bucket -> streamed collections
 
 	// upstream
 	// reqTs, book-keeping on outstanding request posted to feeder.
@@ -103,6 +107,8 @@ func NewFeed(
 		actTss:  make(map[string]*protobuf.TsVbuuid),
 		rollTss: make(map[string]*protobuf.TsVbuuid),
 		feeders: make(map[string]BucketFeeder),
+		// collections streamed from each bucket
+		collections: make(map[string][]uint32),
 		// downstream
 		kvdata:    make(map[string]*KVData),
 		engines:   make(map[string]map[uint64]*Engine),
@@ -691,6 +697,7 @@ func (feed *Feed) start(
 
 	feed.endpointType = req.GetEndpointType()
 	feed.version = req.GetVersion()
+	feed.filterCollections = req.GetFilterCollections()
 
 	// update engines and endpoints
 	if err = feed.processSubscribers(opaque, req); err != nil { // :SideEffect:
@@ -1047,6 +1054,10 @@ func (feed *Feed) addInstances(
 	}
 	errResp := &protobuf.TimestampResponse{Topic: proto.String(feed.topic)}
 
+	// instances cannot be added on collections that are not streamed.
+	if err := feed.checkCollections(opaque, req); err != nil {
+		return errResp, err
+	}
 	// update engines and endpoints
 	if err := feed.processSubscribers(opaque, req); err != nil { // :SideEffect:
 		return errResp, err
@@ -1243,7 +1254,8 @@ func (feed *Feed) cleanupBucket(bucketn string, enginesOk bool) {
 	if ok {
 		feeder.CloseFeed()
 	}
-	delete(feed.feeders, bucketn) // :SideEffect:
+	delete(feed.feeders, bucketn)     // :SideEffect:
+	delete(feed.collections, bucketn) // :SideEffect:
 	// cleanup data structures.
 	if kvdata, ok := feed.kvdata[bucketn]; ok {
 		kvdata.Close()
@@ -1273,10 +1285,13 @@ func (feed *Feed) openFeeder(
 	}
 	name := newDCPConnectionName(bucket.Name, feed.topic, uuid.Uint64())
 	dcpConfig := map[string]interface{}{
-		"genChanSize":    feed.config["dcp.genChanSize"].Int(),
-		"dataChanSize":   feed.config["dcp.dataChanSize"].Int(),
-		"numConnections": feed.config["dcp.numConnections"].Int(),
-		"latencyTick":    feed.config["dcp.latencyTick"].Int(),
+		"genChanSize":      feed.config["dcp.genChanSize"].Int(),
+		"dataChanSize":     feed.config["dcp.dataChanSize"].Int(),
+		"numConnections":   feed.config["dcp.numConnections"].Int(),
+		"latencyTick":      feed.config["dcp.latencyTick"].Int(),
+		"includeXATTRs":    feed.config["dcp.includeXATTRs"].Bool(),
+		"compression":      feed.config["dcp.compression"].Bool(),
+		"collectionsAware": true, // route mutations by collection-id
 	}
 	kvaddr, err := feed.getLocalKVAddrs(pooln, bucketn, opaque)
 	if err != nil {
@@ -1319,11 +1334,49 @@ func (feed *Feed) bucketFeed(
 	} else if start {
 		fmsg := "%v ##%x start-timestamp %v\n"
 		logging.Infof(fmsg, feed.logPrefix, opaque, reqTs.Repr())
-		if err = feeder.StartVbStreams(opaque, reqTs); err != nil {
+		collections := feed.bucketCollections(bucketn)
+		if err = feeder.StartVbStreams(opaque, reqTs, collections); err != nil {
 			fmsg := "%v ##%x StartVbStreams(%q): %v"
 			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, err)
 			return projC.ErrorFeeder
 		}
+		if collections != nil {
+			feed.collections[bucketn] = collections // :SideEffect:
+		}
+	}
+	return nil
+}
+
+// return the collections of instances on bucket, if streams are to be
+// filtered by collection, else nil.
+func (feed *Feed) bucketCollections(bucketn string) []uint32 {
+	if !feed.filterCollections {
+		return nil
+	}
+	collections := make([]uint32, 0)
+	for _, engine := range feed.engines[bucketn] {
+		if cid := engine.CollectionID(); !c.HasUint32(cid, collections) {
+			collections = append(collections, cid)
+		}
+	}
+	return collections
+}
+
+// - return ErrorCollectionNotStreamed if an instance is defined on a
+//   collection that is filtered out of its bucket's streams.
+func (feed *Feed) checkCollections(opaque uint16, req Subscriber) error {
+	evaluators, err := req.GetEvaluators()
+	if err != nil {
+		return projC.ErrorInconsistentFeed
+	}
+	for uuid, evaluator := range evaluators {
+		bucketn, cid := evaluator.Bucket(), evaluator.CollectionID()
+		collections, ok := feed.collections[bucketn]
+		if ok && !c.HasUint32(cid, collections) {
+			fmsg := "%v ##%x instance %v collection %x not streamed from %q\n"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, uuid, cid, bucketn)
+			return projC.ErrorCollectionNotStreamed
+		}
 	}
 	return nil
 }
@@ -1812,6 +1865,8 @@ func FeedConfigParams() []string {
 		"dcp.genChanSize",
 		"dcp.numConnections",
 		"dcp.latencyTick",
+		"dcp.includeXATTRs",
+		"dcp.compression",
 		// dataport
 		"dataport.remoteBlock",
 		"dataport.keyChanSize",
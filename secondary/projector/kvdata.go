@@ -58,6 +58,9 @@ type KVData struct {
 	ainstCount  int64
 	dinstCount  int64
 	tsCount     int64
+	// document values as received from DCP and once decompressed
+	compressedBytes   int64
+	uncompressedBytes int64
 }
 
 // NewKVData create a new data-path instance.
@@ -208,7 +211,7 @@ func (kvdata *KVData) runScatter(
 
 	// stats
 	statSince := time.Now()
-	var stitems [16]string
+	var stitems [18]string
 	logstats := func() {
 		snapStat := kvdata.snapStat
 		stitems[0] = `"topic":"` + kvdata.topic + `"`
@@ -227,6 +230,10 @@ func (kvdata *KVData) runScatter(
 		stitems[13] = `"ainstCount":` + strconv.Itoa(int(kvdata.ainstCount))
 		stitems[14] = `"dinstCount":` + strconv.Itoa(int(kvdata.dinstCount))
 		stitems[15] = `"tsCount":` + strconv.Itoa(int(kvdata.tsCount))
+		stitems[16] = `"compressedBytes":` +
+			strconv.Itoa(int(kvdata.compressedBytes))
+		stitems[17] = `"uncompressedBytes":` +
+			strconv.Itoa(int(kvdata.uncompressedBytes))
 		statjson := strings.Join(stitems[:], ",")
 		fmsg := "%v ##%x stats {%v}\n"
 		logging.Infof(fmsg, kvdata.logPrefix, kvdata.opaque, statjson)
@@ -246,6 +253,10 @@ loop:
 				break loop
 			}
 			kvdata.eventCount++
+			if m.Opcode == mcd.DCP_MUTATION {
+				kvdata.compressedBytes += int64(len(m.Value) + len(m.XATTRs))
+				kvdata.uncompressedBytes += int64(m.DecodedLen())
+			}
 			vbseqnos[m.VBucket], _ = kvdata.scatterMutation(m, ts)
 
 		case <-heartBeat:
@@ -343,6 +354,8 @@ loop:
 				stats.Set("addInsts", float64(kvdata.ainstCount))
 				stats.Set("delInsts", float64(kvdata.dinstCount))
 				stats.Set("tsCount", float64(kvdata.tsCount))
+				stats.Set("compressedBytes", float64(kvdata.compressedBytes))
+				stats.Set("uncompressedBytes", float64(kvdata.uncompressedBytes))
 				statVbuckets := make(map[string]interface{})
 				for _, worker := range kvdata.workers {
 					if stats, err := worker.GetStatistics(); err != nil {
@@ -513,6 +526,9 @@ func (kvdata *KVData) newStats() c.Statistics {
 		"delInsts": float64(0),   // no. of delInsts received
 		"tsCount":  float64(0),   // no. of updateTs received
 		"vbuckets": statVbuckets, // per vbucket statistics
+		// bytes of document values received, and once decompressed
+		"compressedBytes":   float64(0),
+		"uncompressedBytes": float64(0),
 	}
 	stats, _ := c.NewStatistics(m)
 	return stats
@@ -1,6 +1,7 @@
 package protobuf
 
 import "fmt"
+import "encoding/json"
 
 import "github.com/couchbase/indexing/secondary/logging"
 import c "github.com/couchbase/indexing/secondary/common"
@@ -79,12 +80,10 @@ func (instance *IndexInst) GetPartitionObject() Partition {
 		return instance.GetTp()
 	case PartitionScheme_SINGLE:
 		return instance.GetSinglePartn()
-	case PartitionScheme_KEY:
-		// return instance.GetKeyPartn()
-	case PartitionScheme_HASH:
-		// return instance.GetHashPartn()
+	case PartitionScheme_KEY, PartitionScheme_HASH:
+		return instance.GetHashPartn()
 	case PartitionScheme_RANGE:
-		// return instance.GetRangePartn()
+		return instance.GetRangePartn()
 	}
 	return nil
 }
@@ -97,6 +96,10 @@ type IndexEvaluator struct {
 	whExpr   interface{}   // compiled expression
 	instance *IndexInst
 	version  FeedVersion
+	// whether expressions refer to the document value and meta() fields,
+	// compressed values are decompressed only when required.
+	docExprs  bool
+	metaExprs bool
 }
 
 // NewIndexEvaluator returns a reference to a new instance
@@ -138,6 +141,11 @@ func NewIndexEvaluator(instance *IndexInst,
 				ie.whExpr = cExprs[0]
 			}
 		}
+		cExprs := []interface{}{ie.pkExpr, ie.whExpr}
+		if !defn.GetIsPrimary() {
+			cExprs = append(cExprs, ie.skExprs...)
+		}
+		ie.docExprs, ie.metaExprs = n1qlReferences(cExprs)
 
 	default:
 		logging.Errorf("invalid expression type %v\n", exprtype)
@@ -151,6 +159,11 @@ func (ie *IndexEvaluator) Bucket() string {
 	return ie.instance.GetDefinition().GetBucket()
 }
 
+// CollectionID implements Evaluator{} interface.
+func (ie *IndexEvaluator) CollectionID() uint32 {
+	return ie.instance.GetDefinition().GetCollectionID()
+}
+
 // StreamBeginData implement Evaluator{} interface.
 func (ie *IndexEvaluator) StreamBeginData(
 	vbno uint16, vbuuid, seqno uint64) (data interface{}) {
@@ -210,6 +223,18 @@ func (ie *IndexEvaluator) TransformRoute(
 	var newBuf []byte
 	instn := ie.instance
 
+	// collections aware feeds stream mutations from all collections of
+	// the bucket, index only sees mutations on its own collection.
+	if m.CollectionID != instn.GetDefinition().GetCollectionID() {
+		return nil, nil
+	}
+
+	if m.IsCompressed() && ie.needsValue(m) {
+		if err = m.Decompress(); err != nil {
+			return nil, err
+		}
+	}
+
 	meta := dcpEvent2Meta(m)
 	where, err := ie.wherePredicate(m.Value, meta, encodeBuf)
 	if err != nil {
@@ -251,10 +276,27 @@ func (ie *IndexEvaluator) TransformRoute(
 				dkv, ok := data[raddr].(*c.DataportKeyVersions)
 				if !ok {
 					kv := c.NewKeyVersions(seqno, m.Key, 4, m.Ctime)
-					kv.AddUpsert(uuid, nkey, okey)
+					kv.AddPartnUpsert(uuid, nkey, okey, npkey)
+					dkv = &c.DataportKeyVersions{bucket, vbno, vbuuid, kv}
+				} else {
+					dkv.Kv.AddPartnUpsert(uuid, nkey, okey, npkey)
+				}
+				data[raddr] = dkv
+			}
+			// for partitioned index, document might have moved from a
+			// partition hosted by another endpoint, sent upsertdelete
+			// to those endpoints.
+			for _, raddr := range instn.UpsertDeletionEndpoints(m, opkey, nkey, okey) {
+				if hasEndpoint(raddrs, raddr) {
+					continue
+				}
+				dkv, ok := data[raddr].(*c.DataportKeyVersions)
+				if !ok {
+					kv := c.NewKeyVersions(seqno, m.Key, 4, m.Ctime)
+					kv.AddUpsertDeletion(uuid, okey)
 					dkv = &c.DataportKeyVersions{bucket, vbno, vbuuid, kv}
 				} else {
-					dkv.Kv.AddUpsert(uuid, nkey, okey)
+					dkv.Kv.AddUpsertDeletion(uuid, okey)
 				}
 				data[raddr] = dkv
 			}
@@ -322,7 +364,7 @@ func (ie *IndexEvaluator) partitionKey(
 	exprType := defn.GetExprType()
 	switch exprType {
 	case ExprType_N1QL:
-		out, _, err := N1QLTransform(nil, doc, []interface{}{ie.whExpr}, meta, encodeBuf)
+		out, _, err := N1QLTransform(nil, doc, []interface{}{ie.pkExpr}, meta, encodeBuf)
 		return out, err
 	}
 	return nil, nil
@@ -353,9 +395,27 @@ func (ie *IndexEvaluator) wherePredicate(
 	return true, nil
 }
 
+// needsValue returns whether the document value is required to evaluate
+// this index, extended attributes are part of the compressed value.
+func (ie *IndexEvaluator) needsValue(m *mc.DcpEvent) bool {
+	if ie.docExprs {
+		return true
+	}
+	return ie.metaExprs && m.Datatype&mcd.DatatypeXATTR != 0
+}
+
 // helper functions
+func hasEndpoint(endpoints []string, endpoint string) bool {
+	for _, e := range endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
 func dcpEvent2Meta(m *mc.DcpEvent) map[string]interface{} {
-	return map[string]interface{}{
+	meta := map[string]interface{}{
 		"id":         string(m.Key),
 		"byseqno":    m.Seqno,
 		"revseqno":   m.RevSeqno,
@@ -365,4 +425,31 @@ func dcpEvent2Meta(m *mc.DcpEvent) map[string]interface{} {
 		"nru":        m.Nru,
 		"cas":        m.Cas,
 	}
+	if len(m.XATTRs) > 0 {
+		if xattrs := dcpEvent2Xattrs(m); xattrs != nil {
+			meta["xattrs"] = xattrs
+		}
+	}
+	return meta
+}
+
+// dcpEvent2Xattrs decodes the extended attributes of a document, indexed
+// as meta().xattrs.<name>, nil if they are malformed.
+func dcpEvent2Xattrs(m *mc.DcpEvent) map[string]interface{} {
+	attrs, err := mcd.ParseXATTRs(m.XATTRs)
+	if err != nil {
+		logging.Errorf("dcpEvent2Xattrs(): vb:%v seqno:%v %v", m.VBucket, m.Seqno, err)
+		return nil
+	}
+	xattrs := make(map[string]interface{}, len(attrs))
+	for key, value := range attrs {
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			fmsg := "dcpEvent2Xattrs(): vb:%v seqno:%v xattr %q: %v"
+			logging.Errorf(fmsg, m.VBucket, m.Seqno, key, err)
+			return nil
+		}
+		xattrs[key] = v
+	}
+	return xattrs
 }
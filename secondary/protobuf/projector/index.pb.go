@@ -185,6 +185,8 @@ type IndexInst struct {
 	Definition       *IndexDefn       `protobuf:"bytes,3,req,name=definition" json:"definition,omitempty"`
 	Tp               *TestPartition   `protobuf:"bytes,4,opt,name=tp" json:"tp,omitempty"`
 	SinglePartn      *SinglePartition `protobuf:"bytes,5,opt,name=singlePartn" json:"singlePartn,omitempty"`
+	HashPartn        *HashPartition   `protobuf:"bytes,7,opt,name=hashPartn" json:"hashPartn,omitempty"`
+	RangePartn       *RangePartition  `protobuf:"bytes,8,opt,name=rangePartn" json:"rangePartn,omitempty"`
 	XXX_unrecognized []byte           `json:"-"`
 }
 
@@ -227,6 +229,20 @@ func (m *IndexInst) GetSinglePartn() *SinglePartition {
 	return nil
 }
 
+func (m *IndexInst) GetHashPartn() *HashPartition {
+	if m != nil {
+		return m.HashPartn
+	}
+	return nil
+}
+
+func (m *IndexInst) GetRangePartn() *RangePartition {
+	if m != nil {
+		return m.RangePartn
+	}
+	return nil
+}
+
 // Index DDL from create index statement.
 type IndexDefn struct {
 	DefnID           *uint64          `protobuf:"varint,1,req,name=defnID" json:"defnID,omitempty"`
@@ -239,6 +255,9 @@ type IndexDefn struct {
 	PartitionScheme  *PartitionScheme `protobuf:"varint,8,opt,name=partitionScheme,enum=protobuf.PartitionScheme" json:"partitionScheme,omitempty"`
 	PartnExpression  *string          `protobuf:"bytes,9,opt,name=partnExpression" json:"partnExpression,omitempty"`
 	WhereExpression  *string          `protobuf:"bytes,10,opt,name=whereExpression" json:"whereExpression,omitempty"`
+	Scope            *string          `protobuf:"bytes,11,opt,name=scope" json:"scope,omitempty"`
+	Collection       *string          `protobuf:"bytes,12,opt,name=collection" json:"collection,omitempty"`
+	CollectionID     *uint32          `protobuf:"varint,13,opt,name=collectionID" json:"collectionID,omitempty"`
 	XXX_unrecognized []byte           `json:"-"`
 }
 
@@ -316,6 +335,27 @@ func (m *IndexDefn) GetWhereExpression() string {
 	return ""
 }
 
+func (m *IndexDefn) GetScope() string {
+	if m != nil && m.Scope != nil {
+		return *m.Scope
+	}
+	return ""
+}
+
+func (m *IndexDefn) GetCollection() string {
+	if m != nil && m.Collection != nil {
+		return *m.Collection
+	}
+	return ""
+}
+
+func (m *IndexDefn) GetCollectionID() uint32 {
+	if m != nil && m.CollectionID != nil {
+		return *m.CollectionID
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("protobuf.IndexState", IndexState_name, IndexState_value)
 	proto.RegisterEnum("protobuf.StorageType", StorageType_name, StorageType_value)
@@ -21,6 +21,33 @@ func CompileN1QLExpression(expressions []string) ([]interface{}, error) {
 	return cExprs, nil
 }
 
+// n1qlReferences returns whether compiled expressions refer to the
+// document value, and to its meta() fields.
+func n1qlReferences(cExprs []interface{}) (doc, meta bool) {
+	var walk func(expr qexpr.Expression)
+	walk = func(expr qexpr.Expression) {
+		switch expr.(type) {
+		case nil:
+			return
+		case *qexpr.Meta:
+			meta = true
+			return
+		case *qexpr.Identifier, *qexpr.Self:
+			doc = true
+			return
+		}
+		for _, child := range expr.Children() {
+			walk(child)
+		}
+	}
+	for _, cExpr := range cExprs {
+		if cExpr != nil {
+			walk(cExpr.(qexpr.Expression))
+		}
+	}
+	return doc, meta
+}
+
 var missing = qvalue.NewValue(string(collatejson.MissingLiteral))
 
 // N1QLTransform will use compiled list of expression from N1QL's DDL
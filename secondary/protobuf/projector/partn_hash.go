@@ -0,0 +1,99 @@
+package protobuf
+
+import "github.com/golang/protobuf/proto"
+import c "github.com/couchbase/indexing/secondary/common"
+import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+
+// NewHashPartition return a new partition instance, initialized with
+// one endpoint host for each partition. Partitions are spread across
+// indexer nodes, each node's instance has an empty endpoint for
+// partitions hosted by other nodes.
+func NewHashPartition(endpoints []string) *HashPartition {
+	return &HashPartition{Endpoints: endpoints}
+}
+
+// AddEndpoint add host for the next partition.
+func (p *HashPartition) AddEndpoint(endpoint string) *HashPartition {
+	p.Endpoints = append(p.Endpoints, endpoint)
+	return p
+}
+
+// SetCoordinatorEndpoint will set coordinator endpoint, that is different
+// from other endpoints.
+func (p *HashPartition) SetCoordinatorEndpoint(endpoint string) *HashPartition {
+	p.CoordEndpoint = proto.String(endpoint)
+	return p
+}
+
+// NumPartitions return the number of partitions for this instance.
+func (p *HashPartition) NumPartitions() int {
+	return len(p.GetEndpoints())
+}
+
+// Hosts implements Partition{} interface.
+func (p *HashPartition) Hosts(inst *IndexInst) []string {
+	endpoints := uniqueEndpoints(p.GetEndpoints())
+	if p.GetCoordEndpoint() != "" {
+		endpoints = append(endpoints, p.GetCoordEndpoint())
+	}
+	return endpoints
+}
+
+// UpsertEndpoints implements Partition{} interface.
+// - sent only if where clause is true.
+// - sent only to the endpoint hosting the partition for `partKey`,
+//   missing partition key is hashed like an empty key.
+// - for now, `oldKey` is ignored.
+func (p *HashPartition) UpsertEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, partKey, key, oldKey []byte) []string {
+
+	endpoints := p.GetEndpoints()
+	if len(endpoints) == 0 {
+		return nil
+	}
+	partnId := c.HashPartitionId(partKey, len(endpoints))
+	if endpoints[partnId] == "" {
+		return nil
+	}
+	return []string{endpoints[partnId]}
+}
+
+// UpsertDeletionEndpoints implements Partition{} interface.
+// - old partition key is not known unless old document is available,
+//   hence broadcast to all endpoints.
+func (p *HashPartition) UpsertDeletionEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, oldPartKey, key, oldKey []byte) []string {
+
+	return p.DeletionEndpoints(inst, m, oldPartKey, oldKey)
+}
+
+// DeletionEndpoints implements Partition{} interface.
+// - not sent to coordinator-endpoint
+// - if `oldPartKey` is available, sent only to the endpoint hosting
+//   its partition, otherwise broadcast to all endpoints.
+func (p *HashPartition) DeletionEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, oldPartKey, oldKey []byte) []string {
+
+	endpoints := p.GetEndpoints()
+	if len(oldPartKey) > 0 && len(endpoints) > 0 {
+		partnId := c.HashPartitionId(oldPartKey, len(endpoints))
+		if endpoints[partnId] == "" {
+			return nil
+		}
+		return []string{endpoints[partnId]}
+	}
+	return uniqueEndpoints(p.GetEndpoints())
+}
+
+// uniqueEndpoints returns endpoints with duplicates removed, a single
+// endpoint may host more than one partition. Empty endpoints, of
+// partitions not hosted by the instance, are skipped.
+func uniqueEndpoints(endpoints []string) []string {
+	unique := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint != "" && !hasEndpoint(unique, endpoint) {
+			unique = append(unique, endpoint)
+		}
+	}
+	return unique
+}
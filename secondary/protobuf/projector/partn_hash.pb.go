@@ -0,0 +1,42 @@
+// Code generated by protoc-gen-go.
+// source: partn_hash.proto
+// DO NOT EDIT!
+
+package protobuf
+
+import proto "github.com/golang/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+// HashPartition distributes index entries across partitions by hashing
+// the partition key. endpoints[i] is the address of the indexer hosting
+// partition `i`, same endpoint may host more than one partition.
+type HashPartition struct {
+	Endpoints        []string `protobuf:"bytes,1,rep,name=endpoints" json:"endpoints,omitempty"`
+	CoordEndpoint    *string  `protobuf:"bytes,2,opt,name=coordEndpoint" json:"coordEndpoint,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *HashPartition) Reset()         { *m = HashPartition{} }
+func (m *HashPartition) String() string { return proto.CompactTextString(m) }
+func (*HashPartition) ProtoMessage()    {}
+
+func (m *HashPartition) GetEndpoints() []string {
+	if m != nil {
+		return m.Endpoints
+	}
+	return nil
+}
+
+func (m *HashPartition) GetCoordEndpoint() string {
+	if m != nil && m.CoordEndpoint != nil {
+		return *m.CoordEndpoint
+	}
+	return ""
+}
+
+func init() {
+}
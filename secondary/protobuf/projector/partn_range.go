@@ -0,0 +1,78 @@
+package protobuf
+
+import "github.com/golang/protobuf/proto"
+import c "github.com/couchbase/indexing/secondary/common"
+import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+
+// NewRangePartition return a new partition instance, initialized with
+// one endpoint host for each partition and the split keys separating
+// adjacent partitions.
+func NewRangePartition(endpoints []string, splitKeys [][]byte) *RangePartition {
+	return &RangePartition{Endpoints: endpoints, SplitKeys: splitKeys}
+}
+
+// SetCoordinatorEndpoint will set coordinator endpoint, that is different
+// from other endpoints.
+func (p *RangePartition) SetCoordinatorEndpoint(endpoint string) *RangePartition {
+	p.CoordEndpoint = proto.String(endpoint)
+	return p
+}
+
+// NumPartitions return the number of partitions for this instance.
+func (p *RangePartition) NumPartitions() int {
+	return len(p.GetEndpoints())
+}
+
+// Hosts implements Partition{} interface.
+func (p *RangePartition) Hosts(inst *IndexInst) []string {
+	endpoints := uniqueEndpoints(p.GetEndpoints())
+	if p.GetCoordEndpoint() != "" {
+		endpoints = append(endpoints, p.GetCoordEndpoint())
+	}
+	return endpoints
+}
+
+// UpsertEndpoints implements Partition{} interface.
+// - sent only if where clause is true.
+// - sent only to the endpoint hosting the partition whose range covers
+//   `partKey`, located by binary search on split keys.
+func (p *RangePartition) UpsertEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, partKey, key, oldKey []byte) []string {
+
+	if endpoint, ok := p.endpoint(partKey); ok {
+		return []string{endpoint}
+	}
+	return nil
+}
+
+// UpsertDeletionEndpoints implements Partition{} interface.
+func (p *RangePartition) UpsertDeletionEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, oldPartKey, key, oldKey []byte) []string {
+
+	return p.DeletionEndpoints(inst, m, oldPartKey, oldKey)
+}
+
+// DeletionEndpoints implements Partition{} interface.
+// - not sent to coordinator-endpoint
+// - if `oldPartKey` is available, sent only to the endpoint hosting
+//   its partition, otherwise broadcast to all endpoints.
+func (p *RangePartition) DeletionEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, oldPartKey, oldKey []byte) []string {
+
+	if len(oldPartKey) > 0 {
+		if endpoint, ok := p.endpoint(oldPartKey); ok {
+			return []string{endpoint}
+		}
+		return nil
+	}
+	return uniqueEndpoints(p.GetEndpoints())
+}
+
+func (p *RangePartition) endpoint(partKey []byte) (string, bool) {
+	endpoints := p.GetEndpoints()
+	partnId := int(c.RangePartitionId(partKey, p.GetSplitKeys()))
+	if partnId >= len(endpoints) || endpoints[partnId] == "" {
+		return "", false
+	}
+	return endpoints[partnId], true
+}
@@ -0,0 +1,52 @@
+// Code generated by protoc-gen-go.
+// source: partn_range.proto
+// DO NOT EDIT!
+
+package protobuf
+
+import proto "github.com/golang/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+// RangePartition distributes index entries across partitions by the
+// range of partition key values. splitKeys are collatejson encoded
+// partition key values in ascending order, partition `i` holds keys in
+// [splitKeys[i-1], splitKeys[i]) and endpoints[i] is the address of the
+// indexer hosting partition `i`.
+type RangePartition struct {
+	Endpoints        []string `protobuf:"bytes,1,rep,name=endpoints" json:"endpoints,omitempty"`
+	SplitKeys        [][]byte `protobuf:"bytes,2,rep,name=splitKeys" json:"splitKeys,omitempty"`
+	CoordEndpoint    *string  `protobuf:"bytes,3,opt,name=coordEndpoint" json:"coordEndpoint,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *RangePartition) Reset()         { *m = RangePartition{} }
+func (m *RangePartition) String() string { return proto.CompactTextString(m) }
+func (*RangePartition) ProtoMessage()    {}
+
+func (m *RangePartition) GetEndpoints() []string {
+	if m != nil {
+		return m.Endpoints
+	}
+	return nil
+}
+
+func (m *RangePartition) GetSplitKeys() [][]byte {
+	if m != nil {
+		return m.SplitKeys
+	}
+	return nil
+}
+
+func (m *RangePartition) GetCoordEndpoint() string {
+	if m != nil && m.CoordEndpoint != nil {
+		return *m.CoordEndpoint
+	}
+	return ""
+}
+
+func init() {
+}
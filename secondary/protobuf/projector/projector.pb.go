@@ -175,9 +175,11 @@ type MutationTopicRequest struct {
 	EndpointType  *string     `protobuf:"bytes,2,req,name=endpointType" json:"endpointType,omitempty"`
 	ReqTimestamps []*TsVbuuid `protobuf:"bytes,3,rep,name=reqTimestamps" json:"reqTimestamps,omitempty"`
 	// initial list of instances applicable for this topic
-	Instances        []*Instance  `protobuf:"bytes,4,rep,name=instances" json:"instances,omitempty"`
-	Version          *FeedVersion `protobuf:"varint,5,opt,name=version,enum=protobuf.FeedVersion,def=1" json:"version,omitempty"`
-	XXX_unrecognized []byte       `json:"-"`
+	Instances []*Instance  `protobuf:"bytes,4,rep,name=instances" json:"instances,omitempty"`
+	Version   *FeedVersion `protobuf:"varint,5,opt,name=version,enum=protobuf.FeedVersion,def=1" json:"version,omitempty"`
+	// stream only the collections of instances applicable for this topic.
+	FilterCollections *bool  `protobuf:"varint,6,opt,name=filterCollections" json:"filterCollections,omitempty"`
+	XXX_unrecognized  []byte `json:"-"`
 }
 
 func (m *MutationTopicRequest) Reset()         { *m = MutationTopicRequest{} }
@@ -221,6 +223,13 @@ func (m *MutationTopicRequest) GetVersion() FeedVersion {
 	return Default_MutationTopicRequest_Version
 }
 
+func (m *MutationTopicRequest) GetFilterCollections() bool {
+	if m != nil && m.FilterCollections != nil {
+		return *m.FilterCollections
+	}
+	return false
+}
+
 // Response back for
 // MutationTopicRequest, RestartVbucketsRequest, AddBucketsRequest
 type TopicResponse struct {
@@ -11,6 +11,8 @@ const (
 	DataOffset int = FlagOffset + FlagSize
 )
 
+// EncodeAndWrite encodes `r` and sends it on `conn`, compressed if
+// `conn` negotiated compression.
 func EncodeAndWrite(conn net.Conn, buf []byte, r interface{}) (err error) {
 	var data []byte
 	data, err = ProtobufEncodeInBuf(r, buf[transport.MaxSendBufSize:][:0])
@@ -18,6 +20,10 @@ func EncodeAndWrite(conn net.Conn, buf []byte, r interface{}) (err error) {
 		return
 	}
 	flags := transport.TransportFlag(0).SetProtobuf()
+	flags = flags.SetCompression(transport.ConnCompression(conn))
+	if data, err = transport.Compress(flags, data); err != nil {
+		return
+	}
 	err = transport.Send(conn, buf, flags, data)
 	return
 }
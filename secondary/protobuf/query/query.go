@@ -3,17 +3,35 @@ package protobuf
 import "errors"
 import "encoding/json"
 
+import "github.com/couchbase/indexing/secondary/collatejson"
 import c "github.com/couchbase/indexing/secondary/common"
 import "github.com/golang/protobuf/proto"
 
+var codec = collatejson.NewCodec(16)
+
+// ErrorEntryKey is returned for collated entry key that is not an array.
+var ErrorEntryKey = errors.New("queryport.entryKey")
+
 // GetEntries implements queryport.client.ResponseReader{} method.
 func (r *ResponseStream) GetEntries() ([]c.SecondaryKey, [][]byte, error) {
 	entries := r.GetIndexEntries()
 	skeys := make([]c.SecondaryKey, 0, len(entries))
 	pkeys := make([][]byte, 0, len(entries))
+	collated := r.GetCollatedKeys()
 	for _, entry := range entries {
 		secKeyData := entry.GetEntryKey()
-		if len(secKeyData) > 0 {
+		if len(secKeyData) > 0 && collated {
+			// decoded straight into values, without JSON round trip.
+			val, err := codec.DecodeValue(secKeyData)
+			if err != nil {
+				return nil, nil, err
+			}
+			skey, ok := val.([]interface{})
+			if !ok {
+				return nil, nil, ErrorEntryKey
+			}
+			skeys = append(skeys, c.SecondaryKey(skey))
+		} else if len(secKeyData) > 0 {
 			skey := make(c.SecondaryKey, 0)
 			if err := json.Unmarshal(entry.GetEntryKey(), &skey); err != nil {
 				return nil, nil, err
@@ -82,7 +100,15 @@ func (s *IndexStatistics) DistinctCount() (int64, error) {
 
 // Bins implements common.IndexStatistics{} method.
 func (s *IndexStatistics) Bins() ([]c.IndexStatistics, error) {
-	return nil, nil
+	histogram := s.GetHistogram()
+	if len(histogram) == 0 {
+		return nil, nil
+	}
+	bins := make([]c.IndexStatistics, 0, len(histogram))
+	for _, bin := range histogram {
+		bins = append(bins, bin)
+	}
+	return bins, nil
 }
 
 func NewTsConsistency(
@@ -21,6 +21,7 @@ It has these top-level messages:
 	EndStreamRequest
 	ResponseStream
 	StreamEndResponse
+	ScanTrace
 	CountRequest
 	CountResponse
 	Span
@@ -28,6 +29,9 @@ It has these top-level messages:
 	CompositeElementFilter
 	Scan
 	IndexProjection
+	GroupKey
+	Aggregate
+	GroupAggr
 	IndexEntry
 	IndexStatistics
 */
@@ -40,6 +44,84 @@ import math "math"
 var _ = proto.Marshal
 var _ = math.Inf
 
+// Priority class of a scan waiting for admission by the indexer, higher
+// priority scans are admitted first.
+type ScanPriority int32
+
+const (
+	ScanPriority_PRIORITY_NORMAL ScanPriority = 0
+	ScanPriority_PRIORITY_HIGH   ScanPriority = 1
+	ScanPriority_PRIORITY_LOW    ScanPriority = 2
+)
+
+var ScanPriority_name = map[int32]string{
+	0: "PRIORITY_NORMAL",
+	1: "PRIORITY_HIGH",
+	2: "PRIORITY_LOW",
+}
+var ScanPriority_value = map[string]int32{
+	"PRIORITY_NORMAL": 0,
+	"PRIORITY_HIGH":   1,
+	"PRIORITY_LOW":    2,
+}
+
+func (x ScanPriority) Enum() *ScanPriority {
+	p := new(ScanPriority)
+	*p = x
+	return p
+}
+func (x ScanPriority) String() string {
+	return proto.EnumName(ScanPriority_name, int32(x))
+}
+func (x *ScanPriority) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(ScanPriority_value, data, "ScanPriority")
+	if err != nil {
+		return err
+	}
+	*x = ScanPriority(value)
+	return nil
+}
+
+// Aggregate functions evaluated by indexer.
+type AggrFuncType int32
+
+const (
+	AggrFuncType_AGG_MIN   AggrFuncType = 0
+	AggrFuncType_AGG_MAX   AggrFuncType = 1
+	AggrFuncType_AGG_SUM   AggrFuncType = 2
+	AggrFuncType_AGG_COUNT AggrFuncType = 3
+)
+
+var AggrFuncType_name = map[int32]string{
+	0: "AGG_MIN",
+	1: "AGG_MAX",
+	2: "AGG_SUM",
+	3: "AGG_COUNT",
+}
+var AggrFuncType_value = map[string]int32{
+	"AGG_MIN":   0,
+	"AGG_MAX":   1,
+	"AGG_SUM":   2,
+	"AGG_COUNT": 3,
+}
+
+func (x AggrFuncType) Enum() *AggrFuncType {
+	p := new(AggrFuncType)
+	*p = x
+	return p
+}
+func (x AggrFuncType) String() string {
+	return proto.EnumName(AggrFuncType_name, int32(x))
+}
+func (x *AggrFuncType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(AggrFuncType_value, data, "AggrFuncType")
+	if err != nil {
+		return err
+	}
+	*x = AggrFuncType(value)
+	return nil
+}
+
 // Error message can be sent back as response or
 // encapsulated in response packets.
 type Error struct {
@@ -225,8 +307,9 @@ func (m *HeloRequest) GetVersion() uint32 {
 }
 
 type HeloResponse struct {
-	Version          *uint32 `protobuf:"varint,1,req,name=version" json:"version,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Version          *uint32      `protobuf:"varint,1,req,name=version" json:"version,omitempty"`
+	Load             *IndexerLoad `protobuf:"bytes,2,opt,name=load" json:"load,omitempty"`
+	XXX_unrecognized []byte       `json:"-"`
 }
 
 func (m *HeloResponse) Reset()         { *m = HeloResponse{} }
@@ -240,12 +323,22 @@ func (m *HeloResponse) GetVersion() uint32 {
 	return 0
 }
 
+func (m *HeloResponse) GetLoad() *IndexerLoad {
+	if m != nil {
+		return m.Load
+	}
+	return nil
+}
+
 // Get Index statistics. StatisticsResponse is returned back from indexer.
 type StatisticsRequest struct {
-	DefnID           *uint64 `protobuf:"varint,1,req,name=defnID" json:"defnID,omitempty"`
-	Span             *Span   `protobuf:"bytes,2,req,name=span" json:"span,omitempty"`
-	RequestId        *string `protobuf:"bytes,3,opt,name=requestId" json:"requestId,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	DefnID           *uint64        `protobuf:"varint,1,req,name=defnID" json:"defnID,omitempty"`
+	Span             *Span          `protobuf:"bytes,2,req,name=span" json:"span,omitempty"`
+	RequestId        *string        `protobuf:"bytes,3,opt,name=requestId" json:"requestId,omitempty"`
+	Cons             *uint32        `protobuf:"varint,4,opt,name=cons" json:"cons,omitempty"`
+	Vector           *TsConsistency `protobuf:"bytes,5,opt,name=vector" json:"vector,omitempty"`
+	PartitionIds     []uint64       `protobuf:"varint,6,rep,name=partitionIds" json:"partitionIds,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
 }
 
 func (m *StatisticsRequest) Reset()         { *m = StatisticsRequest{} }
@@ -273,6 +366,27 @@ func (m *StatisticsRequest) GetRequestId() string {
 	return ""
 }
 
+func (m *StatisticsRequest) GetCons() uint32 {
+	if m != nil && m.Cons != nil {
+		return *m.Cons
+	}
+	return 0
+}
+
+func (m *StatisticsRequest) GetVector() *TsConsistency {
+	if m != nil {
+		return m.Vector
+	}
+	return nil
+}
+
+func (m *StatisticsRequest) GetPartitionIds() []uint64 {
+	if m != nil {
+		return m.PartitionIds
+	}
+	return nil
+}
+
 type StatisticsResponse struct {
 	Stats            *IndexStatistics `protobuf:"bytes,1,req,name=stats" json:"stats,omitempty"`
 	Err              *Error           `protobuf:"bytes,2,opt,name=err" json:"err,omitempty"`
@@ -310,6 +424,14 @@ type ScanRequest struct {
 	Indexprojection  *IndexProjection `protobuf:"bytes,9,opt,name=indexprojection" json:"indexprojection,omitempty"`
 	Reverse          *bool            `protobuf:"varint,10,opt,name=reverse" json:"reverse,omitempty"`
 	Offset           *int64           `protobuf:"varint,11,opt,name=offset" json:"offset,omitempty"`
+	PartitionIds     []uint64         `protobuf:"varint,12,rep,name=partitionIds" json:"partitionIds,omitempty"`
+	GroupAggr        *GroupAggr       `protobuf:"bytes,13,opt,name=groupAggr" json:"groupAggr,omitempty"`
+	Trace            *bool            `protobuf:"varint,14,opt,name=trace" json:"trace,omitempty"`
+	Priority         *ScanPriority    `protobuf:"varint,15,opt,name=priority,enum=protobuf.ScanPriority" json:"priority,omitempty"`
+	ReportLoad       *bool            `protobuf:"varint,16,opt,name=reportLoad" json:"reportLoad,omitempty"`
+	ResumeFrom       []byte           `protobuf:"bytes,17,opt,name=resumeFrom" json:"resumeFrom,omitempty"`
+	Continuations    *bool            `protobuf:"varint,18,opt,name=continuations" json:"continuations,omitempty"`
+	CollatedKeys     *bool            `protobuf:"varint,19,opt,name=collatedKeys" json:"collatedKeys,omitempty"`
 	XXX_unrecognized []byte           `json:"-"`
 }
 
@@ -394,6 +516,62 @@ func (m *ScanRequest) GetOffset() int64 {
 	return 0
 }
 
+func (m *ScanRequest) GetPartitionIds() []uint64 {
+	if m != nil {
+		return m.PartitionIds
+	}
+	return nil
+}
+
+func (m *ScanRequest) GetGroupAggr() *GroupAggr {
+	if m != nil {
+		return m.GroupAggr
+	}
+	return nil
+}
+
+func (m *ScanRequest) GetTrace() bool {
+	if m != nil && m.Trace != nil {
+		return *m.Trace
+	}
+	return false
+}
+
+func (m *ScanRequest) GetPriority() ScanPriority {
+	if m != nil && m.Priority != nil {
+		return *m.Priority
+	}
+	return ScanPriority_PRIORITY_NORMAL
+}
+
+func (m *ScanRequest) GetReportLoad() bool {
+	if m != nil && m.ReportLoad != nil {
+		return *m.ReportLoad
+	}
+	return false
+}
+
+func (m *ScanRequest) GetResumeFrom() []byte {
+	if m != nil {
+		return m.ResumeFrom
+	}
+	return nil
+}
+
+func (m *ScanRequest) GetContinuations() bool {
+	if m != nil && m.Continuations != nil {
+		return *m.Continuations
+	}
+	return false
+}
+
+func (m *ScanRequest) GetCollatedKeys() bool {
+	if m != nil && m.CollatedKeys != nil {
+		return *m.CollatedKeys
+	}
+	return false
+}
+
 // Full table scan request from indexer.
 type ScanAllRequest struct {
 	DefnID           *uint64        `protobuf:"varint,1,req,name=defnID" json:"defnID,omitempty"`
@@ -401,6 +579,11 @@ type ScanAllRequest struct {
 	Cons             *uint32        `protobuf:"varint,3,req,name=cons" json:"cons,omitempty"`
 	Vector           *TsConsistency `protobuf:"bytes,4,opt,name=vector" json:"vector,omitempty"`
 	RequestId        *string        `protobuf:"bytes,5,opt,name=requestId" json:"requestId,omitempty"`
+	PartitionIds     []uint64       `protobuf:"varint,6,rep,name=partitionIds" json:"partitionIds,omitempty"`
+	Trace            *bool          `protobuf:"varint,7,opt,name=trace" json:"trace,omitempty"`
+	Priority         *ScanPriority  `protobuf:"varint,8,opt,name=priority,enum=protobuf.ScanPriority" json:"priority,omitempty"`
+	ReportLoad       *bool          `protobuf:"varint,9,opt,name=reportLoad" json:"reportLoad,omitempty"`
+	CollatedKeys     *bool          `protobuf:"varint,10,opt,name=collatedKeys" json:"collatedKeys,omitempty"`
 	XXX_unrecognized []byte         `json:"-"`
 }
 
@@ -443,6 +626,41 @@ func (m *ScanAllRequest) GetRequestId() string {
 	return ""
 }
 
+func (m *ScanAllRequest) GetPartitionIds() []uint64 {
+	if m != nil {
+		return m.PartitionIds
+	}
+	return nil
+}
+
+func (m *ScanAllRequest) GetTrace() bool {
+	if m != nil && m.Trace != nil {
+		return *m.Trace
+	}
+	return false
+}
+
+func (m *ScanAllRequest) GetPriority() ScanPriority {
+	if m != nil && m.Priority != nil {
+		return *m.Priority
+	}
+	return ScanPriority_PRIORITY_NORMAL
+}
+
+func (m *ScanAllRequest) GetReportLoad() bool {
+	if m != nil && m.ReportLoad != nil {
+		return *m.ReportLoad
+	}
+	return false
+}
+
+func (m *ScanAllRequest) GetCollatedKeys() bool {
+	if m != nil && m.CollatedKeys != nil {
+		return *m.CollatedKeys
+	}
+	return false
+}
+
 // Request by client to stop streaming the query results.
 type EndStreamRequest struct {
 	XXX_unrecognized []byte `json:"-"`
@@ -455,6 +673,8 @@ func (*EndStreamRequest) ProtoMessage()    {}
 type ResponseStream struct {
 	IndexEntries     []*IndexEntry `protobuf:"bytes,1,rep,name=indexEntries" json:"indexEntries,omitempty"`
 	Err              *Error        `protobuf:"bytes,2,opt,name=err" json:"err,omitempty"`
+	Continuation     []byte        `protobuf:"bytes,3,opt,name=continuation" json:"continuation,omitempty"`
+	CollatedKeys     *bool         `protobuf:"varint,4,opt,name=collatedKeys" json:"collatedKeys,omitempty"`
 	XXX_unrecognized []byte        `json:"-"`
 }
 
@@ -476,10 +696,27 @@ func (m *ResponseStream) GetErr() *Error {
 	return nil
 }
 
+func (m *ResponseStream) GetContinuation() []byte {
+	if m != nil {
+		return m.Continuation
+	}
+	return nil
+}
+
+func (m *ResponseStream) GetCollatedKeys() bool {
+	if m != nil && m.CollatedKeys != nil {
+		return *m.CollatedKeys
+	}
+	return false
+}
+
 // Last response packet sent by server to end query results.
 type StreamEndResponse struct {
-	Err              *Error `protobuf:"bytes,1,opt,name=err" json:"err,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	Err              *Error         `protobuf:"bytes,1,opt,name=err" json:"err,omitempty"`
+	Trace            *ScanTrace     `protobuf:"bytes,2,opt,name=trace" json:"trace,omitempty"`
+	Load             *IndexerLoad   `protobuf:"bytes,3,opt,name=load" json:"load,omitempty"`
+	Staleness        *ScanStaleness `protobuf:"bytes,4,opt,name=staleness" json:"staleness,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
 }
 
 func (m *StreamEndResponse) Reset()         { *m = StreamEndResponse{} }
@@ -493,6 +730,265 @@ func (m *StreamEndResponse) GetErr() *Error {
 	return nil
 }
 
+func (m *StreamEndResponse) GetTrace() *ScanTrace {
+	if m != nil {
+		return m.Trace
+	}
+	return nil
+}
+
+func (m *StreamEndResponse) GetLoad() *IndexerLoad {
+	if m != nil {
+		return m.Load
+	}
+	return nil
+}
+
+func (m *StreamEndResponse) GetStaleness() *ScanStaleness {
+	if m != nil {
+		return m.Staleness
+	}
+	return nil
+}
+
+// Lag of the snapshot scanned with BestEffortConsistency behind the
+// requested timestamp.
+type ScanStaleness struct {
+	Vbnos            []uint32 `protobuf:"varint,1,rep,name=vbnos" json:"vbnos,omitempty"`
+	Seqnos           []uint64 `protobuf:"varint,2,rep,name=seqnos" json:"seqnos,omitempty"`
+	Requested        []uint64 `protobuf:"varint,3,rep,name=requested" json:"requested,omitempty"`
+	Behind           *uint64  `protobuf:"varint,4,opt,name=behind" json:"behind,omitempty"`
+	EstimatedLag     *int64   `protobuf:"varint,5,opt,name=estimatedLag" json:"estimatedLag,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *ScanStaleness) Reset()         { *m = ScanStaleness{} }
+func (m *ScanStaleness) String() string { return proto.CompactTextString(m) }
+func (*ScanStaleness) ProtoMessage()    {}
+
+func (m *ScanStaleness) GetVbnos() []uint32 {
+	if m != nil {
+		return m.Vbnos
+	}
+	return nil
+}
+
+func (m *ScanStaleness) GetSeqnos() []uint64 {
+	if m != nil {
+		return m.Seqnos
+	}
+	return nil
+}
+
+func (m *ScanStaleness) GetRequested() []uint64 {
+	if m != nil {
+		return m.Requested
+	}
+	return nil
+}
+
+func (m *ScanStaleness) GetBehind() uint64 {
+	if m != nil && m.Behind != nil {
+		return *m.Behind
+	}
+	return 0
+}
+
+func (m *ScanStaleness) GetEstimatedLag() int64 {
+	if m != nil && m.EstimatedLag != nil {
+		return *m.EstimatedLag
+	}
+	return 0
+}
+
+// Stage timings of a traced scan request, durations are in nanoseconds.
+type ScanTrace struct {
+	RequestId        *string `protobuf:"bytes,1,opt,name=requestId" json:"requestId,omitempty"`
+	SnapshotWait     *int64  `protobuf:"varint,2,opt,name=snapshotWait" json:"snapshotWait,omitempty"`
+	Storage          *int64  `protobuf:"varint,3,opt,name=storage" json:"storage,omitempty"`
+	Filter           *int64  `protobuf:"varint,4,opt,name=filter" json:"filter,omitempty"`
+	Decode           *int64  `protobuf:"varint,5,opt,name=decode" json:"decode,omitempty"`
+	Write            *int64  `protobuf:"varint,6,opt,name=write" json:"write,omitempty"`
+	RowsScanned      *uint64 `protobuf:"varint,7,opt,name=rowsScanned" json:"rowsScanned,omitempty"`
+	RowsReturned     *uint64 `protobuf:"varint,8,opt,name=rowsReturned" json:"rowsReturned,omitempty"`
+	BytesWritten     *uint64 `protobuf:"varint,9,opt,name=bytesWritten" json:"bytesWritten,omitempty"`
+	Total            *int64  `protobuf:"varint,10,opt,name=total" json:"total,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *ScanTrace) Reset()         { *m = ScanTrace{} }
+func (m *ScanTrace) String() string { return proto.CompactTextString(m) }
+func (*ScanTrace) ProtoMessage()    {}
+
+func (m *ScanTrace) GetRequestId() string {
+	if m != nil && m.RequestId != nil {
+		return *m.RequestId
+	}
+	return ""
+}
+
+func (m *ScanTrace) GetSnapshotWait() int64 {
+	if m != nil && m.SnapshotWait != nil {
+		return *m.SnapshotWait
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetStorage() int64 {
+	if m != nil && m.Storage != nil {
+		return *m.Storage
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetFilter() int64 {
+	if m != nil && m.Filter != nil {
+		return *m.Filter
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetDecode() int64 {
+	if m != nil && m.Decode != nil {
+		return *m.Decode
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetWrite() int64 {
+	if m != nil && m.Write != nil {
+		return *m.Write
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetRowsScanned() uint64 {
+	if m != nil && m.RowsScanned != nil {
+		return *m.RowsScanned
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetRowsReturned() uint64 {
+	if m != nil && m.RowsReturned != nil {
+		return *m.RowsReturned
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetBytesWritten() uint64 {
+	if m != nil && m.BytesWritten != nil {
+		return *m.BytesWritten
+	}
+	return 0
+}
+
+func (m *ScanTrace) GetTotal() int64 {
+	if m != nil && m.Total != nil {
+		return *m.Total
+	}
+	return 0
+}
+
+// Position of a scan after the last row it returned, encoded in the
+// continuation token of ResponseStream.
+type ScanContinuation struct {
+	ScanIndex        *uint32        `protobuf:"varint,1,opt,name=scanIndex" json:"scanIndex,omitempty"`
+	Entry            []byte         `protobuf:"bytes,2,opt,name=entry" json:"entry,omitempty"`
+	Duplicate        *uint32        `protobuf:"varint,3,opt,name=duplicate" json:"duplicate,omitempty"`
+	Rows             *uint64        `protobuf:"varint,4,opt,name=rows" json:"rows,omitempty"`
+	Snapshot         *TsConsistency `protobuf:"bytes,5,opt,name=snapshot" json:"snapshot,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
+}
+
+func (m *ScanContinuation) Reset()         { *m = ScanContinuation{} }
+func (m *ScanContinuation) String() string { return proto.CompactTextString(m) }
+func (*ScanContinuation) ProtoMessage()    {}
+
+func (m *ScanContinuation) GetScanIndex() uint32 {
+	if m != nil && m.ScanIndex != nil {
+		return *m.ScanIndex
+	}
+	return 0
+}
+
+func (m *ScanContinuation) GetEntry() []byte {
+	if m != nil {
+		return m.Entry
+	}
+	return nil
+}
+
+func (m *ScanContinuation) GetDuplicate() uint32 {
+	if m != nil && m.Duplicate != nil {
+		return *m.Duplicate
+	}
+	return 0
+}
+
+func (m *ScanContinuation) GetRows() uint64 {
+	if m != nil && m.Rows != nil {
+		return *m.Rows
+	}
+	return 0
+}
+
+func (m *ScanContinuation) GetSnapshot() *TsConsistency {
+	if m != nil {
+		return m.Snapshot
+	}
+	return nil
+}
+
+// Load of an indexer, used by clients to pick the replica to scan.
+type IndexerLoad struct {
+	ScansRunning     *uint64  `protobuf:"varint,1,opt,name=scansRunning" json:"scansRunning,omitempty"`
+	ScansQueued      *uint64  `protobuf:"varint,2,opt,name=scansQueued" json:"scansQueued,omitempty"`
+	SnapshotWaiters  *uint64  `protobuf:"varint,3,opt,name=snapshotWaiters" json:"snapshotWaiters,omitempty"`
+	CpuUtilization   *float64 `protobuf:"fixed64,4,opt,name=cpuUtilization" json:"cpuUtilization,omitempty"`
+	MemoryPressure   *float64 `protobuf:"fixed64,5,opt,name=memoryPressure" json:"memoryPressure,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *IndexerLoad) Reset()         { *m = IndexerLoad{} }
+func (m *IndexerLoad) String() string { return proto.CompactTextString(m) }
+func (*IndexerLoad) ProtoMessage()    {}
+
+func (m *IndexerLoad) GetScansRunning() uint64 {
+	if m != nil && m.ScansRunning != nil {
+		return *m.ScansRunning
+	}
+	return 0
+}
+
+func (m *IndexerLoad) GetScansQueued() uint64 {
+	if m != nil && m.ScansQueued != nil {
+		return *m.ScansQueued
+	}
+	return 0
+}
+
+func (m *IndexerLoad) GetSnapshotWaiters() uint64 {
+	if m != nil && m.SnapshotWaiters != nil {
+		return *m.SnapshotWaiters
+	}
+	return 0
+}
+
+func (m *IndexerLoad) GetCpuUtilization() float64 {
+	if m != nil && m.CpuUtilization != nil {
+		return *m.CpuUtilization
+	}
+	return 0
+}
+
+func (m *IndexerLoad) GetMemoryPressure() float64 {
+	if m != nil && m.MemoryPressure != nil {
+		return *m.MemoryPressure
+	}
+	return 0
+}
+
 // Count request to indexer.
 type CountRequest struct {
 	DefnID           *uint64        `protobuf:"varint,1,req,name=defnID" json:"defnID,omitempty"`
@@ -502,6 +998,8 @@ type CountRequest struct {
 	RequestId        *string        `protobuf:"bytes,5,opt,name=requestId" json:"requestId,omitempty"`
 	Distinct         *bool          `protobuf:"varint,6,opt,name=distinct" json:"distinct,omitempty"`
 	Scans            []*Scan        `protobuf:"bytes,7,rep,name=scans" json:"scans,omitempty"`
+	Priority         *ScanPriority  `protobuf:"varint,8,opt,name=priority,enum=protobuf.ScanPriority" json:"priority,omitempty"`
+	PartitionIds     []uint64       `protobuf:"varint,9,rep,name=partitionIds" json:"partitionIds,omitempty"`
 	XXX_unrecognized []byte         `json:"-"`
 }
 
@@ -558,6 +1056,20 @@ func (m *CountRequest) GetScans() []*Scan {
 	return nil
 }
 
+func (m *CountRequest) GetPriority() ScanPriority {
+	if m != nil && m.Priority != nil {
+		return *m.Priority
+	}
+	return ScanPriority_PRIORITY_NORMAL
+}
+
+func (m *CountRequest) GetPartitionIds() []uint64 {
+	if m != nil {
+		return m.PartitionIds
+	}
+	return nil
+}
+
 // total number of entries in index.
 type CountResponse struct {
 	Count            *int64 `protobuf:"varint,1,req,name=count" json:"count,omitempty"`
@@ -719,6 +1231,80 @@ func (m *IndexProjection) GetPrimaryKey() bool {
 	return false
 }
 
+type GroupKey struct {
+	KeyPos           *int32 `protobuf:"varint,1,req,name=keyPos" json:"keyPos,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *GroupKey) Reset()         { *m = GroupKey{} }
+func (m *GroupKey) String() string { return proto.CompactTextString(m) }
+func (*GroupKey) ProtoMessage()    {}
+
+func (m *GroupKey) GetKeyPos() int32 {
+	if m != nil && m.KeyPos != nil {
+		return *m.KeyPos
+	}
+	return 0
+}
+
+type Aggregate struct {
+	AggrFunc         *AggrFuncType `protobuf:"varint,1,req,name=aggrFunc,enum=protobuf.AggrFuncType" json:"aggrFunc,omitempty"`
+	KeyPos           *int32        `protobuf:"varint,2,req,name=keyPos" json:"keyPos,omitempty"`
+	Distinct         *bool         `protobuf:"varint,3,opt,name=distinct" json:"distinct,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *Aggregate) Reset()         { *m = Aggregate{} }
+func (m *Aggregate) String() string { return proto.CompactTextString(m) }
+func (*Aggregate) ProtoMessage()    {}
+
+func (m *Aggregate) GetAggrFunc() AggrFuncType {
+	if m != nil && m.AggrFunc != nil {
+		return *m.AggrFunc
+	}
+	return AggrFuncType_AGG_MIN
+}
+
+func (m *Aggregate) GetKeyPos() int32 {
+	if m != nil && m.KeyPos != nil {
+		return *m.KeyPos
+	}
+	return 0
+}
+
+func (m *Aggregate) GetDistinct() bool {
+	if m != nil && m.Distinct != nil {
+		return *m.Distinct
+	}
+	return false
+}
+
+// GROUP BY and aggregates evaluated while scanning, each result row is
+// returned as entryKey, an array of group keys followed by aggregates.
+type GroupAggr struct {
+	GroupKeys        []*GroupKey  `protobuf:"bytes,1,rep,name=groupKeys" json:"groupKeys,omitempty"`
+	Aggrs            []*Aggregate `protobuf:"bytes,2,rep,name=aggrs" json:"aggrs,omitempty"`
+	XXX_unrecognized []byte       `json:"-"`
+}
+
+func (m *GroupAggr) Reset()         { *m = GroupAggr{} }
+func (m *GroupAggr) String() string { return proto.CompactTextString(m) }
+func (*GroupAggr) ProtoMessage()    {}
+
+func (m *GroupAggr) GetGroupKeys() []*GroupKey {
+	if m != nil {
+		return m.GroupKeys
+	}
+	return nil
+}
+
+func (m *GroupAggr) GetAggrs() []*Aggregate {
+	if m != nil {
+		return m.Aggrs
+	}
+	return nil
+}
+
 type IndexEntry struct {
 	EntryKey         []byte `protobuf:"bytes,1,opt,name=entryKey" json:"entryKey,omitempty"`
 	PrimaryKey       []byte `protobuf:"bytes,2,req,name=primaryKey" json:"primaryKey,omitempty"`
@@ -745,11 +1331,13 @@ func (m *IndexEntry) GetPrimaryKey() []byte {
 
 // Statistics of a given index.
 type IndexStatistics struct {
-	KeysCount        *uint64 `protobuf:"varint,1,req,name=keysCount" json:"keysCount,omitempty"`
-	UniqueKeysCount  *uint64 `protobuf:"varint,2,req,name=uniqueKeysCount" json:"uniqueKeysCount,omitempty"`
-	KeyMin           []byte  `protobuf:"bytes,3,req,name=keyMin" json:"keyMin,omitempty"`
-	KeyMax           []byte  `protobuf:"bytes,4,req,name=keyMax" json:"keyMax,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	KeysCount        *uint64            `protobuf:"varint,1,req,name=keysCount" json:"keysCount,omitempty"`
+	UniqueKeysCount  *uint64            `protobuf:"varint,2,req,name=uniqueKeysCount" json:"uniqueKeysCount,omitempty"`
+	KeyMin           []byte             `protobuf:"bytes,3,req,name=keyMin" json:"keyMin,omitempty"`
+	KeyMax           []byte             `protobuf:"bytes,4,req,name=keyMax" json:"keyMax,omitempty"`
+	Sampled          *bool              `protobuf:"varint,5,opt,name=sampled" json:"sampled,omitempty"`
+	Histogram        []*IndexStatistics `protobuf:"bytes,6,rep,name=histogram" json:"histogram,omitempty"`
+	XXX_unrecognized []byte             `json:"-"`
 }
 
 func (m *IndexStatistics) Reset()         { *m = IndexStatistics{} }
@@ -784,5 +1372,21 @@ func (m *IndexStatistics) GetKeyMax() []byte {
 	return nil
 }
 
+func (m *IndexStatistics) GetSampled() bool {
+	if m != nil && m.Sampled != nil {
+		return *m.Sampled
+	}
+	return false
+}
+
+func (m *IndexStatistics) GetHistogram() []*IndexStatistics {
+	if m != nil {
+		return m.Histogram
+	}
+	return nil
+}
+
 func init() {
+	proto.RegisterEnum("protobuf.ScanPriority", ScanPriority_name, ScanPriority_value)
+	proto.RegisterEnum("protobuf.AggrFuncType", AggrFuncType_name, AggrFuncType_value)
 }
@@ -181,6 +181,15 @@ func (b *cbqClient) MoveIndex(defnID uint64, plan map[string]interface{}) error
 	panic("cbqClient does not implement move index")
 }
 
+// AlterIndex implement BridgeAccessor{} interface.
+func (b *cbqClient) AlterIndex(
+	defnID uint64, exprType, partnExpr, whereExpr string,
+	secExprs []string, desc []bool,
+	with []byte) (newDefnID uint64, err error) {
+
+	panic("cbqClient does not implement alter index")
+}
+
 // DropIndex implement BridgeAccessor{} interface.
 func (b *cbqClient) DropIndex(defnID uint64) error {
 	var resp *http.Response
@@ -223,6 +232,13 @@ func (b *cbqClient) GetScanport(
 	return b.queryport, defnID, 0, true
 }
 
+// GetPartitionScanport implements BridgeAccessor{} interface.
+func (b *cbqClient) GetPartitionScanport(
+	defnID uint64, partnId uint64) (queryport string, ok bool) {
+
+	return b.queryport, true
+}
+
 // GetIndexDefn implements BridgeAccessor{} interface.
 func (b *cbqClient) GetIndexDefn(defnID uint64) *common.IndexDefn {
 	panic("cbqClient does not implement GetIndexDefn")
@@ -3,8 +3,10 @@ package client
 import "time"
 import "unsafe"
 import "io"
+import "sync"
 import "sync/atomic"
 import "fmt"
+import "math"
 
 import "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/indexing/secondary/platform"
@@ -59,6 +61,32 @@ type IndexProjection struct {
 	PrimaryKey bool
 }
 
+// AggrFuncType of aggregates evaluated by indexer.
+type AggrFuncType int32
+
+const (
+	AggrMin AggrFuncType = iota
+	AggrMax
+	AggrSum
+	AggrCount
+)
+
+// Aggregate over a composite key position of the index, KeyPos is -1
+// for COUNT(*).
+type Aggregate struct {
+	AggrFunc AggrFuncType
+	KeyPos   int32
+	Distinct bool
+}
+
+// GroupAggr is GROUP BY, over composite key positions of the index, and
+// aggregates evaluated by indexer while scanning. Each row is returned
+// with entry key as group key values followed by aggregate values.
+type GroupAggr struct {
+	Group []int32
+	Aggrs []*Aggregate
+}
+
 const (
 	// Neither does not include low-key and high-key
 	Neither Inclusion = iota
@@ -106,7 +134,9 @@ type BridgeAccessor interface {
 	// isPrimary
 	//      specify whether the index is created on docid.
 	// with
-	//      JSON marshalled description about index deployment (and more...).
+	//      JSON marshalled description about index deployment (and more...),
+	//      "scope" and "collection" define the index on a collection of
+	//      the bucket instead of its default collection.
 	CreateIndex(
 		name, bucket, using, exprType, partnExpr, whereExpr string,
 		secExprs []string, desc []bool, isPrimary bool,
@@ -119,6 +149,15 @@ type BridgeAccessor interface {
 	// MoveIndex to move a set of indexes to different node.
 	MoveIndex(defnID uint64, with map[string]interface{}) error
 
+	// AlterIndex to change definition of index specified by `defnID`,
+	// without dropping it. Index with new definition is built in the
+	// background and swapped in for the index once it is caught up.
+	// Return defnID of the altered index.
+	AlterIndex(
+		defnID uint64, exprType, partnExpr, whereExpr string,
+		secExprs []string, desc []bool,
+		with []byte) (newDefnID uint64, err error)
+
 	// DropIndex to drop index specified by `defnID`.
 	// - if index is in deferred build state, it shall be removed
 	//   from deferred list.
@@ -138,6 +177,11 @@ type BridgeAccessor interface {
 		retry int,
 		excludes map[uint64]bool) (queryport string, targetDefnID uint64, targetInstID uint64, ok bool)
 
+	// GetPartitionScanport shall fetch queryport address for the
+	// indexer hosting partition `partnId` of partitioned index `defnID`.
+	GetPartitionScanport(
+		defnID uint64, partnId uint64) (queryport string, ok bool)
+
 	// GetIndex will return the index-definition structure for defnID.
 	GetIndexDefn(defnID uint64) *common.IndexDefn
 
@@ -172,44 +216,47 @@ type GsiAccessor interface {
 		defnID uint64, requestId string, values []common.SecondaryKey,
 		distinct bool, limit int64,
 		cons common.Consistency, vector *TsConsistency,
-		callb ResponseHandler) error
+		callb ResponseHandler, opts ...ScanOption) error
 
 	// Range scan index between low and high.
 	Range(
 		defnID uint64, requestId string, low, high common.SecondaryKey,
 		inclusion Inclusion, distinct bool, limit int64,
 		cons common.Consistency, vector *TsConsistency,
-		callb ResponseHandler) error
+		callb ResponseHandler, opts ...ScanOption) error
 
 	// ScanAll for full table scan.
 	ScanAll(
 		defnID uint64, requestId string, limit int64,
 		cons common.Consistency, vector *TsConsistency,
-		callb ResponseHandler) error
+		callb ResponseHandler, opts ...ScanOption) error
 
 	// Multiple scans with composite index filters
 	MultiScan(
 		defnID uint64, requestId string, scans Scans,
 		reverse, distinct bool, projection *IndexProjection, offset, limit int64,
 		cons common.Consistency, vector *TsConsistency,
-		callb ResponseHandler) error
+		callb ResponseHandler, opts ...ScanOption) error
 
 	// CountLookup of all entries in index.
 	CountLookup(
 		defnID uint64, requestId string, values []common.SecondaryKey,
-		cons common.Consistency, vector *TsConsistency) (int64, error)
+		cons common.Consistency, vector *TsConsistency,
+		opts ...ScanOption) (int64, error)
 
 	// CountRange of all entries in index.
 	CountRange(
 		defnID uint64, requestId string,
 		low, high common.SecondaryKey, inclusion Inclusion,
-		cons common.Consistency, vector *TsConsistency) (int64, error)
+		cons common.Consistency, vector *TsConsistency,
+		opts ...ScanOption) (int64, error)
 
 	// Count using MultiScan
 	MultiScanCount(
 		defnID uint64, requestId string,
 		scans Scans, distinct bool,
-		cons common.Consistency, vector *TsConsistency) (int64, error)
+		cons common.Consistency, vector *TsConsistency,
+		opts ...ScanOption) (int64, error)
 }
 
 var useMetadataProvider = true
@@ -235,6 +282,10 @@ type GsiClient struct {
 	metaCh       chan bool      // listen to metadata changes
 	settings     *ClientSettings
 	killch       chan bool
+
+	// first response latencies per index, for hedging scans.
+	hedgeMu   sync.Mutex
+	firstRows map[uint64]*firstRowLatency
 }
 
 // NewGsiClient returns client to access GSI cluster.
@@ -400,6 +451,26 @@ func (c *GsiClient) MoveIndex(defnID uint64, with map[string]interface{}) error
 	return err
 }
 
+// AlterIndex implements BridgeAccessor{} interface.
+func (c *GsiClient) AlterIndex(
+	defnID uint64, exprType, partnExpr, whereExpr string,
+	secExprs []string, desc []bool,
+	with []byte) (newDefnID uint64, err error) {
+
+	if c.bridge == nil {
+		return 0, ErrorClientUninitialized
+	}
+	begin := time.Now()
+	newDefnID, err = c.bridge.AlterIndex(
+		defnID, exprType, partnExpr, whereExpr, secExprs, desc, with)
+	fmsg := "AlterIndex %v -> %v exprType:%v partnExpr:%v whereExpr:%v " +
+		"secExprs:%v desc:%v with:%v - elapsed(%v) err(%v)"
+	logging.Infof(
+		fmsg, defnID, newDefnID, exprType, partnExpr, whereExpr, secExprs,
+		desc, string(with), time.Since(begin), err)
+	return newDefnID, err
+}
+
 // DropIndex implements BridgeAccessor{} interface.
 func (c *GsiClient) DropIndex(defnID uint64) error {
 	if c.bridge == nil {
@@ -414,17 +485,122 @@ func (c *GsiClient) DropIndex(defnID uint64) error {
 
 // LookupStatistics for a single secondary-key.
 func (c *GsiClient) LookupStatistics(
-	defnID uint64, requestId string, value common.SecondaryKey) (common.IndexStatistics, error) {
+	defnID uint64, requestId string,
+	value common.SecondaryKey) (stats common.IndexStatistics, err error) {
+
+	if c.bridge == nil {
+		return nil, ErrorClientUninitialized
+	}
+
+	// check whether the index is present and available.
+	if _, err := c.bridge.IndexState(defnID); err != nil {
+		return nil, err
+	}
+
+	begin := time.Now()
+
+	err = c.doScan(
+		defnID, requestId, nil, false, /*hedge*/
+		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
+			var err error
+
+			if c.bridge.IsPrimary(uint64(index.DefnId)) {
+				var e []byte
+				// primary keys are plain sequence of binary.
+				if value != nil && len(value) > 0 {
+					e, _ = curePrimaryKey(value[0])
+				}
+				stats, err = qc.RangeStatisticsPrimary(
+					uint64(index.DefnId), requestId, e, e, Both)
+				return err, false
+			}
+
+			if isScatterScan(index) {
+				values := []common.SecondaryKey{value}
+				partnIds, err := lookupPartitions(index, values)
+				if err != nil {
+					return err, false
+				}
+				stats, err = c.scatterStatistics(
+					qc, index, requestId, partnIds,
+					func(qc *GsiScanClient) (common.IndexStatistics, error) {
+						return qc.LookupStatistics(
+							uint64(index.DefnId), requestId, value)
+					})
+				return err, false
+			}
+			stats, err = qc.LookupStatistics(uint64(index.DefnId), requestId, value)
+			return err, false
+		})
 
-	return nil, ErrorNotImplemented
+	fmsg := "LookupStatistics {%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, defnID, requestId, time.Since(begin), err)
+	return stats, err
 }
 
 // RangeStatistics for index range.
 func (c *GsiClient) RangeStatistics(
 	defnID uint64, requestId string, low, high common.SecondaryKey,
-	inclusion Inclusion) (common.IndexStatistics, error) {
+	inclusion Inclusion) (stats common.IndexStatistics, err error) {
 
-	return nil, ErrorNotImplemented
+	if c.bridge == nil {
+		return nil, ErrorClientUninitialized
+	}
+
+	// check whether the index is present and available.
+	if _, err := c.bridge.IndexState(defnID); err != nil {
+		return nil, err
+	}
+
+	begin := time.Now()
+
+	err = c.doScan(
+		defnID, requestId, nil, false, /*hedge*/
+		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
+			var err error
+
+			if c.bridge.IsPrimary(uint64(index.DefnId)) {
+				var l, h []byte
+				var what string
+				// primary keys are plain sequence of binary.
+				if low != nil && len(low) > 0 {
+					if l, what = curePrimaryKey(low[0]); what == "after" {
+						stats = emptyIndexStatistics()
+						return nil, false
+					}
+				}
+				if high != nil && len(high) > 0 {
+					if h, what = curePrimaryKey(high[0]); what == "before" {
+						stats = emptyIndexStatistics()
+						return nil, false
+					}
+				}
+				stats, err = qc.RangeStatisticsPrimary(
+					uint64(index.DefnId), requestId, l, h, inclusion)
+				return err, false
+			}
+
+			if isScatterScan(index) {
+				partnIds, err := rangePartitions(index, low, high)
+				if err != nil {
+					return err, false
+				}
+				stats, err = c.scatterStatistics(
+					qc, index, requestId, partnIds,
+					func(qc *GsiScanClient) (common.IndexStatistics, error) {
+						return qc.RangeStatistics(
+							uint64(index.DefnId), requestId, low, high, inclusion)
+					})
+				return err, false
+			}
+			stats, err = qc.RangeStatistics(
+				uint64(index.DefnId), requestId, low, high, inclusion)
+			return err, false
+		})
+
+	fmsg := "RangeStatistics {%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, defnID, requestId, time.Since(begin), err)
+	return stats, err
 }
 
 // Lookup scan index between low and high.
@@ -432,7 +608,7 @@ func (c *GsiClient) Lookup(
 	defnID uint64, requestId string, values []common.SecondaryKey,
 	distinct bool, limit int64,
 	cons common.Consistency, vector *TsConsistency,
-	callb ResponseHandler) (err error) {
+	callb ResponseHandler, opts ...ScanOption) (err error) {
 
 	if c.bridge == nil {
 		return ErrorClientUninitialized
@@ -450,14 +626,28 @@ func (c *GsiClient) Lookup(
 	begin := time.Now()
 
 	err = c.doScan(
-		defnID, requestId,
+		defnID, requestId, opts, true, /*hedge*/
 		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
 			var err error
 
-			vector, err = c.getConsistency(qc, cons, vector, index.Bucket)
+			vector, err := c.getConsistency(qc, cons, vector, index.Bucket)
 			if err != nil {
 				return err, false
 			}
+			if isScatterScan(index) {
+				partnIds, err := lookupPartitions(index, values)
+				if err != nil {
+					return err, false
+				}
+				return c.scatterScan(
+					qc, index, requestId, partnIds, false, distinct, nil, 0, limit,
+					func(qc *GsiScanClient, _ *IndexProjection, _, limit int64,
+						callb ResponseHandler) (error, bool) {
+						return qc.Lookup(
+							uint64(index.DefnId), requestId, values, distinct,
+							limit, cons, vector, callb)
+					}, callb)
+			}
 			return qc.Lookup(
 				uint64(index.DefnId), requestId, values, distinct, limit, cons,
 				vector, callb)
@@ -480,7 +670,7 @@ func (c *GsiClient) Range(
 	defnID uint64, requestId string, low, high common.SecondaryKey,
 	inclusion Inclusion, distinct bool, limit int64,
 	cons common.Consistency, vector *TsConsistency,
-	callb ResponseHandler) (err error) {
+	callb ResponseHandler, opts ...ScanOption) (err error) {
 
 	if c.bridge == nil {
 		return ErrorClientUninitialized
@@ -498,11 +688,11 @@ func (c *GsiClient) Range(
 	begin := time.Now()
 
 	err = c.doScan(
-		defnID, requestId,
+		defnID, requestId, opts, true, /*hedge*/
 		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
 			var err error
 
-			vector, err = c.getConsistency(qc, cons, vector, index.Bucket)
+			vector, err := c.getConsistency(qc, cons, vector, index.Bucket)
 			if err != nil {
 				return err, false
 			}
@@ -525,6 +715,20 @@ func (c *GsiClient) Range(
 					limit, cons, vector, callb)
 			}
 			// dealing with secondary index.
+			if isScatterScan(index) {
+				partnIds, err := rangePartitions(index, low, high)
+				if err != nil {
+					return err, false
+				}
+				return c.scatterScan(
+					qc, index, requestId, partnIds, false, distinct, nil, 0, limit,
+					func(qc *GsiScanClient, _ *IndexProjection, _, limit int64,
+						callb ResponseHandler) (error, bool) {
+						return qc.Range(
+							uint64(index.DefnId), requestId, low, high, inclusion,
+							distinct, limit, cons, vector, callb)
+					}, callb)
+			}
 			return qc.Range(
 				uint64(index.DefnId), requestId, low, high, inclusion, distinct,
 				limit, cons, vector, callb)
@@ -546,7 +750,7 @@ func (c *GsiClient) Range(
 func (c *GsiClient) ScanAll(
 	defnID uint64, requestId string, limit int64,
 	cons common.Consistency, vector *TsConsistency,
-	callb ResponseHandler) (err error) {
+	callb ResponseHandler, opts ...ScanOption) (err error) {
 
 	if c.bridge == nil {
 		return ErrorClientUninitialized
@@ -564,14 +768,23 @@ func (c *GsiClient) ScanAll(
 	begin := time.Now()
 
 	err = c.doScan(
-		defnID, requestId,
+		defnID, requestId, opts, true, /*hedge*/
 		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
 			var err error
 
-			vector, err = c.getConsistency(qc, cons, vector, index.Bucket)
+			vector, err := c.getConsistency(qc, cons, vector, index.Bucket)
 			if err != nil {
 				return err, false
 			}
+			if isScatterScan(index) {
+				return c.scatterScan(
+					qc, index, requestId, nil, false, false, nil, 0, limit,
+					func(qc *GsiScanClient, _ *IndexProjection, _, limit int64,
+						callb ResponseHandler) (error, bool) {
+						return qc.ScanAll(
+							uint64(index.DefnId), requestId, limit, cons, vector, callb)
+					}, callb)
+			}
 			return qc.ScanAll(uint64(index.DefnId), requestId, limit, cons, vector, callb)
 		})
 
@@ -591,7 +804,7 @@ func (c *GsiClient) MultiScan(
 	defnID uint64, requestId string, scans Scans, reverse,
 	distinct bool, projection *IndexProjection, offset, limit int64,
 	cons common.Consistency, vector *TsConsistency,
-	callb ResponseHandler) (err error) {
+	callb ResponseHandler, opts ...ScanOption) (err error) {
 
 	if c.bridge == nil {
 		return ErrorClientUninitialized
@@ -609,11 +822,11 @@ func (c *GsiClient) MultiScan(
 	begin := time.Now()
 
 	err = c.doScan(
-		defnID, requestId,
+		defnID, requestId, opts, true, /*hedge*/
 		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
 			var err error
 
-			vector, err = c.getConsistency(qc, cons, vector, index.Bucket)
+			vector, err := c.getConsistency(qc, cons, vector, index.Bucket)
 			if err != nil {
 				return err, false
 			}
@@ -624,6 +837,16 @@ func (c *GsiClient) MultiScan(
 					projection, offset, limit, cons, vector, callb)
 			}
 
+			if isScatterScan(index) {
+				return c.scatterScan(
+					qc, index, requestId, nil, reverse, distinct, projection, offset, limit,
+					func(qc *GsiScanClient, projection *IndexProjection,
+						offset, limit int64, callb ResponseHandler) (error, bool) {
+						return qc.MultiScan(
+							uint64(index.DefnId), requestId, scans, reverse,
+							distinct, projection, offset, limit, cons, vector, callb)
+					}, callb)
+			}
 			return qc.MultiScan(
 				uint64(index.DefnId), requestId, scans, reverse, distinct,
 				projection, offset, limit, cons, vector, callb)
@@ -641,10 +864,204 @@ func (c *GsiClient) MultiScan(
 	return
 }
 
+// ResumableMultiScan is MultiScan whose pages carry a continuation token,
+// see ContinuationToken. When `resumeFrom` is not nil, the scan resumes
+// after the rows returned up to that token, on any replica whose snapshot
+// is at least as recent as the one the token was taken on. A scan that
+// fails after returning rows is resumed on another replica from the last
+// token received. Scans of partitioned index cannot be resumed.
+func (c *GsiClient) ResumableMultiScan(
+	defnID uint64, requestId string, scans Scans,
+	projection *IndexProjection, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency, resumeFrom []byte,
+	callb ResponseHandler, opts ...ScanOption) (err error) {
+
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+
+	// check whether the index is present and available.
+	if _, err = c.bridge.IndexState(defnID); err != nil {
+		protoResp := &protobuf.ResponseStream{
+			Err: &protobuf.Error{Error: proto.String(err.Error())},
+		}
+		callb(protoResp)
+		return
+	}
+	if index := c.bridge.GetIndexDefn(defnID); index != nil && isScatterScan(index) {
+		return ErrorResumePartitioned
+	}
+
+	begin := time.Now()
+
+	// rows returned up to the last token are not returned again by
+	// retries, unless the indexer returned rows without a token.
+	token, untracked := resumeFrom, false
+	tokenCallb := func(resp ResponseReader) bool {
+		stream, ok := resp.(*protobuf.ResponseStream)
+		if ok && len(stream.GetIndexEntries()) > 0 {
+			if t := stream.GetContinuation(); t != nil {
+				token = t
+			} else {
+				untracked = true
+			}
+		}
+		return callb(resp)
+	}
+
+	err = c.doScan(
+		defnID, requestId, opts, false, /*hedge*/
+		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
+			var err error
+			var partial bool
+
+			vector, err := c.getConsistency(qc, cons, vector, index.Bucket)
+			if err != nil {
+				return err, false
+			}
+
+			qc = qc.withContinuation(token)
+			if c.bridge.IsPrimary(uint64(index.DefnId)) {
+				err, partial = qc.MultiScanPrimary(
+					uint64(index.DefnId), requestId, scans, false, false,
+					projection, offset, limit, cons, vector, tokenCallb)
+			} else {
+				err, partial = qc.MultiScan(
+					uint64(index.DefnId), requestId, scans, false, false,
+					projection, offset, limit, cons, vector, tokenCallb)
+			}
+			return err, partial && untracked
+		})
+
+	if err != nil { // callback with error
+		resp := &protobuf.ResponseStream{
+			Err: &protobuf.Error{Error: proto.String(err.Error())},
+		}
+		callb(resp)
+	}
+
+	fmsg := "ResumableScans {%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, defnID, requestId, time.Since(begin), err)
+	return
+}
+
+// ContinuationToken returns the token to resume a scan of
+// ResumableMultiScan after the entries of `resp`, nil if there is none.
+func ContinuationToken(resp ResponseReader) []byte {
+	if stream, ok := resp.(*protobuf.ResponseStream); ok {
+		return stream.GetContinuation()
+	}
+	return nil
+}
+
+// ScanOption is a request option for scans and counts of GsiClient, it
+// is applied on the scan client serving the request.
+type ScanOption func(qc *GsiScanClient) *GsiScanClient
+
+// WithTrace has the indexer trace scans, see Trace.
+func WithTrace() ScanOption {
+	return (*GsiScanClient).WithTrace
+}
+
+// WithPriority has the indexer admit scans and counts with `priority`
+// when it is limiting concurrent scans.
+func WithPriority(priority protobuf.ScanPriority) ScanOption {
+	return func(qc *GsiScanClient) *GsiScanClient {
+		return qc.WithPriority(priority)
+	}
+}
+
+// Trace returns stage timings of a scan requested WithTrace, from the
+// StreamEndResponse that ends a streaming scan. It returns nil for other
+// responses and untraced scans.
+func Trace(resp ResponseReader) *protobuf.ScanTrace {
+	if endResp, ok := resp.(*protobuf.StreamEndResponse); ok {
+		return endResp.GetTrace()
+	}
+	return nil
+}
+
+// Staleness returns how far the snapshot scanned with
+// BestEffortConsistency was behind the requested timestamp, from the
+// StreamEndResponse that ends a streaming scan. It returns nil for other
+// responses and other consistencies.
+func Staleness(resp ResponseReader) *protobuf.ScanStaleness {
+	if endResp, ok := resp.(*protobuf.StreamEndResponse); ok {
+		return endResp.GetStaleness()
+	}
+	return nil
+}
+
+// Scan3 scans index with GROUP BY and aggregates pushed down to indexer,
+// rows are passed to callb, with offset and limit applied on aggregated
+// rows. Partial aggregates from partitions of a partitioned index are
+// merged by client.
+func (c *GsiClient) Scan3(
+	defnID uint64, requestId string, scans Scans, reverse bool,
+	groupAggr *GroupAggr, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler, opts ...ScanOption) (err error) {
+
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+
+	// check whether the index is present and available.
+	if _, err = c.bridge.IndexState(defnID); err != nil {
+		protoResp := &protobuf.ResponseStream{
+			Err: &protobuf.Error{Error: proto.String(err.Error())},
+		}
+		callb(protoResp)
+		return
+	}
+
+	begin := time.Now()
+
+	err = c.doScan(
+		defnID, requestId, opts, true, /*hedge*/
+		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
+			var err error
+
+			vector, err := c.getConsistency(qc, cons, vector, index.Bucket)
+			if err != nil {
+				return err, false
+			}
+
+			if c.bridge.IsPrimary(uint64(index.DefnId)) {
+				return ErrorAggrPrimaryIndex, false
+			}
+
+			if isScatterScan(index) {
+				return c.scatterGroupAggr(
+					qc, index, requestId, groupAggr, offset, limit,
+					func(qc *GsiScanClient, groupAggr *GroupAggr,
+						callb ResponseHandler) (error, bool) {
+						return qc.Scan3(
+							uint64(index.DefnId), requestId, scans, reverse,
+							groupAggr, 0, math.MaxInt64, cons, vector, callb)
+					}, callb)
+			}
+			return qc.Scan3(
+				uint64(index.DefnId), requestId, scans, reverse, groupAggr,
+				offset, limit, cons, vector, callb)
+		})
+
+	if err != nil { // callback with error
+		resp := &protobuf.ResponseStream{
+			Err: &protobuf.Error{Error: proto.String(err.Error())},
+		}
+		callb(resp)
+	}
+
+	fmsg := "Scan3 {%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, defnID, requestId, time.Since(begin), err)
+	return
+}
+
 // CountLookup to count number entries for given set of keys.
 func (c *GsiClient) CountLookup(
 	defnID uint64, requestId string, values []common.SecondaryKey,
-	cons common.Consistency, vector *TsConsistency) (count int64, err error) {
+	cons common.Consistency, vector *TsConsistency, opts ...ScanOption) (count int64, err error) {
 
 	if c.bridge == nil {
 		return count, ErrorClientUninitialized
@@ -658,7 +1075,7 @@ func (c *GsiClient) CountLookup(
 	begin := time.Now()
 
 	err = c.doScan(
-		defnID, requestId,
+		defnID, requestId, opts, false, /*hedge*/
 		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
 			var err error
 
@@ -680,6 +1097,19 @@ func (c *GsiClient) CountLookup(
 				return err, false
 			}
 
+			if isScatterScan(index) {
+				partnIds, err := lookupPartitions(index, values)
+				if err != nil {
+					return err, false
+				}
+				count, err = c.scatterCount(
+					qc, index, requestId, partnIds,
+					func(qc *GsiScanClient) (int64, error) {
+						return qc.CountLookup(
+							uint64(index.DefnId), requestId, values, cons, vector)
+					})
+				return err, false
+			}
 			count, err = qc.CountLookup(uint64(index.DefnId), requestId, values, cons, vector)
 			return err, false
 		})
@@ -694,7 +1124,7 @@ func (c *GsiClient) CountRange(
 	defnID uint64, requestId string,
 	low, high common.SecondaryKey,
 	inclusion Inclusion,
-	cons common.Consistency, vector *TsConsistency) (count int64, err error) {
+	cons common.Consistency, vector *TsConsistency, opts ...ScanOption) (count int64, err error) {
 
 	if c.bridge == nil {
 		return count, ErrorClientUninitialized
@@ -708,7 +1138,7 @@ func (c *GsiClient) CountRange(
 	begin := time.Now()
 
 	err = c.doScan(
-		defnID, requestId,
+		defnID, requestId, opts, false, /*hedge*/
 		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
 			var err error
 
@@ -735,6 +1165,20 @@ func (c *GsiClient) CountRange(
 				return err, false
 			}
 
+			if isScatterScan(index) {
+				partnIds, err := rangePartitions(index, low, high)
+				if err != nil {
+					return err, false
+				}
+				count, err = c.scatterCount(
+					qc, index, requestId, partnIds,
+					func(qc *GsiScanClient) (int64, error) {
+						return qc.CountRange(
+							uint64(index.DefnId), requestId, low, high, inclusion,
+							cons, vector)
+					})
+				return err, false
+			}
 			count, err = qc.CountRange(
 				uint64(index.DefnId), requestId, low, high, inclusion, cons, vector)
 			return err, false
@@ -748,7 +1192,7 @@ func (c *GsiClient) CountRange(
 func (c *GsiClient) MultiScanCount(
 	defnID uint64, requestId string,
 	scans Scans, distinct bool,
-	cons common.Consistency, vector *TsConsistency) (count int64, err error) {
+	cons common.Consistency, vector *TsConsistency, opts ...ScanOption) (count int64, err error) {
 
 	if c.bridge == nil {
 		return count, ErrorClientUninitialized
@@ -762,7 +1206,7 @@ func (c *GsiClient) MultiScanCount(
 	begin := time.Now()
 
 	err = c.doScan(
-		defnID, requestId,
+		defnID, requestId, opts, false, /*hedge*/
 		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
 			var err error
 
@@ -776,6 +1220,28 @@ func (c *GsiClient) MultiScanCount(
 				return err, false
 			}
 
+			if isScatterScan(index) && distinct && !index.CanPrunePartitions() {
+				// equal keys can be hashed to different partitions, count
+				// them once by merging distinct rows of all partitions.
+				count, err = c.scatterDistinctCount(
+					qc, index, requestId,
+					func(qc *GsiScanClient, _ *IndexProjection, _, limit int64,
+						callb ResponseHandler) (error, bool) {
+						return qc.MultiScan(
+							uint64(index.DefnId), requestId, scans, false, true,
+							nil, 0, limit, cons, vector, callb)
+					})
+				return err, false
+			} else if isScatterScan(index) {
+				count, err = c.scatterCount(
+					qc, index, requestId, nil,
+					func(qc *GsiScanClient) (int64, error) {
+						return qc.MultiScanCount(
+							uint64(index.DefnId), requestId, scans, distinct,
+							cons, vector)
+					})
+				return err, false
+			}
 			count, err = qc.MultiScanCount(
 				uint64(index.DefnId), requestId, scans, distinct, cons, vector)
 			return err, false
@@ -852,8 +1318,11 @@ func (c *GsiClient) updateScanClients() {
 	}
 }
 
+// doScan runs `callb` on a replica of index `defnID`, retrying with other
+// replicas on failure. Streaming scans pass `hedge` to be hedged across
+// replicas when hedging is enabled.
 func (c *GsiClient) doScan(
-	defnID uint64, requestId string,
+	defnID uint64, requestId string, opts []ScanOption, hedge bool,
 	callb func(*GsiScanClient, *common.IndexDefn) (error, bool)) (err error) {
 
 	var qc *GsiScanClient
@@ -873,8 +1342,18 @@ func (c *GsiClient) doScan(
 		if queryport, targetDefnID, targetInstID, ok1 = c.bridge.GetScanport(defnID, i, excludes); ok1 {
 			index := c.bridge.GetIndexDefn(targetDefnID)
 			if qc, ok2 = qcs[queryport]; ok2 {
+				for _, opt := range opts {
+					qc = opt(qc)
+				}
 				begin := time.Now()
-				scan_err, partial = callb(qc, index)
+				if c.canHedge(hedge, index) {
+					// Timeit credits the replica whose response was used.
+					scan_err, partial, targetInstID = c.hedgedScan(
+						defnID, requestId, targetInstID, excludes, qc, index, callb)
+				} else {
+					scan_err, partial = callb(qc, index)
+					qc.health.scanDone(scan_err)
+				}
 				if c.isTimeit(scan_err) {
 					c.bridge.Timeit(targetInstID, float64(time.Since(begin)))
 					return scan_err
@@ -887,6 +1366,11 @@ func (c *GsiClient) doScan(
 					logging.Warnf("evict retry (%v)...\n", evictRetry)
 					evictRetry--
 					continue
+				} else if c.isRejected(scan_err) {
+					// indexer is too busy to admit the scan, the request
+					// was never served so retry it with another replica.
+					logging.Warnf("scan rejected by %v for index %v:%v, reqId:%v\n",
+						queryport, targetDefnID, targetInstID, requestId)
 				} else { // TODO: make this error message precise
 					// reset the hash so that we do a full STATS for next
 					// query.
@@ -939,6 +1423,10 @@ func (c *GsiClient) isTimeit(err error) bool {
 	return false
 }
 
+func (c *GsiClient) isRejected(err error) bool {
+	return err != nil && err.Error() == common.ErrScanRejected.Error()
+}
+
 func (c *GsiClient) getConsistency(
 	qc *GsiScanClient, cons common.Consistency,
 	vector *TsConsistency, bucket string) (*TsConsistency, error) {
@@ -977,6 +1465,9 @@ func (c *GsiClient) getConsistency(
 		}
 	} else if cons == common.AnyConsistency {
 		vector = nil
+	} else if cons == common.BestEffortConsistency {
+		// optional, indexer compares with KV timestamp if nil.
+		return vector, nil
 	} else {
 		return nil, ErrorInvalidConsistency
 	}
@@ -1037,7 +1528,8 @@ func makeWithMetaProvider(
 		killch:       make(chan bool, 1),
 	}
 	platform.StorePointer(&c.bucketHash, (unsafe.Pointer)(new(map[string]uint64)))
-	c.bridge, err = newMetaBridgeClient(cluster, config, c.metaCh, c.settings)
+	c.bridge, err = newMetaBridgeClient(
+		cluster, config, c.metaCh, c.settings, c.scanHealth)
 	if err != nil {
 		return nil, err
 	}
@@ -1046,6 +1538,17 @@ func makeWithMetaProvider(
 	return c, nil
 }
 
+// scanHealth returns the load and circuit breaker of the indexer at
+// `queryport`, nil if there is no scan client for it.
+func (c *GsiClient) scanHealth(queryport string) *indexerHealth {
+	qcs :=
+		*((*map[string]*GsiScanClient)(atomic.LoadPointer(&c.queryClients)))
+	if qc, ok := qcs[queryport]; ok {
+		return qc.health
+	}
+	return nil
+}
+
 func (c *GsiClient) listenMetaChange(killch chan bool) {
 	for {
 		select {
@@ -1098,6 +1601,14 @@ func (ts *TsConsistency) Override(
 	return ts
 }
 
+// emptyIndexStatistics for a span that cannot match any entry.
+func emptyIndexStatistics() common.IndexStatistics {
+	return &protobuf.IndexStatistics{
+		KeysCount:       proto.Uint64(0),
+		UniqueKeysCount: proto.Uint64(0),
+	}
+}
+
 func curePrimaryKey(key interface{}) ([]byte, string) {
 	if key == nil {
 		return nil, "before"
@@ -1,5 +1,6 @@
 package client
 
+import "crypto/tls"
 import "errors"
 import "fmt"
 import "net"
@@ -25,6 +26,8 @@ type connectionPool struct {
 	createsem   chan bool
 	// config params
 	maxPayload   int
+	compression  byte
+	tlsConfig    *tls.Config
 	timeout      time.Duration
 	availTimeout time.Duration
 	logPrefix    string
@@ -37,7 +40,8 @@ type connection struct {
 
 func newConnectionPool(
 	host string,
-	poolSize, poolOverflow, maxPayload int,
+	poolSize, poolOverflow, maxPayload int, compression byte,
+	tlsConfig *tls.Config,
 	timeout, availTimeout time.Duration) *connectionPool {
 
 	cp := &connectionPool{
@@ -45,6 +49,8 @@ func newConnectionPool(
 		connections:  make(chan *connection, poolSize),
 		createsem:    make(chan bool, poolSize+poolOverflow),
 		maxPayload:   maxPayload,
+		compression:  compression,
+		tlsConfig:    tlsConfig,
 		timeout:      timeout,
 		availTimeout: availTimeout,
 		logPrefix:    fmt.Sprintf("[Queryport-connpool:%v]", host),
@@ -59,11 +65,13 @@ var ConnPoolCallback func(host string, source string, start time.Time, err error
 
 func (cp *connectionPool) defaultMkConn(host string) (*connection, error) {
 	logging.Infof("%v open new connection ...\n", cp.logPrefix)
-	conn, err := net.Dial("tcp", host)
+	timeout := cp.timeout * time.Millisecond
+	conn, err := transport.DialTimeout(host, cp.tlsConfig, timeout)
 	if err != nil {
 		return nil, err
 	}
-	flags := transport.TransportFlag(0).SetProtobuf()
+	// server responds with the same compression on this connection.
+	flags := transport.TransportFlag(0).SetProtobuf().SetCompression(cp.compression)
 	pkt := transport.NewTransportPacket(cp.maxPayload, flags)
 	pkt.SetEncoder(transport.EncodingProtobuf, protobuf.ProtobufEncode)
 	pkt.SetDecoder(transport.EncodingProtobuf, protobuf.ProtobufDecode)
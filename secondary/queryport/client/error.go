@@ -27,6 +27,15 @@ var ErrorInvalidConsistency = errors.New("queryport.invalidConsistency")
 // ErrorExpectedTimestamp
 var ErrorExpectedTimestamp = errors.New("queryport.expectedTimestamp")
 
+// ErrorAggrPrimaryIndex
+var ErrorAggrPrimaryIndex = errors.New("queryport.aggrPrimaryIndex")
+
+// ErrorAggrDistinct
+var ErrorAggrDistinct = errors.New("queryport.aggrDistinct")
+
+// ErrorResumePartitioned
+var ErrorResumePartitioned = errors.New("queryport.resumePartitioned")
+
 // These error strings need to be in sync with common.ErrIndexNotFound
 // and common.ErrIndexNotReady.
 var ErrIndexNotFound = fmt.Errorf("Index not found")
@@ -41,6 +50,9 @@ var errorDescriptions = map[string]string{
 	ErrorNotImplemented.Error():      "client API not implemented",
 	ErrorInvalidConsistency.Error():  "supplied consistency is invalid",
 	ErrorExpectedTimestamp.Error():   "consistency timestamp is expected",
+	ErrorAggrPrimaryIndex.Error():    "aggregates cannot be pushed down to primary index",
+	ErrorAggrDistinct.Error():        "distinct aggregates over more than one key cannot be pushed down to partitioned index",
+	ErrorResumePartitioned.Error():   "scans of partitioned index cannot be resumed",
 	ErrIndexNotFound.Error():         "index is deleted or node hosting index is down",
 	ErrIndexNotReady.Error():         ErrIndexNotReady.Error(),
 }
@@ -0,0 +1,249 @@
+package client
+
+import "net"
+import "sort"
+import "sync"
+import "time"
+import "sync/atomic"
+
+import "github.com/couchbase/indexing/secondary/logging"
+import common "github.com/couchbase/indexing/secondary/common"
+
+// minimum number of first response latencies on an index before its
+// scans are hedged.
+const hedgeMinSamples = 20
+
+// number of recent first response latencies kept for an index.
+const hedgeMaxSamples = 256
+
+// scanHedge arbitrates between the attempts of a hedged scan. The first
+// attempt to receive a response from its indexer wins, the connection of
+// the other attempt is closed right away, which fails its scan.
+type scanHedge struct {
+	begin   time.Time
+	mu      sync.Mutex
+	winner  int         // -1 until an attempt receives a response
+	firstch chan bool   // closed once there is a winner
+	conns   [2]net.Conn // connection streaming responses of each attempt
+}
+
+func newScanHedge() *scanHedge {
+	return &scanHedge{begin: time.Now(), winner: -1, firstch: make(chan bool)}
+}
+
+// claim is called by `attempt` for every response it receives, it tells
+// whether the response is to be passed on to the caller.
+func (h *scanHedge) claim(attempt int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.winner < 0 {
+		h.winner = attempt
+		close(h.firstch)
+		for i, conn := range h.conns {
+			if i != attempt && conn != nil {
+				conn.Close()
+			}
+		}
+	}
+	return h.winner == attempt
+}
+
+// watch is called by `attempt` with the connection it receives responses
+// on, the connection is closed when another attempt wins. An attempt
+// returns its connection to the pool only after it has received a
+// response, or with the connection marked unhealthy.
+func (h *scanHedge) watch(attempt int, conn net.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[attempt] = conn
+	if h.winner >= 0 && h.winner != attempt {
+		conn.Close()
+	}
+}
+
+// lost tells whether another attempt won.
+func (h *scanHedge) lost(attempt int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.winner >= 0 && h.winner != attempt
+}
+
+func (h *scanHedge) getWinner() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.winner
+}
+
+// firstRowLatency keeps the latencies of the first response of recent
+// scans on an index, the hedge delay is a percentile of them.
+type firstRowLatency struct {
+	samples []time.Duration
+	next    int
+	delay   time.Duration
+	stale   int // samples added since delay was computed
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+
+func (l *firstRowLatency) add(latency time.Duration, percentile int) {
+	if len(l.samples) < hedgeMaxSamples {
+		l.samples = append(l.samples, latency)
+	} else {
+		l.samples[l.next] = latency
+		l.next = (l.next + 1) % hedgeMaxSamples
+	}
+
+	// sorting on every sample is wasteful, the percentile moves slowly.
+	if l.stale++; l.stale < 16 && l.delay > 0 {
+		return
+	}
+	sorted := make(durations, len(l.samples))
+	copy(sorted, l.samples)
+	sort.Sort(sorted)
+	i := len(sorted) * percentile / 100
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	l.delay, l.stale = sorted[i], 0
+}
+
+// canHedge tells whether the scan on `index` can be hedged to another
+// replica. Scatter scans already run on several indexers and are not.
+func (c *GsiClient) canHedge(hedge bool, index *common.IndexDefn) bool {
+	return hedge && c.config["hedge.enable"].Bool() &&
+		index.NumReplica > 0 && !isScatterScan(index)
+}
+
+// hedgeDelay returns how long to wait for the first response of a scan
+// on index `defnID` before hedging it to another replica.
+func (c *GsiClient) hedgeDelay(defnID uint64) (time.Duration, bool) {
+	c.hedgeMu.Lock()
+	defer c.hedgeMu.Unlock()
+
+	latency, ok := c.firstRows[defnID]
+	if !ok || len(latency.samples) < hedgeMinSamples {
+		return 0, false
+	}
+	minDelay := time.Duration(c.config["hedge.minDelay"].Int()) * time.Millisecond
+	if latency.delay < minDelay {
+		return minDelay, true
+	}
+	return latency.delay, true
+}
+
+func (c *GsiClient) recordFirstRow(defnID uint64, latency time.Duration) {
+	c.hedgeMu.Lock()
+	defer c.hedgeMu.Unlock()
+
+	if c.firstRows == nil {
+		c.firstRows = make(map[uint64]*firstRowLatency)
+	}
+	l, ok := c.firstRows[defnID]
+	if !ok {
+		l = &firstRowLatency{}
+		c.firstRows[defnID] = l
+	}
+	l.add(latency, c.config["hedge.percentile"].Int())
+}
+
+// hedgeReplica picks a replica of index `defnID` on another indexer than
+// the one scanned by `qc`, and returns its scan client with the request
+// options of `qc`.
+func (c *GsiClient) hedgeReplica(
+	defnID, instID uint64, excludes map[uint64]bool,
+	qc *GsiScanClient) (*GsiScanClient, *common.IndexDefn, uint64, bool) {
+
+	hedgeExcludes := map[uint64]bool{instID: true}
+	for id := range excludes {
+		hedgeExcludes[id] = true
+	}
+
+	queryport, targetDefnID, targetInstID, ok := c.bridge.GetScanport(defnID, 0, hedgeExcludes)
+	if !ok || queryport == qc.queryport {
+		return nil, nil, 0, false
+	}
+	qcs :=
+		*((*map[string]*GsiScanClient)(atomic.LoadPointer(&c.queryClients)))
+	hedgeQc, ok := qcs[queryport]
+	if !ok {
+		return nil, nil, 0, false
+	}
+	index := c.bridge.GetIndexDefn(targetDefnID)
+	if index == nil || isScatterScan(index) {
+		return nil, nil, 0, false
+	}
+	return hedgeQc.withRequestOptions(qc), index, targetInstID, true
+}
+
+// hedgedScan runs `callb` on replica `instID` scanned by `qc` and, when
+// no response is received within the hedge delay, on a second replica as
+// well. The result of the attempt that responds first is returned, along
+// with the replica it scanned, the connection of the other attempt is
+// closed as soon as there is a winner.
+func (c *GsiClient) hedgedScan(
+	defnID uint64, requestId string, instID uint64, excludes map[uint64]bool,
+	qc *GsiScanClient, index *common.IndexDefn,
+	callb func(*GsiScanClient, *common.IndexDefn) (error, bool)) (error, bool, uint64) {
+
+	type result struct {
+		attempt int
+		instID  uint64
+		err     error
+		partial bool
+	}
+
+	hedge := newScanHedge()
+	results := make(chan result, 2)
+	run := func(attempt int, qc *GsiScanClient, index *common.IndexDefn, instID uint64) {
+		err, partial := callb(qc.withHedge(hedge, attempt), index)
+		// an attempt that lost fails on its closed connection, which is
+		// not the indexer's fault.
+		if !hedge.lost(attempt) {
+			qc.health.scanDone(err)
+		}
+		results <- result{attempt, instID, err, partial}
+	}
+
+	go run(0, qc, index, instID)
+	running := 1
+
+	var timeout <-chan time.Time
+	if delay, ok := c.hedgeDelay(defnID); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	firstch := hedge.firstch
+	var last result
+	for running > 0 {
+		select {
+		case <-timeout:
+			timeout = nil
+			hedgeQc, hedgeIndex, hedgeInstID, ok := c.hedgeReplica(defnID, instID, excludes, qc)
+			if ok {
+				logging.Verbosef("hedging scan of index %v to %v, reqId:%v\n",
+					defnID, hedgeQc.queryport, requestId)
+				go run(1, hedgeQc, hedgeIndex, hedgeInstID)
+				running++
+			}
+
+		case <-firstch:
+			firstch, timeout = nil, nil
+			c.recordFirstRow(defnID, time.Since(hedge.begin))
+
+		case last = <-results:
+			running--
+			if last.attempt == hedge.getWinner() {
+				return last.err, last.partial, last.instID
+			}
+			// failed before receiving a response, wait for the other
+			// attempt if there is one.
+		}
+	}
+	return last.err, last.partial, last.instID
+}
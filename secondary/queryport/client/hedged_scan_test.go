@@ -0,0 +1,195 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// testHedgeBridge serves an index with a replica on each queryport, the
+// first replica that is not excluded is scanned.
+type testHedgeBridge struct {
+	BridgeAccessor
+	index      *common.IndexDefn
+	replicas   []uint64
+	queryports map[uint64]string
+
+	mu     sync.Mutex
+	timeit map[uint64]int
+}
+
+func (b *testHedgeBridge) GetScanport(
+	defnID uint64, retry int, excludes map[uint64]bool) (string, uint64, uint64, bool) {
+
+	for _, instID := range b.replicas {
+		if !excludes[instID] {
+			return b.queryports[instID], defnID, instID, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+func (b *testHedgeBridge) GetIndexDefn(defnID uint64) *common.IndexDefn {
+	return b.index
+}
+
+func (b *testHedgeBridge) Timeit(instID uint64, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timeit[instID]++
+}
+
+// testHedgeClient returns a client whose scans on index 10 are hedged
+// after 1ms, from replica 100 on qp0 to replica 101 on qp1.
+func testHedgeClient(t *testing.T) (*GsiClient, *testHedgeBridge) {
+	config := common.SystemConfig.SectionConfig("queryport.client.", true)
+	if err := config.SetValue("hedge.enable", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetValue("hedge.minDelay", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	bridge := &testHedgeBridge{
+		index:      &common.IndexDefn{DefnId: 10, NumReplica: 1},
+		replicas:   []uint64{100, 101},
+		queryports: map[uint64]string{100: "qp0", 101: "qp1"},
+		timeit:     make(map[uint64]int),
+	}
+	clients := map[string]*GsiScanClient{
+		"qp0": {queryport: "qp0", health: &indexerHealth{}},
+		"qp1": {queryport: "qp1", health: &indexerHealth{}},
+	}
+	c := &GsiClient{bridge: bridge, config: config}
+	atomic.StorePointer(&c.queryClients, unsafe.Pointer(&clients))
+	for i := 0; i < hedgeMinSamples; i++ {
+		c.recordFirstRow(10, time.Millisecond)
+	}
+	return c, bridge
+}
+
+// testAttempt scans like streamResponse does, the indexer responds after
+// `delay` unless the connection is closed meanwhile.
+func testAttempt(qc *GsiScanClient, delay time.Duration) (error, bool) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	qc.hedge.watch(qc.attempt, local)
+
+	go func() {
+		time.Sleep(delay)
+		remote.Write([]byte{1})
+	}()
+	if _, err := local.Read(make([]byte, 1)); err != nil {
+		return err, false
+	}
+	if qc.hedgeLost() {
+		return nil, false
+	}
+	return nil, true
+}
+
+func TestHedgedScanFirstResponseWins(t *testing.T) {
+	c, bridge := testHedgeClient(t)
+
+	lostch := make(chan error, 1)
+	err := c.doScan(10, "req1", nil, true,
+		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
+			if qc.queryport == "qp0" {
+				err, partial := testAttempt(qc, 10*time.Second)
+				lostch <- err
+				return err, partial
+			}
+			return testAttempt(qc, 0)
+		})
+	if err != nil {
+		t.Fatalf("Expected hedged scan to succeed, received %v", err)
+	}
+
+	// loser's connection is closed as soon as the hedge responds.
+	select {
+	case err := <-lostch:
+		if err == nil {
+			t.Errorf("Expected scan on closed connection to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected connection of the slow replica to be closed")
+	}
+
+	if bridge.timeit[101] != 1 || bridge.timeit[100] != 0 {
+		t.Errorf("Expected scan time credited to replica 101, received %v", bridge.timeit)
+	}
+	qcs := *((*map[string]*GsiScanClient)(atomic.LoadPointer(&c.queryClients)))
+	if failures := qcs["qp0"].health.failures; failures != 0 {
+		t.Errorf("Expected losing attempt not to count as failure, received %v", failures)
+	}
+}
+
+func TestHedgedScanErrorBeforeResponse(t *testing.T) {
+	c, _ := testHedgeClient(t)
+	qcs := *((*map[string]*GsiScanClient)(atomic.LoadPointer(&c.queryClients)))
+
+	// first replica fails, after the hedge has started, without a response.
+	err, partial, instID := c.hedgedScan(10, "req1", 100, nil, qcs["qp0"], c.bridge.GetIndexDefn(10),
+		func(qc *GsiScanClient, index *common.IndexDefn) (error, bool) {
+			if qc.queryport == "qp0" {
+				time.Sleep(20 * time.Millisecond)
+				return &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}, false
+			}
+			return testAttempt(qc, 50*time.Millisecond)
+		})
+	if err != nil || !partial || instID != 101 {
+		t.Errorf("Expected hedge on replica 101 to succeed, received %v %v %v",
+			err, partial, instID)
+	}
+	if failures := qcs["qp0"].health.failures; failures != 1 {
+		t.Errorf("Expected 1 failure of first replica, received %v", failures)
+	}
+}
+
+func TestFirstRowLatency(t *testing.T) {
+	l := &firstRowLatency{}
+	for i := 1; i <= 20; i++ {
+		l.add(time.Duration(i)*time.Millisecond, 90)
+	}
+	// percentile is re-computed every 16 samples, last at 17 samples.
+	if l.delay != 16*time.Millisecond {
+		t.Errorf("Expected %v, received %v", 16*time.Millisecond, l.delay)
+	}
+
+	for i := 0; i < 16; i++ {
+		l.add(100*time.Millisecond, 90)
+	}
+	if l.delay != 100*time.Millisecond {
+		t.Errorf("Expected %v, received %v", 100*time.Millisecond, l.delay)
+	}
+
+	// older samples are replaced once hedgeMaxSamples are kept.
+	for i := 0; i < 300; i++ {
+		l.add(5*time.Millisecond, 90)
+	}
+	if len(l.samples) != hedgeMaxSamples || l.delay != 5*time.Millisecond {
+		t.Errorf("Expected %v samples and %v, received %v %v",
+			hedgeMaxSamples, 5*time.Millisecond, len(l.samples), l.delay)
+	}
+}
+
+func TestHedgeDelay(t *testing.T) {
+	c, _ := testHedgeClient(t)
+	if _, ok := c.hedgeDelay(11); ok {
+		t.Errorf("Expected no hedging without enough samples")
+	}
+	if delay, ok := c.hedgeDelay(10); !ok || delay != time.Millisecond {
+		t.Errorf("Expected %v, received %v %v", time.Millisecond, delay, ok)
+	}
+
+	c.config.SetValue("hedge.minDelay", 5)
+	if delay, _ := c.hedgeDelay(10); delay != 5*time.Millisecond {
+		t.Errorf("Expected %v, received %v", 5*time.Millisecond, delay)
+	}
+}
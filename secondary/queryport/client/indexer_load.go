@@ -0,0 +1,112 @@
+package client
+
+import "io"
+import "math"
+import "net"
+import "sync"
+import "time"
+
+import common "github.com/couchbase/indexing/secondary/common"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+import "github.com/couchbase/indexing/secondary/transport"
+
+// indexerHealth tracks the load last reported by an indexer and the
+// outcome of recent scans on it, shared by all copies of its scan client.
+//
+// The circuit breaker opens after `threshold` consecutive scans failed on
+// transport or timeout errors, for `cooldown`, during which replicas on other indexers are preferred.
+// Once the cooldown expires, the next failure opens it again, a success
+// closes it.
+type indexerHealth struct {
+	mu        sync.Mutex
+	load      *protobuf.IndexerLoad
+	updated   time.Time
+	failures  int
+	openUntil time.Time
+
+	threshold int
+	cooldown  time.Duration
+}
+
+func newIndexerHealth(config common.Config) *indexerHealth {
+	cooldown := time.Duration(config["load.breakerCooldown"].Int())
+	return &indexerHealth{
+		threshold: config["load.breakerThreshold"].Int(),
+		cooldown:  cooldown * time.Millisecond,
+	}
+}
+
+// updateLoad records the load piggybacked by the indexer on a response.
+func (h *indexerHealth) updateLoad(load *protobuf.IndexerLoad) {
+	if load == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load, h.updated = load, time.Now()
+}
+
+// scanDone feeds the circuit breaker with the outcome of a scan.
+func (h *indexerHealth) scanDone(err error) {
+	if err != nil && !isIndexerFailure(err) {
+		return // not the indexer's fault
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		h.failures, h.openUntil = 0, time.Time{}
+		return
+	}
+	if h.failures++; h.threshold > 0 && h.failures >= h.threshold {
+		h.openUntil = time.Now().Add(h.cooldown)
+	}
+}
+
+// isIndexerFailure tells whether a scan failed because the indexer could
+// not be reached or did not respond in time. Errors returned by the
+// indexer for the request itself, like an invalid scan or a missing
+// index, say nothing about its health. io.EOF is a pooled connection
+// closed by the indexer, the scan is retried on a new one.
+func isIndexerFailure(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true // dial, read or write failures, including timeouts.
+	}
+
+	switch err {
+	case io.ErrUnexpectedEOF, ErrorPoolTimeout, ErrorProtocol,
+		transport.ErrorPacketWrite, transport.ErrorPacketOverflow:
+		return true
+	case nil, io.EOF:
+		return false
+	}
+	return err.Error() == common.ErrScanTimedOut.Error()
+}
+
+// isOpen tells whether the circuit breaker keeps scans away from the
+// indexer.
+func (h *indexerHealth) isOpen() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Now().Before(h.openUntil)
+}
+
+// cost estimates how much a new scan would wait on the indexer, relative
+// to an idle indexer, from the load reported no longer than `maxAge` ago.
+// Queued scans weigh more than running ones, and the cost grows steeply
+// as cpu or memory approach saturation.
+func (h *indexerHealth) cost(maxAge time.Duration) (float64, bool) {
+	h.mu.Lock()
+	load, updated := h.load, h.updated
+	h.mu.Unlock()
+
+	if load == nil || time.Since(updated) > maxAge {
+		return 0, false
+	}
+
+	work := 1 + float64(load.GetScansRunning()) +
+		2*float64(load.GetScansQueued()) + float64(load.GetSnapshotWaiters())
+	pressure := math.Max(load.GetCpuUtilization(), load.GetMemoryPressure())
+	return work / math.Max(0.05, 1-pressure), true
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestIndexerHealthBreaker(t *testing.T) {
+	h := &indexerHealth{threshold: 2, cooldown: time.Hour}
+	transportErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+
+	// errors returned by the indexer for the request are not failures.
+	for i := 0; i < 5; i++ {
+		h.scanDone(errors.New("Index Not Found"))
+		h.scanDone(io.EOF)
+		h.scanDone(errors.New(common.ErrClientCancel.Error()))
+	}
+	if h.failures != 0 || h.isOpen() {
+		t.Errorf("Expected closed breaker without failures, received %v", h.failures)
+	}
+
+	h.scanDone(transportErr)
+	if h.isOpen() {
+		t.Errorf("Expected closed breaker below threshold")
+	}
+	h.scanDone(errors.New(common.ErrScanTimedOut.Error()))
+	if !h.isOpen() {
+		t.Errorf("Expected open breaker after %v failures", h.failures)
+	}
+
+	h.scanDone(nil)
+	if h.failures != 0 || h.isOpen() {
+		t.Errorf("Expected success to close the breaker, received %v", h.failures)
+	}
+
+	// once the cooldown expires, the next failure opens the breaker again.
+	h.cooldown = time.Millisecond
+	h.scanDone(ErrorPoolTimeout)
+	h.scanDone(io.ErrUnexpectedEOF)
+	time.Sleep(5 * time.Millisecond)
+	if h.isOpen() {
+		t.Errorf("Expected closed breaker after cooldown")
+	}
+	h.cooldown = time.Hour
+	h.scanDone(ErrorProtocol)
+	if !h.isOpen() {
+		t.Errorf("Expected open breaker after failure past cooldown")
+	}
+}
+
+func TestIsIndexerFailure(t *testing.T) {
+	failures := []error{
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+		io.ErrUnexpectedEOF, ErrorPoolTimeout, ErrorProtocol,
+		errors.New(common.ErrScanTimedOut.Error()),
+	}
+	for _, err := range failures {
+		if !isIndexerFailure(err) {
+			t.Errorf("Expected %v to be an indexer failure", err)
+		}
+	}
+
+	others := []error{
+		nil, io.EOF, ErrorIndexNotFound, errors.New("Invalid scan range"),
+		errors.New(common.ErrClientCancel.Error()),
+	}
+	for _, err := range others {
+		if isIndexerFailure(err) {
+			t.Errorf("Expected %v not to be an indexer failure", err)
+		}
+	}
+}
+
+func TestIndexerHealthCost(t *testing.T) {
+	h := &indexerHealth{}
+	if _, ok := h.cost(time.Second); ok {
+		t.Errorf("Expected no cost without load")
+	}
+
+	h.updateLoad(&protobuf.IndexerLoad{})
+	if cost, ok := h.cost(time.Second); !ok || cost != 1 {
+		t.Errorf("Expected %v, received %v %v", 1, cost, ok)
+	}
+
+	// 1 + 2 running + 2*1 queued + 1 waiter, at half the capacity.
+	h.updateLoad(&protobuf.IndexerLoad{
+		ScansRunning:    proto.Uint64(2),
+		ScansQueued:     proto.Uint64(1),
+		SnapshotWaiters: proto.Uint64(1),
+		CpuUtilization:  proto.Float64(0.5),
+		MemoryPressure:  proto.Float64(0.25),
+	})
+	if cost, _ := h.cost(time.Second); math.Abs(cost-12) > 1e-9 {
+		t.Errorf("Expected %v, received %v", 12, cost)
+	}
+
+	// saturation is bounded.
+	h.updateLoad(&protobuf.IndexerLoad{MemoryPressure: proto.Float64(1)})
+	if cost, _ := h.cost(time.Second); math.Abs(cost-20) > 1e-9 {
+		t.Errorf("Expected %v, received %v", 20, cost)
+	}
+
+	// stale load is ignored.
+	h.updated = time.Now().Add(-2 * time.Second)
+	if _, ok := h.cost(time.Second); ok {
+		t.Errorf("Expected no cost with stale load")
+	}
+}
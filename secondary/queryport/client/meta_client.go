@@ -32,6 +32,10 @@ type metadataClient struct {
 	logtick                 time.Duration
 	randomWeight            float64 // value between [0, 1.0)
 	equivalenceFactor       float64 // value between [0, 1.0)
+	maxLoadAge              time.Duration
+
+	// load and circuit breaker of the indexer at queryport.
+	scanHealth func(queryport string) *indexerHealth
 
 	topoChangeLock sync.Mutex
 	metaCh         chan bool
@@ -56,7 +60,8 @@ type indexTopology struct {
 }
 
 func newMetaBridgeClient(
-	cluster string, config common.Config, metaCh chan bool, settings *ClientSettings) (c *metadataClient, err error) {
+	cluster string, config common.Config, metaCh chan bool, settings *ClientSettings,
+	scanHealth func(string) *indexerHealth) (c *metadataClient, err error) {
 
 	b := &metadataClient{
 		cluster:    cluster,
@@ -64,11 +69,13 @@ func newMetaBridgeClient(
 		metaCh:     metaCh,
 		mdNotifyCh: make(chan bool, 1),
 		settings:   settings,
+		scanHealth: scanHealth,
 	}
 	b.servicesNotifierRetryTm = config["servicesNotifierRetryTm"].Int()
 	b.logtick = time.Duration(config["logtick"].Int()) * time.Millisecond
 	b.randomWeight = config["load.randomWeight"].Float64()
 	b.equivalenceFactor = config["load.equivalenceFactor"].Float64()
+	b.maxLoadAge = time.Duration(config["load.maxAge"].Int()) * time.Millisecond
 	// initialize meta-data-provide.
 	uuid, err := common.NewUUID()
 	if err != nil {
@@ -254,6 +261,48 @@ func (b *metadataClient) MoveIndex(defnID uint64, planJSON map[string]interface{
 	return nil
 }
 
+// AlterIndex implements BridgeAccessor{} interface.
+func (b *metadataClient) AlterIndex(
+	defnID uint64, exprType, partnExpr, whereExpr string,
+	secExprs []string, desc []bool,
+	planJSON []byte) (uint64, error) {
+
+	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+	if _, ok := currmeta.defns[common.IndexDefnId(defnID)]; !ok {
+		return 0, ErrorIndexNotFound
+	}
+
+	plan := make(map[string]interface{})
+	if planJSON != nil && len(planJSON) > 0 {
+		err := json.Unmarshal(planJSON, &plan)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	refreshCnt := 0
+RETRY:
+	newDefnID, err, needRefresh := b.mdClient.AlterIndex(
+		common.IndexDefnId(defnID), exprType, partnExpr, whereExpr,
+		secExprs, desc, plan)
+
+	if needRefresh && refreshCnt == 0 {
+		fmsg := "GsiClient: Indexer Node List is out-of-date.  Require refresh."
+		logging.Debugf(fmsg)
+		if err := b.updateIndexerList(false); err != nil {
+			logging.Errorf("updateIndexerList(): %v\n", err)
+			return uint64(newDefnID), err
+		}
+		refreshCnt++
+		goto RETRY
+	}
+	if newDefnID != 0 { // cleanup index local cache.
+		currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+		b.safeupdate(currmeta.adminports, true /*force*/)
+	}
+	return uint64(newDefnID), err
+}
+
 // DropIndex implements BridgeAccessor{} interface.
 func (b *metadataClient) DropIndex(defnID uint64) error {
 	err := b.mdClient.DropIndex(common.IndexDefnId(defnID))
@@ -282,16 +331,11 @@ func (b *metadataClient) GetScanport(
 	var inst *mclient.InstanceDefn
 
 	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+	replicas := b.availableReplicas(currmeta, defnID, excludes)
 	if rand.Float64() < b.randomWeight {
-		var replicas [128]uint64
-		n := 0
-		for _, replicaID := range currmeta.replicas[common.IndexDefnId(defnID)] {
-			replicas[n] = uint64(replicaID)
-			n++
-		}
-		inst, ok = b.pickRandom(replicas[:n], defnID, excludes)
+		inst, ok = b.pickTwoChoices(replicas, defnID, excludes)
 	} else {
-		inst, ok = b.pickOptimal(defnID, excludes)
+		inst, ok = b.pickOptimal(replicas, defnID, excludes)
 	}
 
 	if !ok {
@@ -311,6 +355,29 @@ func (b *metadataClient) GetScanport(
 	return qp, targetDefnID, targetInstID, true
 }
 
+// GetPartitionScanport implements BridgeAccessor{} interface.
+func (b *metadataClient) GetPartitionScanport(
+	defnID uint64, partnId uint64) (queryport string, ok bool) {
+
+	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+	index, ok := currmeta.defns[common.IndexDefnId(defnID)]
+	if !ok || index.Definition == nil {
+		return "", false
+	}
+
+	// partition is hosted by the instance on its node.
+	replicaId := index.Definition.PartitionNode(common.PartitionId(partnId))
+	for _, inst := range index.Instances {
+		if inst.ReplicaId != replicaId || inst.State != common.INDEX_STATE_ACTIVE {
+			continue
+		}
+		if queryport, ok = currmeta.queryports[inst.IndexerId]; ok {
+			return queryport, true
+		}
+	}
+	return "", false
+}
+
 // Timeit implement BridgeAccessor{} interface.
 func (b *metadataClient) Timeit(instID uint64, value float64) {
 
@@ -446,7 +513,7 @@ func (b *metadataClient) equivalentIndex(
 
 	d1, d2 := index1.Definition, index2.Definition
 	if d1.Using != d1.Using ||
-		d1.Bucket != d2.Bucket ||
+		d1.KeyspaceId() != d2.KeyspaceId() ||
 		d1.IsPrimary != d2.IsPrimary ||
 		d1.ExprType != d2.ExprType ||
 		d1.PartitionScheme != d2.PartitionScheme ||
@@ -525,18 +592,65 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64, excludes m
 	return nil, false
 }
 
+// pick two random replicas and return the one whose indexer reports the
+// least load. If either indexer has not reported its load recently, the
+// client side load averages are compared instead.
+func (b *metadataClient) pickTwoChoices(replicas []uint64, defnID uint64, excludes map[uint64]bool) (*mclient.InstanceDefn, bool) {
+	var actvReplicas [128]uint64
+	n := 0
+	for _, replicaID := range replicas {
+		state, _ := b.indexInstState(replicaID)
+		if state == common.INDEX_STATE_ACTIVE && (excludes == nil || !excludes[replicaID]) {
+			actvReplicas[n] = replicaID
+			n++
+		}
+	}
+	if n < 2 {
+		return b.pickRandom(actvReplicas[:n], defnID, excludes)
+	}
+
+	i := rand.Intn(n)
+	j := rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+	first, second := actvReplicas[i], actvReplicas[j]
+
+	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+	cost1, ok1 := b.indexerCost(currmeta, first)
+	cost2, ok2 := b.indexerCost(currmeta, second)
+	if !ok1 || !ok2 {
+		cost1, cost2 = 0, 0
+		if load, ok := currmeta.loads[common.IndexInstId(first)]; ok {
+			cost1 = load.getValue()
+		}
+		if load, ok := currmeta.loads[common.IndexInstId(second)]; ok {
+			cost2 = load.getValue()
+		}
+	}
+
+	chosen := first
+	if cost2 < cost1 {
+		chosen = second
+	}
+	if inst, ok := currmeta.insts[common.IndexInstId(chosen)]; ok {
+		return inst, true
+	}
+	return nil, false
+}
+
 // pick an optimal replica for the index `defnID` under least load.
-func (b *metadataClient) pickOptimal(defnID uint64, excludes map[uint64]bool) (*mclient.InstanceDefn, bool) {
+func (b *metadataClient) pickOptimal(replicas []uint64, defnID uint64, excludes map[uint64]bool) (*mclient.InstanceDefn, bool) {
 	// gather active-replicas
 	var actvReplicas [128]uint64
 	var loadList [128]float64
 	n := 0
 	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
-	for _, replicaID := range currmeta.replicas[common.IndexDefnId(defnID)] {
-		state, _ := b.indexInstState(uint64(replicaID))
-		if state == common.INDEX_STATE_ACTIVE && (excludes == nil || !excludes[uint64(replicaID)]) {
-			actvReplicas[n] = uint64(replicaID)
-			load, ok := currmeta.loads[replicaID]
+	for _, replicaID := range replicas {
+		state, _ := b.indexInstState(replicaID)
+		if state == common.INDEX_STATE_ACTIVE && (excludes == nil || !excludes[replicaID]) {
+			actvReplicas[n] = replicaID
+			load, ok := currmeta.loads[common.IndexInstId(replicaID)]
 			if !ok {
 				loadList[n] = 0.0
 			} else {
@@ -555,17 +669,66 @@ func (b *metadataClient) pickOptimal(defnID uint64, excludes map[uint64]bool) (*
 	sort.Float64s(loadList[:n])
 	leastLoad := loadList[0]
 
-	var replicas [128]uint64
+	var equivReplicas [128]uint64
 	// gather list of replicas with equivalent load
 	m := 0
 	for _, replicaID := range actvReplicas[:n] {
 		load, ok := currmeta.loads[common.IndexInstId(replicaID)]
 		if !ok || (load.getValue()*b.equivalenceFactor <= leastLoad) {
-			replicas[m] = replicaID
+			equivReplicas[m] = replicaID
 			m++
 		}
 	}
-	return b.pickRandom(replicas[:m], defnID, excludes)
+	return b.pickRandom(equivReplicas[:m], defnID, excludes)
+}
+
+// availableReplicas returns the replicas of index `defnID`, leaving out
+// those on indexers whose circuit breaker is open, unless no other active
+// replica is left to scan.
+func (b *metadataClient) availableReplicas(
+	currmeta *indexTopology, defnID uint64, excludes map[uint64]bool) []uint64 {
+
+	replicas := currmeta.replicas[common.IndexDefnId(defnID)]
+	all := make([]uint64, 0, len(replicas))
+	healthy := make([]uint64, 0, len(replicas))
+	for _, replicaID := range replicas {
+		all = append(all, uint64(replicaID))
+		state, _ := b.indexInstState(uint64(replicaID))
+		if state != common.INDEX_STATE_ACTIVE || excludes[uint64(replicaID)] {
+			continue
+		}
+		if health := b.indexerHealth(currmeta, uint64(replicaID)); health == nil || !health.isOpen() {
+			healthy = append(healthy, uint64(replicaID))
+		}
+	}
+	if len(healthy) > 0 {
+		return healthy
+	}
+	return all
+}
+
+func (b *metadataClient) indexerHealth(currmeta *indexTopology, instID uint64) *indexerHealth {
+	if b.scanHealth == nil {
+		return nil
+	}
+	inst, ok := currmeta.insts[common.IndexInstId(instID)]
+	if !ok {
+		return nil
+	}
+	queryport, ok := currmeta.queryports[inst.IndexerId]
+	if !ok {
+		return nil
+	}
+	return b.scanHealth(queryport)
+}
+
+// indexerCost returns the cost of scanning replica `instID` from the load
+// recently reported by its indexer.
+func (b *metadataClient) indexerCost(currmeta *indexTopology, instID uint64) (float64, bool) {
+	if health := b.indexerHealth(currmeta, instID); health != nil {
+		return health.cost(b.maxLoadAge)
+	}
+	return 0, false
 }
 
 func (b *metadataClient) pickReplicaInRebalance(defnID uint64) (*mclient.InstanceDefn, bool) {
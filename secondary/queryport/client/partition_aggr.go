@@ -0,0 +1,390 @@
+package client
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "strconv"
+
+import "github.com/couchbase/indexing/secondary/collatejson"
+import "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/logging"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+
+// partitionAggrScan shall scan a single partition of an index using `qc`,
+// with aggregates re-written for the partition.
+type partitionAggrScan func(qc *GsiScanClient, groupAggr *GroupAggr,
+	callb ResponseHandler) (error, bool)
+
+// partitionAggr merges partial aggregates from partitions of an index.
+// Partial COUNT and SUM of DISTINCT values cannot be merged, instead
+// partitions also group on the distinct key and its distinct values are
+// aggregated while merging. MIN and MAX of DISTINCT values are the same
+// as MIN and MAX of all values.
+type partitionAggr struct {
+	groupAggr *GroupAggr // evaluated by partitions
+	aggrs     []*Aggregate
+	nkeys     int    // group keys of the request
+	aggrPos   []int  // position of aggrs in partition rows, -1 if distinct
+	distinct  bool   // partitions group on the distinct key
+	desc      []bool // of group keys, nil if all are ascending
+}
+
+// aggrGroup is a group merged from partial aggregates of partitions.
+type aggrGroup struct {
+	code    []byte // collated group key
+	keys    []json.RawMessage
+	aggrs   []json.RawMessage
+	values  map[string]bool // distinct values in collatejson encoding
+	count   int64           // of distinct values
+	numbers int64           // of distinct numeric values
+	sum     float64
+}
+
+// newPartitionAggr re-writes `groupAggr` for partitions of `index`,
+// DISTINCT aggregates are supported only over a single key position.
+func newPartitionAggr(
+	index *common.IndexDefn, groupAggr *GroupAggr) (*partitionAggr, error) {
+
+	pa := &partitionAggr{
+		groupAggr: &GroupAggr{Group: append([]int32(nil), groupAggr.Group...)},
+		aggrs:     groupAggr.Aggrs,
+		nkeys:     len(groupAggr.Group),
+	}
+	distinctPos := int32(-1)
+	for _, aggr := range groupAggr.Aggrs {
+		fn := aggr.AggrFunc
+		if aggr.Distinct && aggr.KeyPos >= 0 && (fn == AggrCount || fn == AggrSum) {
+			if distinctPos >= 0 && aggr.KeyPos != distinctPos {
+				return nil, ErrorAggrDistinct
+			}
+			distinctPos = aggr.KeyPos
+			pa.aggrPos = append(pa.aggrPos, -1)
+			continue
+		}
+		pa.aggrPos = append(pa.aggrPos, len(pa.groupAggr.Aggrs))
+		pa.groupAggr.Aggrs = append(pa.groupAggr.Aggrs,
+			&Aggregate{AggrFunc: fn, KeyPos: aggr.KeyPos})
+	}
+	if distinctPos >= 0 {
+		pa.groupAggr.Group = append(pa.groupAggr.Group, distinctPos)
+		pa.distinct = true
+	}
+
+	for i, pos := range groupAggr.Group {
+		if int(pos) < len(index.Desc) && index.Desc[pos] {
+			if pa.desc == nil {
+				pa.desc = make([]bool, len(groupAggr.Group))
+			}
+			pa.desc[i] = true
+		}
+	}
+	return pa, nil
+}
+
+// scatterGroupAggr fans out `scan` to every partition of `index`, each
+// partition streams partial aggregates for its groups in index order of
+// group keys, which are merged by group key as they arrive and passed to
+// callb in the same order. Offset and limit are applied on the merged
+// rows.
+func (c *GsiClient) scatterGroupAggr(
+	qc *GsiScanClient, index *common.IndexDefn, requestId string,
+	groupAggr *GroupAggr, offset, limit int64,
+	scan partitionAggrScan, callb ResponseHandler) (error, bool) {
+
+	pa, err := newPartitionAggr(index, groupAggr)
+	if err != nil {
+		return err, false
+	}
+
+	cursors, stop := c.streamPartitions(qc, index, allPartitions(index),
+		func(pqc *GsiScanClient, callb ResponseHandler) (error, bool) {
+			return scan(pqc, pa.groupAggr, callb)
+		})
+	err, partial, stopped := pa.merge(cursors, offset, limit, callb)
+	stop()
+
+	if err == nil {
+		for _, cur := range cursors {
+			if cur.err != nil {
+				err = fmt.Errorf("partition %v: %v", cur.partnId, cur.err)
+				break
+			}
+		}
+	}
+	if err == nil && !stopped {
+		callb(&protobuf.StreamEndResponse{Trace: partitionTrace(requestId, cursors)})
+	}
+	if err != nil {
+		logging.Errorf("scatterGroupAggr(%v) failed for index %v: %v",
+			requestId, index.DefnId, err)
+	}
+	return err, partial
+}
+
+// merge does a k-way merge of partition rows on group key, a group is
+// passed to callb once every partition has moved past it. Returns whether
+// any rows were passed to callb and whether callb asked to stop the scan.
+func (pa *partitionAggr) merge(
+	cursors []*partitionCursor, offset, limit int64,
+	callb ResponseHandler) (err error, partial, stopped bool) {
+
+	codec := collatejson.NewCodec(16)
+	nvals := len(pa.groupAggr.Group) + len(pa.groupAggr.Aggrs)
+
+	// advance cursor to the next row, returns false if the partition
+	// is exhausted.
+	next := func(cur *partitionCursor) (bool, error) {
+		if len(cur.entries) > 0 {
+			cur.entries = cur.entries[1:]
+		}
+		for len(cur.entries) == 0 {
+			entries, ok := <-cur.ch
+			if !ok {
+				return false, cur.err
+			}
+			cur.entries = entries
+		}
+		row := cur.entries[0].GetEntryKey()
+		cur.vals = nil
+		if err := json.Unmarshal(row, &cur.vals); err != nil {
+			return false, err
+		} else if len(cur.vals) != nvals {
+			return false, fmt.Errorf("Invalid aggregate row %s", row)
+		}
+		key, err := json.Marshal(cur.vals[:pa.nkeys])
+		if err != nil {
+			return false, err
+		}
+		code, err := collateEntryKey(
+			codec, &protobuf.IndexEntry{EntryKey: key}, pa.desc, cur.code)
+		cur.code = code
+		return true, err
+	}
+
+	active := make([]*partitionCursor, 0, len(cursors))
+	for _, cur := range cursors {
+		ok, err := next(cur)
+		if err != nil {
+			return err, false, false
+		} else if ok {
+			active = append(active, cur)
+		}
+	}
+
+	var skipped, emitted int64
+	out := make([]*protobuf.IndexEntry, 0, scatterBatchSize)
+
+	// emit a merged group, returns true once limit is reached or callb
+	// asked to stop.
+	emit := func(group *aggrGroup) (bool, error) {
+		if skipped < offset {
+			skipped++
+			return false, nil
+		}
+		entry, err := pa.groupRow(group)
+		if err != nil {
+			return false, err
+		}
+		out = append(out, entry)
+		emitted++
+
+		done := limit > 0 && emitted >= limit
+		if len(out) == cap(out) || done {
+			partial = true
+			if !callb(&protobuf.ResponseStream{IndexEntries: out}) {
+				stopped = true
+				return true, nil
+			}
+			out = make([]*protobuf.IndexEntry, 0, scatterBatchSize)
+		}
+		return done, nil
+	}
+
+	var group *aggrGroup
+	for len(active) > 0 {
+		least := 0
+		for i := 1; i < len(active); i++ {
+			if bytes.Compare(active[i].code, active[least].code) < 0 {
+				least = i
+			}
+		}
+		cur := active[least]
+
+		if group == nil || !bytes.Equal(group.code, cur.code) {
+			if group != nil {
+				if done, err := emit(group); err != nil || done {
+					return err, partial, stopped
+				}
+			}
+			group = pa.newGroup(cur.code, cur.vals)
+		}
+		if err := pa.addRow(codec, group, cur.vals); err != nil {
+			return err, partial, false
+		}
+
+		ok, err := next(cur)
+		if err != nil {
+			return err, partial, false
+		} else if !ok {
+			active = append(active[:least], active[least+1:]...)
+		}
+	}
+
+	// aggregates without group keys always produce a single row, even
+	// if no entry qualified.
+	if group == nil && pa.nkeys == 0 {
+		group = pa.newGroup(nil, nil)
+	}
+	if group != nil {
+		if done, err := emit(group); err != nil || done {
+			return err, partial, stopped
+		}
+	}
+	if len(out) > 0 {
+		partial = true
+		if !callb(&protobuf.ResponseStream{IndexEntries: out}) {
+			return nil, partial, true
+		}
+	}
+	return nil, partial, false
+}
+
+func (pa *partitionAggr) newGroup(code []byte, vals []json.RawMessage) *aggrGroup {
+	group := &aggrGroup{
+		code:  append([]byte(nil), code...),
+		aggrs: make([]json.RawMessage, len(pa.aggrs)),
+	}
+	if vals != nil {
+		group.keys = vals[:pa.nkeys]
+	}
+	if pa.distinct {
+		group.values = make(map[string]bool)
+	}
+	return group
+}
+
+// addRow merges partial aggregates of a partition row into its group.
+func (pa *partitionAggr) addRow(
+	codec *collatejson.Codec, group *aggrGroup, vals []json.RawMessage) error {
+
+	var err error
+	aggrs := vals[len(pa.groupAggr.Group):]
+	for i, aggr := range pa.aggrs {
+		if pos := pa.aggrPos[i]; pos >= 0 {
+			group.aggrs[i], err = mergeAggrValue(
+				codec, aggr.AggrFunc, group.aggrs[i], aggrs[pos])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !pa.distinct {
+		return nil
+	}
+
+	// null and missing values are ignored, like the indexer does.
+	val := vals[pa.nkeys]
+	code, err := encodeAggrValue(codec, val)
+	if err != nil {
+		return err
+	}
+	switch code[0] {
+	case collatejson.TypeMissing, collatejson.TypeNull:
+		return nil
+	}
+	if group.values[string(code)] {
+		return nil
+	}
+	group.values[string(code)] = true
+	group.count++
+	if code[0] == collatejson.TypeNumber {
+		n, err := strconv.ParseFloat(string(val), 64)
+		if err != nil {
+			return err
+		}
+		group.sum += n
+		group.numbers++
+	}
+	return nil
+}
+
+// groupRow returns a merged group as group key values followed by
+// aggregate values.
+func (pa *partitionAggr) groupRow(group *aggrGroup) (*protobuf.IndexEntry, error) {
+	vals := make([]json.RawMessage, 0, len(group.keys)+len(pa.aggrs))
+	vals = append(vals, group.keys...)
+	for i, aggr := range pa.aggrs {
+		val := group.aggrs[i]
+		switch {
+		case pa.aggrPos[i] < 0 && aggr.AggrFunc == AggrCount:
+			val = json.RawMessage(strconv.FormatInt(group.count, 10))
+		case pa.aggrPos[i] < 0 && group.numbers > 0:
+			val = json.RawMessage(strconv.FormatFloat(group.sum, 'f', -1, 64))
+		case isNullValue(val) && aggr.AggrFunc == AggrCount:
+			val = json.RawMessage("0")
+		case isNullValue(val):
+			val = json.RawMessage("null")
+		}
+		vals = append(vals, val)
+	}
+	key, err := json.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+	return &protobuf.IndexEntry{EntryKey: key, PrimaryKey: []byte{}}, nil
+}
+
+// mergeAggrValue merges two partial aggregates, null is an aggregate over
+// no values.
+func mergeAggrValue(codec *collatejson.Codec, fn AggrFuncType,
+	x, y json.RawMessage) (json.RawMessage, error) {
+
+	if isNullValue(y) {
+		return x, nil
+	} else if isNullValue(x) {
+		return y, nil
+	}
+
+	switch fn {
+	case AggrMin, AggrMax:
+		cx, err := encodeAggrValue(codec, x)
+		if err != nil {
+			return nil, err
+		}
+		cy, err := encodeAggrValue(codec, y)
+		if err != nil {
+			return nil, err
+		}
+		cmp := bytes.Compare(cx, cy)
+		if (fn == AggrMin && cmp > 0) || (fn == AggrMax && cmp < 0) {
+			return y, nil
+		}
+		return x, nil
+
+	case AggrSum, AggrCount:
+		nx, err := strconv.ParseFloat(string(x), 64)
+		if err != nil {
+			return nil, err
+		}
+		ny, err := strconv.ParseFloat(string(y), 64)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(strconv.FormatFloat(nx+ny, 'f', -1, 64)), nil
+	}
+	return nil, fmt.Errorf("Invalid aggregate function %v", fn)
+}
+
+func isNullValue(val json.RawMessage) bool {
+	return len(val) == 0 || bytes.Equal(bytes.TrimSpace(val), []byte("null"))
+}
+
+// encodeAggrValue encodes a value into collatejson to compare values
+// the way index collates them.
+func encodeAggrValue(codec *collatejson.Codec, val interface{}) ([]byte, error) {
+	text, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(text, make([]byte, 0, 3*len(text)+collatejson.MinBufferSize))
+}
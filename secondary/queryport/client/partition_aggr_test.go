@@ -0,0 +1,188 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+// testAggrCursors returns a cursor per partition streaming its
+// aggregate rows.
+func testAggrCursors(partitions ...[]string) []*partitionCursor {
+	rows := make([][][2]string, 0, len(partitions))
+	for _, keys := range partitions {
+		prows := make([][2]string, 0, len(keys))
+		for _, key := range keys {
+			prows = append(prows, [2]string{key, ""})
+		}
+		rows = append(rows, prows)
+	}
+	return testCursors(rows...)
+}
+
+func testMergeAggr(t *testing.T, index *common.IndexDefn, groupAggr *GroupAggr,
+	cursors []*partitionCursor, offset, limit int64) []string {
+
+	pa, err := newPartitionAggr(index, groupAggr)
+	if err != nil {
+		t.Fatalf("newPartitionAggr: %v", err)
+	}
+	rows := []string{}
+	callb := func(resp ResponseReader) bool {
+		for _, entry := range resp.(*protobuf.ResponseStream).GetIndexEntries() {
+			rows = append(rows, string(entry.GetEntryKey()))
+		}
+		return true
+	}
+	if err, _, _ := pa.merge(cursors, offset, limit, callb); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	return rows
+}
+
+func TestMergeGroupAggr(t *testing.T) {
+	index := &common.IndexDefn{SecExprs: []string{"city", "age"}}
+	groupAggr := &GroupAggr{
+		Group: []int32{0},
+		Aggrs: []*Aggregate{
+			{AggrFunc: AggrSum, KeyPos: 1},
+			{AggrFunc: AggrMin, KeyPos: 1},
+			{AggrFunc: AggrMax, KeyPos: 1},
+			{AggrFunc: AggrCount, KeyPos: -1},
+		},
+	}
+	p0 := []string{`["austin",10,10,10,1]`, `["boston",2.5,2.5,2.5,1]`}
+	p1 := []string{`["austin",null,null,null,1]`, `["chicago",1,1,1,1]`}
+	p2 := []string{`["austin",5,1,4,2]`, `["boston",null,"n","n",1]`}
+
+	rows := testMergeAggr(t, index, groupAggr, testAggrCursors(p0, p1, p2), 0, 0)
+	expected := []string{
+		`["austin",15,1,10,4]`,
+		`["boston",2.5,2.5,"n",2]`,
+		`["chicago",1,1,1,1]`,
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+
+	// offset and limit apply on merged groups.
+	rows = testMergeAggr(t, index, groupAggr, testAggrCursors(p0, p1, p2), 1, 1)
+	if !reflect.DeepEqual(rows, expected[1:2]) {
+		t.Errorf("Expected %v, received %v", expected[1:2], rows)
+	}
+
+	// partitions stream groups of a desc key in descending order.
+	index.Desc = []bool{true, false}
+	r0 := []string{`["boston",2.5,2.5,2.5,1]`, `["austin",10,10,10,1]`}
+	r1 := []string{`["chicago",1,1,1,1]`, `["austin",5,1,4,2]`}
+	rows = testMergeAggr(t, index, groupAggr, testAggrCursors(r0, r1), 0, 0)
+	expected = []string{
+		`["chicago",1,1,1,1]`,
+		`["boston",2.5,2.5,2.5,1]`,
+		`["austin",15,1,10,3]`,
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+}
+
+func TestMergeGroupAggrDistinct(t *testing.T) {
+	index := &common.IndexDefn{SecExprs: []string{"city", "age", "name"}}
+	groupAggr := &GroupAggr{
+		Group: []int32{0},
+		Aggrs: []*Aggregate{
+			{AggrFunc: AggrCount, KeyPos: 1, Distinct: true},
+			{AggrFunc: AggrSum, KeyPos: 1, Distinct: true},
+			{AggrFunc: AggrMax, KeyPos: 2, Distinct: true},
+			{AggrFunc: AggrCount, KeyPos: -1},
+		},
+	}
+	pa, err := newPartitionAggr(index, groupAggr)
+	if err != nil {
+		t.Fatalf("newPartitionAggr: %v", err)
+	}
+	// partitions group on the distinct key, and evaluate the rest.
+	expected := &GroupAggr{
+		Group: []int32{0, 1},
+		Aggrs: []*Aggregate{
+			{AggrFunc: AggrMax, KeyPos: 2},
+			{AggrFunc: AggrCount, KeyPos: -1},
+		},
+	}
+	if !reflect.DeepEqual(pa.groupAggr, expected) {
+		t.Errorf("Expected %v, received %v", expected, pa.groupAggr)
+	}
+
+	p0 := []string{`["austin",10,"x",2]`, `["austin",20,"y",1]`, `["boston",null,"z",1]`}
+	p1 := []string{`["austin",10,"z",1]`, `["austin","n","a",1]`}
+	rows := testMergeAggr(t, index, groupAggr, testAggrCursors(p0, p1), 0, 0)
+	expectedRows := []string{`["austin",3,30,"z",5]`, `["boston",0,null,"z",1]`}
+	if !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("Expected %v, received %v", expectedRows, rows)
+	}
+
+	// aggregates without group keys produce a row with no entries.
+	groupAggr.Group = nil
+	rows = testMergeAggr(t, index, groupAggr, testAggrCursors(nil, nil), 0, 0)
+	expectedRows = []string{`[0,null,null,0]`}
+	if !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("Expected %v, received %v", expectedRows, rows)
+	}
+
+	// distinct values of different keys cannot be merged.
+	groupAggr.Aggrs = append(groupAggr.Aggrs,
+		&Aggregate{AggrFunc: AggrCount, KeyPos: 2, Distinct: true})
+	if _, err := newPartitionAggr(index, groupAggr); err != ErrorAggrDistinct {
+		t.Errorf("Expected %v, received %v", ErrorAggrDistinct, err)
+	}
+}
+
+func TestScatterGroupAggr(t *testing.T) {
+	c, stop := testPartitionClient(t)
+	defer stop()
+
+	scans := Scans{&Scan{Filter: []*CompositeElementFilter{
+		{Low: common.MinUnbounded, High: common.MaxUnbounded, Inclusion: Both},
+	}}}
+	groupAggr := &GroupAggr{
+		Group: []int32{0},
+		Aggrs: []*Aggregate{{AggrFunc: AggrCount, KeyPos: -1}},
+	}
+	scan3 := func(offset, limit int64) ([]string, error) {
+		var rows []string
+		var err error
+		c.Scan3(10, "req", scans, false, groupAggr, offset, limit,
+			common.AnyConsistency, nil, func(resp ResponseReader) bool {
+				if err = resp.Error(); err != nil {
+					return false
+				}
+				if stream, ok := resp.(*protobuf.ResponseStream); ok {
+					for _, entry := range stream.GetIndexEntries() {
+						rows = append(rows, string(entry.GetEntryKey()))
+					}
+				}
+				return true
+			})
+		return rows, err
+	}
+
+	// groups of keys hashed to partitions on both nodes are merged.
+	rows, err := scan3(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`["a",2]`, `["b",2]`, `["c",1]`, `["d",2]`}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+
+	rows, err = scan3(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows, expected[1:3]) {
+		t.Errorf("Expected %v, received %v", expected[1:3], rows)
+	}
+}
@@ -0,0 +1,354 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/couchbase/indexing/secondary/queryport"
+	"github.com/golang/protobuf/proto"
+)
+
+// testPartitionRows are rows, as {entry-key, docid}, of a hash partitioned
+// index with 4 partitions, in index order within each partition. Key
+// "a" and "b" are hashed to more than one partition.
+var testPartitionRows = [][][2]string{
+	{{`["a"]`, "d1"}, {`["b"]`, "d2"}},
+	{{`["a"]`, "d3"}, {`["c"]`, "d4"}},
+	{{`["b"]`, "d5"}},
+	{{`["d"]`, "d6"}, {`["d"]`, "d7"}},
+}
+
+// testPartitionBridge serves a partitioned index whose partitions are
+// spread over indexer nodes, scans are started on the first node.
+type testPartitionBridge struct {
+	BridgeAccessor
+	index      *common.IndexDefn
+	queryports []string
+}
+
+func (b *testPartitionBridge) IndexState(defnID uint64) (common.IndexState, error) {
+	return common.INDEX_STATE_ACTIVE, nil
+}
+
+func (b *testPartitionBridge) IsPrimary(defnID uint64) bool {
+	return false
+}
+
+func (b *testPartitionBridge) GetScanport(
+	defnID uint64, retry int, excludes map[uint64]bool) (string, uint64, uint64, bool) {
+
+	if excludes[100] {
+		return "", 0, 0, false
+	}
+	return b.queryports[0], defnID, 100, true
+}
+
+func (b *testPartitionBridge) GetPartitionScanport(
+	defnID uint64, partnId uint64) (string, bool) {
+
+	replicaId := b.index.PartitionNode(common.PartitionId(partnId))
+	return b.queryports[replicaId], true
+}
+
+func (b *testPartitionBridge) GetIndexDefn(defnID uint64) *common.IndexDefn {
+	return b.index
+}
+
+func (b *testPartitionBridge) Timeit(instID uint64, value float64) {
+}
+
+// testPartitionNode is an indexer node hosting `partitions` of the index,
+// requests are served from testPartitionRows.
+type testPartitionNode struct {
+	partitions map[uint64]bool
+}
+
+// rows returns rows of partitions requested in `partnIds`, all hosted
+// partitions if partnIds is empty.
+func (n *testPartitionNode) rows(partnIds []uint64) ([][][2]string, error) {
+	if len(partnIds) == 0 {
+		for partnId := range n.partitions {
+			partnIds = append(partnIds, partnId)
+		}
+	}
+	var rows [][][2]string
+	for _, partnId := range partnIds {
+		if !n.partitions[partnId] {
+			return nil, fmt.Errorf("partition %v not hosted", partnId)
+		}
+		rows = append(rows, testPartitionRows[partnId])
+	}
+	return rows, nil
+}
+
+func (n *testPartitionNode) handleRequest(
+	req interface{}, conn net.Conn, quitch <-chan bool) {
+
+	buf := make([]byte, 64*1024)
+	switch r := req.(type) {
+	case *protobuf.HeloRequest:
+		resp := &protobuf.HeloResponse{Version: proto.Uint32(common.INDEXER_CUR_VERSION)}
+		protobuf.EncodeAndWrite(conn, buf, resp)
+
+	case *protobuf.CountRequest:
+		resp := &protobuf.CountResponse{Count: proto.Int64(0)}
+		partitions, err := n.rows(r.GetPartitionIds())
+		if err != nil {
+			resp.Err = &protobuf.Error{Error: proto.String(err.Error())}
+		}
+		for _, rows := range partitions {
+			last := ""
+			for _, row := range rows {
+				if equals := r.GetSpan().GetEquals(); len(equals) > 0 &&
+					string(equals[0]) != row[0] {
+					continue
+				} else if r.GetDistinct() && row[0] == last {
+					continue
+				}
+				*resp.Count++
+				last = row[0]
+			}
+		}
+		protobuf.EncodeAndWrite(conn, buf, resp)
+
+	case *protobuf.StatisticsRequest:
+		stats := &protobuf.IndexStatistics{
+			KeysCount:       proto.Uint64(0),
+			UniqueKeysCount: proto.Uint64(0),
+			Sampled:         proto.Bool(false),
+		}
+		resp := &protobuf.StatisticsResponse{Stats: stats}
+		partitions, err := n.rows(r.GetPartitionIds())
+		if err != nil {
+			resp.Err = &protobuf.Error{Error: proto.String(err.Error())}
+		}
+		// distinct keys of partitions are added up, like the indexer does.
+		for _, rows := range partitions {
+			last := ""
+			for _, row := range rows {
+				if equals := r.GetSpan().GetEquals(); len(equals) > 0 &&
+					string(equals[0]) != row[0] {
+					continue
+				}
+				if stats.KeyMin == nil || row[0] < string(stats.KeyMin) {
+					stats.KeyMin = []byte(row[0])
+				}
+				if row[0] > string(stats.KeyMax) {
+					stats.KeyMax = []byte(row[0])
+				}
+				*stats.KeysCount++
+				if row[0] != last {
+					*stats.UniqueKeysCount++
+				}
+				last = row[0]
+			}
+		}
+		stats.Sampled = proto.Bool(len(partitions) > 1 && *stats.KeysCount > 0)
+		protobuf.EncodeAndWrite(conn, buf, resp)
+
+	case *protobuf.ScanRequest:
+		resp := &protobuf.ResponseStream{}
+		partitions, err := n.rows(r.GetPartitionIds())
+		if err != nil {
+			resp.Err = &protobuf.Error{Error: proto.String(err.Error())}
+		}
+		for _, rows := range partitions {
+			if r.GetGroupAggr() != nil {
+				resp.IndexEntries = append(resp.IndexEntries,
+					groupPartitionRows(rows, r.GetGroupAggr())...)
+				continue
+			}
+			last := ""
+			for _, row := range rows {
+				if r.GetDistinct() && row[0] == last {
+					continue
+				}
+				resp.IndexEntries = append(resp.IndexEntries, &protobuf.IndexEntry{
+					EntryKey: []byte(row[0]), PrimaryKey: []byte(row[1]),
+				})
+				last = row[0]
+			}
+		}
+		protobuf.EncodeAndWrite(conn, buf, resp)
+		protobuf.EncodeAndWrite(conn, buf, &protobuf.StreamEndResponse{})
+
+	default:
+		resp := &protobuf.ResponseStream{
+			Err: &protobuf.Error{Error: proto.String("unsupported request")},
+		}
+		protobuf.EncodeAndWrite(conn, buf, resp)
+	}
+}
+
+// groupPartitionRows groups rows of a partition on their key and counts
+// rows of each group for every aggregate of `groupAggr`.
+func groupPartitionRows(
+	rows [][2]string, groupAggr *protobuf.GroupAggr) []*protobuf.IndexEntry {
+
+	var entries []*protobuf.IndexEntry
+	for i := 0; i < len(rows); {
+		j := i
+		for j < len(rows) && rows[j][0] == rows[i][0] {
+			j++
+		}
+		key := strings.TrimSuffix(rows[i][0], "]")
+		for range groupAggr.GetAggrs() {
+			key += fmt.Sprintf(",%v", j-i)
+		}
+		entries = append(entries, &protobuf.IndexEntry{EntryKey: []byte(key + "]")})
+		i = j
+	}
+	return entries
+}
+
+// testPartitionClient returns a client for index 10, whose 4 partitions
+// are spread over two indexer nodes, and a function to stop the nodes.
+func testPartitionClient(t *testing.T) (*GsiClient, func()) {
+	index := &common.IndexDefn{
+		DefnId:          common.IndexDefnId(10),
+		PartitionScheme: common.HASH,
+		NumPartitions:   4,
+		Nodes:           []string{"n0", "n1"},
+		SecExprs:        []string{"name"},
+	}
+
+	config := common.SystemConfig.SectionConfig("queryport.client.", true)
+	qconfig := common.SystemConfig.SectionConfig("indexer.queryport.", true)
+	bridge := &testPartitionBridge{index: index}
+	clients := make(map[string]*GsiScanClient)
+	var servers []*queryport.Server
+	stop := func() {
+		for _, qc := range clients {
+			qc.Close()
+		}
+		for _, s := range servers {
+			s.Close()
+		}
+	}
+
+	for replicaId := range index.Nodes {
+		node := &testPartitionNode{partitions: make(map[uint64]bool)}
+		for partnId := 0; partnId < index.GetNumPartitions(); partnId++ {
+			if index.PartitionNode(common.PartitionId(partnId)) == replicaId {
+				node.partitions[uint64(partnId)] = true
+			}
+		}
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		addr := lis.Addr().String()
+		lis.Close()
+
+		s, err := queryport.NewServer(addr, node.handleRequest, qconfig)
+		if err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		servers = append(servers, s)
+		if clients[addr], err = NewGsiScanClient(addr, config); err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		bridge.queryports = append(bridge.queryports, addr)
+	}
+
+	c := &GsiClient{bridge: bridge, config: config}
+	atomic.StorePointer(&c.queryClients, unsafe.Pointer(&clients))
+	return c, stop
+}
+
+func TestScatterCount(t *testing.T) {
+	c, stop := testPartitionClient(t)
+	defer stop()
+
+	// the first node alone hosts partitions 0 and 2.
+	qcs := *((*map[string]*GsiScanClient)(atomic.LoadPointer(&c.queryClients)))
+	qc := qcs[c.bridge.(*testPartitionBridge).queryports[0]]
+	if count, err := qc.CountRange(10, "req", nil, nil, Both, common.AnyConsistency, nil); err != nil {
+		t.Fatal(err)
+	} else if count != 3 {
+		t.Errorf("Expected %v, received %v", 3, count)
+	}
+
+	count, err := c.CountRange(10, "req", nil, nil, Both, common.AnyConsistency, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if count != 7 {
+		t.Errorf("Expected %v, received %v", 7, count)
+	}
+
+	values := []common.SecondaryKey{{"a"}}
+	count, err = c.CountLookup(10, "req", values, common.AnyConsistency, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Errorf("Expected %v, received %v", 2, count)
+	}
+
+	scans := Scans{&Scan{Filter: []*CompositeElementFilter{
+		{Low: common.MinUnbounded, High: common.MaxUnbounded, Inclusion: Both},
+	}}}
+	count, err = c.MultiScanCount(10, "req", scans, false, common.AnyConsistency, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if count != 7 {
+		t.Errorf("Expected %v, received %v", 7, count)
+	}
+
+	// keys hashed to more than one partition are counted once.
+	count, err = c.MultiScanCount(10, "req", scans, true, common.AnyConsistency, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if count != 4 {
+		t.Errorf("Expected %v, received %v", 4, count)
+	}
+}
+
+func TestScatterStatistics(t *testing.T) {
+	c, stop := testPartitionClient(t)
+	defer stop()
+
+	stats, err := c.RangeStatistics(10, "req", nil, nil, Both)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := stats.(*protobuf.IndexStatistics)
+	if ps.GetKeysCount() != 7 {
+		t.Errorf("Expected %v, received %v", 7, ps.GetKeysCount())
+	}
+	// keys hashed to more than one partition are counted in each of them.
+	if ps.GetUniqueKeysCount() != 6 {
+		t.Errorf("Expected %v, received %v", 6, ps.GetUniqueKeysCount())
+	}
+	if !ps.GetSampled() {
+		t.Errorf("Expected %v, received %v", true, ps.GetSampled())
+	}
+	// min comes from the first node and max from the second.
+	if string(ps.GetKeyMin()) != `["a"]` || string(ps.GetKeyMax()) != `["d"]` {
+		t.Errorf("Expected %v/%v, received %s/%s",
+			`["a"]`, `["d"]`, ps.GetKeyMin(), ps.GetKeyMax())
+	}
+
+	stats, err = c.LookupStatistics(10, "req", common.SecondaryKey{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps = stats.(*protobuf.IndexStatistics)
+	if ps.GetKeysCount() != 2 || ps.GetUniqueKeysCount() != 2 {
+		t.Errorf("Expected %v/%v, received %v/%v",
+			2, 2, ps.GetKeysCount(), ps.GetUniqueKeysCount())
+	}
+	if string(ps.GetKeyMin()) != `["b"]` || string(ps.GetKeyMax()) != `["b"]` {
+		t.Errorf("Expected %v/%v, received %s/%s",
+			`["b"]`, `["b"]`, ps.GetKeyMin(), ps.GetKeyMax())
+	}
+}
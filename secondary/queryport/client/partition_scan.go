@@ -0,0 +1,571 @@
+package client
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "math"
+import "sync"
+import "sync/atomic"
+
+import "github.com/couchbase/indexing/secondary/collatejson"
+import "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/logging"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+
+import "github.com/golang/protobuf/proto"
+
+// number of merged rows passed to the caller in a single response.
+const scatterBatchSize = 256
+
+// partitionScan shall scan a single partition of an index using `qc`,
+// with projection, offset and limit re-written for the partition.
+type partitionScan func(qc *GsiScanClient, projection *IndexProjection,
+	offset, limit int64, callb ResponseHandler) (error, bool)
+
+// partitionCursor is the head of rows streamed from a single partition.
+type partitionCursor struct {
+	partnId uint64
+	ch      chan []*protobuf.IndexEntry
+	entries []*protobuf.IndexEntry
+	code    []byte            // collated entry key of entries[0]
+	vals    []json.RawMessage // decoded entries[0] of aggregate rows
+	trace   *protobuf.ScanTrace
+	err     error
+}
+
+// isScatterScan returns true if a scan on index needs to be fanned out
+// to each of its partitions and results merged.
+func isScatterScan(index *common.IndexDefn) bool {
+	return index.IsPartitioned() && !index.IsPrimary && index.GetNumPartitions() > 1
+}
+
+// scatterScan fans out `scan` to partitions `partnIds` of `index`, nil
+// means every partition, merges the rows from each partition in
+// collation order, descending if `reverse`, and passes them to callb.
+// Offset, limit, distinct and projection are applied on the merged rows.
+func (c *GsiClient) scatterScan(
+	qc *GsiScanClient, index *common.IndexDefn, requestId string,
+	partnIds []uint64, reverse, distinct bool, projection *IndexProjection,
+	offset, limit int64, scan partitionScan, callb ResponseHandler) (error, bool) {
+
+	// every partition should return atleast offset+limit rows, partitions
+	// cannot de-duplicate projected keys and return all their rows.
+	plimit := limit
+	if offset > 0 && limit > 0 && limit < math.MaxInt64-offset {
+		plimit = limit + offset
+	}
+	if distinct && projection != nil && len(projection.EntryKeys) > 0 {
+		plimit = math.MaxInt64
+	}
+
+	// rows are merged on full entry key, user projection is applied
+	// after merge.
+	var pprojection *IndexProjection
+	if projection != nil {
+		pprojection = &IndexProjection{PrimaryKey: true}
+		for i := range index.SecExprs {
+			pprojection.EntryKeys = append(pprojection.EntryKeys, int64(i))
+		}
+	}
+
+	if partnIds == nil {
+		partnIds = allPartitions(index)
+	}
+
+	cursors, stop := c.streamPartitions(qc, index, partnIds,
+		func(pqc *GsiScanClient, callb ResponseHandler) (error, bool) {
+			return scan(pqc, pprojection, 0, plimit, callb)
+		})
+	err, partial, stopped := c.mergePartitions(
+		index, cursors, reverse, distinct, projection, offset, limit, callb)
+	stop()
+
+	if err == nil {
+		for _, cur := range cursors {
+			if cur.err != nil {
+				err = fmt.Errorf("partition %v: %v", cur.partnId, cur.err)
+				break
+			}
+		}
+	}
+	if err == nil && !stopped {
+		callb(&protobuf.StreamEndResponse{Trace: partitionTrace(requestId, cursors)})
+	}
+	if err != nil {
+		logging.Errorf("scatterScan(%v) failed for index %v: %v",
+			requestId, index.DefnId, err)
+	}
+	return err, partial
+}
+
+// partitionCount shall count rows of a single partition of an index
+// using `qc`.
+type partitionCount func(qc *GsiScanClient) (int64, error)
+
+// scatterCount fans out `count` to partitions `partnIds` of `index`, nil
+// means every partition, each on the indexer node hosting it, and returns
+// the sum of partition counts.
+func (c *GsiClient) scatterCount(
+	qc *GsiScanClient, index *common.IndexDefn, requestId string,
+	partnIds []uint64, count partitionCount) (int64, error) {
+
+	if partnIds == nil {
+		partnIds = allPartitions(index)
+	}
+
+	counts := make([]int64, len(partnIds))
+	err := c.scatterRequest(qc, index, requestId, partnIds,
+		func(i int, pqc *GsiScanClient) (err error) {
+			counts[i], err = count(pqc)
+			return err
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
+
+// scatterRequest runs `request` for each of the partitions `partnIds` of
+// `index` in parallel, passing the position of the partition in partnIds
+// and a scan client for the indexer node hosting it. Returns the error of
+// the first partition that failed.
+func (c *GsiClient) scatterRequest(
+	qc *GsiScanClient, index *common.IndexDefn, requestId string,
+	partnIds []uint64, request func(int, *GsiScanClient) error) error {
+
+	errs := make([]error, len(partnIds))
+	var wg sync.WaitGroup
+	for i, partnId := range partnIds {
+		wg.Add(1)
+		go func(i int, partnId uint64) {
+			defer wg.Done()
+			pqc, err := c.partitionClient(qc, index, partnId)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = request(i, pqc)
+		}(i, partnId)
+	}
+	wg.Wait()
+
+	for i, partnId := range partnIds {
+		if errs[i] != nil {
+			err := fmt.Errorf("partition %v: %v", partnId, errs[i])
+			logging.Errorf("scatterRequest(%v) failed for index %v: %v",
+				requestId, index.DefnId, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// scatterDistinctCount counts distinct entry keys across all partitions
+// of `index` by merging distinct rows streamed by `scan` from each
+// partition.
+func (c *GsiClient) scatterDistinctCount(
+	qc *GsiScanClient, index *common.IndexDefn, requestId string,
+	scan partitionScan) (int64, error) {
+
+	var count int64
+	err, _ := c.scatterScan(
+		qc, index, requestId, nil, false, true /*distinct*/, nil, 0, math.MaxInt64,
+		scan, func(resp ResponseReader) bool {
+			if stream, ok := resp.(*protobuf.ResponseStream); ok {
+				count += int64(len(stream.GetIndexEntries()))
+			}
+			return true
+		})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// allPartitions returns ids of every partition of `index`.
+func allPartitions(index *common.IndexDefn) []uint64 {
+	partnIds := make([]uint64, 0, index.GetNumPartitions())
+	for i := 0; i < index.GetNumPartitions(); i++ {
+		partnIds = append(partnIds, uint64(i))
+	}
+	return partnIds
+}
+
+// streamPartitions starts `scan` on each of the partitions `partnIds` of
+// `index` and returns a cursor per partition, streaming its rows. Calling
+// stop cancels scans that are still running and waits for them to exit,
+// after which cursor errors can be read.
+func (c *GsiClient) streamPartitions(
+	qc *GsiScanClient, index *common.IndexDefn, partnIds []uint64,
+	scan func(*GsiScanClient, ResponseHandler) (error, bool)) (
+	cursors []*partitionCursor, stop func()) {
+
+	cursors = make([]*partitionCursor, 0, len(partnIds))
+	donech := make(chan bool)
+	var wg sync.WaitGroup
+	for _, partnId := range partnIds {
+		cur := &partitionCursor{
+			partnId: partnId,
+			ch:      make(chan []*protobuf.IndexEntry, 1),
+		}
+		cursors = append(cursors, cur)
+
+		wg.Add(1)
+		go func(cur *partitionCursor) {
+			defer wg.Done()
+			defer close(cur.ch)
+
+			pqc, err := c.partitionClient(qc, index, cur.partnId)
+			if err != nil {
+				cur.err = err
+				return
+			}
+			cur.err, _ = scan(pqc, func(resp ResponseReader) bool {
+				stream, ok := resp.(*protobuf.ResponseStream)
+				if !ok { // StreamEndResponse
+					cur.trace = Trace(resp)
+					return true
+				}
+				select {
+				case cur.ch <- stream.GetIndexEntries():
+					return true
+				case <-donech:
+					return false
+				}
+			})
+		}(cur)
+	}
+
+	stop = func() {
+		close(donech)
+		wg.Wait()
+	}
+	return cursors, stop
+}
+
+// partitionTrace merges traces of partition scans, nil if partitions
+// were not traced. Partitions are scanned in parallel, stage timings and
+// rows are summed while total is that of the slowest partition.
+func partitionTrace(requestId string, cursors []*partitionCursor) *protobuf.ScanTrace {
+	var trace *protobuf.ScanTrace
+	for _, cur := range cursors {
+		t := cur.trace
+		if t == nil {
+			continue
+		} else if trace == nil {
+			trace = &protobuf.ScanTrace{
+				RequestId:    proto.String(requestId),
+				SnapshotWait: proto.Int64(0),
+				Storage:      proto.Int64(0),
+				Filter:       proto.Int64(0),
+				Decode:       proto.Int64(0),
+				Write:        proto.Int64(0),
+				RowsScanned:  proto.Uint64(0),
+				RowsReturned: proto.Uint64(0),
+				BytesWritten: proto.Uint64(0),
+				Total:        proto.Int64(0),
+			}
+		}
+		*trace.SnapshotWait += t.GetSnapshotWait()
+		*trace.Storage += t.GetStorage()
+		*trace.Filter += t.GetFilter()
+		*trace.Decode += t.GetDecode()
+		*trace.Write += t.GetWrite()
+		*trace.RowsScanned += t.GetRowsScanned()
+		*trace.RowsReturned += t.GetRowsReturned()
+		*trace.BytesWritten += t.GetBytesWritten()
+		if t.GetTotal() > trace.GetTotal() {
+			*trace.Total = t.GetTotal()
+		}
+	}
+	return trace
+}
+
+// partitionClient returns a scan client, with the request options of
+// `qc`, for partition `partnId` of `index` on the indexer node hosting
+// the partition.
+func (c *GsiClient) partitionClient(
+	qc *GsiScanClient, index *common.IndexDefn, partnId uint64) (*GsiScanClient, error) {
+
+	queryport, ok := c.bridge.GetPartitionScanport(uint64(index.DefnId), partnId)
+	if !ok {
+		return nil, ErrorNoHost
+	}
+	if queryport != qc.queryport {
+		qcs := *((*map[string]*GsiScanClient)(atomic.LoadPointer(&c.queryClients)))
+		target, ok := qcs[queryport]
+		if !ok {
+			return nil, ErrorNoHost
+		}
+		qc = target.withRequestOptions(qc)
+	}
+	return qc.withPartitions([]uint64{partnId}), nil
+}
+
+// mergePartitions does a k-way merge of rows from the partition cursors,
+// partitions return rows in descending order for a `reverse` scan. With
+// `distinct`, rows are de-duplicated on their projected entry keys.
+// Returns whether any rows were passed to callb and whether callb asked to
+// stop the scan.
+func (c *GsiClient) mergePartitions(
+	index *common.IndexDefn, cursors []*partitionCursor, reverse, distinct bool,
+	projection *IndexProjection, offset, limit int64,
+	callb ResponseHandler) (err error, partial, stopped bool) {
+
+	codec := collatejson.NewCodec(16)
+
+	// advance cursor to the next row, returns false if the partition
+	// is exhausted.
+	next := func(cur *partitionCursor) (bool, error) {
+		if len(cur.entries) > 0 {
+			cur.entries = cur.entries[1:]
+		}
+		for len(cur.entries) == 0 {
+			entries, ok := <-cur.ch
+			if !ok {
+				return false, cur.err
+			}
+			cur.entries = entries
+		}
+		code, err := collateEntryKey(codec, cur.entries[0], index.Desc, cur.code)
+		cur.code = code
+		return true, err
+	}
+
+	active := make([]*partitionCursor, 0, len(cursors))
+	for _, cur := range cursors {
+		ok, err := next(cur)
+		if err != nil {
+			return err, false, false
+		} else if ok {
+			active = append(active, cur)
+		}
+	}
+
+	// rows with equal projected keys are adjacent in index order only
+	// when projection is a leading prefix of entry keys, otherwise
+	// distinct keys are remembered.
+	projectKeys := projection != nil && len(projection.EntryKeys) > 0
+	adjacent := !projectKeys || isLeadingKeys(projection.EntryKeys)
+	seen := make(map[string]bool)
+
+	var lastCode, distinctCode []byte
+	var skipped, emitted int64
+	out := make([]*protobuf.IndexEntry, 0, scatterBatchSize)
+	for len(active) > 0 {
+		// pick the smallest row across partitions, or the largest for a
+		// reverse scan, ties are broken on docid.
+		least := 0
+		for i := 1; i < len(active); i++ {
+			cmp := bytes.Compare(active[i].code, active[least].code)
+			if cmp == 0 {
+				cmp = bytes.Compare(active[i].entries[0].GetPrimaryKey(),
+					active[least].entries[0].GetPrimaryKey())
+			}
+			if reverse {
+				cmp = -cmp
+			}
+			if cmp < 0 {
+				least = i
+			}
+		}
+		cur := active[least]
+		entry := cur.entries[0]
+
+		emit, projected := true, false
+		if distinct {
+			key := cur.code
+			if projectKeys {
+				if entry, err = projectEntry(entry, projection); err != nil {
+					return err, partial, false
+				}
+				projected = true
+				distinctCode, err = collateEntryKey(codec, entry, nil, distinctCode)
+				if err != nil {
+					return err, partial, false
+				}
+				key = distinctCode
+			}
+			if adjacent {
+				emit = lastCode == nil || !bytes.Equal(lastCode, key)
+				lastCode = append(lastCode[:0], key...)
+			} else if seen[string(key)] {
+				emit = false
+			} else {
+				seen[string(key)] = true
+			}
+		}
+		if emit && skipped < offset {
+			skipped++
+			emit = false
+		}
+		if emit {
+			if projection != nil && !projected {
+				if entry, err = projectEntry(entry, projection); err != nil {
+					return err, partial, false
+				}
+			}
+			out = append(out, entry)
+			emitted++
+		}
+
+		done := limit > 0 && emitted >= limit
+		if len(out) == cap(out) || (done && len(out) > 0) {
+			partial = true
+			if !callb(&protobuf.ResponseStream{IndexEntries: out}) {
+				return nil, partial, true
+			}
+			out = make([]*protobuf.IndexEntry, 0, scatterBatchSize)
+		}
+		if done {
+			return nil, partial, false
+		}
+
+		ok, err := next(cur)
+		if err != nil {
+			return err, partial, false
+		} else if !ok {
+			active = append(active[:least], active[least+1:]...)
+		}
+	}
+
+	if len(out) > 0 {
+		partial = true
+		if !callb(&protobuf.ResponseStream{IndexEntries: out}) {
+			return nil, partial, true
+		}
+	}
+	return nil, partial, false
+}
+
+// isLeadingKeys returns true if entry key positions are 0, 1, ..., n-1.
+func isLeadingKeys(positions []int64) bool {
+	for i, pos := range positions {
+		if pos != int64(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// rangePartitions returns partitions of a range partitioned index that
+// can hold rows between low and high, nil means all partitions.
+func rangePartitions(
+	index *common.IndexDefn, low, high common.SecondaryKey) ([]uint64, error) {
+
+	if !index.CanPrunePartitions() {
+		return nil, nil
+	}
+	l, err := leadingKey(low)
+	if err != nil {
+		return nil, err
+	}
+	h, err := leadingKey(high)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := common.RangePartitionIds(l, h, index.PartitionSplits)
+	if err != nil {
+		return nil, err
+	}
+	partnIds := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		partnIds = append(partnIds, uint64(id))
+	}
+	return partnIds, nil
+}
+
+// lookupPartitions returns partitions of a range partitioned index that
+// can hold rows equal to any of the values, nil means all partitions.
+func lookupPartitions(
+	index *common.IndexDefn, values []common.SecondaryKey) ([]uint64, error) {
+
+	if !index.CanPrunePartitions() {
+		return nil, nil
+	}
+	selected := make([]bool, index.GetNumPartitions())
+	for _, value := range values {
+		key, err := leadingKey(value)
+		if err != nil {
+			return nil, err
+		} else if key == nil {
+			return nil, nil
+		}
+		selected[common.RangePartitionId(key, index.PartitionSplits)] = true
+	}
+	partnIds := make([]uint64, 0, len(selected))
+	for id, ok := range selected {
+		if ok {
+			partnIds = append(partnIds, uint64(id))
+		}
+	}
+	return partnIds, nil
+}
+
+// leadingKey returns JSON encoded first value of a composite key, nil
+// if the key is unbounded.
+func leadingKey(key common.SecondaryKey) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(key[0])
+}
+
+// collateEntryKey encodes JSON entry key into collatejson, with desc
+// fields reversed, so that rows can be compared in index order.
+func collateEntryKey(codec *collatejson.Codec,
+	entry *protobuf.IndexEntry, desc []bool, buf []byte) ([]byte, error) {
+
+	key := entry.GetEntryKey()
+	size := 3 * len(key)
+	if size < collatejson.MinBufferSize {
+		size = collatejson.MinBufferSize
+	}
+	if cap(buf) < size {
+		buf = make([]byte, 0, size)
+	}
+	code, err := codec.Encode(key, buf[:0])
+	if err != nil {
+		return buf, err
+	}
+	if desc != nil {
+		code = codec.ReverseCollate(code, desc)
+	}
+	return code, nil
+}
+
+// projectEntry applies user projection on a row scanned with all its
+// entry keys and primary key.
+func projectEntry(
+	entry *protobuf.IndexEntry, projection *IndexProjection) (*protobuf.IndexEntry, error) {
+
+	var key []byte
+	if len(projection.EntryKeys) > 0 {
+		var vals []json.RawMessage
+		if err := json.Unmarshal(entry.GetEntryKey(), &vals); err != nil {
+			return nil, err
+		}
+		projected := make([]json.RawMessage, 0, len(projection.EntryKeys))
+		for _, pos := range projection.EntryKeys {
+			if pos < 0 || pos >= int64(len(vals)) {
+				return nil, fmt.Errorf("Invalid Entry Key %v in IndexProjection", pos)
+			}
+			projected = append(projected, vals[pos])
+		}
+		var err error
+		if key, err = json.Marshal(projected); err != nil {
+			return nil, err
+		}
+	}
+
+	pkey := []byte{}
+	if projection.PrimaryKey {
+		pkey = entry.GetPrimaryKey()
+	}
+	return &protobuf.IndexEntry{EntryKey: key, PrimaryKey: pkey}, nil
+}
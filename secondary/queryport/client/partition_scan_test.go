@@ -0,0 +1,211 @@
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/couchbase/indexing/secondary/common"
+	mclient "github.com/couchbase/indexing/secondary/manager/client"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+)
+
+// testCursors returns a cursor per partition, each partition streams its
+// rows in batches of two.
+func testCursors(partitions ...[][2]string) []*partitionCursor {
+	cursors := make([]*partitionCursor, 0, len(partitions))
+	for partnId, rows := range partitions {
+		ch := make(chan []*protobuf.IndexEntry, len(rows)+1)
+		for i := 0; i < len(rows); i += 2 {
+			batch := []*protobuf.IndexEntry{}
+			for _, row := range rows[i:] {
+				if len(batch) == 2 {
+					break
+				}
+				batch = append(batch, &protobuf.IndexEntry{
+					EntryKey:   []byte(row[0]),
+					PrimaryKey: []byte(row[1]),
+				})
+			}
+			ch <- batch
+		}
+		close(ch)
+		cursors = append(cursors, &partitionCursor{partnId: uint64(partnId), ch: ch})
+	}
+	return cursors
+}
+
+func testMerge(t *testing.T, cursors []*partitionCursor, reverse, distinct bool,
+	projection *IndexProjection, offset, limit int64) []string {
+
+	index := &common.IndexDefn{SecExprs: []string{"a", "b"}}
+	rows := []string{}
+	callb := func(resp ResponseReader) bool {
+		for _, entry := range resp.(*protobuf.ResponseStream).GetIndexEntries() {
+			rows = append(rows, fmt.Sprintf("%s:%s", entry.GetEntryKey(), entry.GetPrimaryKey()))
+		}
+		return true
+	}
+	c := &GsiClient{}
+	err, _, _ := c.mergePartitions(
+		index, cursors, reverse, distinct, projection, offset, limit, callb)
+	if err != nil {
+		t.Fatalf("mergePartitions: %v", err)
+	}
+	return rows
+}
+
+func TestMergePartitions(t *testing.T) {
+	p0 := [][2]string{{`[1,"x"]`, "d1"}, {`[3,"y"]`, "d3"}, {`[5,"x"]`, "d5"}}
+	p1 := [][2]string{{`[2,"y"]`, "d2"}, {`[3,"x"]`, "d4"}, {`[6,"x"]`, "d6"}}
+
+	rows := testMerge(t, testCursors(p0, p1), false, false, nil, 0, 0)
+	expected := []string{`[1,"x"]:d1`, `[2,"y"]:d2`, `[3,"x"]:d4`,
+		`[3,"y"]:d3`, `[5,"x"]:d5`, `[6,"x"]:d6`}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+
+	rows = testMerge(t, testCursors(p0, p1), false, false, nil, 1, 3)
+	if !reflect.DeepEqual(rows, expected[1:4]) {
+		t.Errorf("Expected %v, received %v", expected[1:4], rows)
+	}
+}
+
+func TestMergePartitionsReverse(t *testing.T) {
+	p0 := [][2]string{{`[5,"x"]`, "d5"}, {`[3,"y"]`, "d3"}, {`[1,"x"]`, "d1"}}
+	p1 := [][2]string{{`[6,"x"]`, "d6"}, {`[3,"x"]`, "d4"}, {`[2,"y"]`, "d2"}}
+
+	rows := testMerge(t, testCursors(p0, p1), true, false, nil, 0, 0)
+	expected := []string{`[6,"x"]:d6`, `[5,"x"]:d5`, `[3,"y"]:d3`,
+		`[3,"x"]:d4`, `[2,"y"]:d2`, `[1,"x"]:d1`}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+}
+
+func TestMergePartitionsDistinct(t *testing.T) {
+	p0 := [][2]string{{`[1,"x"]`, "d1"}, {`[3,"y"]`, "d3"}}
+	p1 := [][2]string{{`[1,"x"]`, "d2"}, {`[3,"y"]`, "d4"}, {`[4,"x"]`, "d5"}}
+
+	// without projection rows are de-duplicated on full entry key.
+	rows := testMerge(t, testCursors(p0, p1), false, true, nil, 0, 0)
+	expected := []string{`[1,"x"]:d1`, `[3,"y"]:d3`, `[4,"x"]:d5`}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+
+	// leading key projection.
+	projection := &IndexProjection{EntryKeys: []int64{0}}
+	rows = testMerge(t, testCursors(p0, p1), false, true, projection, 0, 0)
+	expected = []string{`[1]:`, `[3]:`, `[4]:`}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+
+	// non-leading key projection, duplicates are not adjacent.
+	projection = &IndexProjection{EntryKeys: []int64{1}}
+	rows = testMerge(t, testCursors(p0, p1), false, true, projection, 0, 0)
+	expected = []string{`["x"]:`, `["y"]:`}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+
+	// offset and limit apply on distinct rows of a reverse scan.
+	r0 := [][2]string{{`[3,"y"]`, "d3"}, {`[1,"x"]`, "d1"}}
+	r1 := [][2]string{{`[4,"x"]`, "d5"}, {`[3,"y"]`, "d4"}, {`[1,"x"]`, "d2"}}
+	rows = testMerge(t, testCursors(r0, r1), true, true, projection, 1, 1)
+	expected = []string{`["y"]:`}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, received %v", expected, rows)
+	}
+}
+
+func TestPartitionClient(t *testing.T) {
+	index := &common.IndexDefn{
+		DefnId:          common.IndexDefnId(10),
+		PartitionScheme: common.HASH,
+		NumPartitions:   4,
+		Nodes:           []string{"n0", "n1"},
+	}
+	insts := []*mclient.InstanceDefn{
+		{InstId: 100, State: common.INDEX_STATE_ACTIVE, IndexerId: "n0", ReplicaId: 0},
+		{InstId: 101, State: common.INDEX_STATE_ACTIVE, IndexerId: "n1", ReplicaId: 1},
+	}
+	currmeta := &indexTopology{
+		defns: map[common.IndexDefnId]*mclient.IndexMetadata{
+			index.DefnId: {Definition: index, Instances: insts},
+		},
+		queryports: map[common.IndexerId]string{"n0": "qp0", "n1": "qp1"},
+	}
+	bridge := &metadataClient{}
+	atomic.StorePointer(&bridge.indexers, unsafe.Pointer(currmeta))
+
+	clients := map[string]*GsiScanClient{
+		"qp0": {queryport: "qp0"},
+		"qp1": {queryport: "qp1"},
+	}
+	c := &GsiClient{bridge: bridge}
+	atomic.StorePointer(&c.queryClients, unsafe.Pointer(&clients))
+
+	// partitions are spread round-robin, request options are carried over.
+	qc := clients["qp0"].WithTrace().WithPriority(protobuf.ScanPriority_PRIORITY_HIGH)
+	for partnId, expected := range []string{"qp0", "qp1", "qp0", "qp1"} {
+		pqc, err := c.partitionClient(qc, index, uint64(partnId))
+		if err != nil {
+			t.Fatalf("partitionClient(%v): %v", partnId, err)
+		}
+		if pqc.queryport != expected {
+			t.Errorf("Expected %v, received %v", expected, pqc.queryport)
+		}
+		if !reflect.DeepEqual(pqc.partitions, []uint64{uint64(partnId)}) {
+			t.Errorf("Expected partition %v, received %v", partnId, pqc.partitions)
+		}
+		if !pqc.trace || pqc.priority != protobuf.ScanPriority_PRIORITY_HIGH {
+			t.Errorf("Expected request options of scan client")
+		}
+	}
+
+	// partition without an active instance has no host.
+	insts[1].State = common.INDEX_STATE_INITIAL
+	if _, err := c.partitionClient(qc, index, 1); err != ErrorNoHost {
+		t.Errorf("Expected %v, received %v", ErrorNoHost, err)
+	}
+}
+
+func TestPartitionTrace(t *testing.T) {
+	cursors := []*partitionCursor{
+		{partnId: 0, trace: &protobuf.ScanTrace{
+			Storage: proto.Int64(10), RowsScanned: proto.Uint64(5), Total: proto.Int64(30)}},
+		{partnId: 1},
+		{partnId: 2, trace: &protobuf.ScanTrace{
+			Storage: proto.Int64(20), RowsScanned: proto.Uint64(7), Total: proto.Int64(25)}},
+	}
+	trace := partitionTrace("req1", cursors)
+	if trace.GetRequestId() != "req1" || trace.GetStorage() != 30 ||
+		trace.GetRowsScanned() != 12 || trace.GetTotal() != 30 {
+		t.Errorf("Unexpected merged trace %v", trace)
+	}
+
+	if trace := partitionTrace("req1", cursors[1:2]); trace != nil {
+		t.Errorf("Expected no trace for untraced partitions, received %v", trace)
+	}
+
+	qc := WithTrace()(&GsiScanClient{})
+	if !qc.trace {
+		t.Errorf("Expected WithTrace option to trace scans")
+	}
+}
+
+func TestScanOptions(t *testing.T) {
+	qc := &GsiScanClient{}
+	for _, opt := range []ScanOption{WithPriority(protobuf.ScanPriority_PRIORITY_LOW)} {
+		qc = opt(qc)
+	}
+	if qc.priority != protobuf.ScanPriority_PRIORITY_LOW {
+		t.Errorf("Expected %v, received %v", protobuf.ScanPriority_PRIORITY_LOW, qc.priority)
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import "bytes"
+
+import "github.com/couchbase/indexing/secondary/collatejson"
+import "github.com/couchbase/indexing/secondary/common"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+
+import "github.com/golang/protobuf/proto"
+
+// partitionStatistics shall compute statistics for a single partition of
+// an index using `qc`.
+type partitionStatistics func(qc *GsiScanClient) (common.IndexStatistics, error)
+
+// scatterStatistics fans out `statistics` to partitions `partnIds` of
+// `index`, nil means every partition, each on the indexer node hosting it,
+// and merges statistics of the partitions.
+func (c *GsiClient) scatterStatistics(
+	qc *GsiScanClient, index *common.IndexDefn, requestId string,
+	partnIds []uint64, statistics partitionStatistics) (common.IndexStatistics, error) {
+
+	if partnIds == nil {
+		partnIds = allPartitions(index)
+	}
+
+	partitions := make([]common.IndexStatistics, len(partnIds))
+	err := c.scatterRequest(qc, index, requestId, partnIds,
+		func(i int, pqc *GsiScanClient) (err error) {
+			partitions[i], err = statistics(pqc)
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return mergeStatistics(index, partitions)
+}
+
+// mergeStatistics adds up counts of partition statistics, takes the
+// smallest min key and largest max key in collation order and concatenates
+// histogram bins of partitions. Distinct counts are added up as well,
+// unless the index is range partitioned on its leading key equal keys can
+// be in more than one partition, then distinct is an upper bound and the
+// merged statistics are marked as sampled.
+func mergeStatistics(index *common.IndexDefn,
+	partitions []common.IndexStatistics) (*protobuf.IndexStatistics, error) {
+
+	merged := &protobuf.IndexStatistics{
+		KeysCount:       proto.Uint64(0),
+		UniqueKeysCount: proto.Uint64(0),
+		Sampled:         proto.Bool(false),
+	}
+
+	codec := collatejson.NewCodec(16)
+	var minCode, maxCode []byte
+	nonEmpty := 0
+	for _, stats := range partitions {
+		ps, ok := stats.(*protobuf.IndexStatistics)
+		if !ok {
+			return nil, ErrorProtocol
+		}
+		merged.Histogram = append(merged.Histogram, ps.GetHistogram()...)
+		if ps.GetSampled() {
+			merged.Sampled = proto.Bool(true)
+		}
+		if ps.GetKeysCount() == 0 {
+			continue
+		}
+		nonEmpty++
+		*merged.KeysCount += ps.GetKeysCount()
+		*merged.UniqueKeysCount += ps.GetUniqueKeysCount()
+
+		code, err := collateStatsKey(codec, ps.GetKeyMin())
+		if err != nil {
+			return nil, err
+		} else if minCode == nil || bytes.Compare(code, minCode) < 0 {
+			minCode, merged.KeyMin = code, ps.GetKeyMin()
+		}
+		code, err = collateStatsKey(codec, ps.GetKeyMax())
+		if err != nil {
+			return nil, err
+		} else if maxCode == nil || bytes.Compare(code, maxCode) > 0 {
+			maxCode, merged.KeyMax = code, ps.GetKeyMax()
+		}
+	}
+	if nonEmpty > 1 && !index.CanPrunePartitions() {
+		merged.Sampled = proto.Bool(true)
+	}
+	return merged, nil
+}
+
+// collateStatsKey encodes a JSON encoded min or max key into collatejson
+// so that keys can be compared in collation order.
+func collateStatsKey(codec *collatejson.Codec, key []byte) ([]byte, error) {
+	size := 3 * len(key)
+	if size < collatejson.MinBufferSize {
+		size = collatejson.MinBufferSize
+	}
+	return codec.Encode(key, make([]byte, 0, size))
+}
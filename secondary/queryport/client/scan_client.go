@@ -10,6 +10,7 @@
 
 package client
 
+import "crypto/tls"
 import "errors"
 import "fmt"
 import "io"
@@ -36,12 +37,45 @@ type GsiScanClient struct {
 	poolOverflow       int
 	cpTimeout          time.Duration
 	cpAvailWaitTimeout time.Duration
+	compression        byte
+	tlsConfig          *tls.Config
 	logPrefix          string
 
 	serverVersion uint32
+
+	// partitions to scan, for a partitioned index, nil scans all.
+	partitions []uint64
+
+	// request stage timings for scans, returned in StreamEndResponse.
+	trace bool
+
+	// admission priority of scan and count requests.
+	priority protobuf.ScanPriority
+
+	// load reported by the indexer and circuit breaker, shared by copies.
+	health *indexerHealth
+
+	// hedged scan this client runs `attempt` of, nil if not hedged.
+	hedge   *scanHedge
+	attempt int
+
+	// ask for continuation tokens, and resume scans from `resumeFrom`.
+	continuations bool
+	resumeFrom    []byte
 }
 
 func NewGsiScanClient(queryport string, config common.Config) (*GsiScanClient, error) {
+	compression, err := transport.ParseCompression(config["compression"].String())
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if config["enableTLS"].Bool() {
+		tlsConfig, err = transport.NewTLSClientConfig(config["caFile"].String())
+		if err != nil {
+			return nil, err
+		}
+	}
 	t := time.Duration(config["connPoolAvailWaitTimeout"].Int())
 	c := &GsiScanClient{
 		queryport:          queryport,
@@ -52,11 +86,14 @@ func NewGsiScanClient(queryport string, config common.Config) (*GsiScanClient, e
 		poolOverflow:       config["settings.poolOverflow"].Int(),
 		cpTimeout:          time.Duration(config["connPoolTimeout"].Int()),
 		cpAvailWaitTimeout: t,
+		compression:        compression,
+		tlsConfig:          tlsConfig,
 		logPrefix:          fmt.Sprintf("[GsiScanClient:%q]", queryport),
+		health:             newIndexerHealth(config),
 	}
 	c.pool = newConnectionPool(
-		queryport, c.poolSize, c.poolOverflow, c.maxPayload, c.cpTimeout,
-		c.cpAvailWaitTimeout)
+		queryport, c.poolSize, c.poolOverflow, c.maxPayload, c.compression,
+		c.tlsConfig, c.cpTimeout, c.cpAvailWaitTimeout)
 	logging.Infof("%v started ...\n", c.logPrefix)
 
 	if version, err := c.Helo(); err == nil || err == io.EOF {
@@ -93,12 +130,14 @@ func (c *GsiScanClient) Helo() (uint32, error) {
 		return 0, err
 	}
 	heloResp := resp.(*protobuf.HeloResponse)
+	c.health.updateLoad(heloResp.GetLoad())
 	return heloResp.GetVersion(), nil
 }
 
 // LookupStatistics for a single secondary-key.
 func (c *GsiScanClient) LookupStatistics(
-	defnID uint64, value common.SecondaryKey) (common.IndexStatistics, error) {
+	defnID uint64, requestId string,
+	value common.SecondaryKey) (common.IndexStatistics, error) {
 
 	// serialize lookup value.
 	val, err := json.Marshal(value)
@@ -106,10 +145,12 @@ func (c *GsiScanClient) LookupStatistics(
 		return nil, err
 	}
 	req := &protobuf.StatisticsRequest{
-		DefnID: proto.Uint64(defnID),
-		Span:   &protobuf.Span{Equals: [][]byte{val}},
+		DefnID:    proto.Uint64(defnID),
+		RequestId: proto.String(requestId),
+		Span:      &protobuf.Span{Equals: [][]byte{val}},
+		Cons:      proto.Uint32(uint32(common.AnyConsistency)),
 	}
-	resp, err := c.doRequestResponse(req, "")
+	resp, err := c.doRequestResponse(req, requestId)
 	if err != nil {
 		return nil, err
 	}
@@ -123,7 +164,7 @@ func (c *GsiScanClient) LookupStatistics(
 
 // RangeStatistics for index range.
 func (c *GsiScanClient) RangeStatistics(
-	defnID uint64, low, high common.SecondaryKey,
+	defnID uint64, requestId string, low, high common.SecondaryKey,
 	inclusion Inclusion) (common.IndexStatistics, error) {
 
 	// serialize low and high values.
@@ -136,15 +177,32 @@ func (c *GsiScanClient) RangeStatistics(
 		return nil, err
 	}
 
+	return c.rangeStatistics(defnID, requestId, l, h, inclusion)
+}
+
+// RangeStatisticsPrimary for primary index range.
+func (c *GsiScanClient) RangeStatisticsPrimary(
+	defnID uint64, requestId string, low, high []byte,
+	inclusion Inclusion) (common.IndexStatistics, error) {
+
+	return c.rangeStatistics(defnID, requestId, low, high, inclusion)
+}
+
+func (c *GsiScanClient) rangeStatistics(
+	defnID uint64, requestId string, low, high []byte,
+	inclusion Inclusion) (common.IndexStatistics, error) {
+
 	req := &protobuf.StatisticsRequest{
-		DefnID: proto.Uint64(defnID),
+		DefnID:    proto.Uint64(defnID),
+		RequestId: proto.String(requestId),
 		Span: &protobuf.Span{
 			Range: &protobuf.Range{
-				Low: l, High: h, Inclusion: proto.Uint32(uint32(inclusion)),
+				Low: low, High: high, Inclusion: proto.Uint32(uint32(inclusion)),
 			},
 		},
+		Cons: proto.Uint32(uint32(common.AnyConsistency)),
 	}
-	resp, err := c.doRequestResponse(req, "")
+	resp, err := c.doRequestResponse(req, requestId)
 	if err != nil {
 		return nil, err
 	}
@@ -386,6 +444,30 @@ func (c *GsiScanClient) MultiScan(
 	cons common.Consistency, vector *TsConsistency,
 	callb ResponseHandler) (error, bool) {
 
+	return c.multiScan(
+		defnID, requestId, scans, reverse, distinct, projection, nil,
+		offset, limit, cons, vector, callb)
+}
+
+// Scan3 is MultiScan with GROUP BY and aggregates evaluated by indexer.
+func (c *GsiScanClient) Scan3(
+	defnID uint64, requestId string, scans Scans, reverse bool,
+	groupAggr *GroupAggr, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (error, bool) {
+
+	return c.multiScan(
+		defnID, requestId, scans, reverse, false, nil, groupAggr,
+		offset, limit, cons, vector, callb)
+}
+
+func (c *GsiScanClient) multiScan(
+	defnID uint64, requestId string, scans Scans,
+	reverse, distinct bool, projection *IndexProjection,
+	groupAggr *GroupAggr, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (error, bool) {
+
 	// serialize scans
 	protoScans := make([]*protobuf.Scan, len(scans))
 	for i, scan := range scans {
@@ -447,6 +529,23 @@ func (c *GsiScanClient) MultiScan(
 		}
 	}
 
+	//GroupAggr
+	var protoGroupAggr *protobuf.GroupAggr
+	if groupAggr != nil {
+		protoGroupAggr = &protobuf.GroupAggr{}
+		for _, keyPos := range groupAggr.Group {
+			protoGroupAggr.GroupKeys = append(protoGroupAggr.GroupKeys,
+				&protobuf.GroupKey{KeyPos: proto.Int32(keyPos)})
+		}
+		for _, aggr := range groupAggr.Aggrs {
+			protoGroupAggr.Aggrs = append(protoGroupAggr.Aggrs, &protobuf.Aggregate{
+				AggrFunc: protobuf.AggrFuncType(aggr.AggrFunc).Enum(),
+				KeyPos:   proto.Int32(aggr.KeyPos),
+				Distinct: proto.Bool(aggr.Distinct),
+			})
+		}
+	}
+
 	connectn, err := c.pool.Get()
 	if err != nil {
 		return err, false
@@ -469,6 +568,7 @@ func (c *GsiScanClient) MultiScan(
 		Indexprojection: protoProjection,
 		Reverse:         proto.Bool(reverse),
 		Offset:          proto.Int64(offset),
+		GroupAggr:       protoGroupAggr,
 	}
 	if vector != nil {
 		req.Vector = protobuf.NewTsConsistency(
@@ -977,10 +1077,126 @@ func (c *GsiScanClient) doRequestResponse(
 func (c *GsiScanClient) sendRequest(
 	conn net.Conn, pkt *transport.TransportPacket, req interface{}) (err error) {
 
+	if len(c.partitions) > 0 {
+		switch r := req.(type) {
+		case *protobuf.ScanRequest:
+			r.PartitionIds = c.partitions
+		case *protobuf.ScanAllRequest:
+			r.PartitionIds = c.partitions
+		case *protobuf.CountRequest:
+			r.PartitionIds = c.partitions
+		case *protobuf.StatisticsRequest:
+			r.PartitionIds = c.partitions
+		}
+	}
+
+	switch r := req.(type) {
+	case *protobuf.ScanRequest:
+		r.ReportLoad = proto.Bool(true)
+	case *protobuf.ScanAllRequest:
+		r.ReportLoad = proto.Bool(true)
+	}
+
+	// entry keys are decoded by ResponseStream.GetEntries straight from
+	// collatejson, rows of a scattered scan are merged as JSON.
+	if len(c.partitions) == 0 {
+		switch r := req.(type) {
+		case *protobuf.ScanRequest:
+			r.CollatedKeys = proto.Bool(true)
+		case *protobuf.ScanAllRequest:
+			r.CollatedKeys = proto.Bool(true)
+		}
+	}
+
+	if c.trace {
+		switch r := req.(type) {
+		case *protobuf.ScanRequest:
+			r.Trace = proto.Bool(true)
+		case *protobuf.ScanAllRequest:
+			r.Trace = proto.Bool(true)
+		}
+	}
+
+	if c.continuations {
+		if r, ok := req.(*protobuf.ScanRequest); ok {
+			r.Continuations = proto.Bool(true)
+			r.ResumeFrom = c.resumeFrom
+		}
+	}
+
+	if c.priority != protobuf.ScanPriority_PRIORITY_NORMAL {
+		switch r := req.(type) {
+		case *protobuf.ScanRequest:
+			r.Priority = c.priority.Enum()
+		case *protobuf.ScanAllRequest:
+			r.Priority = c.priority.Enum()
+		case *protobuf.CountRequest:
+			r.Priority = c.priority.Enum()
+		}
+	}
+
 	c.trySetDeadline(conn, c.writeDeadline)
 	return pkt.Send(conn, req)
 }
 
+// withPartitions return a copy of scan client, sharing the same connection
+// pool, whose scan requests are restricted to `partitions`.
+func (c *GsiScanClient) withPartitions(partitions []uint64) *GsiScanClient {
+	qc := *c
+	qc.partitions = partitions
+	return &qc
+}
+
+// withRequestOptions return a copy of scan client, sharing the same
+// connection pool, with the request options of `from`.
+func (c *GsiScanClient) withRequestOptions(from *GsiScanClient) *GsiScanClient {
+	qc := *c
+	qc.partitions, qc.trace, qc.priority = from.partitions, from.trace, from.priority
+	qc.continuations, qc.resumeFrom = from.continuations, from.resumeFrom
+	return &qc
+}
+
+// WithTrace return a copy of scan client, sharing the same connection
+// pool, whose scans are traced by the indexer. The callback receives the
+// trace as a *protobuf.StreamEndResponse at the end of the stream.
+func (c *GsiScanClient) WithTrace() *GsiScanClient {
+	qc := *c
+	qc.trace = true
+	return &qc
+}
+
+// WithPriority return a copy of scan client, sharing the same connection
+// pool, whose scan and count requests are admitted by the indexer with
+// `priority` when it is limiting concurrent scans.
+func (c *GsiScanClient) WithPriority(priority protobuf.ScanPriority) *GsiScanClient {
+	qc := *c
+	qc.priority = priority
+	return &qc
+}
+
+// withContinuation return a copy of scan client, sharing the same
+// connection pool, whose scans return a continuation token with every
+// page and resume after the rows returned up to `resumeFrom`, if not nil.
+func (c *GsiScanClient) withContinuation(resumeFrom []byte) *GsiScanClient {
+	qc := *c
+	qc.continuations, qc.resumeFrom = true, resumeFrom
+	return &qc
+}
+
+// withHedge return a copy of scan client, sharing the same connection
+// pool, that runs `attempt` of a hedged scan.
+func (c *GsiScanClient) withHedge(hedge *scanHedge, attempt int) *GsiScanClient {
+	qc := *c
+	qc.hedge, qc.attempt = hedge, attempt
+	return &qc
+}
+
+// hedgeLost tells whether another attempt of the hedged scan received
+// a response first, responses of this attempt are then dropped.
+func (c *GsiScanClient) hedgeLost() bool {
+	return c.hedge != nil && !c.hedge.claim(c.attempt)
+}
+
 func (c *GsiScanClient) streamResponse(
 	conn net.Conn,
 	pkt *transport.TransportPacket,
@@ -990,6 +1206,9 @@ func (c *GsiScanClient) streamResponse(
 	var finish bool
 
 	laddr := conn.LocalAddr()
+	if c.hedge != nil {
+		c.hedge.watch(c.attempt, conn)
+	}
 	c.trySetDeadline(conn, c.readDeadline)
 	if resp, err = pkt.Receive(conn); err != nil {
 		//resp := &protobuf.ResponseStream{
@@ -997,7 +1216,10 @@ func (c *GsiScanClient) streamResponse(
 		//}
 		//callb(resp) // callback with error
 		cont, healthy = false, false
-		if err == io.EOF {
+		if c.hedge != nil && c.hedge.lost(c.attempt) {
+			fmsg := "%v req(%v) connection %q closed, hedged scan lost"
+			logging.Tracef(fmsg, c.logPrefix, requestId, laddr)
+		} else if err == io.EOF {
 			fmsg := "%v req(%v) connection %q closed `%v` \n"
 			logging.Errorf(fmsg, c.logPrefix, requestId, laddr, err)
 		} else {
@@ -1009,13 +1231,35 @@ func (c *GsiScanClient) streamResponse(
 		finish = true
 		fmsg := "%v req(%v) connection %q received StreamEndResponse"
 		logging.Tracef(fmsg, c.logPrefix, requestId, laddr)
-		callb(&protobuf.StreamEndResponse{}) // callback most likely return true
+		if !c.hedgeLost() {
+			callb(&protobuf.StreamEndResponse{}) // callback most likely return true
+		}
 		cont, healthy = false, true
 
+	} else if endResp, ok := resp.(*protobuf.StreamEndResponse); ok {
+		// trailer carrying trace and load, followed by end of stream
+		finish = true
+		c.health.updateLoad(endResp.GetLoad())
+		c.trySetDeadline(conn, c.readDeadline)
+		if resp, err = pkt.Receive(conn); err == nil && resp != nil {
+			err = ErrorProtocol
+		}
+		if err != nil {
+			fmsg := "%v req(%v) connection %q response transport failed `%v`\n"
+			logging.Errorf(fmsg, c.logPrefix, requestId, laddr, err)
+			cont, healthy = false, false
+		} else {
+			if !c.hedgeLost() {
+				callb(endResp)
+			}
+			cont, healthy = false, true
+		}
+
 	} else {
 		streamResp := resp.(*protobuf.ResponseStream)
 		if err = streamResp.Error(); err == nil {
-			cont = callb(streamResp)
+			// the attempt that lost a hedged scan closes its stream.
+			cont = !c.hedgeLost() && callb(streamResp)
 		}
 		healthy = true
 	}
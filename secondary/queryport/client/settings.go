@@ -18,9 +18,10 @@ import (
 )
 
 type ClientSettings struct {
-	numReplica int32
-	config     common.Config
-	cancelCh   chan struct{}
+	numReplica   int32
+	numPartition int32
+	config       common.Config
+	cancelCh     chan struct{}
 }
 
 func NewClientSettings(needRefresh bool) *ClientSettings {
@@ -93,8 +94,19 @@ func (s *ClientSettings) handleSettings(config common.Config) {
 	} else {
 		logging.Errorf("ClientSettings: invalid setting value for num_replica=%v", numReplica)
 	}
+
+	numPartition := int32(config["indexer.settings.num_partitions"].Int())
+	if numPartition > 0 {
+		atomic.StoreInt32(&s.numPartition, numPartition)
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for num_partitions=%v", numPartition)
+	}
 }
 
 func (s *ClientSettings) NumReplica() int32 {
 	return atomic.LoadInt32(&s.numReplica)
 }
+
+func (s *ClientSettings) NumPartition() int32 {
+	return atomic.LoadInt32(&s.numPartition)
+}
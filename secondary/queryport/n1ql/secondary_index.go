@@ -428,7 +428,9 @@ func (gsi *gsiKeyspace) Refresh() errors.Error {
 	}
 	si_s := make([]*secondaryIndex, 0, len(indexes))
 	for _, index := range indexes {
-		if index.Definition.Bucket != gsi.keyspace {
+		// indexes on other collections of the bucket are not visible
+		// on the bucket's keyspace.
+		if index.Definition.KeyspaceId() != gsi.keyspace {
 			continue
 		}
 		si, err := newSecondaryIndexFromMetaData(gsi, version, index)
@@ -868,6 +870,63 @@ func (si *secondaryIndex) CountDistinct(requestId string, spans datastore.Spans2
 	return count, nil
 }
 
+// CanGroupAggregate advertise that GROUP BY and MIN, MAX, SUM, COUNT
+// aggregates over index keys can be pushed down to indexer, via Scan3.
+// Aggregate pushdown is not available for primary index.
+func (si *secondaryIndex) CanGroupAggregate() bool {
+	return si != nil && !si.isPrimary
+}
+
+// Scan3 scans index with GROUP BY and aggregates evaluated by indexer,
+// each entry's key is the group key values followed by aggregate values,
+// offset and limit apply to aggregated entries.
+func (si *secondaryIndex) Scan3(
+	requestId string, spans datastore.Spans2, reverse bool,
+	groupAggr *qclient.GroupAggr, offset, limit int64,
+	cons datastore.ScanConsistency, vector timestamp.Vector,
+	conn *datastore.IndexConnection) {
+
+	entryChannel := conn.EntryChannel()
+	var tmpfile *os.File
+	var backfillSync int64
+
+	syncCh := make(chan bool)
+
+	defer close(entryChannel)
+	defer func() { // cleanup tmpfile
+		if tmpfile != nil {
+			<-syncCh
+			tmpfile.Close()
+			name := tmpfile.Name()
+			fmsg := "%v Scan(%v) removing backfill file %v ...\n"
+			l.Infof(fmsg, si.gsi.logPrefix, requestId, name)
+			if err := os.Remove(name); err != nil {
+				fmsg := "%v remove backfill file %v unexpected failure: %v\n"
+				l.Errorf(fmsg, si.gsi.logPrefix, name, err)
+			}
+			atomic.AddInt64(&si.gsi.totalbackfills, 1)
+		}
+	}()
+	defer func() {
+		atomic.StoreInt64(&backfillSync, DONEREQUEST)
+	}()
+
+	starttm := time.Now()
+
+	client, cnf := si.gsi.gsiClient, si.gsi.config
+
+	gsiscans := n1qlspanstogsi(spans)
+	client.Scan3(
+		si.defnID, requestId, gsiscans, reverse, groupAggr, offset, limit,
+		n1ql2GsiConsistency[cons], vector2ts(vector),
+		makeResponsehandler(
+			requestId,
+			si, client, conn, &tmpfile, &backfillSync, syncCh, cnf))
+
+	atomic.AddInt64(&si.gsi.totalscans, 1)
+	atomic.AddInt64(&si.gsi.scandur, int64(time.Since(starttm)))
+}
+
 // Scan implement PrimaryIndex{} interface.
 func (si *secondaryIndex) ScanEntries(
 	requestId string, limit int64, cons datastore.ScanConsistency,
@@ -1116,6 +1175,7 @@ type statistics struct {
 	uniqueKeys int64
 	min        value.Values
 	max        value.Values
+	bins       []datastore.Statistics
 }
 
 // return an
@@ -1128,6 +1188,10 @@ func newStatistics(pstats c.IndexStatistics) datastore.Statistics {
 	stats.min = skey2Values(min)
 	max, _ := pstats.MaxKey()
 	stats.max = skey2Values(max)
+	bins, _ := pstats.Bins()
+	for _, bin := range bins {
+		stats.bins = append(stats.bins, newStatistics(bin))
+	}
 	return stats
 }
 
@@ -1153,7 +1217,7 @@ func (stats *statistics) Max() (value.Values, errors.Error) {
 
 // Bins implement Statistics{} interface.
 func (stats *statistics) Bins() ([]datastore.Statistics, errors.Error) {
-	return nil, nil
+	return stats.bins, nil
 }
 
 //------------------
@@ -1,5 +1,6 @@
 package queryport
 
+import "crypto/tls"
 import "fmt"
 import "net"
 import "sync"
@@ -19,16 +20,30 @@ type RequestHandler func(
 	req interface{}, conn net.Conn, quitch <-chan bool)
 
 type request struct {
-	r      interface{}
-	quitch chan bool
+	r           interface{}
+	quitch      chan bool
+	compression byte // compression used by client for this request
 }
 
-func newRequest(r interface{}) (req request) {
+func newRequest(r interface{}, compression byte) (req request) {
 	req.r = r
 	req.quitch = make(chan bool)
+	req.compression = compression
 	return
 }
 
+// responseConn is the connection on which response to a request is
+// sent, compressed the same way as the request.
+type responseConn struct {
+	net.Conn
+	compression byte
+}
+
+// Compression implements transport.Compressed{} interface.
+func (conn *responseConn) Compression() byte {
+	return conn.compression
+}
+
 // Server handles queryport connections.
 type Server struct {
 	laddr string         // address to listen
@@ -64,7 +79,16 @@ func NewServer(
 		logPrefix:      fmt.Sprintf("[Queryport %q]", laddr),
 		nConnections:   platform.NewAlignedInt64(0),
 	}
-	if s.lis, err = net.Listen("tcp", laddr); err != nil {
+	var tlsConfig *tls.Config
+	requireTLS := config["requireTLS"].Bool()
+	if requireTLS || config["enableTLS"].Bool() {
+		certFile, keyFile := config["certFile"].String(), config["keyFile"].String()
+		if tlsConfig, err = transport.NewTLSServerConfig(certFile, keyFile); err != nil {
+			logging.Errorf("%v failed loading certificate %v !!\n", s.logPrefix, err)
+			return nil, err
+		}
+	}
+	if s.lis, err = transport.Listen(laddr, tlsConfig, requireTLS); err != nil {
 		logging.Errorf("%v failed starting %v !!\n", s.logPrefix, err)
 		return nil, err
 	}
@@ -146,7 +170,11 @@ func (s *Server) handleConnection(conn net.Conn) {
 	go s.doReceive(conn, rcvch)
 
 	for req := range rcvch {
-		s.callb(req.r, conn, req.quitch) // blocking call
+		rconn := net.Conn(conn)
+		if req.compression != transport.CompressionNone {
+			rconn = &responseConn{Conn: conn, compression: req.compression}
+		}
+		s.callb(req.r, rconn, req.quitch) // blocking call
 		transport.SendResponseEnd(conn)
 	}
 }
@@ -188,7 +216,7 @@ loop:
 			logging.Debugf(format, s.logPrefix, raddr)
 			close(currRequest.quitch)
 		} else {
-			currRequest = newRequest(reqMsg)
+			currRequest = newRequest(reqMsg, rpkt.Flags().GetCompression())
 			rcvch <- currRequest
 		}
 	}
@@ -66,7 +66,7 @@ func TestStatistics(t *testing.T) {
 	}
 
 	l, h := c.SecondaryKey{[]byte("aaaa")}, c.SecondaryKey{[]byte("zzzz")}
-	out, err := client.RangeStatistics(0x0 /*defnID*/, l, h, 0)
+	out, err := client.RangeStatistics(0x0 /*defnID*/, "", l, h, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -214,7 +214,7 @@ func BenchmarkStatistics(b *testing.B) {
 	b.ResetTimer()
 	l, h := c.SecondaryKey{[]byte("aaaa")}, c.SecondaryKey{[]byte("zzzz")}
 	for i := 0; i < b.N; i++ {
-		qc.RangeStatistics(0x0 /*defnID*/, l, h, 0)
+		qc.RangeStatistics(0x0 /*defnID*/, "", l, h, 0)
 	}
 	b.StopTimer()
 	s.Close()
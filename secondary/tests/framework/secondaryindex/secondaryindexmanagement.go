@@ -349,6 +349,46 @@ func IndexExistsWithClient(indexName, bucketName, server string, client *qc.GsiC
 	return false
 }
 
+// Alters an index to the new definition and waits for it to become active
+func AlterSecondaryIndex(
+	indexName, bucketName, server, whereExpr string, indexFields []string, with []byte,
+	indexActiveTimeoutSeconds int64) error {
+
+	client, e := CreateClient(server, "2itest")
+	if e != nil {
+		return e
+	}
+	defer client.Close()
+
+	defnID, ok := GetDefnID(client, bucketName, indexName)
+	if !ok {
+		return errors.New(fmt.Sprintf("Index %v not found", indexName))
+	}
+
+	var secExprs []string
+	for _, indexField := range indexFields {
+		expr, err := n1ql.ParseExpression(indexField)
+		if err != nil {
+			log.Printf("Altering index %v. Error while parsing the expression (%v) : %v", indexName, indexField, err)
+		}
+
+		secExprs = append(secExprs, expression.NewStringer().Visit(expr))
+	}
+
+	start := time.Now()
+	newDefnID, err := client.AlterIndex(defnID, "N1QL", "", whereExpr, secExprs, nil, with)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Altered the secondary index %v. Waiting for it become active", indexName)
+	if e := WaitTillIndexActive(newDefnID, client, indexActiveTimeoutSeconds); e != nil {
+		return e
+	}
+	tc.LogPerfStat("AlterIndex", time.Since(start))
+	return nil
+}
+
 func DropSecondaryIndex(indexName, bucketName, server string) error {
 	log.Printf("Dropping the secondary index %v", indexName)
 	client, e := CreateClient(server, "2itest")
@@ -228,6 +228,35 @@ func TestCreateDropCreate(t *testing.T) {
 	log.Printf("(Inclusion 3) Lengths of expected and actual scan results are %d and %d. Num of docs in bucket = %d", len(docScanResults), len(scanResults), len(docs))
 }
 
+func TestAlterIndex(t *testing.T) {
+	log.Printf("In TestAlterIndex()")
+	var indexName = "index_alter"
+	var bucketName = "default"
+
+	err := secondaryindex.CreateSecondaryIndex(indexName, bucketName, indexManagementAddress, "", []string{"company"}, false, nil, true, defaultIndexActiveTimeout, nil)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_string(docs, "company", "FI", "SR", 1)
+	scanResults, err := secondaryindex.Range(indexName, bucketName, indexScanAddress, []interface{}{"FI"}, []interface{}{"SR"}, 1, false, defaultlimit, c.SessionConsistency, nil)
+	FailTestIfError(err, "Error in scan 1", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan 1 result validation", t)
+
+	// Alter the index to a different key.  Index is not dropped while the
+	// new definition is built.
+	err = secondaryindex.AlterSecondaryIndex(indexName, bucketName, indexManagementAddress, "", []string{"age"}, nil, defaultIndexActiveTimeout)
+	FailTestIfError(err, "Error in altering the index", t)
+
+	docScanResults = datautility.ExpectedScanResponse_float64(docs, "age", 30, 50, 1)
+	scanResults, err = secondaryindex.Range(indexName, bucketName, indexScanAddress, []interface{}{30}, []interface{}{50}, 1, false, defaultlimit, c.SessionConsistency, nil)
+	FailTestIfError(err, "Error in scan 2", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan 2 result validation", t)
+
+	err = secondaryindex.DropSecondaryIndex(indexName, bucketName, indexManagementAddress)
+	FailTestIfError(err, "Error in dropping the index", t)
+}
+
 func TestCreate2Drop1Scan2(t *testing.T) {
 	log.Printf("In TestCreate2Drop1Scan2()")
 	var index1 = "index_i1"
@@ -67,6 +67,23 @@ var initialPlacementTestCases = []initialPlacementTestCase{
 	{"initial placement - 3 replica constraint, 2 index, 2x", 2, 2, "", "../testdata/planner/index/replica-3-constraint.json", 0, 0},
 }
 
+type diskPlacementTestCase struct {
+	comment        string
+	storageMode    string
+	memQuotaFactor float64
+	cpuQuotaFactor float64
+	diskQuota      int64
+	indexSpec      string
+	minNumNode     int
+}
+
+var diskPlacementTestCases = []diskPlacementTestCase{
+	{"disk placement - plasma, 6 2M index, 1 replica, 6G disk", "plasma", 2, 2, 6 * 1024 * 1024 * 1024,
+		"../testdata/planner/index/small-2M-6-1.json", 3},
+	{"disk placement - forestdb, 6 2M index, 1 replica, 6G disk", "forestdb", 2, 2, 6 * 1024 * 1024 * 1024,
+		"../testdata/planner/index/small-2M-6-1.json", 3},
+}
+
 var incrPlacementTestCases = []incrPlacementTestCase{
 	{"incr placement - 20-50M, 5 2M index, 1 replica, 1x", 1, 1, "../testdata/planner/plan/uniform-small-10-3.json",
 		"../testdata/planner/index/small-2M-5-1.json", 0.1, 0.1},
@@ -100,6 +117,7 @@ func TestPlanner(t *testing.T) {
 	initialPlacementTest(t)
 	incrPlacementTest(t)
 	rebalanceTest(t)
+	diskPlacementTest(t)
 }
 
 //
@@ -231,3 +249,48 @@ func rebalanceTest(t *testing.T) {
 		}
 	}
 }
+
+//
+// This test places indexes using plasma or forestdb sizing with a disk quota.
+// The placement algorithm will expand the cluster until every node is under
+// disk quota.
+//
+func diskPlacementTest(t *testing.T) {
+
+	for _, testcase := range diskPlacementTestCases {
+		log.Printf("-------------------------------------------")
+		log.Printf(testcase.comment)
+
+		config := planner.DefaultRunConfig()
+		config.StorageMode = testcase.storageMode
+		config.MemQuotaFactor = testcase.memQuotaFactor
+		config.CpuQuotaFactor = testcase.cpuQuotaFactor
+		config.DiskQuota = testcase.diskQuota
+
+		s := planner.NewSimulator()
+
+		indexSpecs, err := planner.ReadIndexSpecs(testcase.indexSpec)
+		FailTestIfError(err, "Fail to read index spec", t)
+
+		p, _, err := s.RunSingleTest(config, planner.CommandPlan, nil, nil, indexSpecs)
+		FailTestIfError(err, "Error in planner test", t)
+
+		p.PrintCost()
+
+		if len(p.Result.Placement) < testcase.minNumNode {
+			p.Result.PrintLayout()
+			t.Fatalf("Expected at least %v indexer nodes, found %v", testcase.minNumNode, len(p.Result.Placement))
+		}
+
+		for _, indexer := range p.Result.Placement {
+			if indexer.DiskUsage > uint64(testcase.diskQuota) {
+				p.Result.PrintLayout()
+				t.Fatalf("Disk usage %v of indexer %v exceed disk quota", indexer.DiskUsage, indexer.NodeId)
+			}
+		}
+
+		if err := planner.ValidateSolution(p.Result); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package transport
+
+import "bytes"
+import "compress/bzip2"
+import "compress/gzip"
+import "errors"
+import "io"
+import "io/ioutil"
+import "strings"
+
+import "github.com/golang/snappy"
+
+// ErrorCompressionUnknown for unknown compression.
+var ErrorCompressionUnknown = errors.New("transport.compressionUnknown")
+
+// ErrorCompressionUnsupported for compression that can only be decoded.
+var ErrorCompressionUnsupported = errors.New("transport.compressionUnsupported")
+
+// Compression names used in configuration.
+var compressionNames = map[string]byte{
+	"none":   CompressionNone,
+	"snappy": CompressionSnappy,
+	"gzip":   CompressionGzip,
+}
+
+// ParseCompression return compression bits for configured compression
+// name, one of "none", "snappy" or "gzip". Bzip2 is only decoded.
+func ParseCompression(name string) (byte, error) {
+	if compression, ok := compressionNames[strings.ToLower(name)]; ok {
+		return compression, nil
+	}
+	return CompressionNone, ErrorCompressionUnknown
+}
+
+// CompressionName return configuration name for compression bits.
+func CompressionName(compression byte) string {
+	for name, c := range compressionNames {
+		if c == compression {
+			return name
+		}
+	}
+	if compression == CompressionBzip2 {
+		return "bzip2"
+	}
+	return "unknown"
+}
+
+// Compressed is implemented by connections that negotiated compression
+// for packets sent on them.
+type Compressed interface {
+	Compression() byte
+}
+
+// ConnCompression return the compression negotiated for `conn`, if it
+// is a Compressed connection.
+func ConnCompression(conn interface{}) byte {
+	if c, ok := conn.(Compressed); ok {
+		return c.Compression()
+	}
+	return CompressionNone
+}
+
+// Compress payload as per compression bits in flags.
+func Compress(flags TransportFlag, big []byte) ([]byte, error) {
+	switch flags.GetCompression() {
+	case CompressionNone:
+		return big, nil
+
+	case CompressionSnappy:
+		return snappy.Encode(nil, big), nil
+
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(big); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case CompressionBzip2:
+		return nil, ErrorCompressionUnsupported
+	}
+	return nil, ErrorCompressionUnknown
+}
+
+// Decompress payload as per compression bits in flags, decompressed
+// payload shall not be larger than `maxlen` bytes.
+func Decompress(flags TransportFlag, small []byte, maxlen int) ([]byte, error) {
+	var r io.Reader
+	switch flags.GetCompression() {
+	case CompressionNone:
+		return small, nil
+
+	case CompressionSnappy:
+		n, err := snappy.DecodedLen(small)
+		if err != nil {
+			return nil, err
+		} else if n > maxlen {
+			return nil, ErrorPacketOverflow
+		}
+		return snappy.Decode(nil, small)
+
+	case CompressionGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(small))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+
+	case CompressionBzip2:
+		r = bzip2.NewReader(bytes.NewReader(small))
+
+	default:
+		return nil, ErrorCompressionUnknown
+	}
+
+	big, err := ioutil.ReadAll(io.LimitReader(r, int64(maxlen)+1))
+	if err != nil {
+		return nil, err
+	} else if len(big) > maxlen {
+		return nil, ErrorPacketOverflow
+	}
+	return big, nil
+}
@@ -0,0 +1,244 @@
+package transport
+
+import "crypto/tls"
+import "crypto/x509"
+import "errors"
+import "io"
+import "io/ioutil"
+import "net"
+import "os"
+import "sync"
+import "time"
+
+import "github.com/couchbase/indexing/secondary/logging"
+
+// ErrorTLSRequired is plaintext connection made to a listener requiring TLS.
+var ErrorTLSRequired = errors.New("transport.tlsRequired")
+
+// ErrorInvalidCAFile is CA file without any PEM encoded certificate.
+var ErrorInvalidCAFile = errors.New("transport.invalidCAFile")
+
+// tlsRecordHandshake is the first byte sent by a TLS client. Plaintext
+// packets start with a big-endian uint32 packet length, that can begin
+// with this byte only for packets larger than 352MB.
+const tlsRecordHandshake = 0x16
+
+// CertReloader serves X509 key-pair for TLS handshakes, key-pair is
+// reloaded when certificate or key file is modified.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads key-pair from `certFile` and `keyFile`.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config{}.GetCertificate. If modified
+// files fail to load, previously loaded key-pair is served.
+func (r *CertReloader) GetCertificate(
+	*tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.lastModified()
+	if err == nil && r.cert != nil && modTime.Equal(r.modTime) {
+		return r.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err == nil {
+			if r.cert != nil {
+				logging.Infof("transport: reloaded certificate %v\n", r.certFile)
+			}
+			r.cert, r.modTime = &cert, modTime
+			return r.cert, nil
+		}
+		r.modTime = modTime // don't retry until files are modified again.
+	}
+	if r.cert == nil {
+		return nil, err
+	}
+	logging.Errorf("transport: reloading certificate %v: %v\n", r.certFile, err)
+	return r.cert, nil
+}
+
+// lastModified return the latest modification time of key-pair files.
+func (r *CertReloader) lastModified() (time.Time, error) {
+	cfi, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	kfi, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if kfi.ModTime().After(cfi.ModTime()) {
+		return kfi.ModTime(), nil
+	}
+	return cfi.ModTime(), nil
+}
+
+// NewTLSServerConfig return TLS configuration for servers, serving
+// key-pair from `certFile` and `keyFile` and reloading them on change.
+func NewTLSServerConfig(certFile, keyFile string) (*tls.Config, error) {
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	// allow only strong ssl as this is an internal API and interop
+	// is not a concern.
+	config := &tls.Config{
+		GetCertificate:           r.GetCertificate,
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+	}
+	return config, nil
+}
+
+// NewTLSClientConfig return TLS configuration for clients, server
+// certificate is verified against CA certificates from `caFile`, or
+// against system's root CAs if `caFile` is empty.
+func NewTLSClientConfig(caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return config, nil
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, ErrorInvalidCAFile
+	}
+	return config, nil
+}
+
+// Dial connects to `addr`, over TLS if `config` is not nil.
+func Dial(addr string, config *tls.Config) (net.Conn, error) {
+	if config == nil {
+		return net.Dial("tcp", addr)
+	}
+	return tls.Dial("tcp", addr, config)
+}
+
+// DialTimeout is like Dial, but fails if the connection, including the
+// TLS handshake, is not established within `timeout`.
+func DialTimeout(addr string, config *tls.Config,
+	timeout time.Duration) (net.Conn, error) {
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if config == nil {
+		return dialer.Dial("tcp", addr)
+	}
+	// deadline of the dialer applies to the handshake as well.
+	if timeout > 0 {
+		dialer.Deadline = time.Now().Add(timeout)
+	}
+	return tls.DialWithDialer(dialer, "tcp", addr, config)
+}
+
+// Listen on `laddr`, if `config` is not nil connections from TLS
+// clients are served over TLS. Plaintext connections are accepted
+// only when `require` is false.
+func Listen(laddr string, config *tls.Config, require bool) (net.Listener, error) {
+	lis, err := net.Listen("tcp", laddr)
+	if err != nil || config == nil {
+		return lis, err
+	}
+	return &tlsListener{Listener: lis, config: config, require: require}, nil
+}
+
+type tlsListener struct {
+	net.Listener
+	config  *tls.Config
+	require bool
+}
+
+// Accept implements net.Listener{} interface.
+func (lis *tlsListener) Accept() (net.Conn, error) {
+	conn, err := lis.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &sniffConn{Conn: conn, config: lis.config, require: lis.require}, nil
+}
+
+// sniffConn tells TLS connection from plaintext connection by the first
+// byte sent by client. That is done on first Read or Write so that
+// Accept() is not blocked by slow clients.
+type sniffConn struct {
+	net.Conn // raw connection
+	config   *tls.Config
+	require  bool
+
+	once sync.Once
+	conn net.Conn // TLS or plaintext connection after sniffing
+	err  error
+}
+
+func (c *sniffConn) sniff() (net.Conn, error) {
+	c.once.Do(func() {
+		first := make([]byte, 1)
+		if _, c.err = io.ReadFull(c.Conn, first); c.err != nil {
+			return
+		}
+		raw := &peekedConn{Conn: c.Conn, peeked: first}
+		if first[0] == tlsRecordHandshake {
+			c.conn = tls.Server(raw, c.config)
+		} else if c.require {
+			logging.Errorf("transport: plaintext connection from %v refused\n",
+				c.RemoteAddr())
+			c.err = ErrorTLSRequired
+		} else {
+			c.conn = raw
+		}
+	})
+	return c.conn, c.err
+}
+
+// Read implements net.Conn{} interface.
+func (c *sniffConn) Read(b []byte) (int, error) {
+	conn, err := c.sniff()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Read(b)
+}
+
+// Write implements net.Conn{} interface.
+func (c *sniffConn) Write(b []byte) (int, error) {
+	conn, err := c.sniff()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Write(b)
+}
+
+// peekedConn replays bytes already read from connection.
+type peekedConn struct {
+	net.Conn
+	peeked []byte
+}
+
+// Read implements net.Conn{} interface.
+func (c *peekedConn) Read(b []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(b, c.peeked)
+		c.peeked = c.peeked[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
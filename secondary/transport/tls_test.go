@@ -0,0 +1,292 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSListenerSniff(t *testing.T) {
+	dir, certFile, keyFile := testKeyPair(t, "server")
+	defer os.RemoveAll(dir)
+
+	lis := testListen(t, certFile, keyFile, false /*require*/)
+	defer lis.Close()
+	errch := testEchoServer(lis, 2)
+
+	// TLS client.
+	config, err := NewTLSClientConfig(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := Dial(lis.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEcho(t, conn)
+	if !conn.(*tls.Conn).ConnectionState().HandshakeComplete {
+		t.Errorf("Expected TLS connection")
+	}
+	conn.Close()
+
+	// plaintext client on the same listener.
+	conn, err = Dial(lis.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEcho(t, conn)
+	conn.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errch; err != nil {
+			t.Errorf("Expected %v, received %v", nil, err)
+		}
+	}
+}
+
+func TestTLSListenerRequire(t *testing.T) {
+	dir, certFile, keyFile := testKeyPair(t, "server")
+	defer os.RemoveAll(dir)
+
+	lis := testListen(t, certFile, keyFile, true /*require*/)
+	defer lis.Close()
+	errch := testEchoServer(lis, 1)
+
+	conn, err := Dial(lis.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-errch; err != ErrorTLSRequired {
+		t.Errorf("Expected %v, received %v", ErrorTLSRequired, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Read(make([]byte, 5)); err == nil {
+		t.Errorf("Expected plaintext connection closed, received %v bytes", n)
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	// server accepts connections but never completes the handshake.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	config := &tls.Config{InsecureSkipVerify: true}
+	start := time.Now()
+	conn, err := DialTimeout(lis.Addr().String(), config, 100*time.Millisecond)
+	if err == nil {
+		conn.Close()
+		t.Fatalf("Expected handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected timeout after 100ms, received %v", elapsed)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, certFile, keyFile := testKeyPair(t, "first")
+	defer os.RemoveAll(dir)
+
+	if _, err := NewCertReloader(filepath.Join(dir, "missing"), keyFile); err == nil {
+		t.Errorf("Expected error for missing certificate")
+	}
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := testCommonName(t, r); name != "first" {
+		t.Errorf("Expected %v, received %v", "first", name)
+	}
+
+	// files are modified, the new key-pair is served.
+	testWriteKeyPair(t, certFile, keyFile, "second")
+	testTouch(t, time.Now().Add(time.Minute), certFile, keyFile)
+	if name := testCommonName(t, r); name != "second" {
+		t.Errorf("Expected %v, received %v", "second", name)
+	}
+
+	// invalid files keep serving the previous key-pair.
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testTouch(t, time.Now().Add(2*time.Minute), certFile)
+	if name := testCommonName(t, r); name != "second" {
+		t.Errorf("Expected %v, received %v", "second", name)
+	}
+}
+
+func TestNewTLSClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTLSClientConfig(caFile); err != ErrorInvalidCAFile {
+		t.Errorf("Expected %v, received %v", ErrorInvalidCAFile, err)
+	}
+
+	config, err := NewTLSClientConfig("")
+	if err != nil || config.RootCAs != nil {
+		t.Errorf("Expected system root CAs, received %v (%v)", config, err)
+	}
+}
+
+func testListen(t *testing.T, certFile, keyFile string, require bool) net.Listener {
+	config, err := NewTLSServerConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := Listen("127.0.0.1:0", config, require)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lis
+}
+
+// testEchoServer echoes 5 bytes on `n` connections, and reports the
+// outcome of each connection.
+func testEchoServer(lis net.Listener, n int) chan error {
+	errch := make(chan error, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			conn, err := lis.Accept()
+			if err != nil {
+				errch <- err
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 5)
+				if _, err := io.ReadFull(conn, buf); err != nil {
+					errch <- err
+					return
+				}
+				_, err := conn.Write(buf)
+				errch <- err
+			}()
+		}
+	}()
+	return errch
+}
+
+func testEcho(t *testing.T, conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, []byte("hello")) {
+		t.Errorf("Expected %q, received %q", "hello", buf)
+	}
+}
+
+func testCommonName(t *testing.T, r *CertReloader) string {
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x509Cert.Subject.CommonName
+}
+
+func testTouch(t *testing.T, mtime time.Time, files ...string) {
+	for _, file := range files {
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testKeyPair writes a self-signed key-pair for 127.0.0.1 in a new
+// directory, the certificate is also its own CA.
+func testKeyPair(t *testing.T, name string) (dir, certFile, keyFile string) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	testWriteKeyPair(t, certFile, keyFile, name)
+	return dir, certFile, keyFile
+}
+
+func testWriteKeyPair(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(certFile, certPem, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -50,6 +50,9 @@ type TransportPacket struct {
 	buf      []byte
 	encoders map[byte]Encoder
 	decoders map[byte]Decoder
+	// statistics
+	payloadBytes int64 // bytes sent, before compression
+	wireBytes    int64 // bytes sent, after compression
 }
 
 // Encoder callback
@@ -99,14 +102,30 @@ func (pkt *TransportPacket) Send(conn transporter, payload interface{}) (err err
 		return
 	}
 	// compress
+	payloadLen := len(data)
 	if data, err = pkt.compress(data); err != nil {
 		return
 	}
 
-	err = Send(conn, pkt.buf, pkt.flags, data)
+	if err = Send(conn, pkt.buf, pkt.flags, data); err == nil {
+		pkt.payloadBytes += int64(payloadLen)
+		pkt.wireBytes += int64(len(data))
+	}
 	return
 }
 
+// Flags return transport flags used for sending packets, which are
+// updated to that of the last packet received.
+func (pkt *TransportPacket) Flags() TransportFlag {
+	return pkt.flags
+}
+
+// BytesSent return the number of payload bytes sent using this packet,
+// before and after compression.
+func (pkt *TransportPacket) BytesSent() (payload, wire int64) {
+	return pkt.payloadBytes, pkt.wireBytes
+}
+
 // Receive payload from remote, decode, decompress the payload and return the
 // payload.
 func (pkt *TransportPacket) Receive(conn transporter) (payload interface{}, err error) {
@@ -165,20 +184,13 @@ func (pkt *TransportPacket) decode(data []byte) (payload interface{}, err error)
 
 // compress array of bytes.
 func (pkt *TransportPacket) compress(big []byte) (small []byte, err error) {
-	switch pkt.flags.GetCompression() {
-	case CompressionNone:
-		small = big
-	}
-	return
+	return Compress(pkt.flags, big)
 }
 
-// decompress array of bytes.
+// decompress array of bytes, decompressed payload cannot be larger than
+// the packet buffer.
 func (pkt *TransportPacket) decompress(small []byte) (big []byte, err error) {
-	switch pkt.flags.GetCompression() {
-	case CompressionNone:
-		big = small
-	}
-	return
+	return Decompress(pkt.flags, small, len(pkt.buf))
 }
 
 // read len(buf) bytes from `conn`.
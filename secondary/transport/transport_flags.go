@@ -45,6 +45,11 @@ func (flags TransportFlag) SetGzip() TransportFlag {
 	return (flags & TransportFlag(0xFFF0)) | TransportFlag(CompressionGzip)
 }
 
+// SetCompression will set packet compression bits
+func (flags TransportFlag) SetCompression(compression byte) TransportFlag {
+	return (flags & TransportFlag(0xFFF0)) | TransportFlag(compression&0x0F)
+}
+
 // SetBzip2 will set packet compression to bzip2
 func (flags TransportFlag) SetBzip2() TransportFlag {
 	return (flags & TransportFlag(0xFFF0)) | TransportFlag(CompressionBzip2)